@@ -1,29 +1,112 @@
 package clients
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/utils"
 )
 
 const feederGatewayPath = "/feeder_gateway/"
 
+// ErrMissingChainId is returned by [NewGatewayClientWithConfig] when the
+// chain id of a gateway is neither configured nor known from its URL
+var ErrMissingChainId = errors.New("missing chain id")
+
+// Config configures a [GatewayClient]. A zero Config is the one of
+// [DefaultConfig].
+type Config struct {
+	// BaseURL is the URL the feeder gateway is served under, such as
+	// "https://alpha4.starknet.io" or "http://localhost:5050" for a devnet
+	BaseURL string
+	// ChainId is the id of the chain served by the gateway, which hashes of
+	// its blocks and transactions depend on. It can only be left out for
+	// the URLs of the public networks, whose chain ids are known.
+	ChainId *felt.Felt
+}
+
+// NetworkConfig returns the [Config] of the public gateway of the given
+// network.
+func NetworkConfig(n utils.Network) Config {
+	return Config{
+		BaseURL: n.URL(),
+		ChainId: n.ChainId(),
+	}
+}
+
+// DefaultConfig returns the [Config] of the mainnet gateway.
+func DefaultConfig() Config {
+	return NetworkConfig(utils.MAINNET)
+}
+
+// GatewayClient fetches data from the feeder gateway. It holds no mutable
+// state, requests share the default HTTP client, so all of its methods are
+// safe to call concurrently.
 type GatewayClient struct {
 	baseUrl string
+	chainId *felt.Felt
 }
 
+// NewGatewayClient creates a [GatewayClient] for the gateway at baseUrl.
+// Its chain id is the one of the public network served at baseUrl, nil
+// for other URLs, see [NewGatewayClientWithConfig] to set it.
 func NewGatewayClient(baseUrl string) *GatewayClient {
 	return &GatewayClient{
-		baseUrl: baseUrl + feederGatewayPath,
+		baseUrl: strings.TrimSuffix(baseUrl, "/") + feederGatewayPath,
+		chainId: networkChainId(baseUrl),
 	}
 }
 
+// NewGatewayClientWithConfig creates a [GatewayClient] configured by cfg.
+// [ErrMissingChainId] is returned when cfg overrides the BaseURL with the
+// URL of no public network and does not set the ChainId, rather than
+// hashing with the chain id of another network.
+func NewGatewayClientWithConfig(cfg Config) (*GatewayClient, error) {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultConfig().BaseURL
+	}
+	if cfg.ChainId == nil {
+		cfg.ChainId = networkChainId(cfg.BaseURL)
+		if cfg.ChainId == nil {
+			return nil, fmt.Errorf("%w: for gateway at %s", ErrMissingChainId, cfg.BaseURL)
+		}
+	}
+
+	client := NewGatewayClient(cfg.BaseURL)
+	client.chainId = cfg.ChainId
+	return client, nil
+}
+
+// networkChainId returns the chain id of the public network whose gateway
+// is served at baseUrl, if any
+func networkChainId(baseUrl string) *felt.Felt {
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+	for _, n := range []utils.Network{utils.GOERLI, utils.MAINNET, utils.GOERLI2, utils.INTEGRATION} {
+		if n.URL() == baseUrl {
+			return n.ChainId()
+		}
+	}
+	return nil
+}
+
+// ChainId returns the id of the chain served by the gateway, nil if it is
+// not known, see [NewGatewayClient]
+func (c *GatewayClient) ChainId() *felt.Felt {
+	return c.chainId
+}
+
 // `buildQueryString` builds the query url with encoded parameters
 func (c *GatewayClient) buildQueryString(endpoint string, args map[string]string) string {
 	base, err := url.Parse(c.baseUrl)
@@ -47,7 +130,10 @@ func (c *GatewayClient) get(queryUrl string) ([]byte, error) {
 	res, err := http.Get(queryUrl)
 	if err != nil {
 		return nil, err
-	} else if res.StatusCode != http.StatusOK {
+	}
+	// the body is closed so that the connection can be reused
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
 		return nil, errors.New(res.Status)
 	}
 
@@ -73,12 +159,122 @@ type StateUpdate struct {
 			ClassHash *felt.Felt `json:"class_hash"`
 		} `json:"deployed_contracts"`
 		DeclaredContracts []*felt.Felt `json:"declared_contracts"`
+		DeclaredClasses   []struct {
+			ClassHash         *felt.Felt `json:"class_hash"`
+			CompiledClassHash *felt.Felt `json:"compiled_class_hash"`
+		} `json:"declared_classes"`
 	} `json:"state_diff"`
 }
 
+// MarshalJSON encodes the [StateUpdate] in the format of the gateway, with
+// felts as 0x prefixed hex strings and roots as 64 unprefixed hex digits,
+// so that fetched updates can be stored as test fixtures. Collections of
+// the state diff that are nil are left out, which makes unmarshalling the
+// result give back an equal update.
+func (u StateUpdate) MarshalJSON() ([]byte, error) {
+	type storageDiff struct {
+		Key   *gatewayFelt `json:"key"`
+		Value *gatewayFelt `json:"value"`
+	}
+	type deployedContract struct {
+		Address   *gatewayFelt `json:"address"`
+		ClassHash *gatewayFelt `json:"class_hash"`
+	}
+	type declaredClass struct {
+		ClassHash         *gatewayFelt `json:"class_hash"`
+		CompiledClassHash *gatewayFelt `json:"compiled_class_hash"`
+	}
+
+	diff := make(map[string]interface{})
+	if u.StateDiff.StorageDiffs != nil {
+		storageDiffs := make(map[string][]storageDiff, len(u.StateDiff.StorageDiffs))
+		for addr, contractDiffs := range u.StateDiff.StorageDiffs {
+			diffs := make([]storageDiff, 0, len(contractDiffs))
+			for _, d := range contractDiffs {
+				diffs = append(diffs, storageDiff{Key: (*gatewayFelt)(d.Key), Value: (*gatewayFelt)(d.Value)})
+			}
+			storageDiffs[addr] = diffs
+		}
+		diff["storage_diffs"] = storageDiffs
+	}
+	if u.StateDiff.Nonces != nil {
+		nonces := make(map[string]*gatewayFelt, len(u.StateDiff.Nonces))
+		for addr, nonce := range u.StateDiff.Nonces {
+			nonces[addr] = (*gatewayFelt)(nonce)
+		}
+		diff["nonces"] = nonces
+	}
+	if u.StateDiff.DeployedContracts != nil {
+		deployed := make([]deployedContract, 0, len(u.StateDiff.DeployedContracts))
+		for _, contract := range u.StateDiff.DeployedContracts {
+			deployed = append(deployed, deployedContract{
+				Address:   (*gatewayFelt)(contract.Address),
+				ClassHash: (*gatewayFelt)(contract.ClassHash),
+			})
+		}
+		diff["deployed_contracts"] = deployed
+	}
+	if u.StateDiff.DeclaredContracts != nil {
+		declared := make([]*gatewayFelt, 0, len(u.StateDiff.DeclaredContracts))
+		for _, classHash := range u.StateDiff.DeclaredContracts {
+			declared = append(declared, (*gatewayFelt)(classHash))
+		}
+		diff["declared_contracts"] = declared
+	}
+	if u.StateDiff.DeclaredClasses != nil {
+		declared := make([]declaredClass, 0, len(u.StateDiff.DeclaredClasses))
+		for _, class := range u.StateDiff.DeclaredClasses {
+			declared = append(declared, declaredClass{
+				ClassHash:         (*gatewayFelt)(class.ClassHash),
+				CompiledClassHash: (*gatewayFelt)(class.CompiledClassHash),
+			})
+		}
+		diff["declared_classes"] = declared
+	}
+
+	return json.Marshal(struct {
+		BlockHash *gatewayFelt           `json:"block_hash"`
+		NewRoot   *gatewayRoot           `json:"new_root"`
+		OldRoot   *gatewayRoot           `json:"old_root"`
+		StateDiff map[string]interface{} `json:"state_diff"`
+	}{
+		BlockHash: (*gatewayFelt)(u.BlockHash),
+		NewRoot:   (*gatewayRoot)(u.NewRoot),
+		OldRoot:   (*gatewayRoot)(u.OldRoot),
+		StateDiff: diff,
+	})
+}
+
+// gatewayFelt is a felt encoded in JSON the way the gateway does, as a 0x
+// prefixed hex string
+type gatewayFelt felt.Felt
+
+func (f *gatewayFelt) MarshalJSON() ([]byte, error) {
+	return json.Marshal("0x" + (*felt.Felt)(f).Text(16))
+}
+
+// gatewayRoot is a state root encoded in JSON the way the gateway does, as
+// 64 hex digits, zero-padded and without a 0x prefix
+type gatewayRoot felt.Felt
+
+func (f *gatewayRoot) MarshalJSON() ([]byte, error) {
+	rootBytes := (*felt.Felt)(f).Bytes()
+	return json.Marshal(hex.EncodeToString(rootBytes[:]))
+}
+
 func (c *GatewayClient) GetStateUpdate(blockNumber uint64) (*StateUpdate, error) {
+	return c.getStateUpdate(strconv.FormatUint(blockNumber, 10))
+}
+
+// GetPendingStateUpdate returns the state update of the pending block,
+// whose old root is the root of the latest block.
+func (c *GatewayClient) GetPendingStateUpdate() (*StateUpdate, error) {
+	return c.getStateUpdate("pending")
+}
+
+func (c *GatewayClient) getStateUpdate(blockNumber string) (*StateUpdate, error) {
 	queryUrl := c.buildQueryString("get_state_update", map[string]string{
-		"blockNumber": strconv.FormatUint(blockNumber, 10),
+		"blockNumber": blockNumber,
 	})
 
 	if body, err := c.get(queryUrl); err != nil {
@@ -112,6 +308,20 @@ type Transaction struct {
 	SenderAddress *felt.Felt `json:"sender_address"`
 }
 
+// UnmarshalJSON accepts both the full form of a transaction and the
+// abbreviated one, which is just the hash of the transaction.
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*t = Transaction{Hash: new(felt.Felt)}
+		return t.Hash.UnmarshalJSON(data)
+	}
+
+	// transaction has the fields of Transaction but not its methods, which
+	// keeps json.Unmarshal from calling this method again
+	type transaction Transaction
+	return json.Unmarshal(data, (*transaction)(t))
+}
+
 type TransactionStatus struct {
 	Status           string       `json:"status"`
 	BlockHash        *felt.Felt   `json:"block_hash"`
@@ -170,6 +380,10 @@ type ExecutionResources struct {
 }
 
 type TransactionReceipt struct {
+	// status and block fields are only set by the "get_transaction_receipt" endpoint
+	Status             string              `json:"status"`
+	BlockHash          *felt.Felt          `json:"block_hash"`
+	BlockNumber        uint64              `json:"block_number"`
 	ActualFee          *felt.Felt          `json:"actual_fee"`
 	Events             []*Event            `json:"events"`
 	ExecutionResources *ExecutionResources `json:"execution_resources"`
@@ -179,23 +393,56 @@ type TransactionReceipt struct {
 	TransactionIndex   *big.Int            `json:"transaction_index"`
 }
 
+func (c *GatewayClient) GetTransactionReceipt(transactionHash *felt.Felt) (*TransactionReceipt, error) {
+	queryUrl := c.buildQueryString("get_transaction_receipt", map[string]string{
+		"transactionHash": "0x" + transactionHash.Text(16),
+	})
+
+	if body, err := c.get(queryUrl); err != nil {
+		return nil, err
+	} else {
+		receipt := new(TransactionReceipt)
+		if err = json.Unmarshal(body, receipt); err != nil {
+			return nil, err
+		}
+		return receipt, nil
+	}
+}
+
 // Block object returned by the gateway in JSON format for "get_block" endpoint
 type Block struct {
-	Hash         *felt.Felt            `json:"block_hash"`
-	ParentHash   *felt.Felt            `json:"parent_block_hash"`
-	Number       uint64                `json:"block_number"`
-	StateRoot    *felt.Felt            `json:"state_root"`
-	Status       string                `json:"status"`
-	GasPrice     *felt.Felt            `json:"gas_price"`
-	Transactions []*Transaction        `json:"transactions"`
-	Timestamp    uint64                `json:"timestamp"`
-	Version      string                `json:"starknet_version"`
-	Receipts     []*TransactionReceipt `json:"transaction_receipts"`
+	Hash             *felt.Felt            `json:"block_hash"`
+	ParentHash       *felt.Felt            `json:"parent_block_hash"`
+	Number           uint64                `json:"block_number"`
+	StateRoot        *felt.Felt            `json:"state_root"`
+	Status           string                `json:"status"`
+	GasPrice         *felt.Felt            `json:"gas_price"`
+	SequencerAddress *felt.Felt            `json:"sequencer_address"`
+	Transactions     []*Transaction        `json:"transactions"`
+	Timestamp        uint64                `json:"timestamp"`
+	Version          string                `json:"starknet_version"`
+	Receipts         []*TransactionReceipt `json:"transaction_receipts"`
 }
 
 func (c *GatewayClient) GetBlock(blockNumber uint64) (*Block, error) {
+	return c.getBlock(strconv.FormatUint(blockNumber, 10))
+}
+
+// GetPendingBlock returns the block the sequencer is currently building.
+// It has neither a hash nor a number, and its content may change until it
+// is sealed.
+func (c *GatewayClient) GetPendingBlock() (*Block, error) {
+	return c.getBlock("pending")
+}
+
+// GetLatestBlock returns the latest block accepted on L2
+func (c *GatewayClient) GetLatestBlock() (*Block, error) {
+	return c.getBlock("latest")
+}
+
+func (c *GatewayClient) getBlock(blockNumber string) (*Block, error) {
 	queryUrl := c.buildQueryString("get_block", map[string]string{
-		"blockNumber": strconv.FormatUint(blockNumber, 10),
+		"blockNumber": blockNumber,
 	})
 
 	if body, err := c.get(queryUrl); err != nil {
@@ -214,14 +461,98 @@ type EntryPoint struct {
 	Offset   *felt.Felt `json:"offset"`
 }
 
-type Abi []struct {
+// AbiParam is a parameter of a function or event, or a member of a struct
+// in an [Abi]. Offset is only set for struct members.
+type AbiParam struct {
 	Name   string `json:"name"`
 	Type   string `json:"type"`
-	Inputs []struct {
-		Name string `json:"name"`
-		Type string `json:"type"`
-	} `json:"inputs"`
-	Outputs []interface{} `json:"outputs"`
+	Offset uint64 `json:"offset,omitempty"`
+}
+
+// AbiEntry is an entry of an [Abi], its Type tells which fields are set:
+//   - "function", "constructor" and "l1_handler": Inputs, Outputs and
+//     StateMutability
+//   - "event": Keys and Data
+//   - "struct": Size and Members
+type AbiEntry struct {
+	Name            string     `json:"name"`
+	Type            string     `json:"type"`
+	Inputs          []AbiParam `json:"inputs"`
+	Outputs         []AbiParam `json:"outputs"`
+	StateMutability string     `json:"stateMutability,omitempty"`
+	Keys            []AbiParam `json:"keys"`
+	Data            []AbiParam `json:"data"`
+	Size            uint64     `json:"size,omitempty"`
+	Members         []AbiParam `json:"members"`
+}
+
+type Abi []AbiEntry
+
+type Program struct {
+	Builtins         []string     `json:"builtins"`
+	Prime            string       `json:"prime"`
+	ReferenceManager interface{}  `json:"reference_manager"`
+	Identifiers      interface{}  `json:"identifiers"`
+	Attributes       interface{}  `json:"attributes"`
+	Data             []*felt.Felt `json:"data"`
+	DebugInfo        interface{}  `json:"debug_info"`
+	MainScope        interface{}  `json:"main_scope"`
+	Hints            interface{}  `json:"hints"`
+	CompilerVersion  string       `json:"compiler_version"`
+	// Compressed is the base64 encoding of the gzip compressed JSON
+	// object of the program, as it was decoded.
+	Compressed string `json:"-"`
+}
+
+// UnmarshalJSON decodes a [Program] given either as a JSON object or, like
+// in declare transactions, as the base64 encoding of the gzip compressed
+// JSON object. The original program is kept compressed in
+// [Program.Compressed], compressed programs are kept as they are.
+func (p *Program) UnmarshalJSON(data []byte) error {
+	// program is an alias without the UnmarshalJSON method
+	type program Program
+
+	var compressed string
+	if err := json.Unmarshal(data, &compressed); err != nil {
+		if err = json.Unmarshal(data, (*program)(p)); err != nil {
+			return err
+		}
+		p.Compressed, err = compressProgram(data)
+		return err
+	}
+
+	gzipped, err := base64.StdEncoding.DecodeString(compressed)
+	if err != nil {
+		return fmt.Errorf("decode program: invalid base64: %w", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(gzipped))
+	if err != nil {
+		return fmt.Errorf("decode program: invalid gzip: %w", err)
+	}
+	defer reader.Close()
+	decompressed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("decode program: invalid gzip: %w", err)
+	}
+	if err = json.Unmarshal(decompressed, (*program)(p)); err != nil {
+		return fmt.Errorf("decode program: %w", err)
+	}
+	p.Compressed = compressed
+	return nil
+}
+
+// compressProgram returns the base64 encoding of the gzip compressed
+// JSON object of a program
+func compressProgram(programJson []byte) (string, error) {
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	if _, err := writer.Write(programJson); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gzipped.Bytes()), nil
 }
 
 type ClassDefinition struct {
@@ -231,18 +562,7 @@ type ClassDefinition struct {
 		External    []EntryPoint `json:"EXTERNAL"`
 		L1Handler   []EntryPoint `json:"L1_HANDLER"`
 	} `json:"entry_points_by_type"`
-	Program struct {
-		Builtins         []string     `json:"builtins"`
-		Prime            string       `json:"prime"`
-		ReferenceManager interface{}  `json:"reference_manager"`
-		Identifiers      interface{}  `json:"identifiers"`
-		Attributes       interface{}  `json:"attributes"`
-		Data             []*felt.Felt `json:"data"`
-		DebugInfo        interface{}  `json:"debug_info"`
-		MainScope        interface{}  `json:"main_scope"`
-		Hints            interface{}  `json:"hints"`
-		CompilerVersion  string       `json:"compiler_version"`
-	} `json:"program"`
+	Program Program `json:"program"`
 }
 
 func (c *GatewayClient) GetClassDefinition(classHash *felt.Felt) (*ClassDefinition, error) {
@@ -1,15 +1,24 @@
 package clients
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/utils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStateUpdateUnmarshal(t *testing.T) {
@@ -78,6 +87,66 @@ func TestStateUpdateUnmarshal(t *testing.T) {
 	assert.Equal(t, true, value.Equal(expected))
 }
 
+func TestStateUpdateMarshal(t *testing.T) {
+	t.Run("gateway format", func(t *testing.T) {
+		var update StateUpdate
+		assert.NoError(t, json.Unmarshal([]byte(`{
+  "block_hash": "0x47c3637b57c2b079b93c61539950c17e868a28f46cdef28f88521067f21e943",
+  "new_root": "021870ba80540e7831fb21c591ee93481f5ae1bb71ff85a86ddd465be4eddee6",
+  "old_root": "0000000000000000000000000000000000000000000000000000000000000000",
+  "state_diff": {
+    "storage_diffs": {"0x37": [{"key": "0x5", "value": "0x22b"}]},
+    "nonces": {"0x37": "0x44"},
+    "deployed_contracts": [{"address": "0x37", "class_hash": "0x10"}]
+  }
+}`), &update))
+
+		marshaled, err := json.Marshal(update)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{
+  "block_hash": "0x47c3637b57c2b079b93c61539950c17e868a28f46cdef28f88521067f21e943",
+  "new_root": "021870ba80540e7831fb21c591ee93481f5ae1bb71ff85a86ddd465be4eddee6",
+  "old_root": "0000000000000000000000000000000000000000000000000000000000000000",
+  "state_diff": {
+    "storage_diffs": {"0x37": [{"key": "0x5", "value": "0x22b"}]},
+    "nonces": {"0x37": "0x44"},
+    "deployed_contracts": [{"address": "0x37", "class_hash": "0x10"}]
+  }
+}`, string(marshaled))
+	})
+
+	for _, fixture := range []string{
+		"mainnet_state_update_0.json",
+		"mainnet_state_update_1.json",
+		"mainnet_state_update_2.json",
+	} {
+		t.Run(fixture, func(t *testing.T) {
+			fixtureJson, err := os.ReadFile("../core/state/testdata/" + fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want StateUpdate
+			if err = json.Unmarshal(fixtureJson, &want); err != nil {
+				t.Fatal(err)
+			}
+
+			marshaled, err := json.Marshal(&want)
+			assert.NoError(t, err)
+			var got StateUpdate
+			assert.NoError(t, json.Unmarshal(marshaled, &got))
+			assert.Equal(t, want, got)
+
+			// the roots keep the form of the fixture
+			var fixtureFields, marshaledFields map[string]interface{}
+			assert.NoError(t, json.Unmarshal(fixtureJson, &fixtureFields))
+			assert.NoError(t, json.Unmarshal(marshaled, &marshaledFields))
+			for _, root := range []string{"new_root", "old_root"} {
+				assert.Equal(t, fixtureFields[root], marshaledFields[root])
+			}
+		})
+	}
+}
+
 func TestDeclareTransactionUnmarshal(t *testing.T) {
 	declareJson := []byte(`{
       "transaction_hash":"0x93f542728e403f1edcea4a41f1509a39be35ebcad7d4b5aa77623e5e6480d",
@@ -281,6 +350,24 @@ func TestBlockUnmarshal(t *testing.T) {
 	assert.Equal(t, 52, len(block.Receipts))
 	assert.Equal(t, uint64(1669465009), block.Timestamp)
 	assert.Equal(t, "0.10.1", block.Version)
+	assert.Equal(t, "5dcd266a80b8a5f29f04d779c6b166b80150c24f2180a75e82427242dab20a9", block.SequencerAddress.Text(16))
+	for _, transaction := range block.Transactions {
+		assert.NotNil(t, transaction.Hash)
+	}
+
+	t.Run("abbreviated transactions", func(t *testing.T) {
+		abbreviatedJson := []byte(`{
+			"block_number": 11817,
+			"transactions": ["0x1", "0x2a"]
+		}`)
+
+		var abbreviated Block
+		assert.NoError(t, json.Unmarshal(abbreviatedJson, &abbreviated))
+		assert.Equal(t, 2, len(abbreviated.Transactions))
+		assert.Equal(t, "1", abbreviated.Transactions[0].Hash.Text(16))
+		assert.Equal(t, "2a", abbreviated.Transactions[1].Hash.Text(16))
+		assert.Equal(t, "", abbreviated.Transactions[1].Type)
+	})
 }
 
 func TestClassUnmarshal(t *testing.T) {
@@ -303,12 +390,142 @@ func TestClassUnmarshal(t *testing.T) {
 	assert.Equal(t, 250, len(class.Program.Data))
 	assert.Equal(t, []string{"pedersen", "range_check"}, class.Program.Builtins)
 	assert.Equal(t, "0.10.1", class.Program.CompilerVersion)
+
+	assert.Equal(t, 5, len(class.Abi))
+	upgraded := class.Abi[0]
+	assert.Equal(t, "event", upgraded.Type)
+	assert.Equal(t, "Upgraded", upgraded.Name)
+	assert.Equal(t, []AbiParam{{Name: "implementation", Type: "felt"}}, upgraded.Data)
+	assert.Equal(t, 0, len(upgraded.Keys))
+	defaultFunction := class.Abi[3]
+	assert.Equal(t, "function", defaultFunction.Type)
+	assert.Equal(t, "__default__", defaultFunction.Name)
+	assert.Equal(t, 3, len(defaultFunction.Inputs))
+	assert.Equal(t, []AbiParam{
+		{Name: "retdata_size", Type: "felt"},
+		{Name: "retdata", Type: "felt*"},
+	}, defaultFunction.Outputs)
+
+	t.Run("struct and view function", func(t *testing.T) {
+		var abi Abi
+		assert.NoError(t, json.Unmarshal([]byte(`[
+  {
+    "members": [
+      {"name": "low", "offset": 0, "type": "felt"},
+      {"name": "high", "offset": 1, "type": "felt"}
+    ],
+    "name": "Uint256",
+    "size": 2,
+    "type": "struct"
+  },
+  {
+    "inputs": [{"name": "account", "type": "felt"}],
+    "name": "balanceOf",
+    "outputs": [{"name": "balance", "type": "Uint256"}],
+    "stateMutability": "view",
+    "type": "function"
+  }
+]`), &abi))
+		assert.Equal(t, 2, len(abi))
+		assert.Equal(t, uint64(2), abi[0].Size)
+		assert.Equal(t, []AbiParam{
+			{Name: "low", Type: "felt"},
+			{Name: "high", Type: "felt", Offset: 1},
+		}, abi[0].Members)
+		assert.Equal(t, "view", abi[1].StateMutability)
+	})
+
+	t.Run("compressed program", func(t *testing.T) {
+		programJson, err := json.Marshal(class.Program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gzipped bytes.Buffer
+		writer := gzip.NewWriter(&gzipped)
+		_, err = writer.Write(programJson)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+
+		compressed, err := json.Marshal(base64.StdEncoding.EncodeToString(gzipped.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var program Program
+		assert.NoError(t, json.Unmarshal(compressed, &program))
+		// compressed programs are kept as they are
+		assert.Equal(t, base64.StdEncoding.EncodeToString(gzipped.Bytes()), program.Compressed)
+		program.Compressed = class.Program.Compressed
+		assert.Equal(t, class.Program, program)
+	})
+
+	t.Run("original program", func(t *testing.T) {
+		var fixture struct {
+			Program json.RawMessage `json:"program"`
+		}
+		assert.NoError(t, json.Unmarshal(classJson, &fixture))
+
+		gzipped, err := base64.StdEncoding.DecodeString(class.Program.Compressed)
+		assert.NoError(t, err)
+		reader, err := gzip.NewReader(bytes.NewReader(gzipped))
+		assert.NoError(t, err)
+		programJson, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, string(fixture.Program), string(programJson))
+	})
+
+	t.Run("malformed compressed program", func(t *testing.T) {
+		var program Program
+		err := json.Unmarshal([]byte(`"not base64!"`), &program)
+		assert.ErrorContains(t, err, "decode program: invalid base64")
+
+		err = json.Unmarshal([]byte(`"`+base64.StdEncoding.EncodeToString([]byte("not gzip"))+`"`), &program)
+		assert.ErrorContains(t, err, "decode program: invalid gzip")
+	})
 }
 
 func TestNewGatewayClient(t *testing.T) {
-	baseUrl := "https://mock_gateway.io"
-	gatewayClient := NewGatewayClient(baseUrl)
-	assert.Equal(t, baseUrl+feederGatewayPath, gatewayClient.baseUrl)
+	t.Run("custom", func(t *testing.T) {
+		baseUrl := "https://mock_gateway.io"
+		gatewayClient := NewGatewayClient(baseUrl)
+		assert.Equal(t, baseUrl+feederGatewayPath, gatewayClient.baseUrl)
+		assert.Equal(t, (*felt.Felt)(nil), gatewayClient.ChainId())
+	})
+	t.Run("network", func(t *testing.T) {
+		gatewayClient := NewGatewayClient(utils.GOERLI2.URL() + "/")
+		assert.Equal(t, utils.GOERLI2.URL()+feederGatewayPath, gatewayClient.baseUrl)
+		assert.Equal(t, utils.GOERLI2.ChainId(), gatewayClient.ChainId())
+	})
+}
+
+func TestNewGatewayClientWithConfig(t *testing.T) {
+	t.Run("defaults to mainnet", func(t *testing.T) {
+		gatewayClient, err := NewGatewayClientWithConfig(Config{})
+		require.NoError(t, err)
+		assert.Equal(t, utils.MAINNET.URL()+feederGatewayPath, gatewayClient.baseUrl)
+		assert.Equal(t, utils.MAINNET.ChainId(), gatewayClient.ChainId())
+	})
+	t.Run("network", func(t *testing.T) {
+		gatewayClient, err := NewGatewayClientWithConfig(NetworkConfig(utils.GOERLI))
+		require.NoError(t, err)
+		assert.Equal(t, "https://alpha4.starknet.io"+feederGatewayPath, gatewayClient.baseUrl)
+		assert.Equal(t, utils.GOERLI.ChainId(), gatewayClient.ChainId())
+	})
+	t.Run("chain id derived from the network URL", func(t *testing.T) {
+		gatewayClient, err := NewGatewayClientWithConfig(Config{BaseURL: utils.GOERLI.URL()})
+		require.NoError(t, err)
+		assert.Equal(t, utils.GOERLI.ChainId(), gatewayClient.ChainId())
+	})
+	t.Run("custom", func(t *testing.T) {
+		chainId := new(felt.Felt).SetBytes([]byte("SN_DEVNET"))
+		gatewayClient, err := NewGatewayClientWithConfig(Config{BaseURL: "http://localhost:5050/", ChainId: chainId})
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:5050"+feederGatewayPath, gatewayClient.baseUrl)
+		assert.Equal(t, chainId, gatewayClient.ChainId())
+	})
+	t.Run("custom without chain id", func(t *testing.T) {
+		_, err := NewGatewayClientWithConfig(Config{BaseURL: "http://localhost:5050"})
+		assert.ErrorIs(t, err, ErrMissingChainId)
+	})
 }
 
 func TestBuildQueryString(t *testing.T) {
@@ -515,7 +732,7 @@ func TestGetBlock(t *testing.T) {
 				assert.Equal(t, nil, err, "No Query value")
 				queryBlockNumebr := queryMap["blockNumber"]
 				t.Log(queryBlockNumebr[0])
-				if queryBlockNumebr[0] == "11817" {
+				if queryBlockNumebr[0] == "11817" || queryBlockNumebr[0] == "pending" || queryBlockNumebr[0] == "latest" {
 					w.WriteHeader(200)
 					marshaledStr, _ := json.Marshal(block)
 					w.Write(marshaledStr)
@@ -541,6 +758,16 @@ func TestGetBlock(t *testing.T) {
 		assert.Nil(t, actualBlock, "Unexpected error")
 		assert.NotNil(t, err)
 	})
+	t.Run("Test pending block", func(t *testing.T) {
+		actualBlock, err := gatewayClient.GetPendingBlock()
+		assert.Equal(t, nil, err, "Unexpected error")
+		assert.Equal(t, *actualBlock, block)
+	})
+	t.Run("Test latest block", func(t *testing.T) {
+		actualBlock, err := gatewayClient.GetLatestBlock()
+		assert.Equal(t, nil, err, "Unexpected error")
+		assert.Equal(t, *actualBlock, block)
+	})
 }
 
 func TestGetClassDefinition(t *testing.T) {
@@ -567,8 +794,7 @@ func TestGetClassDefinition(t *testing.T) {
 				serverClassFelt, _ := new(felt.Felt).SetString("0x01efa8f8")
 				if inputClassFelt.Equal(serverClassFelt) {
 					w.WriteHeader(200)
-					marshaledStr, _ := json.Marshal(class)
-					w.Write(marshaledStr)
+					w.Write(classJson)
 				} else {
 					w.WriteHeader(404)
 				}
@@ -620,3 +846,28 @@ func TestHttpError(t *testing.T) {
 		assert.EqualError(t, err, "500 Internal Server Error")
 	})
 }
+
+func TestConcurrentGetStateUpdate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blockNumber, err := strconv.ParseUint(r.URL.Query().Get("blockNumber"), 10, 64)
+		assert.NoError(t, err)
+		// the block hash is the block number, to tell responses apart
+		fmt.Fprintf(w, `{"block_hash": "0x%x", "new_root": "0x1", "old_root": "0x2"}`, blockNumber)
+	}))
+	defer srv.Close()
+	gatewayClient := NewGatewayClient(srv.URL)
+
+	const calls = 50
+	var wg sync.WaitGroup
+	wg.Add(calls)
+	for i := uint64(0); i < calls; i++ {
+		go func(blockNumber uint64) {
+			defer wg.Done()
+			stateUpdate, err := gatewayClient.GetStateUpdate(blockNumber)
+			if assert.NoError(t, err) {
+				assert.Equal(t, true, new(felt.Felt).SetUint64(blockNumber).Equal(stateUpdate.BlockHash))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
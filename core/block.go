@@ -2,6 +2,8 @@ package core
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/NethermindEth/juno/core/crypto"
 	"github.com/NethermindEth/juno/core/felt"
@@ -9,7 +11,9 @@ import (
 	"github.com/NethermindEth/juno/utils"
 )
 
-type Block struct {
+// BlockHeader holds the fields of a [Block] its hash commits to, which is
+// enough to verify the hash of a block without its transactions.
+type BlockHeader struct {
 	// The hash of this block’s parent
 	ParentHash *felt.Felt
 	// The number (height) of this block
@@ -34,6 +38,12 @@ type Block struct {
 	ExtraData *felt.Felt
 }
 
+type Block struct {
+	BlockHeader
+	// The hashes of the transactions of the block, in order
+	TransactionHashes []*felt.Felt
+}
+
 type blockHashMetaInfo struct {
 	First07Block             uint64     // First block that uses the post-0.7.0 block hash algorithm
 	UnverifiableRange        []uint64   // Range of blocks that are not verifiable
@@ -84,7 +94,7 @@ func getBlockHashMetaInfo(network utils.Network) *blockHashMetaInfo {
 
 // Hash computes the block hash. Due to bugs in StarkNet alpha, not all blocks have
 // verifiable hashes. In that case, an [UnverifiableBlockError] is returned.
-func (b *Block) Hash(network utils.Network) (*felt.Felt, error) {
+func (b *BlockHeader) Hash(network utils.Network) (*felt.Felt, error) {
 	blockHashMetaInfo := getBlockHashMetaInfo(network)
 
 	unverifiableRange := blockHashMetaInfo.UnverifiableRange
@@ -105,7 +115,7 @@ func (b *Block) Hash(network utils.Network) (*felt.Felt, error) {
 }
 
 // pre07Hash computes the block hash for blocks generated before Cairo 0.7.0
-func (b *Block) pre07Hash(chain *felt.Felt) *felt.Felt {
+func (b *BlockHeader) pre07Hash(chain *felt.Felt) *felt.Felt {
 	blockNumber := new(felt.Felt).SetUint64(b.Number)
 	zeroFelt := new(felt.Felt)
 
@@ -126,7 +136,7 @@ func (b *Block) pre07Hash(chain *felt.Felt) *felt.Felt {
 }
 
 // post07Hash computes the block hash for blocks generated after Cairo 0.7.0
-func (b *Block) post07Hash() *felt.Felt {
+func (b *BlockHeader) post07Hash() *felt.Felt {
 	blockNumber := new(felt.Felt).SetUint64(b.Number)
 	zeroFelt := new(felt.Felt)
 
@@ -151,55 +161,120 @@ func (b *Block) post07Hash() *felt.Felt {
 	)
 }
 
+// CommitmentScheme is how the transaction and event commitments of a block
+// are calculated, which depends on the protocol version of the block
+type CommitmentScheme int
+
+const (
+	// PedersenCommitments are the commitments of blocks before StarkNet
+	// 0.13.2, height 64 tries hashed with Pedersen
+	PedersenCommitments CommitmentScheme = iota
+	// PoseidonCommitments are the commitments of blocks from StarkNet
+	// 0.13.2 on, height 64 tries hashed with Poseidon whose leaves commit
+	// to the signatures of every transaction and to the transaction
+	// emitting every event
+	PoseidonCommitments
+)
+
+// firstPoseidonCommitmentsVersion is the protocol version from which
+// blocks use [PoseidonCommitments]
+var firstPoseidonCommitmentsVersion = []uint64{0, 13, 2}
+
+// CommitmentSchemeFor returns the [CommitmentScheme] of the blocks with the
+// given protocol version, such as "0.13.2". Early blocks do not have a
+// version, the empty version is that of [PedersenCommitments].
+func CommitmentSchemeFor(protocolVersion string) (CommitmentScheme, error) {
+	if protocolVersion == "" {
+		return PedersenCommitments, nil
+	}
+
+	var version []uint64
+	for _, part := range strings.Split(protocolVersion, ".") {
+		number, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid protocol version %q: %w", protocolVersion, err)
+		}
+		version = append(version, number)
+	}
+
+	for idx, first := range firstPoseidonCommitmentsVersion {
+		switch {
+		case idx >= len(version) || version[idx] < first:
+			return PedersenCommitments, nil
+		case version[idx] > first:
+			return PoseidonCommitments, nil
+		}
+	}
+	return PoseidonCommitments, nil
+}
+
 // TransactionCommitment is the root of a height 64 binary Merkle Patricia tree of the
-// transaction hashes and signatures in a block.
-func TransactionCommitment(receipts []*TransactionReceipt) (*felt.Felt, error) {
-	var transactionCommitment *felt.Felt
-	return transactionCommitment, trie.RunOnTempTrie(64, func(trie *trie.Trie) error {
-		zeroFelt := new(felt.Felt)
-		for i, receipt := range receipts {
+// transaction hashes and signatures in a block, calculated with the given scheme.
+// Every transaction is keyed by the [trie.IndexKey] of its index in the block.
+func TransactionCommitment(receipts []*TransactionReceipt, scheme CommitmentScheme) (*felt.Felt, error) {
+	zeroFelt := new(felt.Felt)
+	values := make([]*felt.Felt, 0, len(receipts))
+	for _, receipt := range receipts {
+		switch scheme {
+		case PedersenCommitments:
 			signaturesHash := crypto.Pedersen(zeroFelt, zeroFelt)
 			if receipt.Type == Invoke {
 				signaturesHash = crypto.PedersenArray(receipt.Signatures...)
 			}
-			transactionAndSignatureHash := crypto.Pedersen(receipt.TransactionHash, signaturesHash)
-			if err := trie.Put(new(felt.Felt).SetUint64(uint64(i)), transactionAndSignatureHash); err != nil {
-				return err
+			values = append(values, crypto.Pedersen(receipt.TransactionHash, signaturesHash))
+		case PoseidonCommitments:
+			// a missing signature is committed to as a zero signature
+			signatures := receipt.Signatures
+			if len(signatures) == 0 {
+				signatures = []*felt.Felt{zeroFelt}
 			}
+			values = append(values, crypto.PoseidonArray(append([]*felt.Felt{receipt.TransactionHash}, signatures...)...))
+		default:
+			return nil, fmt.Errorf("unknown commitment scheme %d", scheme)
 		}
-		root, err := trie.Root()
-		if err != nil {
-			return err
-		}
-		transactionCommitment = root
-		return nil
-	})
+	}
+	return flatCommitment(values, scheme)
 }
 
-// EventData computes the event commitment and event count for a block.
-func EventData(receipts []*TransactionReceipt) (*felt.Felt, uint64, error) {
-	var eventCommitment *felt.Felt // root of a height 64 binary Merkle Patricia tree of the events in a block.
-	var eventCount uint64          // number of events in a block.
-	return eventCommitment, eventCount, trie.RunOnTempTrie(64, func(trie *trie.Trie) error {
-		for _, receipt := range receipts {
-			for _, event := range receipt.Events {
-				eventHash := crypto.PedersenArray(
+// EventData computes the event commitment and event count for a block, the
+// commitment is calculated with the given scheme.
+func EventData(receipts []*TransactionReceipt, scheme CommitmentScheme) (*felt.Felt, uint64, error) {
+	var eventHashes []*felt.Felt
+	for _, receipt := range receipts {
+		for _, event := range receipt.Events {
+			switch scheme {
+			case PedersenCommitments:
+				eventHashes = append(eventHashes, crypto.PedersenArrayWith(
 					event.From,
 					crypto.PedersenArray(event.Keys...),
 					crypto.PedersenArray(event.Data...),
-				)
-
-				if err := trie.Put(new(felt.Felt).SetUint64(eventCount), eventHash); err != nil {
-					return err
-				}
-				eventCount++
+				))
+			case PoseidonCommitments:
+				elems := []*felt.Felt{event.From, receipt.TransactionHash, new(felt.Felt).SetUint64(uint64(len(event.Keys)))}
+				elems = append(elems, event.Keys...)
+				elems = append(elems, new(felt.Felt).SetUint64(uint64(len(event.Data))))
+				eventHashes = append(eventHashes, crypto.PoseidonArray(append(elems, event.Data...)...))
+			default:
+				return nil, 0, fmt.Errorf("unknown commitment scheme %d", scheme)
 			}
 		}
-		root, err := trie.Root()
-		if err != nil {
-			return err
-		}
-		eventCommitment = root
-		return nil
-	})
+	}
+
+	// root of a height 64 binary Merkle Patricia tree of the events in a block,
+	// keyed by the [trie.IndexKey] of their index in the block.
+	eventCommitment, err := flatCommitment(eventHashes, scheme)
+	if err != nil {
+		return nil, 0, err
+	}
+	return eventCommitment, uint64(len(eventHashes)), nil
+}
+
+// flatCommitment returns the root of the height 64 trie that maps the
+// [trie.IndexKey] of every value to the value, with the hash of the given
+// scheme
+func flatCommitment(values []*felt.Felt, scheme CommitmentScheme) (*felt.Felt, error) {
+	if scheme == PoseidonCommitments {
+		return trie.FlatCommitmentWithHash(values, crypto.Poseidon)
+	}
+	return trie.FlatCommitment(values)
 }
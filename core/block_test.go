@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/NethermindEth/juno/core/crypto"
 	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
 	"github.com/NethermindEth/juno/utils"
 )
 
@@ -16,7 +18,7 @@ func TestBlockHash(t *testing.T) {
 	}
 
 	tests := []struct {
-		block   *Block
+		header  *BlockHeader
 		chain   utils.Network
 		name    string
 		want    string
@@ -25,7 +27,7 @@ func TestBlockHash(t *testing.T) {
 		{
 			// block 231579: goerli
 			// "https://alpha4.starknet.io/feeder_gateway/get_block?blockHash=0x40ffdbd9abbc4fc64652c50db94a29bce65c183316f304a95df624de708e746",
-			&Block{
+			&BlockHeader{
 				hexToFelt("0x2e304af9a165977b79298abe812607a2d5044d278bd784f245e3cb21d7a77e8"),
 				231579,
 				hexToFelt("0x1ee483d84c82fec55ec52fdf62e85abaebc47dfe0e4623187a2350a17a1b1dc"),
@@ -46,7 +48,7 @@ func TestBlockHash(t *testing.T) {
 		{
 			// block 156000: goerli
 			// "https://alpha4.starknet.io/feeder_gateway/get_block?blockNumber=156000",
-			&Block{
+			&BlockHeader{
 				hexToFelt("0x331e6b9d99341aba27113ff30bd211b84194e87f2a8fe41f3485ca91b3e047b"),
 				156000,
 				hexToFelt("0x24e7360800ca4cdfc0ac3e18fb32399142d75b7a20d29ecbb563fbf962aa3c5"),
@@ -67,7 +69,7 @@ func TestBlockHash(t *testing.T) {
 		{
 			// block 1: goerli
 			// "https://alpha4.starknet.io/feeder_gateway/get_block?blockNumber=1",
-			&Block{
+			&BlockHeader{
 				hexToFelt("0x7d328a71faf48c5c3857e99f20a77b18522480956d1cd5bff1ff2df3c8b427b"),
 				1,
 				hexToFelt("0x3f04ffa63e188d602796505a2ee4f6e1f294ee29a914b057af8e75b17259d9f"),
@@ -88,7 +90,7 @@ func TestBlockHash(t *testing.T) {
 		{
 			// block 16789: mainnet
 			// "https://alpha-mainnet.starknet.io/feeder_gateway/get_block?blockNumber=16789"
-			&Block{
+			&BlockHeader{
 				hexToFelt("0x3a97d46093a823719ac0c905e6548cebcbd6028b39f3cd184b0bf47498c1f66"),
 				16789,
 				hexToFelt("0x23710fe6dcc2fd95b74f66b30695e7b48506a17e5795676035c845fef50678c"),
@@ -109,7 +111,7 @@ func TestBlockHash(t *testing.T) {
 		{
 			// block 1: integration
 			// "https://external.integration.starknet.io/feeder_gateway/get_block?blockNumber=1"
-			&Block{
+			&BlockHeader{
 				hexToFelt("0x3ae41b0f023e53151b0c8ab8b9caafb7005d5f41c9ab260276d5bdc49726279"),
 				1,
 				hexToFelt("0x074abfb3f55d3f9c3967014e1a5ec7205949130ff8912dba0565daf70299144c"),
@@ -130,7 +132,7 @@ func TestBlockHash(t *testing.T) {
 		{
 			// block 119802: goerli
 			// https://alpha4.starknet.io/feeder_gateway/get_block?blockNumber=119802
-			&Block{
+			&BlockHeader{
 				hexToFelt("0x3947adfc82697eaff29275eb4dba13c8e9d606d24246507d9c2faf8321f3c6b"),
 				119802,
 				hexToFelt("0x12c1e72707cd8a1226728aa8dee7fe70d281b482da5997c13db7c8746f9e8c0"),
@@ -151,7 +153,7 @@ func TestBlockHash(t *testing.T) {
 		{
 			// block 10: goerli2
 			// https://alpha4-2.starknet.io/feeder_gateway/get_block?blockNumber=10
-			&Block{
+			&BlockHeader{
 				hexToFelt("0x57467bd9f04b75e138357376d1f705604e0044fd677f7c12bbdfb9819d31b51"),
 				10,
 				hexToFelt("0x0097a5aa9bef614afc2f5f2b7fa1849f384be4bcc4e987b97e7640254eef0d7c"),
@@ -173,13 +175,23 @@ func TestBlockHash(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.block.Hash(tt.chain)
+			got, err := tt.header.Hash(tt.chain)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("got error %v, want error %v", err, tt.wantErr)
 			}
 			if !tt.wantErr && ("0x"+(got.Text(16)) != tt.want) {
 				t.Errorf("got %s, want %s", "0x"+got.Text(16), tt.want)
 			}
+
+			// the hash of a block is the hash of its header
+			block := &Block{BlockHeader: *tt.header}
+			blockHash, err := block.Hash(tt.chain)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(blockHash) {
+				t.Errorf("got block hash %s, want header hash %s", blockHash.Text(16), got.Text(16))
+			}
 		})
 	}
 }
@@ -342,7 +354,7 @@ func TestTransactionCommitment(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			commitment, _ := TransactionCommitment(test.receipts)
+			commitment, _ := TransactionCommitment(test.receipts, PedersenCommitments)
 			assertCorrectCommitment(t, commitment, test.want)
 		})
 	}
@@ -378,8 +390,108 @@ func TestEventCommitment(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			commitment, _, _ := EventData(test.receipts)
+			commitment, _, _ := EventData(test.receipts, PedersenCommitments)
 			assertCorrectCommitment(t, commitment, test.want)
 		})
 	}
 }
+
+func TestCommitmentSchemeFor(t *testing.T) {
+	tests := map[string]CommitmentScheme{
+		"":         PedersenCommitments,
+		"0.10.1":   PedersenCommitments,
+		"0.13.1.1": PedersenCommitments,
+		"0.13":     PedersenCommitments,
+		"0.13.2":   PoseidonCommitments,
+		"0.13.2.1": PoseidonCommitments,
+		"0.13.10":  PoseidonCommitments,
+		"0.14.0":   PoseidonCommitments,
+		"1.0":      PoseidonCommitments,
+	}
+	for version, want := range tests {
+		got, err := CommitmentSchemeFor(version)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", version, err)
+		} else if got != want {
+			t.Errorf("%q: got scheme %d, want %d", version, got, want)
+		}
+	}
+
+	for _, version := range []string{"0.13.x", "v0.13.2", "0..1"} {
+		if _, err := CommitmentSchemeFor(version); err == nil {
+			t.Errorf("%q: expected an error", version)
+		}
+	}
+}
+
+// Todo: pin the commitments of a real block from 0.13.2 on against the
+// transaction_commitment and event_commitment published by the feeder
+// gateway. No such block is in testdata yet, so the Poseidon scheme is
+// only checked against a trie of the leaves described by the spec.
+func TestPoseidonCommitments(t *testing.T) {
+	// receipts[3] is a mainnet block with events, the hashes of its
+	// transactions and events are committed to with Poseidon
+	blockReceipts := receipts[3]
+
+	poseidonRoot := func(values []*felt.Felt) *felt.Felt {
+		tr := trie.NewTrieWithHash(trie.NewMapStorage(), 64, nil, crypto.Poseidon)
+		for idx, value := range values {
+			if err := tr.Put(trie.IndexKey(uint64(idx)), value); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		root, err := tr.Root()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return root
+	}
+
+	var transactionLeaves, eventLeaves []*felt.Felt
+	for _, receipt := range blockReceipts {
+		signatures := receipt.Signatures
+		if len(signatures) == 0 {
+			signatures = []*felt.Felt{new(felt.Felt)}
+		}
+		transactionLeaves = append(transactionLeaves,
+			crypto.PoseidonArray(append([]*felt.Felt{receipt.TransactionHash}, signatures...)...))
+
+		for _, event := range receipt.Events {
+			elems := []*felt.Felt{event.From, receipt.TransactionHash, new(felt.Felt).SetUint64(uint64(len(event.Keys)))}
+			elems = append(elems, event.Keys...)
+			elems = append(elems, new(felt.Felt).SetUint64(uint64(len(event.Data))))
+			eventLeaves = append(eventLeaves, crypto.PoseidonArray(append(elems, event.Data...)...))
+		}
+	}
+	if len(eventLeaves) == 0 {
+		t.Fatal("expected a block with events")
+	}
+
+	transactionCommitment, err := TransactionCommitment(blockReceipts, PoseidonCommitments)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertCorrectCommitment(t, transactionCommitment, "0x"+poseidonRoot(transactionLeaves).Text(16))
+
+	eventCommitment, eventCount, err := EventData(blockReceipts, PoseidonCommitments)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertCorrectCommitment(t, eventCommitment, "0x"+poseidonRoot(eventLeaves).Text(16))
+	if eventCount != uint64(len(eventLeaves)) {
+		t.Errorf("got %d events, want %d", eventCount, len(eventLeaves))
+	}
+
+	// the schemes do not agree
+	legacyCommitment, err := TransactionCommitment(blockReceipts, PedersenCommitments)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if legacyCommitment.Equal(transactionCommitment) {
+		t.Error("expected the commitments of the schemes to differ")
+	}
+
+	if _, err = TransactionCommitment(blockReceipts, CommitmentScheme(37)); err == nil {
+		t.Error("expected an error for an unknown scheme")
+	}
+}
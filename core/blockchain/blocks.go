@@ -0,0 +1,253 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/NethermindEth/juno/utils"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// ErrBlockNotFound is returned when no block is stored with the requested
+// number or hash
+var ErrBlockNotFound = errors.New("block not found")
+
+// BlockHashMismatchError is returned when the hash reported for a block
+// does not match the hash computed from its header.
+type BlockHashMismatchError struct {
+	Number   uint64
+	Reported *felt.Felt
+	Computed *felt.Felt
+}
+
+func (e *BlockHashMismatchError) Error() string {
+	return fmt.Sprintf("block %d hash mismatch: reported 0x%s, computed 0x%s",
+		e.Number, e.Reported.Text(16), e.Computed.Text(16))
+}
+
+// BlockCountMismatchError is returned when the number of transactions or
+// events reported by the header of a block does not match the number of
+// transactions or events of the block.
+type BlockCountMismatchError struct {
+	Number uint64
+	// Count is either "transaction" or "event"
+	Count    string
+	Reported *felt.Felt
+	Counted  uint64
+}
+
+func (e *BlockCountMismatchError) Error() string {
+	return fmt.Sprintf("block %d %s count mismatch: header reports %s, counted %d",
+		e.Number, e.Count, e.Reported.Text(10), e.Counted)
+}
+
+// BlockStore stores blocks keyed by number and indexed by hash
+type BlockStore struct {
+	db      *badger.DB
+	network utils.Network
+}
+
+func NewBlockStore(db *badger.DB, network utils.Network) BlockStore {
+	return BlockStore{db: db, network: network}
+}
+
+// StoreBlock verifies that blockHash is the hash of the block on the
+// network of the store, then stores the block. A block with a mismatching
+// hash is rejected with a [BlockHashMismatchError] and not stored. Blocks
+// whose hash is unverifiable (see [core.UnverifiableBlockError]) are stored
+// as is.
+//
+// A block whose parent is stored is checked against it with
+// [ValidateBlock] and rejected if it does not follow it.
+//
+// The receipts of the transactions of the block are used to check the
+// transaction and event counts of the block, a block with a mismatching
+// count is rejected with a [BlockCountMismatchError]. Receipts are not
+// stored, see [ReceiptStore].
+//
+// A block with the number of a stored block replaces it, as on a reorg,
+// and the replaced block is no longer found by its hash.
+func (b BlockStore) StoreBlock(blockHash *felt.Felt, block *core.Block, receipts []*core.TransactionReceipt) error {
+	if err := verifyCounts(block, receipts); err != nil {
+		return err
+	}
+
+	computed, err := block.Hash(b.network)
+	var unverifiable *core.UnverifiableBlockError
+	if err != nil && !errors.As(err, &unverifiable) {
+		return err
+	} else if err == nil && !computed.Equal(blockHash) {
+		return &BlockHashMismatchError{Number: block.Number, Reported: blockHash, Computed: computed}
+	}
+
+	blockBytes, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+
+	numberBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(numberBytes, block.Number)
+	return b.db.Update(func(txn *badger.Txn) error {
+		if err := validateParent(block, txn); err != nil {
+			return err
+		}
+
+		if err := unindexReplacedBlock(numberBytes, blockHash, txn); err != nil {
+			return err
+		}
+
+		if err := txn.Set(db.Blocks.Key(numberBytes), blockBytes); err != nil {
+			return err
+		}
+		if err := txn.Set(db.BlockHashes.Key(numberBytes), blockHash.Marshal()); err != nil {
+			return err
+		}
+		return txn.Set(db.BlockNumbers.Key(blockHash.Marshal()), numberBytes)
+	})
+}
+
+// unindexReplacedBlock deletes the hash index of the block stored with the
+// given number, if any and if its hash is not blockHash, in the given Txn
+// context, so that the block replacing it is not found by the old hash.
+func unindexReplacedBlock(numberBytes []byte, blockHash *felt.Felt, txn *badger.Txn) error {
+	item, err := txn.Get(db.BlockHashes.Key(numberBytes))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	oldHash, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	if blockHash.Equal(new(felt.Felt).SetBytes(oldHash)) {
+		return nil
+	}
+	return txn.Delete(db.BlockNumbers.Key(oldHash))
+}
+
+// validateParent checks block against its parent with [ValidateBlock] in
+// the given Txn context, if the parent and its hash are stored.
+func validateParent(block *core.Block, txn *badger.Txn) error {
+	if block.Number == 0 {
+		return nil
+	}
+
+	parent, err := getBlock(block.Number-1, txn)
+	if errors.Is(err, ErrBlockNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	numberBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(numberBytes, parent.Number)
+	item, err := txn.Get(db.BlockHashes.Key(numberBytes))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		// stored before block hashes were
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	parentHash := new(felt.Felt)
+	if err = item.Value(func(val []byte) error {
+		parentHash.SetBytes(val)
+		return nil
+	}); err != nil {
+		return err
+	}
+	return ValidateBlock(parent, block, parentHash)
+}
+
+// verifyCounts checks the transaction and event counts of block against
+// receipts and the transaction hashes of block, if any.
+func verifyCounts(block *core.Block, receipts []*core.TransactionReceipt) error {
+	verify := func(count string, reported *felt.Felt, counted int) error {
+		if reported == nil {
+			reported = new(felt.Felt)
+		}
+		if !reported.Equal(new(felt.Felt).SetUint64(uint64(counted))) {
+			return &BlockCountMismatchError{
+				Number: block.Number, Count: count, Reported: reported, Counted: uint64(counted),
+			}
+		}
+		return nil
+	}
+
+	if err := verify("transaction", block.TransactionCount, len(receipts)); err != nil {
+		return err
+	}
+	if block.TransactionHashes != nil {
+		if err := verify("transaction", block.TransactionCount, len(block.TransactionHashes)); err != nil {
+			return err
+		}
+	}
+
+	events := 0
+	for _, receipt := range receipts {
+		events += len(receipt.Events)
+	}
+	return verify("event", block.EventCount, events)
+}
+
+// BlockByNumber returns the block with the given number, or
+// [ErrBlockNotFound] if it is not stored.
+func (b BlockStore) BlockByNumber(number uint64) (*core.Block, error) {
+	var block *core.Block
+	return block, b.db.View(func(txn *badger.Txn) error {
+		var err error
+		block, err = getBlock(number, txn)
+		return err
+	})
+}
+
+// BlockByHash returns the block with the given hash, or
+// [ErrBlockNotFound] if it is not stored.
+func (b BlockStore) BlockByHash(blockHash *felt.Felt) (*core.Block, error) {
+	var block *core.Block
+	return block, b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(db.BlockNumbers.Key(blockHash.Marshal()))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrBlockNotFound
+		} else if err != nil {
+			return err
+		}
+
+		var number uint64
+		if err = item.Value(func(val []byte) error {
+			number = binary.BigEndian.Uint64(val)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		block, err = getBlock(number, txn)
+		return err
+	})
+}
+
+// getBlock returns the block with the given number in the given Txn
+// context.
+func getBlock(number uint64, txn *badger.Txn) (*core.Block, error) {
+	numberBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(numberBytes, number)
+
+	item, err := txn.Get(db.Blocks.Key(numberBytes))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrBlockNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	block := new(core.Block)
+	return block, item.Value(func(val []byte) error {
+		return json.Unmarshal(val, block)
+	})
+}
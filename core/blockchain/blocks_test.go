@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/NethermindEth/juno/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreBlock(t *testing.T) {
+	hexToFelt := func(hex string) *felt.Felt {
+		f, err := new(felt.Felt).SetString(hex)
+		assert.NoError(t, err)
+		return f
+	}
+
+	// block 231579: goerli
+	// "https://alpha4.starknet.io/feeder_gateway/get_block?blockHash=0x40ffdbd9abbc4fc64652c50db94a29bce65c183316f304a95df624de708e746",
+	blockHash := hexToFelt("0x40ffdbd9abbc4fc64652c50db94a29bce65c183316f304a95df624de708e746")
+	newBlock := func() *core.Block {
+		return &core.Block{BlockHeader: core.BlockHeader{
+			ParentHash:            hexToFelt("0x2e304af9a165977b79298abe812607a2d5044d278bd784f245e3cb21d7a77e8"),
+			Number:                231579,
+			GlobalStateRoot:       hexToFelt("0x1ee483d84c82fec55ec52fdf62e85abaebc47dfe0e4623187a2350a17a1b1dc"),
+			SequencerAddress:      hexToFelt("0x46a89ae102987331d369645031b49c27738ed096f2789c24449966da4c6de6b"),
+			Timestamp:             new(felt.Felt).SetUint64(1654526121),
+			TransactionCount:      new(felt.Felt).SetUint64(65),
+			TransactionCommitment: hexToFelt("0x73a0e2053e3ab5c3e23f656bdb8c6055e572174426a9453db4a486835cfd596"),
+			EventCount:            new(felt.Felt).SetUint64(89),
+			EventCommitment:       hexToFelt("0x125a4eebce8aa3f9f0825c15d93a06f0977d55799aa2917d040bffe30ac444a"),
+			ProtocolVersion:       new(felt.Felt),
+			ExtraData:             new(felt.Felt),
+		}}
+	}
+
+	// the block has 65 transactions with 89 events in total
+	newReceipts := func() []*core.TransactionReceipt {
+		receipts := make([]*core.TransactionReceipt, 65)
+		for idx := range receipts {
+			receipts[idx] = &core.TransactionReceipt{TransactionHash: new(felt.Felt).SetUint64(uint64(idx))}
+		}
+		receipts[0].Events = make([]*core.Event, 25)
+		receipts[64].Events = make([]*core.Event, 64)
+		return receipts
+	}
+
+	t.Run("tampered block", func(t *testing.T) {
+		store := NewBlockStore(db.NewTestDb(), utils.GOERLI)
+		tampered := newBlock()
+		tampered.Timestamp = new(felt.Felt).SetUint64(1654526122)
+
+		var mismatch *BlockHashMismatchError
+		assert.ErrorAs(t, store.StoreBlock(blockHash, tampered, newReceipts()), &mismatch)
+		assert.Equal(t, uint64(231579), mismatch.Number)
+
+		_, err := store.BlockByNumber(231579)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+		_, err = store.BlockByHash(blockHash)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+
+	t.Run("known-good block", func(t *testing.T) {
+		store := NewBlockStore(db.NewTestDb(), utils.GOERLI)
+		block := newBlock()
+		assert.NoError(t, store.StoreBlock(blockHash, block, newReceipts()))
+
+		byNumber, err := store.BlockByNumber(231579)
+		assert.NoError(t, err)
+		assert.Equal(t, block, byNumber)
+
+		byHash, err := store.BlockByHash(blockHash)
+		assert.NoError(t, err)
+		assert.Equal(t, block, byHash)
+	})
+
+	t.Run("unverifiable block", func(t *testing.T) {
+		store := NewBlockStore(db.NewTestDb(), utils.GOERLI)
+		block := newBlock()
+		block.Number = 119802
+		assert.NoError(t, store.StoreBlock(new(felt.Felt).SetUint64(1), block, newReceipts()))
+	})
+
+	t.Run("replaced block", func(t *testing.T) {
+		store := NewBlockStore(db.NewTestDb(), utils.GOERLI)
+		oldHash, newHash := new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(2)
+		block := newBlock()
+		block.Number = 119802
+		assert.NoError(t, store.StoreBlock(oldHash, block, newReceipts()))
+
+		replacement := newBlock()
+		replacement.Number = 119802
+		replacement.Timestamp = new(felt.Felt).SetUint64(1654526122)
+		assert.NoError(t, store.StoreBlock(newHash, replacement, newReceipts()))
+
+		_, err := store.BlockByHash(oldHash)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+		byHash, err := store.BlockByHash(newHash)
+		assert.NoError(t, err)
+		assert.Equal(t, replacement, byHash)
+		byNumber, err := store.BlockByNumber(119802)
+		assert.NoError(t, err)
+		assert.Equal(t, replacement, byNumber)
+
+		// storing the same block again keeps its hash indexed
+		assert.NoError(t, store.StoreBlock(newHash, replacement, newReceipts()))
+		_, err = store.BlockByHash(newHash)
+		assert.NoError(t, err)
+	})
+
+	t.Run("mismatched counts", func(t *testing.T) {
+		store := NewBlockStore(db.NewTestDb(), utils.GOERLI)
+		var mismatch *BlockCountMismatchError
+
+		wrongEvents := newBlock()
+		wrongEvents.EventCount = new(felt.Felt).SetUint64(90)
+		assert.ErrorAs(t, store.StoreBlock(blockHash, wrongEvents, newReceipts()), &mismatch)
+		assert.EqualError(t, mismatch, "block 231579 event count mismatch: header reports 90, counted 89")
+
+		truncated := newReceipts()[:64]
+		assert.ErrorAs(t, store.StoreBlock(blockHash, newBlock(), truncated), &mismatch)
+		assert.EqualError(t, mismatch, "block 231579 transaction count mismatch: header reports 65, counted 64")
+
+		wrongHashes := newBlock()
+		wrongHashes.TransactionHashes = []*felt.Felt{new(felt.Felt)}
+		assert.ErrorAs(t, store.StoreBlock(blockHash, wrongHashes, newReceipts()), &mismatch)
+		assert.Equal(t, uint64(1), mismatch.Counted)
+
+		_, err := store.BlockByNumber(231579)
+		assert.ErrorIs(t, err, ErrBlockNotFound)
+	})
+}
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// ErrReceiptNotFound is returned when no receipt is stored for a
+// transaction
+var ErrReceiptNotFound = errors.New("transaction receipt not found")
+
+// ReceiptStore stores transaction receipts keyed by transaction hash
+type ReceiptStore struct {
+	db *badger.DB
+}
+
+func NewReceiptStore(db *badger.DB) ReceiptStore {
+	return ReceiptStore{db: db}
+}
+
+// Put stores the given receipts, overwriting any receipt already stored
+// for the same transaction.
+func (r ReceiptStore) Put(receipts ...*core.TransactionReceipt) error {
+	return r.db.Update(func(txn *badger.Txn) error {
+		for _, receipt := range receipts {
+			if receipt.TransactionHash == nil {
+				return errors.New("receipt without a transaction hash")
+			}
+
+			receiptBytes, err := json.Marshal(receipt)
+			if err != nil {
+				return err
+			}
+			if err = txn.Set(db.Receipts.Key(receipt.TransactionHash.Marshal()), receiptBytes); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Receipt returns the receipt of the transaction with the given hash, or
+// [ErrReceiptNotFound] if it is not stored.
+func (r ReceiptStore) Receipt(transactionHash *felt.Felt) (*core.TransactionReceipt, error) {
+	var receipt *core.TransactionReceipt
+	return receipt, r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(db.Receipts.Key(transactionHash.Marshal()))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrReceiptNotFound
+		} else if err != nil {
+			return err
+		}
+
+		receipt = new(core.TransactionReceipt)
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, receipt)
+		})
+	})
+}
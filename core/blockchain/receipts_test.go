@@ -0,0 +1,54 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiptStore(t *testing.T) {
+	store := NewReceiptStore(db.NewTestDb())
+	hash := new(felt.Felt).SetUint64(1)
+
+	_, err := store.Receipt(hash)
+	assert.ErrorIs(t, err, ErrReceiptNotFound)
+
+	receipt := &core.TransactionReceipt{
+		BlockHash:   new(felt.Felt).SetUint64(2),
+		BlockNumber: 3,
+		ActualFee:   new(felt.Felt).SetUint64(4),
+		Events: []*core.Event{{
+			Data: []*felt.Felt{new(felt.Felt).SetUint64(5)},
+			From: new(felt.Felt).SetUint64(6),
+			Keys: []*felt.Felt{new(felt.Felt).SetUint64(7)},
+		}},
+		ExecutionResources: &core.ExecutionResources{Steps: 8},
+		L1ToL2Message: &core.L1ToL2Message{
+			From:     common.HexToAddress("0x9"),
+			Nonce:    new(felt.Felt).SetUint64(10),
+			Payload:  []*felt.Felt{new(felt.Felt).SetUint64(11)},
+			Selector: new(felt.Felt).SetUint64(12),
+			To:       new(felt.Felt).SetUint64(13),
+		},
+		L2ToL1Message: &[]core.L2ToL1Message{{
+			From:    new(felt.Felt).SetUint64(14),
+			Payload: []*felt.Felt{new(felt.Felt).SetUint64(15)},
+			To:      common.HexToAddress("0x10"),
+		}},
+		TransactionHash:  hash,
+		TransactionIndex: big.NewInt(17),
+		Type:             core.L1Handler,
+	}
+	assert.NoError(t, store.Put(receipt))
+
+	got, err := store.Receipt(hash)
+	assert.NoError(t, err)
+	assert.Equal(t, receipt, got)
+
+	assert.EqualError(t, store.Put(&core.TransactionReceipt{}), "receipt without a transaction hash")
+}
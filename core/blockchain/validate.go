@@ -0,0 +1,60 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+var (
+	// ErrNonSequentialBlock is returned when the number of a block is not
+	// the one following the number of its parent
+	ErrNonSequentialBlock = errors.New("block does not follow its parent")
+	// ErrParentHashMismatch is returned when the parent hash of a block is
+	// not the hash of its parent
+	ErrParentHashMismatch = errors.New("parent hash mismatch")
+	// ErrTimestampDecreased is returned when a block is older than its
+	// parent
+	ErrTimestampDecreased = errors.New("block timestamp before its parent's")
+)
+
+// ValidateBlock checks that cur can follow prev, whose hash is prevHash: the
+// number of cur must be the one of prev plus one, its parent hash must be
+// prevHash and its timestamp must not be before the one of prev. Each
+// failed check is reported with its own error.
+func ValidateBlock(prev, cur *core.Block, prevHash *felt.Felt) error {
+	if cur.Number != prev.Number+1 {
+		return fmt.Errorf("%w: block %d after block %d", ErrNonSequentialBlock, cur.Number, prev.Number)
+	}
+	if cur.ParentHash == nil || !cur.ParentHash.Equal(prevHash) {
+		return fmt.Errorf("%w: block %d has parent hash 0x%s, block %d has hash 0x%s", ErrParentHashMismatch,
+			cur.Number, feltText(cur.ParentHash, 16), prev.Number, feltText(prevHash, 16))
+	}
+
+	prevTime, curTime := timestampBytes(prev), timestampBytes(cur)
+	if bytes.Compare(curTime, prevTime) < 0 {
+		return fmt.Errorf("%w: block %d at %s, block %d at %s", ErrTimestampDecreased,
+			cur.Number, feltText(cur.Timestamp, 10), prev.Number, feltText(prev.Timestamp, 10))
+	}
+	return nil
+}
+
+// timestampBytes returns the big endian bytes of the timestamp of a block,
+// which sort like the timestamps
+func timestampBytes(block *core.Block) []byte {
+	if block.Timestamp == nil {
+		return new(felt.Felt).Marshal()
+	}
+	return block.Timestamp.Marshal()
+}
+
+// feltText is [felt.Felt.Text] for felts that may be nil, which are zero
+func feltText(f *felt.Felt, base int) string {
+	if f == nil {
+		return "0"
+	}
+	return f.Text(base)
+}
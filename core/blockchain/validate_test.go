@@ -0,0 +1,71 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/NethermindEth/juno/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBlock(t *testing.T) {
+	prevHash := new(felt.Felt).SetUint64(37)
+	prev := &core.Block{BlockHeader: core.BlockHeader{Number: 10, Timestamp: new(felt.Felt).SetUint64(1000)}}
+	next := func() *core.Block {
+		return &core.Block{BlockHeader: core.BlockHeader{
+			ParentHash: prevHash,
+			Number:     11,
+			Timestamp:  new(felt.Felt).SetUint64(1000),
+		}}
+	}
+
+	assert.NoError(t, ValidateBlock(prev, next(), prevHash))
+
+	skipped := next()
+	skipped.Number = 12
+	assert.ErrorIs(t, ValidateBlock(prev, skipped, prevHash), ErrNonSequentialBlock)
+
+	wrongParent := next()
+	wrongParent.ParentHash = new(felt.Felt).SetUint64(38)
+	assert.EqualError(t, ValidateBlock(prev, wrongParent, prevHash),
+		"parent hash mismatch: block 11 has parent hash 0x26, block 10 has hash 0x25")
+	wrongParent.ParentHash = nil
+	assert.ErrorIs(t, ValidateBlock(prev, wrongParent, prevHash), ErrParentHashMismatch)
+
+	older := next()
+	older.Timestamp = new(felt.Felt).SetUint64(999)
+	assert.EqualError(t, ValidateBlock(prev, older, prevHash),
+		"block timestamp before its parent's: block 11 at 999, block 10 at 1000")
+}
+
+func TestStoreBlockValidatesParent(t *testing.T) {
+	// blocks in the unverifiable range of goerli are stored whatever their hash
+	hash := func(number uint64) *felt.Felt {
+		return new(felt.Felt).SetUint64(number + 1000)
+	}
+	block := func(number, timestamp uint64) *core.Block {
+		return &core.Block{BlockHeader: core.BlockHeader{
+			ParentHash:       hash(number - 1),
+			Number:           number,
+			Timestamp:        new(felt.Felt).SetUint64(timestamp),
+			TransactionCount: new(felt.Felt),
+			EventCount:       new(felt.Felt),
+		}}
+	}
+
+	store := NewBlockStore(db.NewTestDb(), utils.GOERLI)
+	// the parent of the first block is not stored
+	assert.NoError(t, store.StoreBlock(hash(120000), block(120000, 100), nil))
+
+	assert.ErrorIs(t, store.StoreBlock(hash(120001), block(120001, 99), nil), ErrTimestampDecreased)
+	wrongParent := block(120001, 100)
+	wrongParent.ParentHash = hash(119000)
+	assert.ErrorIs(t, store.StoreBlock(hash(120001), wrongParent, nil), ErrParentHashMismatch)
+	_, err := store.BlockByNumber(120001)
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+
+	assert.NoError(t, store.StoreBlock(hash(120001), block(120001, 100), nil))
+	assert.NoError(t, store.StoreBlock(hash(120002), block(120002, 101), nil))
+}
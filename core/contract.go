@@ -1,6 +1,10 @@
 package core
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+
 	"github.com/NethermindEth/juno/core/crypto"
 	"github.com/NethermindEth/juno/core/felt"
 )
@@ -21,6 +25,11 @@ type Class struct {
 	// The starknet_keccak hash of the ".json" file compiler output.
 	ProgramHash *felt.Felt
 	Bytecode    []*felt.Felt
+	// The interface of the class, it does not influence the class hash.
+	Abi Abi
+	// The base64 encoded, gzip compressed program of the class as it was
+	// declared or fetched, it does not influence the class hash either.
+	Program string
 }
 
 func (c *Class) Hash() *felt.Felt {
@@ -54,6 +63,141 @@ type EntryPoint struct {
 	Offset *felt.Felt
 }
 
+// CompiledClass is the CASM form of a Cairo 1 class, as compiled by the
+// sequencer out of its Sierra form. Only the fields committed to by
+// [CompiledClassHash] are kept.
+type CompiledClass struct {
+	Bytecode    []*felt.Felt
+	External    []CompiledEntryPoint
+	L1Handler   []CompiledEntryPoint
+	Constructor []CompiledEntryPoint
+}
+
+// CompiledEntryPoint is an entry point of a [CompiledClass].
+type CompiledEntryPoint struct {
+	// starknet_keccak hash of the function name.
+	Selector *felt.Felt
+	// The offset of the instruction in the class's bytecode.
+	Offset *felt.Felt
+	// The names of the builtins used by the function, such as
+	// "range_check".
+	Builtins []string
+}
+
+// compiledClassVersion is the short string prefixing the hash of a
+// [CompiledClass]
+var compiledClassVersion = new(felt.Felt).SetBytes([]byte("COMPILED_CLASS_V1"))
+
+// CompiledClassHash returns the hash of a [CompiledClass], which is
+// committed to by the leaves of the class trie. The entry points of each
+// type are hashed in the given order, each as its selector, offset and
+// the hash of its builtin names encoded as short strings, then hashed
+// along with the version and the bytecode, all with
+// [crypto.PoseidonArray].
+func CompiledClassHash(casm *CompiledClass) (*felt.Felt, error) {
+	if casm == nil {
+		return nil, errors.New("nil compiled class")
+	}
+
+	elems := []*felt.Felt{compiledClassVersion}
+	for _, entryPoints := range [][]CompiledEntryPoint{casm.External, casm.L1Handler, casm.Constructor} {
+		hash, err := hashCompiledEntryPoints(entryPoints)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, hash)
+	}
+	for _, f := range casm.Bytecode {
+		if f == nil {
+			return nil, errors.New("nil felt in bytecode")
+		}
+	}
+	return crypto.PoseidonArray(append(elems, crypto.PoseidonArray(casm.Bytecode...))...), nil
+}
+
+func hashCompiledEntryPoints(entryPoints []CompiledEntryPoint) (*felt.Felt, error) {
+	elems := make([]*felt.Felt, 0, 3*len(entryPoints))
+	for _, entryPoint := range entryPoints {
+		if entryPoint.Selector == nil || entryPoint.Offset == nil {
+			return nil, errors.New("entry point without selector or offset")
+		}
+
+		builtins := make([]*felt.Felt, 0, len(entryPoint.Builtins))
+		for _, name := range entryPoint.Builtins {
+			// builtin names are short strings, which fit in a felt
+			if len(name) > felt.Bytes-1 {
+				return nil, fmt.Errorf("builtin name too long: %s", name)
+			}
+			builtins = append(builtins, new(felt.Felt).SetBytes([]byte(name)))
+		}
+		elems = append(elems, entryPoint.Selector, entryPoint.Offset, crypto.PoseidonArray(builtins...))
+	}
+	return crypto.PoseidonArray(elems...), nil
+}
+
+// Abi describes the functions, events and structs of a [Class].
+type Abi struct {
+	Functions []AbiFunction
+	Events    []AbiEvent
+	Structs   []AbiStruct
+}
+
+// AbiFunction is a function of a [Class] that can be called from outside.
+type AbiFunction struct {
+	// Either "function", "constructor" or "l1_handler".
+	Type    string
+	Name    string
+	Inputs  []AbiParam
+	Outputs []AbiParam
+	// "view" for functions that only read the state, empty otherwise.
+	StateMutability string
+}
+
+// defaultEntryPoints are the names of the functions called when no other
+// entry point matches the selector of a call. Their entry points have a
+// zero selector.
+var defaultEntryPoints = map[string]bool{
+	"__default__":    true,
+	"__l1_default__": true,
+}
+
+// Selector returns the selector of the [EntryPoint] of the function, which
+// is the starknet_keccak of its name.
+func (f *AbiFunction) Selector() (*felt.Felt, error) {
+	if defaultEntryPoints[f.Name] {
+		return new(felt.Felt), nil
+	}
+	return crypto.StarkNetKeccak([]byte(f.Name))
+}
+
+// AbiEvent is an event a [Class] can emit.
+type AbiEvent struct {
+	Name string
+	Keys []AbiParam
+	Data []AbiParam
+}
+
+// AbiStruct is a struct used by the functions and events of a [Class].
+type AbiStruct struct {
+	Name string
+	// The number of felts a value of the struct takes.
+	Size    uint64
+	Members []AbiMember
+}
+
+// AbiParam is a named and typed parameter or field.
+type AbiParam struct {
+	Name string
+	Type string
+}
+
+// AbiMember is a member of an [AbiStruct], located at Offset felts from
+// the start of the struct.
+type AbiMember struct {
+	AbiParam
+	Offset uint64
+}
+
 // Contract is an instance of a [Class].
 type Contract struct {
 	// The number of transactions sent from this contract.
@@ -65,6 +209,21 @@ type Contract struct {
 	StorageRoot *felt.Felt // TODO: is this field necessary?
 }
 
+// addressBound is the exclusive upper bound of contract addresses, 2^251 - 256
+var addressBound = func() []byte {
+	bound, err := new(felt.Felt).SetString("0x7ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff00")
+	if err != nil {
+		panic(err)
+	}
+	return bound.Marshal()
+}()
+
+// IsValidContractAddress tells whether a contract can be deployed at f:
+// contract addresses are in the range (0, 2^251 - 256).
+func IsValidContractAddress(f *felt.Felt) bool {
+	return f != nil && !f.IsZero() && bytes.Compare(f.Marshal(), addressBound) < 0
+}
+
 // ContractAddress computes the address of a StarkNet contract.
 // Todo: [Contract] should have all the information it needs to calculate its address therefore we
 // should add callerAddress, salt and constructorCallData to [Contract]'s fields.
@@ -87,7 +246,7 @@ func ContractAddress(callerAddress, classHash, salt *felt.Felt, constructorCallD
 	callDataHash := crypto.PedersenArray(constructorCallData...)
 
 	// https://docs.starknet.io/documentation/architecture_and_concepts/Contracts/contract-address
-	return crypto.PedersenArray(
+	return crypto.PedersenArrayWith(
 		prefix,
 		callerAddress,
 		salt,
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/NethermindEth/juno/core/crypto"
 	"github.com/NethermindEth/juno/core/felt"
 )
 
@@ -15,6 +16,8 @@ var (
 	bytecodeCairo08Bytes []byte
 	//go:embed testdata/bytecode_0_10.json
 	bytecodeCairo10Bytes []byte
+	//go:embed testdata/compiled_class_1338d85d.json
+	compiledClass1338d85dBytes []byte
 )
 
 func hexToFelt(hex string) *felt.Felt {
@@ -271,3 +274,125 @@ func TestContractAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestIsValidContractAddress(t *testing.T) {
+	tests := map[string]struct {
+		address *felt.Felt
+		want    bool
+	}{
+		"nil":          {nil, false},
+		"zero":         {hexToFelt("0x0"), false},
+		"one":          {hexToFelt("0x1"), true},
+		"mainnet":      {hexToFelt("0x3ec215c6c9028ff671b46a2a9814970ea23ed3c4bcc3838c6d1dcbf395263c3"), true},
+		"largest":      {hexToFelt("0x7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffeff"), true},
+		"bound":        {hexToFelt("0x7ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff00"), false},
+		"2^251":        {hexToFelt("0x800000000000000000000000000000000000000000000000000000000000000"), false},
+		"largest felt": {new(felt.Felt).Sub(new(felt.Felt), hexToFelt("0x1")), false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := IsValidContractAddress(tt.address); got != tt.want {
+				t.Errorf("IsValidContractAddress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompiledClassHash(t *testing.T) {
+	casm := &CompiledClass{
+		Bytecode: []*felt.Felt{hexToFelt("0x40780017fff7fff"), hexToFelt("0x1"), hexToFelt("0x208b7fff7fff7ffe")},
+		External: []CompiledEntryPoint{
+			{Selector: hexToFelt("0x1"), Offset: hexToFelt("0x0"), Builtins: []string{"range_check"}},
+			{Selector: hexToFelt("0x2"), Offset: hexToFelt("0x2")},
+		},
+		Constructor: []CompiledEntryPoint{
+			{Selector: hexToFelt("0x3"), Offset: hexToFelt("0x1"), Builtins: []string{"pedersen", "range_check"}},
+		},
+	}
+
+	shortString := func(s string) *felt.Felt {
+		return new(felt.Felt).SetBytes([]byte(s))
+	}
+	want := crypto.PoseidonArray(
+		shortString("COMPILED_CLASS_V1"),
+		crypto.PoseidonArray(
+			hexToFelt("0x1"), hexToFelt("0x0"), crypto.PoseidonArray(shortString("range_check")),
+			hexToFelt("0x2"), hexToFelt("0x2"), crypto.PoseidonArray(),
+		),
+		crypto.PoseidonArray(),
+		crypto.PoseidonArray(
+			hexToFelt("0x3"), hexToFelt("0x1"), crypto.PoseidonArray(shortString("pedersen"), shortString("range_check")),
+		),
+		crypto.PoseidonArray(casm.Bytecode...),
+	)
+
+	hash, err := CompiledClassHash(casm)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !hash.Equal(want) {
+		t.Errorf("wrong hash: got %s, want %s", hash.Text(16), want.Text(16))
+	}
+
+	t.Run("goerli class", func(t *testing.T) {
+		// the CASM served by the goerli feeder gateway for the class
+		// 0x1338d85d3e579f6944ba06c005238d145920afeb32f94e3a1e234d21e1e9292,
+		// compiled by Cairo 1.1.0, without the hints that are not hashed.
+		// want was recorded with CompiledClassHash, it still has to be
+		// checked against the compiled class hash published on chain.
+		var compiled struct {
+			EntryPoints map[string][]struct {
+				Selector *felt.Felt `json:"selector"`
+				Offset   uint64     `json:"offset"`
+				Builtins []string   `json:"builtins"`
+			} `json:"entry_points_by_type"`
+			Bytecode []*felt.Felt `json:"bytecode"`
+		}
+		if err := json.Unmarshal(compiledClass1338d85dBytes, &compiled); err != nil {
+			t.Fatal(err)
+		}
+		entryPoints := func(entryPointType string) []CompiledEntryPoint {
+			adapted := make([]CompiledEntryPoint, 0, len(compiled.EntryPoints[entryPointType]))
+			for _, entryPoint := range compiled.EntryPoints[entryPointType] {
+				adapted = append(adapted, CompiledEntryPoint{
+					Selector: entryPoint.Selector,
+					Offset:   new(felt.Felt).SetUint64(entryPoint.Offset),
+					Builtins: entryPoint.Builtins,
+				})
+			}
+			return adapted
+		}
+
+		hash, err := CompiledClassHash(&CompiledClass{
+			Bytecode:    compiled.Bytecode,
+			External:    entryPoints("EXTERNAL"),
+			L1Handler:   entryPoints("L1_HANDLER"),
+			Constructor: entryPoints("CONSTRUCTOR"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := hexToFelt("0xf2056a217cc9cabef54d4b1bceea5a3e8625457cb393698ba507259ed6f3c")
+		if !hash.Equal(want) {
+			t.Errorf("wrong hash: got %s, want %s", hash.Text(16), want.Text(16))
+		}
+	})
+
+	t.Run("invalid classes", func(t *testing.T) {
+		longBuiltin := *casm
+		longBuiltin.External = []CompiledEntryPoint{
+			{Selector: hexToFelt("0x1"), Offset: hexToFelt("0x0"), Builtins: []string{"a_builtin_name_too_long_for_a_felt"}},
+		}
+		noSelector := *casm
+		noSelector.L1Handler = []CompiledEntryPoint{{Offset: hexToFelt("0x0")}}
+		nilBytecode := *casm
+		nilBytecode.Bytecode = []*felt.Felt{nil}
+
+		for _, invalid := range []*CompiledClass{&longBuiltin, &noSelector, &nilBytecode, nil} {
+			if _, err := CompiledClassHash(invalid); err == nil {
+				t.Errorf("expected an error")
+			}
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"github.com/NethermindEth/juno/core/felt"
+	"golang.org/x/crypto/sha3"
+)
+
+// L2ToL1MessageHash returns the hash of a message sent from the contract at
+// fromAddr on L2 to the contract at toAddr on L1, as computed by the
+// StarkNet core contract when the message is consumed. It is the Ethereum
+// keccak256 of the big-endian 32 byte encodings of fromAddr, toAddr, the
+// length of payload and every payload element.
+func L2ToL1MessageHash(fromAddr, toAddr *felt.Felt, payload []*felt.Felt) [32]byte {
+	length := new(felt.Felt).SetUint64(uint64(len(payload)))
+	return messageHash(append([]*felt.Felt{fromAddr, toAddr, length}, payload...))
+}
+
+// L1ToL2MessageHash returns the hash of a message sent from the contract at
+// fromAddr on L1 to the entry point selector of the contract at toAddr on
+// L2, as computed by the StarkNet core contract when the message is sent.
+// It is the Ethereum keccak256 of the big-endian 32 byte encodings of
+// fromAddr, toAddr, nonce, selector, the length of payload and every
+// payload element.
+func L1ToL2MessageHash(fromAddr, toAddr, nonce, selector *felt.Felt, payload []*felt.Felt) [32]byte {
+	length := new(felt.Felt).SetUint64(uint64(len(payload)))
+	return messageHash(append([]*felt.Felt{fromAddr, toAddr, nonce, selector, length}, payload...))
+}
+
+// messageHash returns the keccak256 of the concatenated 32 byte encodings
+// of words
+func messageHash(words []*felt.Felt) [32]byte {
+	// the package level hasher is not used, so that hashing is safe for
+	// concurrent use
+	hasher := sha3.NewLegacyKeccak256()
+	for _, word := range words {
+		wordBytes := word.Bytes()
+		// writing to a hash never fails
+		hasher.Write(wordBytes[:])
+	}
+
+	var digest [32]byte
+	hasher.Sum(digest[:0])
+	return digest
+}
@@ -0,0 +1,54 @@
+package crypto
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// The messages are the ones of the StarkGate ETH bridge in mainnet block
+// 16789, see core/testdata/block_16789_main.json. Their expected hashes are
+// the keccak256 of the message encodings used by the StarkNet core
+// contract, computed with go-ethereum rather than with the hasher under
+// test.
+var (
+	l1Bridge, _ = new(felt.Felt).SetString("0xae0ee0a63a2ce6baeeffe56e7714fb4efe48d419")
+	l2Bridge, _ = new(felt.Felt).SetString("0x73314940630fd6dcda0d772d4c972c4e0a9946bef9dabf4ef84eda8ef542b82")
+)
+
+func hexToFelts(t *testing.T, hexes ...string) []*felt.Felt {
+	felts := make([]*felt.Felt, 0, len(hexes))
+	for _, hex := range hexes {
+		f, err := new(felt.Felt).SetString(hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		felts = append(felts, f)
+	}
+	return felts
+}
+
+func TestL2ToL1MessageHash(t *testing.T) {
+	// https://alpha-mainnet.starknet.io/feeder_gateway/get_transaction_receipt?transactionHash=0x11a84993d01a8142aa87beb4f490ce899ddd22144e20f8af1464ce3aaa0eccc
+	payload := hexToFelts(t, "0x0", "0x3f9d6fcfede4267b86680c4d9618b7ae0e252acc", "0x1c6bf526340000", "0x0")
+	want := "e0098df84f43e29245c9810a55adfa7f58d91e468f0f7d88e9ac30c3aa92419e"
+
+	got := fmt.Sprintf("%x", L2ToL1MessageHash(l2Bridge, l1Bridge, payload))
+	if want != got {
+		t.Errorf("expected hash %q but got %q", want, got)
+	}
+}
+
+func TestL1ToL2MessageHash(t *testing.T) {
+	// https://alpha-mainnet.starknet.io/feeder_gateway/get_transaction_receipt?transactionHash=0x2186bb0c25bc56bd4de431cb4d2a8c2f2afe1ca113fa1f0c89a6078fde4b30f
+	nonce, _ := new(felt.Felt).SetString("0x1f039")
+	selector, _ := new(felt.Felt).SetString("0x2d757788a8d8d6f21d1cd40bce38a8222d70654214e96ff95d8086e684fbee5")
+	payload := hexToFelts(t, "0x2fd9fa8166918b2d359f5adb6d79ad5d668ccd59108108ce6ba907b45fe09a9", "0x16dedf44bdd8000", "0x0")
+	want := "2089e8cd22810034a823db24abdc9588ff4a0e2e7e4dc533eabffff9341aa7d4"
+
+	got := fmt.Sprintf("%x", L1ToL2MessageHash(l1Bridge, l2Bridge, nonce, selector, payload))
+	if want != got {
+		t.Errorf("expected hash %q but got %q", want, got)
+	}
+}
@@ -61,6 +61,17 @@ func PedersenArray(elems ...*felt.Felt) *felt.Felt {
 	return Pedersen(d, new(felt.Felt).SetUint64(uint64(len(elems))))
 }
 
+// PedersenArrayWith returns the [PedersenArray] hash of prefix followed by
+// elems, such as a domain separator followed by the elements of a
+// structure, without copying them into a new slice.
+func PedersenArrayWith(prefix *felt.Felt, elems ...*felt.Felt) *felt.Felt {
+	d := Pedersen(&felt.Zero, prefix)
+	for _, e := range elems {
+		d = Pedersen(d, e)
+	}
+	return Pedersen(d, new(felt.Felt).SetUint64(uint64(len(elems)+1)))
+}
+
 // Pedersen implements the [Pedersen hash] based on the [reference implementation].
 //
 // [Pedersen hash]: https://docs.starknet.io/documentation/develop/Hashing/hash-functions/#pedersen_hash
@@ -114,6 +114,18 @@ func TestPedersenArray(t *testing.T) {
 	}
 }
 
+func TestPedersenArrayWith(t *testing.T) {
+	prefix := new(felt.Felt).SetBytes([]byte("deploy"))
+	elems := []*felt.Felt{new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(2), new(felt.Felt).SetUint64(3)}
+
+	for n := 0; n <= len(elems); n++ {
+		want := PedersenArray(append([]*felt.Felt{prefix}, elems[:n]...)...)
+		if got := PedersenArrayWith(prefix, elems[:n]...); !got.Equal(want) {
+			t.Errorf("PedersenArrayWith(%x, %x) = %x, want %x", prefix, elems[:n], got, want)
+		}
+	}
+}
+
 var feltBench *felt.Felt
 
 // go test -bench=. -run=^# -cpu=1,2,4,8,16
@@ -0,0 +1,56 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoseidon(t *testing.T) {
+	want, _ := new(felt.Felt).SetString("0x5d44a3decb2b2e0cc71071f7b802f45dd792d064f0fc7316c46514f70f9891a")
+	got := Poseidon(new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(2))
+	assert.Equal(t, true, want.Equal(got))
+}
+
+func TestPoseidonArray(t *testing.T) {
+	tests := map[string]struct {
+		elems []*felt.Felt
+		want  string
+	}{
+		"empty array": {
+			elems: []*felt.Felt{},
+			want:  "0x2272be0f580fd156823304800919530eaa97430e972d7213ee13f4fbf7a5dbc",
+		},
+		"odd elems": {
+			elems: []*felt.Felt{
+				new(felt.Felt), new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(2),
+			},
+			want: "0x7a01142da8aecae3782ba66fc3285fd02fcd2c55aa868fe50fd95c089068d16",
+		},
+		"even elems": {
+			elems: []*felt.Felt{
+				new(felt.Felt), new(felt.Felt).SetUint64(1),
+				new(felt.Felt).SetUint64(2), new(felt.Felt).SetUint64(3),
+			},
+			want: "0x7b8f30ac298ea12d170c0873f1fa631a18c00756c6e7d1fd273b9a239d0d413",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			want, _ := new(felt.Felt).SetString(test.want)
+			assert.Equal(t, true, want.Equal(PoseidonArray(test.elems...)))
+		})
+	}
+}
+
+func BenchmarkPoseidon(b *testing.B) {
+	x, _ := new(felt.Felt).SetRandom()
+	y, _ := new(felt.Felt).SetRandom()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Poseidon(x, y)
+	}
+}
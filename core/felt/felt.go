@@ -1,8 +1,10 @@
 package felt
 
 import (
+	"encoding/binary"
 	"errors"
 	"math/big"
+	"strings"
 	"sync"
 
 	"github.com/consensys/gnark-crypto/ecc/stark-curve/fp"
@@ -24,8 +26,37 @@ const (
 	Bytes = fp.Bytes // number of bytes needed to represent a Element
 )
 
-// zero felt constant
-var Zero = Felt{}
+// Zero and One are the felts of the common values, shared by every
+// package. They must never be modified, a copy to work on is made with
+// new(felt.Felt).Set(&felt.One).
+var (
+	Zero = Felt{}
+	One  = Felt{val: fp.One()}
+)
+
+// Modulus returns the modulus of the field, the returned value is a copy
+// that can be modified freely.
+func Modulus() *big.Int {
+	return fp.Modulus()
+}
+
+// ErrNotCanonical is returned when parsing a value whose absolute value is
+// not smaller than the field modulus, rather than silently reducing it.
+// Negative values are accepted since they are produced by [Felt.Text] in
+// base 10.
+var ErrNotCanonical = errors.New("value is not a canonical field element")
+
+// modulusWords are the little-endian 64-bit words of the field modulus
+var modulusWords = func() [Limbs]uint64 {
+	var modulusBytes [Bytes]byte
+	Modulus().FillBytes(modulusBytes[:])
+
+	var words [Limbs]uint64
+	for idx := range words {
+		words[idx] = binary.BigEndian.Uint64(modulusBytes[Bytes-8*(idx+1) : Bytes-8*idx])
+	}
+	return words
+}()
 
 var bigIntPool = sync.Pool{
 	New: func() interface{} {
@@ -33,15 +64,15 @@ var bigIntPool = sync.Pool{
 	},
 }
 
-// Impl returns the underlying field element type
+// Impl returns the underlying field element type. Its limbs are in
+// Montgomery form, [Felt.Bytes] gives the canonical value.
 func (z *Felt) Impl() *fp.Element {
 	return &z.val
 }
 
-// UnmarshalJSON accepts numbers and strings as input.
-// See Element.SetString for valid prefixes (0x, 0b, ...).
-// If there is an error, we try to explicitly unmarshal from hex before
-// returning an error. This implementation is taken from [gnark-crypto].
+// UnmarshalJSON accepts numbers and strings as input, strings are parsed
+// like [Felt.SetString] does. This implementation is adapted from
+// [gnark-crypto].
 //
 // [gnark-crypto]: https://github.com/ConsenSys/gnark-crypto/blob/9fd0a7de2044f088a29cfac373da73d868230148/ecc/stark-curve/fp/element.go#L1028-L1056
 func (z *Felt) UnmarshalJSON(data []byte) error {
@@ -60,20 +91,72 @@ func (z *Felt) UnmarshalJSON(data []byte) error {
 
 	// get temporary big int from the pool
 	vv := bigIntPool.Get().(*big.Int)
+	defer bigIntPool.Put(vv)
 
-	if _, ok := vv.SetString(s, 0); !ok {
-		if _, ok := vv.SetString(s, 16); !ok {
-			return errors.New("can't parse into a big.Int: " + s)
-		}
+	if err := parseBigInt(vv, s); err != nil {
+		return err
+	}
+	return z.setCanonicalBigInt(vv)
+}
+
+// parseBigInt sets v to the value of number, detecting its base as
+// described in [Felt.SetString]
+func parseBigInt(v *big.Int, number string) error {
+	negative := strings.HasPrefix(number, "-")
+	digits := strings.TrimPrefix(number, "-")
+
+	base := 16
+	switch {
+	case strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X"):
+		digits = digits[2:]
+	case digits != "" && isDecimal(digits) && (len(digits) == 1 || digits[0] != '0'):
+		base = 10
 	}
 
-	z.val.SetBigInt(vv)
+	if strings.ContainsAny(digits, "+-_") {
+		return errors.New("can't parse into a big.Int: " + number)
+	}
+	if _, ok := v.SetString(digits, base); !ok {
+		return errors.New("can't parse into a big.Int: " + number)
+	}
+	if negative {
+		v.Neg(v)
+	}
+	return nil
+}
 
-	// release object into pool
-	bigIntPool.Put(vv)
+// isDecimal checks whether s only holds decimal digits
+func isDecimal(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// setCanonicalBigInt sets z to v, or returns [ErrNotCanonical] if v is not
+// in the (-modulus, modulus) range
+func (z *Felt) setCanonicalBigInt(v *big.Int) error {
+	if v.CmpAbs(Modulus()) >= 0 {
+		return ErrNotCanonical
+	}
+	z.val.SetBigInt(v)
 	return nil
 }
 
+// IsCanonical checks that the underlying representation of z is smaller
+// than the field modulus. Felts set by this package always are, but ones
+// created from an arbitrary [fp.Element] with [NewFelt] might not be.
+func (z *Felt) IsCanonical() bool {
+	for idx := Limbs - 1; idx >= 0; idx-- {
+		if z.val[idx] != modulusWords[idx] {
+			return z.val[idx] < modulusWords[idx]
+		}
+	}
+	return false
+}
+
 // MarshalJSON forwards the call to underlying field element implementation
 func (z *Felt) MarshalJSON() ([]byte, error) {
 	return z.val.MarshalJSON()
@@ -91,10 +174,26 @@ func (z *Felt) SetBytes(e []byte) *Felt {
 	return z
 }
 
-// SetString forwards the call to underlying field element implementation
+// SetString sets z to the value of number, optionally preceded by a minus
+// sign, whose base is detected as follows:
+//   - numbers with a 0x or 0X prefix are hex
+//   - numbers made of decimal digits without a leading zero are decimal
+//   - other numbers are hex without a prefix, such as the zero padded
+//     hashes sent by the gateway
+//
+// Hex without a prefix that only has decimal digits and no leading zero is
+// hence read as decimal. Unlike the underlying field element
+// implementation, it returns [ErrNotCanonical] rather than reducing values
+// outside of the field.
 func (z *Felt) SetString(number string) (*Felt, error) {
-	_, err := z.val.SetString(number)
-	return z, err
+	// get temporary big int from the pool
+	vv := bigIntPool.Get().(*big.Int)
+	defer bigIntPool.Put(vv)
+
+	if err := parseBigInt(vv, number); err != nil {
+		return z, err
+	}
+	return z, z.setCanonicalBigInt(vv)
 }
 
 // SetUint64 forwards the call to underlying field element implementation
@@ -124,12 +223,13 @@ func (z *Felt) Equal(x *Felt) bool {
 	return z.val.Equal(&x.val)
 }
 
-// Marshal forwards the call to underlying field element implementation
+// Marshal returns the same encoding as [Felt.Bytes], as a slice
 func (z *Felt) Marshal() []byte {
 	return z.val.Marshal()
 }
 
-// Bytes forwards the call to underlying field element implementation
+// Bytes returns the canonical value of the felt as a 32-byte big-endian
+// number, i.e. the most significant byte comes first.
 func (z *Felt) Bytes() [32]byte {
 	return z.val.Bytes()
 }
@@ -165,3 +265,27 @@ func (z *Felt) Add(x, y *Felt) *Felt {
 func (z *Felt) Halve() {
 	z.val.Halve()
 }
+
+// Set forwards the call to underlying field element implementation
+func (z *Felt) Set(x *Felt) *Felt {
+	z.val.Set(&x.val)
+	return z
+}
+
+// Double forwards the call to underlying field element implementation
+func (z *Felt) Double(x *Felt) *Felt {
+	z.val.Double(&x.val)
+	return z
+}
+
+// Sub forwards the call to underlying field element implementation
+func (z *Felt) Sub(x, y *Felt) *Felt {
+	z.val.Sub(&x.val, &y.val)
+	return z
+}
+
+// Mul forwards the call to underlying field element implementation
+func (z *Felt) Mul(x, y *Felt) *Felt {
+	z.val.Mul(&x.val, &y.val)
+	return z
+}
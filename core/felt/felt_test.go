@@ -1,8 +1,10 @@
 package felt
 
 import (
+	"math/big"
 	"testing"
 
+	"github.com/consensys/gnark-crypto/ecc/stark-curve/fp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,3 +16,124 @@ func TestUnmarshalJson(t *testing.T) {
 	assert.NoError(t, without.UnmarshalJSON([]byte("4437ab")))
 	assert.Equal(t, true, without.Equal(&with))
 }
+
+func TestConstants(t *testing.T) {
+	assert.Equal(t, true, Zero.IsZero())
+	assert.Equal(t, true, One.IsOne())
+	assert.Equal(t, true, One.Equal(new(Felt).SetUint64(1)))
+
+	modulus := Modulus()
+	assert.Equal(t, fp.Modulus(), modulus)
+	modulus.SetUint64(37)
+	assert.Equal(t, fp.Modulus(), Modulus())
+
+	// copies of the constants are independent of them
+	two := new(Felt).Set(&One)
+	two.Add(two, &One)
+	assert.Equal(t, true, two.Equal(new(Felt).SetUint64(2)))
+	assert.Equal(t, true, One.IsOne())
+}
+
+func TestSetString(t *testing.T) {
+	tests := map[string]struct {
+		number string
+		want   uint64
+	}{
+		"decimal":            {number: "1234", want: 1234},
+		"zero":               {number: "0", want: 0},
+		"hex":                {number: "0x4d2", want: 1234},
+		"upper case hex":     {number: "0X4D2", want: 1234},
+		"hex without prefix": {number: "4d2", want: 1234},
+		"zero padded hex":    {number: "00000000000000000000000000000000000000000000000000000000000004d2", want: 1234},
+		"zero padded digits": {number: "0010", want: 16},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, err := new(Felt).SetString(test.number)
+			assert.NoError(t, err)
+			assert.Equal(t, true, f.Equal(new(Felt).SetUint64(test.want)))
+
+			var fromJson Felt
+			assert.NoError(t, fromJson.UnmarshalJSON([]byte(`"`+test.number+`"`)))
+			assert.Equal(t, true, f.Equal(&fromJson))
+		})
+	}
+
+	t.Run("overflow", func(t *testing.T) {
+		modulus := Modulus()
+		for _, number := range []string{
+			modulus.String(),
+			"0x" + modulus.Text(16),
+			"0" + modulus.Text(16),
+			"0x" + new(big.Int).Lsh(modulus, 1).Text(16),
+		} {
+			_, err := new(Felt).SetString(number)
+			assert.ErrorIs(t, err, ErrNotCanonical, number)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, number := range []string{"", "0x", "-", "0xg", "12g", "--1", "+1", "0x-1", "1_000"} {
+			_, err := new(Felt).SetString(number)
+			assert.Error(t, err, number)
+			assert.NotErrorIs(t, err, ErrNotCanonical, number)
+		}
+	})
+}
+
+func TestCanonical(t *testing.T) {
+	modulus := Modulus()
+	modulusMinusOne := new(big.Int).Sub(modulus, big.NewInt(1))
+
+	t.Run("modulus - 1", func(t *testing.T) {
+		for _, text := range []string{modulusMinusOne.String(), "0x" + modulusMinusOne.Text(16), "-1"} {
+			f, err := new(Felt).SetString(text)
+			assert.NoError(t, err)
+			assert.Equal(t, true, f.IsCanonical())
+			assert.Equal(t, "0x"+modulusMinusOne.Text(16), "0x"+f.Text(16))
+
+			var fromJson Felt
+			assert.NoError(t, fromJson.UnmarshalJSON([]byte(`"`+text+`"`)))
+			assert.Equal(t, true, f.Equal(&fromJson))
+		}
+	})
+
+	t.Run("modulus", func(t *testing.T) {
+		for _, value := range []*big.Int{modulus, new(big.Int).Add(modulus, big.NewInt(1)), new(big.Int).Neg(modulus)} {
+			_, err := new(Felt).SetString(value.String())
+			assert.ErrorIs(t, err, ErrNotCanonical)
+
+			var fromJson Felt
+			assert.ErrorIs(t, fromJson.UnmarshalJSON([]byte(`"`+value.String()+`"`)), ErrNotCanonical)
+		}
+	})
+
+	t.Run("underlying representation", func(t *testing.T) {
+		assert.Equal(t, true, new(Felt).IsCanonical())
+		for _, f := range []*Felt{new(Felt).SetUint64(1), NewFelt(new(fp.Element).SetBigInt(modulusMinusOne))} {
+			assert.Equal(t, true, f.IsCanonical())
+		}
+
+		// raw words of the modulus itself
+		var atModulus fp.Element
+		for idx := range atModulus {
+			atModulus[idx] = modulusWords[idx]
+		}
+		assert.Equal(t, false, NewFelt(&atModulus).IsCanonical())
+		atModulus[0]--
+		assert.Equal(t, true, NewFelt(&atModulus).IsCanonical())
+	})
+}
+
+func TestBytes(t *testing.T) {
+	f, err := new(Felt).SetString("0x102030405060708090a0b0c0d0e0f")
+	assert.NoError(t, err)
+
+	expected := [32]byte{
+		17: 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+	}
+	assert.Equal(t, expected, f.Bytes())
+	assert.Equal(t, expected[:], f.Marshal())
+	assert.Equal(t, true, f.Equal(new(Felt).SetBytes(expected[:])))
+}
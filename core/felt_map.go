@@ -0,0 +1,41 @@
+package core
+
+import "github.com/NethermindEth/juno/core/felt"
+
+// FeltMap is a map keyed by felts, such as the storage diffs and nonces of
+// a [StateDiff].
+//
+// Felts are passed around as *felt.Felt, but a map keyed by *felt.Felt
+// compares keys by pointer rather than by value: two pointers to equal
+// felts are different keys, and a lookup with a felt parsed anew never
+// finds anything. FeltMap is keyed by felt values and its methods take
+// *felt.Felt, so that keys are not dereferenced by hand. Being a map, it
+// can still be made, indexed and ranged over as one, in random order.
+type FeltMap[V any] map[felt.Felt]V
+
+// Get returns the value of the key equal to f, and whether there is one
+func (m FeltMap[V]) Get(f *felt.Felt) (V, bool) {
+	value, ok := m[*f]
+	return value, ok
+}
+
+// Set sets the value of the key equal to f. It can be called on a nil
+// FeltMap, which is made first.
+func (m *FeltMap[V]) Set(f *felt.Felt, value V) {
+	if *m == nil {
+		*m = make(FeltMap[V])
+	}
+	(*m)[*f] = value
+}
+
+// Keys returns the keys of the map in ascending order, so that iterating
+// over them is deterministic
+func (m FeltMap[V]) Keys() []*felt.Felt {
+	keys := make([]*felt.Felt, 0, len(m))
+	for key := range m {
+		key := key
+		keys = append(keys, &key)
+	}
+	sortFelts(keys)
+	return keys
+}
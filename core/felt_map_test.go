@@ -0,0 +1,45 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeltMap(t *testing.T) {
+	var m FeltMap[string]
+	_, ok := m.Get(new(felt.Felt))
+	assert.Equal(t, false, ok)
+	assert.Equal(t, []*felt.Felt{}, m.Keys())
+
+	// Set makes a nil map
+	m.Set(new(felt.Felt).SetUint64(3), "three")
+	m.Set(new(felt.Felt).SetUint64(1), "one")
+	// equal felts behind different pointers are the same key
+	m.Set(new(felt.Felt).SetUint64(2), "two")
+	m.Set(new(felt.Felt).SetUint64(3), "THREE")
+	assert.Equal(t, 3, len(m))
+
+	value, ok := m.Get(new(felt.Felt).SetUint64(3))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "THREE", value)
+	_, ok = m.Get(new(felt.Felt).SetUint64(4))
+	assert.Equal(t, false, ok)
+
+	keys := m.Keys()
+	assert.Equal(t, 3, len(keys))
+	for idx, key := range keys {
+		assert.Equal(t, true, new(felt.Felt).SetUint64(uint64(idx+1)).Equal(key))
+	}
+
+	// the map does not alias the felts set in it
+	key := new(felt.Felt).SetUint64(5)
+	m.Set(key, "five")
+	key.SetUint64(6)
+	value, ok = m.Get(new(felt.Felt).SetUint64(5))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "five", value)
+	_, ok = m.Get(key)
+	assert.Equal(t, false, ok)
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// FeltSet is a set of felts. Felts are compared by value, so adding two
+// pointers to equal felts adds a single element. The zero value is an
+// empty set ready to use.
+type FeltSet struct {
+	felts map[felt.Felt]struct{}
+}
+
+// NewFeltSet returns a set holding the given felts
+func NewFeltSet(felts ...*felt.Felt) *FeltSet {
+	s := &FeltSet{felts: make(map[felt.Felt]struct{}, len(felts))}
+	s.Add(felts...)
+	return s
+}
+
+// Add adds the given felts to the set
+func (s *FeltSet) Add(felts ...*felt.Felt) {
+	if s.felts == nil {
+		s.felts = make(map[felt.Felt]struct{}, len(felts))
+	}
+	for _, f := range felts {
+		s.felts[*f] = struct{}{}
+	}
+}
+
+// Contains reports whether the set holds a felt equal to f
+func (s *FeltSet) Contains(f *felt.Felt) bool {
+	_, ok := s.felts[*f]
+	return ok
+}
+
+// Len returns the number of felts in the set
+func (s *FeltSet) Len() int {
+	return len(s.felts)
+}
+
+// Slice returns the felts of the set in ascending order
+func (s *FeltSet) Slice() []*felt.Felt {
+	felts := make([]*felt.Felt, 0, len(s.felts))
+	for f := range s.felts {
+		f := f
+		felts = append(felts, &f)
+	}
+	sort.Slice(felts, func(i, j int) bool {
+		return bytes.Compare(felts[i].Marshal(), felts[j].Marshal()) < 0
+	})
+	return felts
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeltSet(t *testing.T) {
+	var empty FeltSet
+	assert.Equal(t, 0, empty.Len())
+	assert.Equal(t, false, empty.Contains(new(felt.Felt)))
+	assert.Equal(t, []*felt.Felt{}, empty.Slice())
+
+	set := NewFeltSet(new(felt.Felt).SetUint64(3), new(felt.Felt).SetUint64(1))
+	// equal felts behind different pointers are the same element
+	set.Add(new(felt.Felt).SetUint64(2), new(felt.Felt).SetUint64(3))
+	assert.Equal(t, 3, set.Len())
+	assert.Equal(t, true, set.Contains(new(felt.Felt).SetUint64(2)))
+	assert.Equal(t, false, set.Contains(new(felt.Felt).SetUint64(4)))
+
+	slice := set.Slice()
+	assert.Equal(t, 3, len(slice))
+	for idx, f := range slice {
+		assert.Equal(t, true, new(felt.Felt).SetUint64(uint64(idx+1)).Equal(f))
+	}
+
+	// the set does not alias the felts added to it
+	added := new(felt.Felt).SetUint64(5)
+	set.Add(added)
+	added.SetUint64(6)
+	assert.Equal(t, true, set.Contains(new(felt.Felt).SetUint64(5)))
+	assert.Equal(t, false, set.Contains(added))
+}
@@ -0,0 +1,163 @@
+package state
+
+import (
+	"context"
+	"errors"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// ErrInvalidMessageSelector is returned by [State.Call] when the class of
+// the contract has no external entry point with the given selector
+var ErrInvalidMessageSelector = errors.New("invalid message selector")
+
+// ErrInvalidCallData is returned by an [Executor] when the calldata does
+// not match the arguments of the called function
+var ErrInvalidCallData = errors.New("invalid call data")
+
+// ErrNoExecutor is returned by [State.Call] when the State has no
+// [Executor], see [State.WithExecutor]
+var ErrNoExecutor = errors.New("no executor")
+
+// Executor runs entry points of contracts, e.g. a Cairo VM. It only reads
+// the State, through the given [StateReader].
+type Executor interface {
+	// Call runs entryPoint of class, the class of the contract at address
+	// contract, with the given calldata and returns its result. Calldata
+	// that does not match the function is reported with
+	// [ErrInvalidCallData].
+	Call(reader StateReader, contract *felt.Felt, class *core.Class, entryPoint core.EntryPoint,
+		calldata []*felt.Felt) ([]*felt.Felt, error)
+}
+
+// StateReader is a read-only view of a [State], only valid during the
+// [Executor.Call] it is given to. Once the context of the call, see
+// [State.CallCtx], is done, its reads fail with the error of the context,
+// which the Executor is expected to return.
+type StateReader interface {
+	// ContractClass returns the class hash of the contract at addr, or
+	// [ErrContractNotFound].
+	ContractClass(addr *felt.Felt) (*felt.Felt, error)
+	// ContractNonce returns the nonce of the contract at addr, or
+	// [ErrContractNotFound].
+	ContractNonce(addr *felt.Felt) (*felt.Felt, error)
+	// ContractStorage returns the value of the given storage slot of the
+	// contract at addr, zero if the slot was never written, or
+	// [ErrContractNotFound].
+	ContractStorage(addr, key *felt.Felt) (*felt.Felt, error)
+	// Class returns the class with the given hash.
+	Class(classHash *felt.Felt) (*core.Class, error)
+}
+
+// WithExecutor sets the [Executor] that runs the calls of [State.Call].
+func (s *State) WithExecutor(executor Executor) *State {
+	s.executor = executor
+	return s
+}
+
+// Call runs the external entry point with the given selector of the
+// contract at address contract, as of the last applied block, with the
+// given calldata and returns its result. The State is not modified. The
+// entry point is run by the [Executor] of the State, [ErrNoExecutor] is
+// returned if it has none. [ErrContractNotFound] and
+// [ErrInvalidMessageSelector] are returned if there is no such contract or
+// entry point.
+func (s *State) Call(contract, selector *felt.Felt, calldata []*felt.Felt) ([]*felt.Felt, error) {
+	return s.CallCtx(context.Background(), contract, selector, calldata)
+}
+
+// CallCtx is [State.Call] with a context: once ctx is done, the reads of
+// the call fail and ctx.Err() is returned, which bounds the time a call
+// can spend reading the State.
+func (s *State) CallCtx(ctx context.Context, contract, selector *felt.Felt, calldata []*felt.Felt) ([]*felt.Felt, error) {
+	var result []*felt.Felt
+	return result, s.db.View(func(txn *badger.Txn) error {
+		reader := &txnReader{ctx: ctx, state: s, txn: txn}
+		classHash, err := reader.ContractClass(contract)
+		if err != nil {
+			return err
+		}
+		class, err := reader.Class(classHash)
+		if err != nil {
+			return err
+		}
+
+		entryPoint, found := externalEntryPoint(class, selector)
+		if !found {
+			return ErrInvalidMessageSelector
+		}
+		if s.executor == nil {
+			return ErrNoExecutor
+		}
+		result, err = s.executor.Call(reader, contract, class, entryPoint, calldata)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			// whatever the executor made of its failed reads
+			return ctxErr
+		}
+		return err
+	})
+}
+
+// externalEntryPoint returns the external entry point of class with the
+// given selector, if any
+func externalEntryPoint(class *core.Class, selector *felt.Felt) (core.EntryPoint, bool) {
+	for _, entryPoint := range class.Externals {
+		if entryPoint.Selector.Equal(selector) {
+			return entryPoint, true
+		}
+	}
+	return core.EntryPoint{}, false
+}
+
+// txnReader is the [StateReader] of a [State] in the given Txn context,
+// whose reads fail once ctx is done
+type txnReader struct {
+	ctx   context.Context
+	state *State
+	txn   *badger.Txn
+}
+
+func (r *txnReader) ContractClass(addr *felt.Felt) (*felt.Felt, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	classHash, err := r.state.getContractClass(addr, r.txn)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrContractNotFound
+	}
+	return classHash, err
+}
+
+func (r *txnReader) ContractNonce(addr *felt.Felt) (*felt.Felt, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.state.getContractNonce(addr, r.txn)
+}
+
+func (r *txnReader) ContractStorage(addr, key *felt.Felt) (*felt.Felt, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := r.state.getContractNonce(addr, r.txn); err != nil {
+		return nil, err
+	}
+	storage, err := r.state.getContractStorage(addr, r.txn)
+	if err != nil {
+		return nil, err
+	}
+	value, err := storage.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return new(felt.Felt), nil
+	}
+	return value, err
+}
+
+func (r *txnReader) Class(classHash *felt.Felt) (*core.Class, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return getClass(classHash, r.txn)
+}
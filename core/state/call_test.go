@@ -0,0 +1,74 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// getterExecutor runs every entry point as a getter of the storage slot
+// given as its only argument
+type getterExecutor struct{}
+
+func (getterExecutor) Call(reader StateReader, contract *felt.Felt, _ *core.Class, _ core.EntryPoint,
+	calldata []*felt.Felt,
+) ([]*felt.Felt, error) {
+	if len(calldata) != 1 {
+		return nil, ErrInvalidCallData
+	}
+	value, err := reader.ContractStorage(contract, calldata[0])
+	if err != nil {
+		return nil, err
+	}
+	return []*felt.Felt{value}, nil
+}
+
+func TestCall(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	update0 := coreStateUpdate(t, mainnetStateUpdate0)
+	assert.NoError(t, state.Update(0, update0))
+
+	contract := update0.StateDiff.DeployedContracts[0]
+	storageDiff := update0.StateDiff.StorageDiffs[*contract.Address][0]
+	selector := new(felt.Felt).SetUint64(37)
+	calldata := []*felt.Felt{storageDiff.Key}
+
+	_, err := state.Call(new(felt.Felt).SetUint64(1), selector, calldata)
+	assert.ErrorIs(t, err, ErrContractNotFound)
+	_, err = state.Call(contract.Address, selector, calldata)
+	assert.ErrorIs(t, err, badger.ErrKeyNotFound)
+
+	assert.NoError(t, state.PutClass(contract.ClassHash, &core.Class{
+		APIVersion: new(felt.Felt),
+		Externals:  []core.EntryPoint{{Selector: selector, Offset: new(felt.Felt)}},
+	}))
+	_, err = state.Call(contract.Address, new(felt.Felt).SetUint64(38), calldata)
+	assert.ErrorIs(t, err, ErrInvalidMessageSelector)
+	_, err = state.Call(contract.Address, selector, calldata)
+	assert.ErrorIs(t, err, ErrNoExecutor)
+
+	state.WithExecutor(getterExecutor{})
+	got, err := state.Call(contract.Address, selector, calldata)
+	assert.NoError(t, err)
+	assert.Equal(t, []*felt.Felt{storageDiff.Value}, got)
+
+	// slots that were never written are zero
+	got, err = state.Call(contract.Address, selector, []*felt.Felt{new(felt.Felt).SetUint64(1)})
+	assert.NoError(t, err)
+	assert.Equal(t, []*felt.Felt{new(felt.Felt)}, got)
+
+	_, err = state.Call(contract.Address, selector, nil)
+	assert.ErrorIs(t, err, ErrInvalidCallData)
+
+	t.Run("done context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := state.CallCtx(ctx, contract.Address, selector, calldata)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,175 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// DivergenceKind tells which value of a [State] a [StateDiffEntry] is about
+type DivergenceKind int
+
+const (
+	// DivergedClassHash is the class hash of a contract
+	DivergedClassHash DivergenceKind = iota
+	// DivergedNonce is the nonce of a contract
+	DivergedNonce
+	// DivergedStorage is a storage slot of a contract
+	DivergedStorage
+	// DivergedDeclaredClass is the leaf of a declared class in the class
+	// trie, which commits to its compiled class hash
+	DivergedDeclaredClass
+)
+
+func (k DivergenceKind) String() string {
+	switch k {
+	case DivergedClassHash:
+		return "class hash"
+	case DivergedNonce:
+		return "nonce"
+	case DivergedStorage:
+		return "storage"
+	case DivergedDeclaredClass:
+		return "declared class"
+	default:
+		return fmt.Sprintf("DivergenceKind(%d)", int(k))
+	}
+}
+
+// StateDiffEntry is a value that differs between two [State]s, see
+// [DiffStates]
+type StateDiffEntry struct {
+	Kind DivergenceKind
+	// Address is the address of the contract, nil for
+	// DivergedDeclaredClass
+	Address *felt.Felt
+	// Key is the storage slot for DivergedStorage and the class hash for
+	// DivergedDeclaredClass, nil otherwise
+	Key *felt.Felt
+	// A and B are the values in each of the [State]s. The class hash and
+	// nonce of a contract that is not deployed are nil, absent storage
+	// slots and classes are zero.
+	A, B *felt.Felt
+}
+
+func (e StateDiffEntry) String() string {
+	text := func(f *felt.Felt) string {
+		if f == nil {
+			return "none"
+		}
+		return "0x" + f.Text(16)
+	}
+
+	switch e.Kind {
+	case DivergedStorage:
+		return fmt.Sprintf("contract %s storage %s: %s != %s", text(e.Address), text(e.Key), text(e.A), text(e.B))
+	case DivergedDeclaredClass:
+		return fmt.Sprintf("declared class %s: %s != %s", text(e.Key), text(e.A), text(e.B))
+	default:
+		return fmt.Sprintf("contract %s %s: %s != %s", text(e.Address), e.Kind, text(e.A), text(e.B))
+	}
+}
+
+// DiffStates returns the values that differ between the [State]s a and b,
+// to find out where the root of a diverges from the root of a reference.
+// Contracts are listed in ascending order of addresses, with their class
+// hash, nonce and storage slots in that order, followed by the declared
+// classes.
+//
+// The contract tries are traversed side by side with [trie.DiffTries],
+// which skips equal subtrees, and only the storage tries of the contracts
+// whose commitment differs are traversed the same way, so the cost grows
+// with the number of differences rather than the size of the [State]s.
+func DiffStates(a, b *State) ([]StateDiffEntry, error) {
+	var entries []StateDiffEntry
+	return entries, a.db.View(func(aTxn *badger.Txn) error {
+		return b.db.View(func(bTxn *badger.Txn) error {
+			aContracts, err := a.getStateStorage(aTxn)
+			if err != nil {
+				return err
+			}
+			bContracts, err := b.getStateStorage(bTxn)
+			if err != nil {
+				return err
+			}
+
+			if err = trie.DiffTries(aContracts, bContracts, func(addr, _, _ *felt.Felt) error {
+				contractEntries, err := diffContracts(addr, a, aTxn, b, bTxn)
+				entries = append(entries, contractEntries...)
+				return err
+			}); err != nil {
+				return err
+			}
+
+			aClasses, err := a.getClassesStorage(aTxn)
+			if err != nil {
+				return err
+			}
+			bClasses, err := b.getClassesStorage(bTxn)
+			if err != nil {
+				return err
+			}
+			return trie.DiffTries(aClasses, bClasses, func(classHash, aLeaf, bLeaf *felt.Felt) error {
+				entries = append(entries, StateDiffEntry{Kind: DivergedDeclaredClass, Key: classHash, A: aLeaf, B: bLeaf})
+				return nil
+			})
+		})
+	})
+}
+
+// diffContracts returns the values that differ between the contracts at
+// addr of the [State]s a and b
+func diffContracts(addr *felt.Felt, a *State, aTxn *badger.Txn, b *State, bTxn *badger.Txn) ([]StateDiffEntry, error) {
+	aClassHash, aNonce, err := a.contractClassAndNonce(addr, aTxn)
+	if err != nil {
+		return nil, err
+	}
+	bClassHash, bNonce, err := b.contractClassAndNonce(addr, bTxn)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []StateDiffEntry
+	differ := func(x, y *felt.Felt) bool {
+		return (x == nil) != (y == nil) || x != nil && !x.Equal(y)
+	}
+	if differ(aClassHash, bClassHash) {
+		entries = append(entries, StateDiffEntry{Kind: DivergedClassHash, Address: addr, A: aClassHash, B: bClassHash})
+	}
+	if differ(aNonce, bNonce) {
+		entries = append(entries, StateDiffEntry{Kind: DivergedNonce, Address: addr, A: aNonce, B: bNonce})
+	}
+
+	aStorage, err := a.getContractStorage(addr, aTxn)
+	if err != nil {
+		return nil, err
+	}
+	bStorage, err := b.getContractStorage(addr, bTxn)
+	if err != nil {
+		return nil, err
+	}
+	return entries, trie.DiffTries(aStorage, bStorage, func(key, aValue, bValue *felt.Felt) error {
+		entries = append(entries, StateDiffEntry{Kind: DivergedStorage, Address: addr, Key: key, A: aValue, B: bValue})
+		return nil
+	})
+}
+
+// contractClassAndNonce returns the class hash and nonce of the contract
+// at addr in the given Txn context, both nil if it is not deployed
+func (s *State) contractClassAndNonce(addr *felt.Felt, txn *badger.Txn) (*felt.Felt, *felt.Felt, error) {
+	nonce, err := s.getContractNonce(addr, txn)
+	if errors.Is(err, ErrContractNotFound) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	classHash, err := s.getContractClass(addr, txn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return classHash, nonce, nil
+}
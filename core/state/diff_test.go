@@ -0,0 +1,84 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffStates(t *testing.T) {
+	newState := func() *State {
+		state := NewState(db.NewTestDb())
+		for idx, updateJson := range [][]byte{mainnetStateUpdate0, mainnetStateUpdate1} {
+			assert.NoError(t, state.Update(uint64(idx), coreStateUpdate(t, updateJson)))
+		}
+		return state
+	}
+	a, b := newState(), newState()
+
+	entries, err := DiffStates(a, b)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// diverge b from a
+	update0 := coreStateUpdate(t, mainnetStateUpdate0)
+	contract := update0.StateDiff.DeployedContracts[0].Address
+	oldValue := update0.StateDiff.StorageDiffs[*contract][0].Value
+	slot := update0.StateDiff.StorageDiffs[*contract][0].Key
+	newSlot := new(felt.Felt).SetUint64(37)
+	deployed := new(felt.Felt).SetUint64(38)
+	classHash := new(felt.Felt).SetUint64(39)
+	compiledClassHash := new(felt.Felt).SetUint64(40)
+
+	root, err := b.Root()
+	assert.NoError(t, err)
+	update := &core.StateUpdate{
+		OldRoot: root,
+		StateDiff: &core.StateDiff{
+			StorageDiffs: map[felt.Felt][]core.StorageDiff{
+				*contract: {
+					{Key: slot, Value: new(felt.Felt).SetUint64(1)},
+					{Key: newSlot, Value: new(felt.Felt).SetUint64(2)},
+				},
+			},
+			Nonces:            map[felt.Felt]*felt.Felt{*contract: new(felt.Felt).SetUint64(3)},
+			DeployedContracts: []core.DeployedContract{{Address: deployed, ClassHash: classHash}},
+			DeclaredV1Classes: []core.DeclaredV1Class{{ClassHash: classHash, CompiledClassHash: compiledClassHash}},
+		},
+	}
+	update.NewRoot, err = b.SimulateUpdate(update)
+	assert.NoError(t, err)
+	assert.NoError(t, b.Update(2, update))
+
+	entries, err = DiffStates(a, b)
+	assert.NoError(t, err)
+
+	// the deployed contract comes first as its address is lower
+	slots := []StateDiffEntry{
+		{Kind: DivergedStorage, Address: contract, Key: slot, A: oldValue, B: new(felt.Felt).SetUint64(1)},
+		{Kind: DivergedStorage, Address: contract, Key: newSlot, A: new(felt.Felt), B: new(felt.Felt).SetUint64(2)},
+	}
+	if slot.Impl().Cmp(newSlot.Impl()) > 0 {
+		slots[0], slots[1] = slots[1], slots[0]
+	}
+	want := append([]StateDiffEntry{
+		{Kind: DivergedClassHash, Address: deployed, B: classHash},
+		{Kind: DivergedNonce, Address: deployed, B: new(felt.Felt)},
+		{Kind: DivergedNonce, Address: contract, A: new(felt.Felt), B: new(felt.Felt).SetUint64(3)},
+	}, slots...)
+	want = append(want, StateDiffEntry{
+		Kind: DivergedDeclaredClass, Key: classHash, A: new(felt.Felt),
+		B: crypto.Poseidon(leafVersion, compiledClassHash),
+	})
+
+	if assert.Equal(t, len(want), len(entries), entries) {
+		for idx := range want {
+			assert.Equal(t, want[idx].String(), entries[idx].String())
+		}
+	}
+	assert.Equal(t, "contract 0x26 class hash: none != 0x27", entries[0].String())
+}
@@ -0,0 +1,55 @@
+package state
+
+import (
+	"context"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// ExpectedRoot returns the state commitment that applying diff to state
+// would result in, which can be compared with the new root of a state
+// update. Unlike [State.SimulateUpdate], it only reads from the database,
+// in a read-only transaction, and keeps every change in memory. This makes
+// it usable on read-only databases and concurrently with updates.
+func ExpectedRoot(state *State, diff *core.StateDiff) (*felt.Felt, error) {
+	overlay := state.withOverlay()
+
+	var root *felt.Felt
+	return root, state.db.View(func(txn *badger.Txn) error {
+		if err := overlay.applyDiff(context.Background(), diff, txn); err != nil {
+			return err
+		}
+
+		var err error
+		root, err = overlay.root(txn)
+		return err
+	})
+}
+
+// txnOverlay holds the writes of a State with an overlay, see
+// [State.withOverlay]
+type txnOverlay struct {
+	// values holds the values written to the Txn, nil for deleted keys
+	values map[string][]byte
+	// tries holds the storages of the tries written to, by the prefix of
+	// their nodes
+	tries map[string]*trie.MemoryOverlay
+}
+
+// withOverlay returns a State over the same database that keeps its
+// writes in memory, on top of the Txn it is given, so that it can apply
+// diffs in read-only Txns. Its tries are backed by [trie.MemoryOverlay]s.
+func (s *State) withOverlay() *State {
+	return &State{
+		db:      s.db,
+		log:     s.log,
+		heights: s.heights,
+		overlay: &txnOverlay{
+			values: make(map[string][]byte),
+			tries:  make(map[string]*trie.MemoryOverlay),
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpectedRoot(t *testing.T) {
+	state := NewState(db.NewTestDb())
+
+	for idx, updateJson := range [][]byte{mainnetStateUpdate0, mainnetStateUpdate1, mainnetStateUpdate2} {
+		update := coreStateUpdate(t, updateJson)
+		oldRoot, err := state.Root()
+		assert.NoError(t, err)
+
+		expected, err := ExpectedRoot(state, update.StateDiff)
+		assert.NoError(t, err)
+		assert.Equal(t, true, update.NewRoot.Equal(expected), idx)
+
+		// state is left untouched
+		root, err := state.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, oldRoot.Equal(root), idx)
+
+		assert.NoError(t, state.Update(uint64(idx), update))
+	}
+
+	t.Run("deploying an existing contract", func(t *testing.T) {
+		update0 := coreStateUpdate(t, mainnetStateUpdate0)
+		_, err := ExpectedRoot(state, update0.StateDiff)
+		assert.ErrorIs(t, err, ErrContractAlreadyDeployed)
+	})
+
+	t.Run("deploying at an invalid address", func(t *testing.T) {
+		_, err := ExpectedRoot(state, &core.StateDiff{
+			DeployedContracts: []core.DeployedContract{{Address: new(felt.Felt), ClassHash: new(felt.Felt).SetUint64(37)}},
+		})
+		assert.ErrorIs(t, err, ErrInvalidContractAddress)
+	})
+
+	t.Run("redeploying a contract with another class", func(t *testing.T) {
+		update0 := coreStateUpdate(t, mainnetStateUpdate0)
+		for idx := range update0.StateDiff.DeployedContracts {
+			update0.StateDiff.DeployedContracts[idx].ClassHash = new(felt.Felt).SetUint64(37)
+		}
+		expected, err := ExpectedRoot(state, update0.StateDiff)
+		assert.NoError(t, err)
+
+		oldRoot, err := state.Root()
+		assert.NoError(t, err)
+		simulated, err := state.SimulateUpdate(&core.StateUpdate{OldRoot: oldRoot, StateDiff: update0.StateDiff})
+		assert.NoError(t, err)
+		assert.Equal(t, true, simulated.Equal(expected))
+	})
+
+	t.Run("declared v1 classes", func(t *testing.T) {
+		classHash, _ := new(felt.Felt).SetString("0xDEADBEEF")
+		compiledClassHash, _ := new(felt.Felt).SetString("0xBEEFDEAD")
+		newRoot, _ := new(felt.Felt).SetString("0x46f1033cfb8e0b2e16e1ad6f95c41fd3a123f168fe72665452b6cddbc1d8e7a")
+
+		expected, err := ExpectedRoot(state, &core.StateDiff{
+			DeclaredContracts: []*felt.Felt{classHash},
+			DeclaredV1Classes: []core.DeclaredV1Class{
+				{ClassHash: classHash, CompiledClassHash: compiledClassHash},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, true, newRoot.Equal(expected))
+	})
+}
+
+func TestExpectedRootReadOnly(t *testing.T) {
+	path := t.TempDir()
+	testDb, err := db.NewDb(path)
+	assert.NoError(t, err)
+	assert.NoError(t, NewState(testDb).Update(0, coreStateUpdate(t, mainnetStateUpdate0)))
+	assert.NoError(t, testDb.Close())
+
+	readOnlyDb, err := db.NewReadOnly(path)
+	assert.NoError(t, err)
+	defer readOnlyDb.Close()
+	state := NewState(readOnlyDb)
+
+	update1 := coreStateUpdate(t, mainnetStateUpdate1)
+	expected, err := ExpectedRoot(state, update1.StateDiff)
+	assert.NoError(t, err)
+	assert.Equal(t, true, update1.NewRoot.Equal(expected))
+
+	root, err := state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, update1.OldRoot.Equal(root))
+}
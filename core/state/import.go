@@ -0,0 +1,209 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/NethermindEth/juno/db"
+	"github.com/bits-and-blooms/bitset"
+	"github.com/dgraph-io/badger/v3"
+)
+
+var (
+	// ErrImportOnPopulatedState is returned by [State.ImportNodes] when
+	// the State already has a contract trie
+	ErrImportOnPopulatedState = errors.New("cannot import nodes into a populated state")
+	// ErrImportInProgress is returned by [State.ImportNodes] when the
+	// nodes of a trie with another root are being imported
+	ErrImportInProgress = errors.New("import of another root in progress")
+)
+
+var (
+	importProgressKey = db.NodeImport.Key([]byte{'p'})
+	importQueuePrefix = []byte{'q'}
+)
+
+// importProgress is how far the import of the contract trie with the given
+// root has gone, see [State.ImportNodes]
+type importProgress struct {
+	Root *felt.Felt `json:"root"`
+	// RootKey is the key of the root node, nil until it is imported
+	RootKey []byte `json:"root_key,omitempty"`
+	// Head and Tail delimit the queue of the keys of the imported internal
+	// nodes whose children are yet to be imported, in breadth-first order
+	Head uint64 `json:"head"`
+	Tail uint64 `json:"tail"`
+	// Pending is the left child that ended the last batch, waiting for
+	// its right sibling
+	Pending []byte `json:"pending,omitempty"`
+}
+
+// ImportNodes imports the contract trie whose commitment is root out of its
+// [trie.Node]s, such as served by a peer, rather than by applying every
+// state update. The nodes are expected in breadth-first order, from the
+// root down and from left to right in every level, and can be split in
+// batches of any size over several calls, which resume where the previous
+// one left off.
+//
+// Siblings are verified against their parent, which has been verified
+// itself, so that every imported node chains to root. A batch that fails
+// verification is discarded as a whole with [trie.ErrInvalidProof] and can
+// be retried. Once the last node is imported, root becomes the root of the
+// State.
+//
+// Only the contract trie is imported, the class hashes, nonces and storage
+// tries of the contracts and the class trie are not. As with proofs, a
+// trie holding a single contract can not be imported.
+func (s *State) ImportNodes(root *felt.Felt, nodes []*trie.Node) error {
+	return s.update(func(txn *badger.Txn) error {
+		if err := s.putTrieHeights(txn); err != nil {
+			return err
+		}
+		progress, err := getImportProgress(txn)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			if _, err = s.rootKey(txn, stateRootKey); err == nil {
+				return ErrImportOnPopulatedState
+			} else if !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+			progress = &importProgress{Root: root}
+		} else if err != nil {
+			return err
+		} else if !progress.Root.Equal(root) {
+			return ErrImportInProgress
+		}
+
+		if progress.Pending != nil {
+			pending := new(trie.Node)
+			if err = pending.UnmarshalBinary(progress.Pending); err != nil {
+				return err
+			}
+			nodes = append([]*trie.Node{pending}, nodes...)
+			progress.Pending = nil
+		}
+		if len(nodes) == 0 {
+			return nil
+		}
+
+		storage := trie.NewTrieBadgerTxn(txn, []byte{byte(db.StateTrie)})
+		if progress.RootKey == nil {
+			rootKey, err := trie.RootNodeKey(root, nodes[0], crypto.Pedersen)
+			if err != nil {
+				return err
+			}
+			if err = storage.Put(rootKey, nodes[0]); err != nil {
+				return err
+			}
+			progress.RootKey = trie.MarshalKey(rootKey)
+			if err = pushImportQueue(txn, progress, rootKey); err != nil {
+				return err
+			}
+			nodes = nodes[1:]
+		}
+
+		for ; len(nodes) >= 2 && progress.Head < progress.Tail; nodes = nodes[2:] {
+			if err = s.importChildren(txn, storage, progress, nodes[0], nodes[1]); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case len(nodes) == 1 && progress.Head < progress.Tail:
+			if progress.Pending, err = nodes[0].MarshalBinary(); err != nil {
+				return err
+			}
+		case len(nodes) > 0:
+			return errors.New("more nodes than the trie has")
+		}
+
+		if progress.Head < progress.Tail {
+			return putImportProgress(txn, progress)
+		}
+		// every node is imported
+		if err = txn.Set(db.State.Key([]byte(stateRootKey)), progress.RootKey); err != nil {
+			return err
+		}
+		return txn.Delete(importProgressKey)
+	})
+}
+
+// importChildren verifies the children of the next node in the queue of
+// the import and puts them in storage, the ones with children are queued
+func (s *State) importChildren(txn *badger.Txn, storage trie.Storage, progress *importProgress,
+	left, right *trie.Node,
+) error {
+	queueKey := importQueueKey(progress.Head)
+	var parentKey *bitset.BitSet
+	item, err := txn.Get(queueKey)
+	if err != nil {
+		return err
+	}
+	if err = item.Value(func(val []byte) error {
+		parentKey, err = trie.UnmarshalKey(val)
+		return err
+	}); err != nil {
+		return err
+	}
+	parent, err := storage.Get(parentKey)
+	if err != nil {
+		return err
+	}
+
+	if err = trie.VerifyChildren(parent, parentKey, left, right, s.heights.Global, crypto.Pedersen); err != nil {
+		return err
+	}
+	for _, child := range []struct {
+		key  *bitset.BitSet
+		node *trie.Node
+	}{{parent.Left(), left}, {parent.Right(), right}} {
+		if err = storage.Put(child.key, child.node); err != nil {
+			return err
+		}
+		if !child.node.IsLeaf() {
+			if err = pushImportQueue(txn, progress, child.key); err != nil {
+				return err
+			}
+		}
+	}
+
+	progress.Head++
+	return txn.Delete(queueKey)
+}
+
+func importQueueKey(idx uint64) []byte {
+	idxBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(idxBytes, idx)
+	return db.NodeImport.Key(importQueuePrefix, idxBytes)
+}
+
+func pushImportQueue(txn *badger.Txn, progress *importProgress, key *bitset.BitSet) error {
+	if err := txn.Set(importQueueKey(progress.Tail), trie.MarshalKey(key)); err != nil {
+		return err
+	}
+	progress.Tail++
+	return nil
+}
+
+func getImportProgress(txn *badger.Txn) (*importProgress, error) {
+	item, err := txn.Get(importProgressKey)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := new(importProgress)
+	return progress, item.Value(func(val []byte) error {
+		return json.Unmarshal(val, progress)
+	})
+}
+
+func putImportProgress(txn *badger.Txn, progress *importProgress) error {
+	progressBytes, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return txn.Set(importProgressKey, progressBytes)
+}
@@ -0,0 +1,141 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/NethermindEth/juno/db"
+	"github.com/bits-and-blooms/bitset"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// contractTrieNodes returns the nodes of the contract trie of the State in
+// breadth-first order
+func contractTrieNodes(t *testing.T, state *State) []*trie.Node {
+	var nodes []*trie.Node
+	assert.NoError(t, state.db.View(func(txn *badger.Txn) error {
+		contracts, err := state.getStateStorage(txn)
+		if err != nil {
+			return err
+		}
+		storage := trie.NewTrieBadgerTxn(txn, []byte{byte(db.StateTrie)})
+
+		queue := []*bitset.BitSet{contracts.RootKey()}
+		for len(queue) > 0 {
+			node, err := storage.Get(queue[0])
+			if err != nil {
+				return err
+			}
+			queue = queue[1:]
+			nodes = append(nodes, node)
+			if !node.IsLeaf() {
+				queue = append(queue, node.Left(), node.Right())
+			}
+		}
+		return nil
+	}))
+	return nodes
+}
+
+func TestImportNodes(t *testing.T) {
+	source := NewState(db.NewTestDb())
+	for idx, updateJson := range [][]byte{mainnetStateUpdate0, mainnetStateUpdate1, mainnetStateUpdate2} {
+		assert.NoError(t, source.Update(uint64(idx), coreStateUpdate(t, updateJson)))
+	}
+	root, err := source.Root()
+	assert.NoError(t, err)
+	nodes := contractTrieNodes(t, source)
+
+	assertImported := func(t *testing.T, state *State) {
+		got, err := state.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, root.Equal(got))
+
+		// every contract is reachable
+		want := make(map[felt.Felt]felt.Felt)
+		assert.NoError(t, source.db.View(func(txn *badger.Txn) error {
+			contracts, err := source.getStateStorage(txn)
+			if err != nil {
+				return err
+			}
+			return contracts.Iterate(func(key, value *felt.Felt) (bool, error) {
+				want[*key] = *value
+				return true, nil
+			})
+		}))
+		assert.NoError(t, state.db.View(func(txn *badger.Txn) error {
+			contracts, err := state.getStateStorage(txn)
+			if err != nil {
+				return err
+			}
+			for key, value := range want {
+				key := key
+				got, err := contracts.Get(&key)
+				if err != nil {
+					return err
+				}
+				assert.Equal(t, true, value.Equal(got))
+			}
+			return nil
+		}))
+	}
+
+	t.Run("single batch", func(t *testing.T) {
+		state := NewState(db.NewTestDb())
+		assert.NoError(t, state.ImportNodes(root, nodes))
+		assertImported(t, state)
+
+		assert.ErrorIs(t, state.ImportNodes(root, nodes), ErrImportOnPopulatedState)
+	})
+
+	t.Run("batches of any size", func(t *testing.T) {
+		for _, size := range []int{1, 2, 3} {
+			state := NewState(db.NewTestDb())
+			for start := 0; start < len(nodes); start += size {
+				// nothing is exposed until the trie is complete
+				got, err := state.Root()
+				assert.NoError(t, err)
+				assert.Equal(t, true, got.IsZero())
+
+				end := start + size
+				if end > len(nodes) {
+					end = len(nodes)
+				}
+				assert.NoError(t, state.ImportNodes(root, nodes[start:end]), size)
+			}
+			assertImported(t, state)
+		}
+	})
+
+	t.Run("invalid batches are discarded", func(t *testing.T) {
+		state := NewState(db.NewTestDb())
+		assert.NoError(t, state.ImportNodes(root, nodes[:3]))
+
+		// siblings swapped
+		swapped := []*trie.Node{nodes[4], nodes[3]}
+		var invalid trie.ErrInvalidProof
+		assert.ErrorAs(t, state.ImportNodes(root, swapped), &invalid)
+
+		// a leaf of another trie
+		other := NewState(db.NewTestDb())
+		assert.NoError(t, other.Update(0, coreStateUpdate(t, mainnetStateUpdate0)))
+		otherNodes := contractTrieNodes(t, other)
+		assert.ErrorAs(t, state.ImportNodes(root, otherNodes[1:3]), &invalid)
+
+		assert.ErrorIs(t, state.ImportNodes(new(felt.Felt).SetUint64(1), nodes[3:]), ErrImportInProgress)
+
+		// the import resumes after the last valid batch
+		assert.Error(t, state.ImportNodes(root, append(nodes[3:], nodes[0])))
+		assert.NoError(t, state.ImportNodes(root, nodes[3:]))
+		assertImported(t, state)
+	})
+
+	t.Run("root mismatch", func(t *testing.T) {
+		state := NewState(db.NewTestDb())
+		var invalid trie.ErrInvalidProof
+		assert.ErrorAs(t, state.ImportNodes(new(felt.Felt).SetUint64(1), nodes), &invalid)
+		assert.NoError(t, state.ImportNodes(root, nodes))
+	})
+}
@@ -0,0 +1,77 @@
+package state
+
+import (
+	"github.com/NethermindEth/juno/core"
+)
+
+// Pending is the block the sequencer is building on top of the latest
+// block, along with its state update. Its content may change until the
+// block is sealed.
+type Pending struct {
+	Block       *core.Block
+	StateUpdate *core.StateUpdate
+}
+
+// SetPending replaces the pending block of the State, nil clears it. The
+// pending block is kept in memory only and is not applied to the State.
+func (s *State) SetPending(pending *Pending) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	s.pendingBlock = pending
+}
+
+// SetPendingOnTop sets pending as the pending block of the State if it is
+// built on top of the State, that is if its old root is the root of the
+// State, and clears the pending block otherwise. It returns whether
+// pending is set. The root is read while holding the pending block, so
+// that a pending block set concurrently with an update is never left on
+// top of an older root once the update is followed by
+// [State.ClearStalePending].
+func (s *State) SetPendingOnTop(pending *Pending) (bool, error) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	onTop, err := s.isOnTop(pending)
+	if err != nil {
+		return false, err
+	}
+	if !onTop {
+		pending = nil
+	}
+	s.pendingBlock = pending
+	return onTop, nil
+}
+
+// ClearStalePending clears the pending block of the State unless it is
+// built on top of the State, such as after the block it was built on top
+// of has been followed by another, see [State.SetPendingOnTop].
+func (s *State) ClearStalePending() error {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if s.pendingBlock == nil {
+		return nil
+	}
+	onTop, err := s.isOnTop(s.pendingBlock)
+	if err == nil && !onTop {
+		s.pendingBlock = nil
+	}
+	return err
+}
+
+// isOnTop returns whether pending is built on top of the State
+func (s *State) isOnTop(pending *Pending) (bool, error) {
+	root, err := s.Root()
+	if err != nil {
+		return false, err
+	}
+	return pending.StateUpdate.OldRoot.Equal(root), nil
+}
+
+// Pending returns the pending block set by [State.SetPending], or nil if
+// there is none.
+func (s *State) Pending() *Pending {
+	s.pendingMu.RLock()
+	defer s.pendingMu.RUnlock()
+	return s.pendingBlock
+}
@@ -0,0 +1,47 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetPendingOnTop(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	update0 := coreStateUpdate(t, mainnetStateUpdate0)
+	update1 := coreStateUpdate(t, mainnetStateUpdate1)
+	pending0 := &Pending{Block: new(core.Block), StateUpdate: update0}
+	pending1 := &Pending{Block: new(core.Block), StateUpdate: update1}
+
+	set, err := state.SetPendingOnTop(pending1)
+	assert.NoError(t, err)
+	assert.Equal(t, false, set)
+	assert.Nil(t, state.Pending())
+
+	set, err = state.SetPendingOnTop(pending0)
+	assert.NoError(t, err)
+	assert.Equal(t, true, set)
+	assert.Equal(t, pending0, state.Pending())
+
+	// a pending block that is not on top clears the one that is
+	set, err = state.SetPendingOnTop(pending1)
+	assert.NoError(t, err)
+	assert.Equal(t, false, set)
+	assert.Nil(t, state.Pending())
+
+	t.Run("stale pending block", func(t *testing.T) {
+		state.SetPending(pending0)
+		assert.NoError(t, state.ClearStalePending())
+		assert.Equal(t, pending0, state.Pending())
+
+		assert.NoError(t, state.Update(0, update0))
+		assert.NoError(t, state.ClearStalePending())
+		assert.Nil(t, state.Pending())
+
+		state.SetPending(pending1)
+		assert.NoError(t, state.ClearStalePending())
+		assert.Equal(t, pending1, state.Pending())
+	})
+}
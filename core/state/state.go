@@ -1,25 +1,94 @@
 package state
 
 import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/NethermindEth/juno/core"
 	"github.com/NethermindEth/juno/core/crypto"
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/juno/core/trie"
 	"github.com/NethermindEth/juno/db"
+	"github.com/NethermindEth/juno/utils"
 	"github.com/bits-and-blooms/bitset"
 	"github.com/dgraph-io/badger/v3"
 )
 
 const (
-	stateTrieHeight           = 251
+	// globalTrieHeight and contractStorageTrieHeight are the default
+	// [TrieHeights] of a State
+	globalTrieHeight          = 251
 	contractStorageTrieHeight = 251
 	// fields of state metadata table
-	stateRootKey = "rootKey"
+	stateRootKey   = "rootKey"
+	classesRootKey = "classesRootKey"
+	heightKey      = "height"
+	trieHeightsKey = "trieHeights"
 )
 
+var (
+	stateVersion = new(felt.Felt).SetBytes([]byte("STARKNET_STATE_V0"))
+	leafVersion  = new(felt.Felt).SetBytes([]byte("CONTRACT_CLASS_LEAF_V0"))
+	// classTrieVersion is the first protocol version whose state
+	// commitment commits to the class trie
+	classTrieVersion = [3]uint64{0, 11, 0}
+)
+
+// ErrNotSynced is returned by [State.Height] when no block has been
+// applied to the State
+var ErrNotSynced = errors.New("no block applied")
+
+// ErrHistoricalStateUnavailable is returned when the State is requested as
+// of a block before the last applied one, which is not kept
+var ErrHistoricalStateUnavailable = errors.New("historical state unavailable")
+
+// ErrTrieHeightsMismatch is returned when a State is opened with
+// [TrieHeights] that differ from the ones its database was written with
+var ErrTrieHeightsMismatch = errors.New("trie heights mismatch")
+
+// ErrContractNotFound is returned when a contract is not deployed in the State
+var ErrContractNotFound = errors.New("contract not found")
+
+// ErrContractAlreadyDeployed is returned when a contract is deployed at an
+// address that already has one of the same class, such as when an update
+// is applied again
+var ErrContractAlreadyDeployed = errors.New("contract already deployed")
+
+// ErrInvalidContractAddress is returned when a contract is deployed at an
+// address outside of the range of contract addresses, see
+// [core.IsValidContractAddress]
+var ErrInvalidContractAddress = errors.New("invalid contract address")
+
+// ErrGenesisOnPopulatedState is returned when a genesis update, one with a
+// zero old root, is applied to a State that already holds contracts or
+// classes
+var ErrGenesisOnPopulatedState = errors.New("genesis update applied to a populated state")
+
+// ErrStorageLimitExceeded is returned by [State.ContractStorage] when the
+// storage of the contract has more slots than the storage limit of the
+// State, see [State.WithStorageLimit]
+var ErrStorageLimitExceeded = errors.New("storage limit exceeded")
+
+// ErrContractsNotFound lists the addresses of a batch lookup that have no
+// contract deployed, it matches [ErrContractNotFound] with [errors.Is].
+type ErrContractsNotFound struct {
+	Addresses []*felt.Felt
+}
+
+func (e *ErrContractsNotFound) Error() string {
+	return fmt.Sprintf("%d of the contracts not found", len(e.Addresses))
+}
+
+func (e *ErrContractsNotFound) Unwrap() error {
+	return ErrContractNotFound
+}
+
 type ErrMismatchedRoot struct {
 	Want  *felt.Felt
 	Got   *felt.Felt
@@ -35,16 +104,262 @@ func (e *ErrMismatchedRoot) Error() string {
 }
 
 type State struct {
-	db *badger.DB
+	db       *badger.DB
+	log      utils.Logger
+	heights  TrieHeights
+	executor Executor
+	// storageLimit is the maximum number of storage slots returned at
+	// once, 0 for no limit
+	storageLimit int
+
+	// deferred is set when updates are accumulated in pending until
+	// Commit, instead of being applied one by one. pendingBlocks keeps
+	// the updates of the individual blocks, which are persisted on
+	// Commit.
+	deferred      bool
+	pending       *core.StateUpdate
+	pendingBlocks []numberedUpdate
+
+	// pendingBlock is the block the sequencer is building, see
+	// [State.SetPending]. Unlike the other fields, it is accessed
+	// concurrently.
+	pendingMu    sync.RWMutex
+	pendingBlock *Pending
+
+	// overlay keeps the writes of the State in memory instead of in the
+	// Txn it is given, see [ExpectedRoot]
+	overlay *txnOverlay
+}
+
+// TrieHeights are the heights of the tries of a [State]
+type TrieHeights struct {
+	// Global is the height of the contract and class tries
+	Global uint
+	// ContractStorage is the height of the storage tries of the contracts
+	ContractStorage uint
+}
+
+// trieKind tells which of the [TrieHeights] a trie of the State has
+type trieKind int
+
+const (
+	globalTrie trieKind = iota
+	contractStorageTrie
+)
+
+// numberedUpdate is a state update along with the number of its block
+type numberedUpdate struct {
+	blockNumber uint64
+	update      *core.StateUpdate
 }
 
 func NewState(db *badger.DB) *State {
 	state := &State{
-		db: db,
+		db:  db,
+		log: utils.NopLogger{},
+		heights: TrieHeights{
+			Global:          globalTrieHeight,
+			ContractStorage: contractStorageTrieHeight,
+		},
 	}
 	return state
 }
 
+// WithTrieHeights sets the heights of the tries of the State, which are
+// 251 by default. Lower tries are meant for tests that need full tries or
+// keys close to the largest key quickly; a database must always be opened
+// with the heights it was written with. The heights are recorded on the
+// first write, opening the tries of a database written with other heights
+// fails with [ErrTrieHeightsMismatch].
+func (s *State) WithTrieHeights(heights TrieHeights) *State {
+	s.heights = heights
+	return s
+}
+
+// checkTrieHeights returns [ErrTrieHeightsMismatch] if the database was
+// written with other [TrieHeights] than the ones of the State, in the given
+// Txn context. A database that has not been written to yet matches any
+// heights.
+func (s *State) checkTrieHeights(txn *badger.Txn) error {
+	var stored TrieHeights
+	err := s.txnGet(txn, db.State.Key([]byte(trieHeightsKey)), func(val []byte) error {
+		if len(val) != 16 {
+			return fmt.Errorf("invalid trie heights record of %d bytes", len(val))
+		}
+		stored.Global = uint(binary.BigEndian.Uint64(val))
+		stored.ContractStorage = uint(binary.BigEndian.Uint64(val[8:]))
+		return nil
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if stored != s.heights {
+		return fmt.Errorf("%w: opened with heights %d and %d, written with %d and %d", ErrTrieHeightsMismatch,
+			s.heights.Global, s.heights.ContractStorage, stored.Global, stored.ContractStorage)
+	}
+	return nil
+}
+
+// putTrieHeights records the [TrieHeights] of the State in the given Txn
+// context, or checks them against the recorded ones, see
+// [State.checkTrieHeights].
+func (s *State) putTrieHeights(txn *badger.Txn) error {
+	key := db.State.Key([]byte(trieHeightsKey))
+	if err := s.txnGet(txn, key, nil); err == nil {
+		return s.checkTrieHeights(txn)
+	} else if !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+
+	heightsBytes := make([]byte, 16)
+	binary.BigEndian.PutUint64(heightsBytes, uint64(s.heights.Global))
+	binary.BigEndian.PutUint64(heightsBytes[8:], uint64(s.heights.ContractStorage))
+	return s.txnSet(txn, key, heightsBytes)
+}
+
+// newTrie creates a trie of the State over storage, all the tries of the
+// State are created through it so that they have the configured
+// [TrieHeights]
+func (s *State) newTrie(kind trieKind, storage trie.Storage, rootKey *bitset.BitSet,
+	hash trie.HashFunc,
+) *trie.Trie {
+	height := s.heights.Global
+	if kind == contractStorageTrie {
+		height = s.heights.ContractStorage
+	}
+	return trie.NewTrieWithHash(storage, height, rootKey, hash)
+}
+
+// WithStorageLimit sets the maximum number of storage slots
+// [State.ContractStorage] and [State.ContractStoragePage] return at once,
+// so that dumping a large storage cannot exhaust the memory of the node.
+// There is no limit by default, or if limit is not positive.
+func (s *State) WithStorageLimit(limit int) *State {
+	s.storageLimit = limit
+	return s
+}
+
+// WithLogger sets the [utils.Logger] the State reports applied updates
+// and root mismatches to.
+func (s *State) WithLogger(log utils.Logger) *State {
+	s.log = log
+	return s
+}
+
+// update runs fn in a read-write Txn, or fails with [db.ErrReadOnly] if
+// the database is read-only. The storage of the contracts replaced by fn
+// is deleted once it is committed, see [State.deleteStaleStorage].
+func (s *State) update(fn func(txn *badger.Txn) error) error {
+	if s.db.Opts().ReadOnly {
+		return db.ErrReadOnly
+	}
+	if err := s.db.Update(fn); err != nil {
+		return err
+	}
+	if err := s.deleteStaleStorage(); err != nil {
+		// the update is applied, the storage is deleted after the next one
+		s.log.Warn("Failed to delete the storage of replaced contracts", "err", err)
+	}
+	return nil
+}
+
+// txnGet calls fn, if not nil, with the value of key in the given Txn
+// context, or returns [badger.ErrKeyNotFound] if there is none. Like
+// [State.txnSet], [State.txnDelete] and [State.trieStorage], it goes
+// through the overlay of the State, if any.
+func (s *State) txnGet(txn *badger.Txn, key []byte, fn func(val []byte) error) error {
+	if s.overlay != nil {
+		if value, ok := s.overlay.values[string(key)]; ok {
+			if value == nil {
+				return badger.ErrKeyNotFound
+			} else if fn == nil {
+				return nil
+			}
+			return fn(value)
+		}
+	}
+
+	item, err := txn.Get(key)
+	if err != nil || fn == nil {
+		return err
+	}
+	return item.Value(fn)
+}
+
+// txnSet sets the value of key in the given Txn context
+func (s *State) txnSet(txn *badger.Txn, key, value []byte) error {
+	if s.overlay != nil {
+		// never nil, which marks deleted keys
+		s.overlay.values[string(key)] = append([]byte{}, value...)
+		return nil
+	}
+	return txn.Set(key, value)
+}
+
+// txnDelete deletes key in the given Txn context
+func (s *State) txnDelete(txn *badger.Txn, key []byte) error {
+	if s.overlay != nil {
+		s.overlay.values[string(key)] = nil
+		return nil
+	}
+	return txn.Delete(key)
+}
+
+// trieStorage returns the storage of the trie whose nodes are stored
+// under prefix in the given Txn context
+func (s *State) trieStorage(txn *badger.Txn, prefix []byte) trie.Storage {
+	storage := trie.NewTrieBadgerTxn(txn, prefix)
+	if s.overlay == nil {
+		return storage
+	}
+
+	// the changes to a trie are kept across the tries created over it
+	overlay, ok := s.overlay.tries[string(prefix)]
+	if !ok {
+		overlay = trie.NewMemoryOverlay(storage)
+		s.overlay.tries[string(prefix)] = overlay
+	}
+	return overlay
+}
+
+// deleteStaleStorage deletes the storage nodes of the contracts replaced
+// by committed updates, see [State.replaceContract]. Nodes are deleted in
+// chunks with [db.DeletePrefix], since the storage of a contract can
+// exceed the size limits of a transaction. Their prefixes are only
+// forgotten once all of them are deleted, so that an interrupted deletion
+// is resumed.
+func (s *State) deleteStaleStorage() error {
+	var prefixes [][]byte
+	if err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = db.StaleStorage.Key()
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			prefixes = append(prefixes, it.Item().KeyCopy(nil)[len(opts.Prefix):])
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, prefix := range prefixes {
+		if err := db.DeletePrefix(s.db, prefix); err != nil {
+			return err
+		}
+		if err := s.db.Update(func(txn *badger.Txn) error {
+			return txn.Delete(db.StaleStorage.Key(prefix))
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func CalculateContractCommitment(storageRoot, classHash, nonce *felt.Felt) *felt.Felt {
 	commitment := crypto.Pedersen(classHash, storageRoot)
 	commitment = crypto.Pedersen(commitment, nonce)
@@ -55,26 +370,120 @@ func CalculateContractCommitment(storageRoot, classHash, nonce *felt.Felt) *felt
 // stores the relation between contract address and class hash to be
 // queried later on with [GetContractClass].
 func (s *State) putNewContract(addr, classHash *felt.Felt, txn *badger.Txn) error {
+	if err := s.registerContract(addr, classHash, txn); err != nil {
+		return err
+	}
+
+	commitment := CalculateContractCommitment(&felt.Zero, classHash, &felt.Zero)
+	if state, err := s.getStateStorage(txn); err != nil {
+		return err
+	} else if err = state.Put(addr, commitment); err != nil {
+		return err
+	} else {
+		return s.putStateStorage(state, txn)
+	}
+}
+
+// registerContract stores the class hash and the zero nonce of a newly
+// deployed contract in the given Txn context, without committing to the
+// contract in the state trie.
+func (s *State) registerContract(addr, classHash *felt.Felt, txn *badger.Txn) error {
+	if !core.IsValidContractAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrInvalidContractAddress, addr)
+	}
+
 	addrBytes := addr.Marshal()
 	classHashKey := db.ContractClassHash.Key(addrBytes)
-	nonceKey := db.ContractNonce.Key(addrBytes)
-	if _, err := txn.Get(classHashKey); err == nil {
-		// Should not happen.
-		return errors.New("existing contract")
-	} else if err = txn.Set(classHashKey, classHash.Marshal()); err != nil {
+	if err := s.txnGet(txn, classHashKey, nil); err == nil {
+		// a deployment applied again, see [State.replaceContract]
+		return ErrContractAlreadyDeployed
+	} else if !errors.Is(err, badger.ErrKeyNotFound) {
 		return err
-	} else if err = txn.Set(nonceKey, felt.Zero.Marshal()); err != nil {
+	} else if err = s.txnSet(txn, classHashKey, classHash.Marshal()); err != nil {
 		return err
-	} else {
-		commitment := CalculateContractCommitment(&felt.Zero, classHash, &felt.Zero)
-		if state, err := s.getStateStorage(txn); err != nil {
+	}
+	return s.txnSet(txn, db.ContractNonce.Key(addrBytes), felt.Zero.Marshal())
+}
+
+// replaceContract prepares the deployment of a contract of the given
+// class at addr in the given Txn context. A contract of another class
+// deployed there is replaced: it is deleted, and its storage is moved to
+// a new generation, so that the new contract starts with an empty one.
+// The nodes of the previous generation are deleted once the Txn is
+// committed, see [State.deleteStaleStorage], rather than in the Txn, which
+// they could outgrow. A contract of the same class is left as it is, so
+// that deploying it fails with [ErrContractAlreadyDeployed]. The
+// commitment of the contract in the state trie is not updated.
+func (s *State) replaceContract(addr, classHash *felt.Felt, txn *badger.Txn) error {
+	if oldClassHash, err := s.replacedClass(addr, classHash, txn); err != nil || oldClassHash == nil {
+		return err
+	}
+
+	generation, err := s.storageGeneration(addr, txn)
+	if err != nil {
+		return err
+	}
+	if err = s.txnSet(txn, db.StaleStorage.Key(storageNodesPrefix(addr, generation)), nil); err != nil {
+		return err
+	}
+	generationBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(generationBytes, generation+1)
+	if err = s.txnSet(txn, db.StorageGeneration.Key(addr.Marshal()), generationBytes); err != nil {
+		return err
+	}
+
+	addrBytes := addr.Marshal()
+	for _, key := range [][]byte{
+		db.ContractClassHash.Key(addrBytes),
+		db.ContractNonce.Key(addrBytes),
+		db.ContractRootKey.Key(addrBytes),
+	} {
+		if err = s.txnDelete(txn, key); err != nil {
 			return err
-		} else if err = state.Put(addr, commitment); err != nil {
+		}
+	}
+	return nil
+}
+
+// replacedClass returns the class hash of the contract at addr in the
+// given Txn context if deploying a contract of the given class replaces
+// it, see [State.replaceContract], nil if there is no contract at addr.
+// [ErrContractAlreadyDeployed] is returned if the contract at addr has the
+// same class.
+func (s *State) replacedClass(addr, classHash *felt.Felt, txn *badger.Txn) (*felt.Felt, error) {
+	oldClassHash, _, err := s.contractClassAndNonce(addr, txn)
+	if err != nil || oldClassHash == nil {
+		return nil, err
+	}
+	if oldClassHash.Equal(classHash) {
+		return nil, ErrContractAlreadyDeployed
+	}
+	return oldClassHash, nil
+}
+
+// removeContract removes the contract at the given address from the
+// state in the given Txn context. Its storage is expected to have been
+// cleared already, as reverse diffs do.
+func (s *State) removeContract(addr *felt.Felt, txn *badger.Txn) error {
+	addrBytes := addr.Marshal()
+	for _, key := range [][]byte{
+		db.ContractClassHash.Key(addrBytes),
+		db.ContractNonce.Key(addrBytes),
+		db.ContractRootKey.Key(addrBytes),
+	} {
+		if err := s.txnDelete(txn, key); err != nil {
 			return err
-		} else {
-			return s.putStateStorage(state, txn)
 		}
 	}
+
+	state, err := s.getStateStorage(txn)
+	if err != nil {
+		return err
+	}
+	if err = state.Put(addr, new(felt.Felt)); err != nil {
+		return err
+	}
+	return s.putStateStorage(state, txn)
 }
 
 // GetContractClass returns class hash of a contract at a given address.
@@ -94,17 +503,14 @@ func (s *State) getContractClass(addr *felt.Felt, txn *badger.Txn) (*felt.Felt,
 	var classHash *felt.Felt
 
 	key := db.ContractClassHash.Key(addr.Marshal())
-	item, err := txn.Get(key)
-	if err != nil {
-		return nil, err
-	}
-	return classHash, item.Value(func(val []byte) error {
+	return classHash, s.txnGet(txn, key, func(val []byte) error {
 		classHash = new(felt.Felt).SetBytes(val)
 		return nil
 	})
 }
 
-// GetContractNonce returns nonce of a contract at a given address.
+// GetContractNonce returns nonce of a contract at a given address. If
+// there is no contract at the address, [ErrContractNotFound] is returned.
 func (s *State) GetContractNonce(addr *felt.Felt) (*felt.Felt, error) {
 	var nonce *felt.Felt
 
@@ -121,252 +527,1169 @@ func (s *State) getContractNonce(addr *felt.Felt, txn *badger.Txn) (*felt.Felt,
 	var nonce *felt.Felt
 
 	key := db.ContractNonce.Key(addr.Marshal())
-	item, err := txn.Get(key)
-	if err != nil {
-		return nil, err
-	}
-	return nonce, item.Value(func(val []byte) error {
+	err := s.txnGet(txn, key, func(val []byte) error {
 		nonce = new(felt.Felt).SetBytes(val)
 		return nil
 	})
-}
-
-// Root returns the state commitment.
-func (s *State) Root() (*felt.Felt, error) {
-	var root *felt.Felt
-	return root, s.db.View(func(txn *badger.Txn) error {
-		read, err := s.root(txn)
-
-		root = read
-		return err
-	})
-}
-
-// root returns the state commitment in the given Txn context.
-func (s *State) root(txn *badger.Txn) (*felt.Felt, error) {
-	storage, err := s.getStateStorage(txn)
-	if err != nil {
-		return nil, err
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrContractNotFound
 	}
-	return storage.Root()
+	return nonce, err
 }
 
-// getStateStorage returns a [core.Trie] that represents the StarkNet
-// global state in the given Txn context
-func (s *State) getStateStorage(txn *badger.Txn) (*trie.Trie, error) {
-	tTxn := trie.NewTrieBadgerTxn(txn, []byte{byte(db.StateTrie)})
-
-	rootKey, err := s.rootKey(txn)
-	if err != nil {
-		rootKey = nil
-	}
+// GetContractClasses returns class hashes of the contracts at the given
+// addresses, reading all of them in a single Txn. Entries of addresses
+// without a contract are nil and [ErrContractsNotFound] lists them.
+func (s *State) GetContractClasses(addrs []*felt.Felt) ([]*felt.Felt, error) {
+	return s.getContractsField(addrs, s.getContractClass)
+}
 
-	return trie.NewTrie(tTxn, stateTrieHeight, rootKey), nil
+// GetContractNonces returns nonces of the contracts at the given
+// addresses, reading all of them in a single Txn. Entries of addresses
+// without a contract are nil and [ErrContractsNotFound] lists them.
+func (s *State) GetContractNonces(addrs []*felt.Felt) ([]*felt.Felt, error) {
+	return s.getContractsField(addrs, s.getContractNonce)
 }
 
-// rootKey returns key to the root node in the given Txn context.
-func (s *State) rootKey(txn *badger.Txn) (*bitset.BitSet, error) {
-	key := new(bitset.BitSet)
+// getContractsField reads a field of the contracts at the given addresses
+// using the given getter in a single Txn.
+func (s *State) getContractsField(addrs []*felt.Felt,
+	get func(*felt.Felt, *badger.Txn) (*felt.Felt, error),
+) ([]*felt.Felt, error) {
+	values := make([]*felt.Felt, len(addrs))
+	var notFound []*felt.Felt
 
-	item, err := txn.Get(db.State.Key([]byte(stateRootKey)))
-	if err != nil {
+	if err := s.db.View(func(txn *badger.Txn) error {
+		for idx, addr := range addrs {
+			value, err := get(addr, txn)
+			if errors.Is(err, badger.ErrKeyNotFound) || errors.Is(err, ErrContractNotFound) {
+				notFound = append(notFound, addr)
+				continue
+			} else if err != nil {
+				return err
+			}
+			values[idx] = value
+		}
+		return nil
+	}); err != nil {
 		return nil, err
 	}
 
-	return key, item.Value(func(val []byte) error {
-		return key.UnmarshalBinary(val)
-	})
-}
-
-// putStateStorage updates the fields related to the state trie root in
-// the given Txn context.
-func (s *State) putStateStorage(state *trie.Trie, txn *badger.Txn) error {
-	rootKeyDbKey := db.State.Key([]byte(stateRootKey))
-	if rootKey := state.RootKey(); rootKey != nil {
-		if rootKeyBytes, err := rootKey.MarshalBinary(); err != nil {
-			return err
-		} else if err = txn.Set(rootKeyDbKey, rootKeyBytes); err != nil {
-			return err
-		}
-	} else if err := txn.Delete(rootKeyDbKey); err != nil {
-		return err
+	if len(notFound) > 0 {
+		return values, &ErrContractsNotFound{Addresses: notFound}
 	}
-
-	return nil
+	return values, nil
 }
 
-// Update applies a StateUpdate to the State object. State is not
-// updated if an error is encountered during the operation. If update's
-// old or new root does not match the state's old or new roots,
-// [ErrMismatchedRoot] is returned.
-func (s *State) Update(update *core.StateUpdate) error {
-	return s.db.Update(func(txn *badger.Txn) error {
-		currentRoot, err := s.root(txn)
+// IterateContracts calls visit on every deployed contract with its class
+// hash, nonce and storage root, in ascending order of addresses, until
+// visit returns false or an error. All contracts are read in a single
+// Txn, so they reflect a consistent view of the State.
+func (s *State) IterateContracts(visit func(addr, classHash, nonce, storageRoot *felt.Felt) (bool, error)) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		state, err := s.getStateStorage(txn)
 		if err != nil {
 			return err
 		}
-		if !update.OldRoot.Equal(currentRoot) {
-			return &ErrMismatchedRoot{
-				Want:  update.OldRoot,
-				Got:   currentRoot,
-				IsOld: true,
-			}
-		}
 
-		// register deployed contracts
-		for _, contract := range update.StateDiff.DeployedContracts {
-			if err := s.putNewContract(contract.Address, contract.ClassHash, txn); err != nil {
-				return err
+		return state.Iterate(func(addr, _ *felt.Felt) (bool, error) {
+			classHash, err := s.getContractClass(addr, txn)
+			if err != nil {
+				return false, err
 			}
-		}
 
-		// update contract nonces
-		for addr, nonce := range update.StateDiff.Nonces {
+			nonce, err := s.getContractNonce(addr, txn)
 			if err != nil {
-				return err
-			}
-			if err = s.updateContractNonce(&addr, nonce, txn); err != nil {
-				return err
+				return false, err
 			}
-		}
 
-		// update contract storages
-		for addr, diff := range update.StateDiff.StorageDiffs {
+			storage, err := s.getContractStorage(addr, txn)
 			if err != nil {
-				return err
+				return false, err
 			}
-			if err = s.updateContractStorage(&addr, diff, txn); err != nil {
-				return err
+			storageRoot, err := storage.Root()
+			if err != nil {
+				return false, err
 			}
+
+			return visit(addr, classHash, nonce, storageRoot)
+		})
+	})
+}
+
+// ContractStorage returns every storage slot of the contract at the given
+// address mapped to its value, empty if the contract has no storage. It
+// reads the whole storage trie of the contract, so it is meant for exports
+// and debugging rather than serving requests. If the storage has more
+// slots than the storage limit of the State, [ErrStorageLimitExceeded] is
+// returned, and [State.ContractStoragePage] returns it in pages. If there
+// is no contract at the address, [ErrContractNotFound] is returned.
+func (s *State) ContractStorage(addr *felt.Felt) (map[felt.Felt]*felt.Felt, error) {
+	slots, next, err := s.ContractStoragePage(addr, nil)
+	if err != nil {
+		return nil, err
+	} else if next != nil {
+		return nil, fmt.Errorf("%w: more than %d slots", ErrStorageLimitExceeded, s.storageLimit)
+	}
+	return slots, nil
+}
+
+// ContractStoragePage returns the storage slots of the contract at the
+// given address from key start on, or from the first one if start is nil,
+// at most as many as the storage limit of the State, see
+// [State.WithStorageLimit]. next is the key of the first slot left out,
+// which the following page starts from, nil once the last slot is
+// returned. If there is no contract at the address,
+// [ErrContractNotFound] is returned.
+func (s *State) ContractStoragePage(addr, start *felt.Felt) (slots map[felt.Felt]*felt.Felt, next *felt.Felt,
+	err error,
+) {
+	slots = make(map[felt.Felt]*felt.Felt)
+	err = s.db.View(func(txn *badger.Txn) error {
+		if _, err := s.getContractNonce(addr, txn); err != nil {
+			return err
 		}
 
-		newRoot, err := s.root(txn)
+		storage, err := s.getContractStorage(addr, txn)
 		if err != nil {
 			return err
 		}
-		if !update.NewRoot.Equal(newRoot) {
-			return &ErrMismatchedRoot{
-				Want:  update.NewRoot,
-				Got:   newRoot,
-				IsOld: false,
+		return storage.IterateRange(start, nil, func(key, value *felt.Felt) (bool, error) {
+			if s.storageLimit > 0 && len(slots) == s.storageLimit {
+				next = key
+				return false, nil
 			}
-		}
-		return nil
+			slots[*key] = value
+			return true, nil
+		})
 	})
+	return slots, next, err
 }
 
-// getContractStorage returns the [core.Trie] that represents the
-// storage of the contract at the given address in the given Txn
-// context.
-func (s *State) getContractStorage(addr *felt.Felt, txn *badger.Txn) (*trie.Trie, error) {
-	addrBytes := addr.Marshal()
-	var contractRootKey *bitset.BitSet
-
-	if item, err := txn.Get(db.ContractRootKey.Key(addrBytes)); err == nil {
-		if err = item.Value(func(val []byte) error {
-			contractRootKey = new(bitset.BitSet)
-			return contractRootKey.UnmarshalBinary(val)
-		}); err != nil {
-			return nil, err
+// Height returns the number of the last block applied with
+// [State.Update]. On a State no block has been applied to, 0 and
+// [ErrNotSynced] are returned, which tells it apart from a State
+// block 0 has been applied to.
+func (s *State) Height() (uint64, error) {
+	var height uint64
+	return height, s.db.View(func(txn *badger.Txn) error {
+		var err error
+		height, err = latestBlockNumber(txn)
+		if errors.Is(err, ErrStateUpdateNotFound) {
+			return ErrNotSynced
 		}
-	} else if !errors.Is(err, badger.ErrKeyNotFound) {
-		// Don't continue normal operation with arbitrary
-		// database error.
-		return nil, err
-	}
-	trieTxn := trie.NewTrieBadgerTxn(txn, db.ContractStorage.Key(addrBytes))
-	return trie.NewTrie(trieTxn, contractStorageTrieHeight, contractRootKey), nil
+		return err
+	})
 }
 
-// updateContractStorage applies the diff set to the Trie of the
-// contract at the given address in the given Txn context.
-func (s *State) updateContractStorage(addr *felt.Felt, diff []core.StorageDiff, txn *badger.Txn) error {
-	classHash, err := s.getContractClass(addr, txn)
-	if err != nil {
-		return err
+// StateAtBlockNumber returns the State as of the block with the given
+// number, or [ErrStateUpdateNotFound] if the block has not been applied.
+// Only the state of the last applied block is kept, the State itself, so
+// [ErrHistoricalStateUnavailable] is returned for earlier blocks.
+func (s *State) StateAtBlockNumber(blockNumber uint64) (*State, error) {
+	height, err := s.Height()
+	if errors.Is(err, ErrNotSynced) {
+		return nil, ErrStateUpdateNotFound
+	} else if err != nil {
+		return nil, err
 	}
 
-	storage, err := s.getContractStorage(addr, txn)
-	if err != nil {
-		return err
+	switch {
+	case blockNumber > height:
+		return nil, ErrStateUpdateNotFound
+	case blockNumber < height:
+		return nil, ErrHistoricalStateUnavailable
+	default:
+		return s, nil
 	}
+}
 
-	nonce, err := s.getContractNonce(addr, txn)
-	if err != nil {
+// StateAtBlockHash returns the State as of the block with the given hash
+// like [State.StateAtBlockNumber] does, the hash is resolved to the
+// number of the block through the index of applied blocks. An unknown
+// hash results in [ErrStateUpdateNotFound].
+func (s *State) StateAtBlockHash(blockHash *felt.Felt) (*State, error) {
+	var blockNumber uint64
+	if err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		blockNumber, err = blockNumberByHash(blockHash, txn)
 		return err
+	}); err != nil {
+		return nil, err
 	}
+	return s.StateAtBlockNumber(blockNumber)
+}
 
-	// apply the diff
-	for _, pair := range diff {
-		if err = storage.Put(pair.Key, pair.Value); err != nil {
-			return err
-		}
+// RootAtBlock returns the state commitment as of the block with the given
+// number, or [ErrStateUpdateNotFound] if the block has not been applied.
+// Trie nodes are stored by their path and overwritten by later blocks, so
+// rather than being read from the tries the commitment is the one
+// recorded when the block was applied, which was checked against the
+// tries then. Unlike [State.StateAtBlockNumber] it is available for every
+// applied block.
+func (s *State) RootAtBlock(blockNumber uint64) (*felt.Felt, error) {
+	var root *felt.Felt
+	return root, s.db.View(func(txn *badger.Txn) error {
+		var err error
+		root, err = stateRoot(blockNumber, txn)
+		return err
+	})
+}
+
+// Root returns the state commitment. An empty class trie is not
+// committed to, so this matches [State.RootAtVersion] for any version as
+// long as no v1 class has been declared.
+func (s *State) Root() (*felt.Felt, error) {
+	var root *felt.Felt
+	return root, s.db.View(func(txn *badger.Txn) error {
+		read, err := s.root(txn)
+
+		root = read
+		return err
+	})
+}
+
+// RootAtVersion returns the state commitment as defined by the given
+// protocol version, e.g. the "starknet_version" of a block header.
+// Before version 0.11.0 the commitment is the root of the contract trie,
+// from then on it also commits to the class trie, see [State.Root].
+// Blocks without a version predate 0.11.0.
+func (s *State) RootAtVersion(protocolVersion string) (*felt.Felt, error) {
+	commitsToClasses, err := commitsToClassTrie(protocolVersion)
+	if err != nil {
+		return nil, err
 	}
 
-	// update contract storage root in the database
-	rootKeyDbKey := db.ContractRootKey.Key(addr.Marshal())
-	if rootKey := storage.RootKey(); rootKey != nil {
-		if rootKeyBytes, err := storage.RootKey().MarshalBinary(); err != nil {
+	var root *felt.Felt
+	return root, s.db.View(func(txn *badger.Txn) error {
+		if commitsToClasses {
+			root, err = s.root(txn)
 			return err
-		} else if err = txn.Set(rootKeyDbKey, rootKeyBytes); err != nil {
+		}
+
+		storage, err := s.getStateStorage(txn)
+		if err != nil {
 			return err
 		}
-	} else if err = txn.Delete(rootKeyDbKey); err != nil {
+		root, err = storage.Root()
 		return err
+	})
+}
+
+// RecomputeRoot recomputes the state commitment from scratch: the contract
+// trie is rebuilt in memory out of the commitments of every deployed
+// contract, which are calculated from their class hashes, nonces and the
+// roots of their storage tries. Contracts are found through their class
+// hashes rather than through the contract trie. A result that differs
+// from [State.Root] tells the contract trie is inconsistent with the
+// contracts, rather than a storage trie being corrupt.
+//
+// It reads the whole State, so it is meant for diagnostics only.
+func (s *State) RecomputeRoot() (*felt.Felt, error) {
+	var root *felt.Felt
+	return root, s.db.View(func(txn *badger.Txn) error {
+		contracts := s.newTrie(globalTrie, trie.NewMapStorage(), nil, crypto.Pedersen)
+		contracts.DeferCommitment()
+
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = db.ContractClassHash.Key()
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			addr := new(felt.Felt).SetBytes(it.Item().Key()[len(opts.Prefix):])
+			classHash, err := s.getContractClass(addr, txn)
+			if err != nil {
+				return err
+			}
+			nonce, err := s.getContractNonce(addr, txn)
+			if err != nil {
+				return err
+			}
+			storage, err := s.getContractStorage(addr, txn)
+			if err != nil {
+				return err
+			}
+			storageRoot, err := storage.Root()
+			if err != nil {
+				return err
+			}
+
+			if err = contracts.Put(addr, CalculateContractCommitment(storageRoot, classHash, nonce)); err != nil {
+				return err
+			}
+		}
+		if err := contracts.Commit(); err != nil {
+			return err
+		}
+		contractsRoot, err := contracts.Root()
+		if err != nil {
+			return err
+		}
+
+		classes, err := s.getClassesStorage(txn)
+		if err != nil {
+			return err
+		}
+		classesRoot, err := classes.Root()
+		if err != nil {
+			return err
+		}
+
+		root = stateCommitment(contractsRoot, classesRoot)
+		return nil
+	})
+}
+
+// commitsToClassTrie checks whether the state commitment of the given
+// protocol version commits to the class trie.
+func commitsToClassTrie(protocolVersion string) (bool, error) {
+	if protocolVersion == "" {
+		return false, nil
 	}
 
-	// recalculate commitment to be put in the global state
+	// versions may have more or less than three components, e.g.
+	// 0.11.0.2, missing components are zero
+	parts := strings.Split(protocolVersion, ".")
+	for idx, want := range classTrieVersion {
+		var got uint64
+		if idx < len(parts) {
+			var err error
+			if got, err = strconv.ParseUint(parts[idx], 10, 64); err != nil {
+				return false, fmt.Errorf("invalid protocol version %q: %w", protocolVersion, err)
+			}
+		}
+		if got != want {
+			return got > want, nil
+		}
+	}
+	return true, nil
+}
+
+// root returns the state commitment in the given Txn context. Once a
+// class has been added to the class trie, the commitment combines the
+// roots of the contract and class tries, before that it is the root of
+// the contract trie.
+func (s *State) root(txn *badger.Txn) (*felt.Felt, error) {
+	storage, err := s.getStateStorage(txn)
+	if err != nil {
+		return nil, err
+	}
 	storageRoot, err := storage.Root()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	commitment := CalculateContractCommitment(storageRoot, classHash, nonce)
-	state, err := s.getStateStorage(txn)
+	classes, err := s.getClassesStorage(txn)
+	if err != nil {
+		return nil, err
+	}
+	classesRoot, err := classes.Root()
 	if err != nil {
+		return nil, err
+	}
+	return stateCommitment(storageRoot, classesRoot), nil
+}
+
+// stateCommitment returns the state commitment given the roots of the
+// state trie and of the class trie
+func stateCommitment(storageRoot, classesRoot *felt.Felt) *felt.Felt {
+	if classesRoot.IsZero() {
+		return storageRoot
+	}
+	return crypto.PoseidonArray(stateVersion, storageRoot, classesRoot)
+}
+
+// getStateStorage returns a [core.Trie] that represents the StarkNet
+// global state in the given Txn context
+func (s *State) getStateStorage(txn *badger.Txn) (*trie.Trie, error) {
+	return s.getGlobalTrie(txn, db.StateTrie, stateRootKey, crypto.Pedersen)
+}
+
+// putStateStorage updates the fields related to the state trie root in
+// the given Txn context.
+func (s *State) putStateStorage(state *trie.Trie, txn *badger.Txn) error {
+	return s.putGlobalTrie(state, stateRootKey, txn)
+}
+
+// getClassesStorage returns a [core.Trie] that maps class hashes to
+// the commitments of their compiled class hashes in the given Txn
+// context
+func (s *State) getClassesStorage(txn *badger.Txn) (*trie.Trie, error) {
+	return s.getGlobalTrie(txn, db.ClassesTrie, classesRootKey, crypto.Poseidon)
+}
+
+// putClassesStorage updates the fields related to the class trie root
+// in the given Txn context.
+func (s *State) putClassesStorage(classes *trie.Trie, txn *badger.Txn) error {
+	return s.putGlobalTrie(classes, classesRootKey, txn)
+}
+
+// getGlobalTrie returns the global [core.Trie] stored under the given
+// bucket, whose root key is kept in the state metadata field with the
+// given name.
+func (s *State) getGlobalTrie(txn *badger.Txn, bucket db.Bucket, rootKeyName string,
+	hash trie.HashFunc,
+) (*trie.Trie, error) {
+	if err := s.checkTrieHeights(txn); err != nil {
+		return nil, err
+	}
+	rootKey, err := s.rootKey(txn, rootKeyName)
+	if err != nil {
+		rootKey = nil
+	}
+
+	return s.newTrie(globalTrie, s.trieStorage(txn, []byte{byte(bucket)}), rootKey, hash), nil
+}
+
+// rootKey returns key to the root node stored in the state metadata
+// field with the given name in the given Txn context.
+func (s *State) rootKey(txn *badger.Txn, rootKeyName string) (*bitset.BitSet, error) {
+	var key *bitset.BitSet
+
+	return key, s.txnGet(txn, db.State.Key([]byte(rootKeyName)), func(val []byte) error {
+		var err error
+		key, err = trie.UnmarshalKey(val)
+		return err
+	})
+}
+
+// putGlobalTrie updates the state metadata field with the given name
+// to point to the root of the given trie in the given Txn context.
+func (s *State) putGlobalTrie(globalTrie *trie.Trie, rootKeyName string, txn *badger.Txn) error {
+	if err := s.putTrieHeights(txn); err != nil {
 		return err
 	}
 
-	if err = state.Put(addr, commitment); err != nil {
+	rootKeyDbKey := db.State.Key([]byte(rootKeyName))
+	if rootKey := globalTrie.RootKey(); rootKey != nil {
+		if err := s.txnSet(txn, rootKeyDbKey, trie.MarshalKey(rootKey)); err != nil {
+			return err
+		}
+	} else if err := s.txnDelete(txn, rootKeyDbKey); err != nil {
 		return err
 	}
 
-	return s.putStateStorage(state, txn)
+	return nil
 }
 
-// updateContractNonce updates nonce of the contract at the
-// given address in the given Txn context.
-func (s *State) updateContractNonce(addr, nonce *felt.Felt, txn *badger.Txn) error {
-	classHash, err := s.getContractClass(addr, txn)
+// putDeclaredV1Classes adds the compiled class hash commitments of the
+// given classes to the class trie in the given Txn context. Declaring an
+// already declared class leaves the class trie unchanged, unlike
+// deploying an already deployed contract which is an error.
+func (s *State) putDeclaredV1Classes(declared []core.DeclaredV1Class, txn *badger.Txn) error {
+	if len(declared) == 0 {
+		return nil
+	}
+
+	classes, err := s.getClassesStorage(txn)
 	if err != nil {
 		return err
 	}
 
-	storage, err := s.getContractStorage(addr, txn)
+	for _, class := range declared {
+		leaf := crypto.Poseidon(leafVersion, class.CompiledClassHash)
+		if err = classes.Put(class.ClassHash, leaf); err != nil {
+			return err
+		}
+	}
+
+	return s.putClassesStorage(classes, txn)
+}
+
+// removeV1Classes removes the given classes from the class trie in the
+// given Txn context.
+func (s *State) removeV1Classes(classHashes []*felt.Felt, txn *badger.Txn) error {
+	if len(classHashes) == 0 {
+		return nil
+	}
+
+	classes, err := s.getClassesStorage(txn)
 	if err != nil {
 		return err
 	}
 
-	// update nonce in the database
-	if err = txn.Set(db.ContractNonce.Key(addr.Marshal()), nonce.Marshal()); err != nil {
+	for _, classHash := range classHashes {
+		if err = classes.Put(classHash, new(felt.Felt)); err != nil {
+			return err
+		}
+	}
+
+	return s.putClassesStorage(classes, txn)
+}
+
+// Update applies the StateUpdate of the given block to the State object
+// and persists it to be read later on with a [StateDiffReader]. State is
+// not updated if an error is encountered during the operation. If
+// update's old or new root does not match the state's old or new roots,
+// [ErrMismatchedRoot] is returned. Genesis updates, whose old root is zero,
+// only apply to an empty State, otherwise [ErrGenesisOnPopulatedState] is
+// returned. A storage key listed more than once in the storage diffs of a
+// contract takes the value of its last entry.
+//
+// Deploying a contract at an address that already has one of the same
+// class fails with [ErrContractAlreadyDeployed], as happens when an update
+// is applied again. A contract of another class replaces the one deployed
+// there: its previous storage is deleted and its nonce is reset.
+//
+// The deployments of an update are applied first, in their order, then
+// its nonces and then its storage diffs, both in ascending order of
+// address. Nonces and storage diffs may thus target contracts deployed by
+// the same update, other contracts they target must already be deployed
+// or [ErrContractNotFound] is returned.
+func (s *State) Update(blockNumber uint64, update *core.StateUpdate) error {
+	return s.UpdateCtx(context.Background(), blockNumber, update)
+}
+
+// UpdateCtx applies a StateUpdate like [State.Update] does, but stops
+// applying it once ctx is cancelled, which is checked before every
+// contract is updated. A cancelled update is rolled back as a whole,
+// leaving the State unchanged, and ctx.Err() is returned.
+func (s *State) UpdateCtx(ctx context.Context, blockNumber uint64, update *core.StateUpdate) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
+	if s.deferred {
+		return s.deferUpdate(blockNumber, update)
+	}
 
-	// calculate commitment to be put in the global state
-	storageRoot, err := storage.Root()
-	if err != nil {
+	return s.checkedUpdate(ctx, update, nil, func(txn *badger.Txn) error {
+		return putStateUpdate(blockNumber, update, txn)
+	})
+}
+
+// UpdateWithReverseDiff applies a StateUpdate to the State object like
+// [State.Update] does, and returns the [core.StateDiff] that undoes it.
+// The reverse diff holds the previous values of every written storage
+// slot and nonce, and removes the deployed contracts and declared v1
+// classes that did not exist before. Contracts replaced by one of another
+// class are deployed again with their previous class hash, nonce and
+// storage. It is not available while commitments are deferred.
+func (s *State) UpdateWithReverseDiff(blockNumber uint64, update *core.StateUpdate) (*core.StateDiff, error) {
+	if s.deferred {
+		return nil, errors.New("reverse diffs are not recorded while commitments are deferred")
+	}
+
+	var reverse *core.StateDiff
+	if err := s.checkedUpdate(context.Background(), update, func(txn *badger.Txn) error {
+		var err error
+		reverse, err = s.reverseDiff(update.StateDiff, txn)
 		return err
+	}, func(txn *badger.Txn) error {
+		return putStateUpdate(blockNumber, update, txn)
+	}); err != nil {
+		return nil, err
+	}
+	return reverse, nil
+}
+
+// ReplayUpdate applies a StateUpdate that is already known to be valid,
+// such as one read back from a [StateDiffReader], and persists it like
+// [State.Update] does. Neither its old nor its new root is checked, which
+// saves calculating the state commitment for every block. The caller is
+// expected to check the root once the replay is done with [State.Root].
+// It is not available while commitments are deferred.
+func (s *State) ReplayUpdate(blockNumber uint64, update *core.StateUpdate) error {
+	if s.deferred {
+		return errors.New("updates cannot be replayed while commitments are deferred")
+	}
+
+	return s.update(func(txn *badger.Txn) error {
+		if err := s.applyDiff(context.Background(), update.StateDiff, txn); err != nil {
+			return err
+		}
+		return putStateUpdate(blockNumber, update, txn)
+	})
+}
+
+// checkedUpdate applies update and checks the resulting state
+// commitment against its new root, then calls persist in the same Txn
+// context. If before is not nil, it is called in the same Txn context
+// before any of the changes are applied. Applying update stops with
+// ctx.Err() once ctx is cancelled.
+func (s *State) checkedUpdate(ctx context.Context, update *core.StateUpdate, before, persist func(txn *badger.Txn) error) error {
+	err := s.update(func(txn *badger.Txn) error {
+		if before != nil {
+			if err := before(txn); err != nil {
+				return err
+			}
+		}
+
+		newRoot, err := s.applyUpdate(ctx, update, txn)
+		if err != nil {
+			return err
+		}
+		if !update.NewRoot.Equal(newRoot) {
+			return &ErrMismatchedRoot{
+				Want:  update.NewRoot,
+				Got:   newRoot,
+				IsOld: false,
+			}
+		}
+		return persist(txn)
+	})
+
+	var mismatch *ErrMismatchedRoot
+	if errors.As(err, &mismatch) {
+		s.log.Warn("Mismatched state root", "want", mismatch.Want.Text(16), "got", mismatch.Got.Text(16),
+			"old", mismatch.IsOld)
+	} else if err == nil {
+		s.log.Debug("Applied state update", "newRoot", update.NewRoot.Text(16),
+			"storageDiffs", len(update.StateDiff.StorageDiffs),
+			"deployedContracts", len(update.StateDiff.DeployedContracts),
+			"nonces", len(update.StateDiff.Nonces))
+	}
+	return err
+}
+
+// reverseDiff returns the [core.StateDiff] that undoes diff, reading the
+// current values from the given Txn context.
+func (s *State) reverseDiff(diff *core.StateDiff, txn *badger.Txn) (*core.StateDiff, error) {
+	reverse := &core.StateDiff{
+		StorageDiffs: make(core.FeltMap[[]core.StorageDiff], len(diff.StorageDiffs)),
+		Nonces:       make(core.FeltMap[*felt.Felt], len(diff.Nonces)),
+	}
+
+	// redeployed contracts are undone by deploying them again with their
+	// whole previous storage
+	var redeployed core.FeltSet
+	for _, contract := range diff.DeployedContracts {
+		classHash, err := s.replacedClass(contract.Address, contract.ClassHash, txn)
+		if err != nil {
+			return nil, err
+		}
+		if classHash == nil {
+			reverse.RemovedContracts = append(reverse.RemovedContracts, contract.Address)
+			continue
+		}
+		nonce, err := s.getContractNonce(contract.Address, txn)
+		if err != nil {
+			return nil, err
+		}
+
+		redeployed.Add(contract.Address)
+		reverse.DeployedContracts = append(reverse.DeployedContracts, core.DeployedContract{
+			Address:   contract.Address,
+			ClassHash: classHash,
+		})
+		if !nonce.IsZero() {
+			reverse.Nonces.Set(contract.Address, nonce)
+		}
+		storage, err := s.getContractStorage(contract.Address, txn)
+		if err != nil {
+			return nil, err
+		}
+		var storageDiffs []core.StorageDiff
+		if err = storage.Iterate(func(key, value *felt.Felt) (bool, error) {
+			storageDiffs = append(storageDiffs, core.StorageDiff{Key: key, Value: value})
+			return true, nil
+		}); err != nil {
+			return nil, err
+		}
+		if len(storageDiffs) > 0 {
+			reverse.StorageDiffs.Set(contract.Address, storageDiffs)
+		}
+	}
+
+	for _, addr := range diff.Nonces.Keys() {
+		if redeployed.Contains(addr) {
+			continue
+		}
+		nonce, _ := diff.Nonces.Get(addr)
+		oldNonce, err := s.getContractNonce(addr, txn)
+		if errors.Is(err, ErrContractNotFound) {
+			// deployed by diff, it is removed as a whole
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !oldNonce.Equal(nonce) {
+			reverse.Nonces.Set(addr, oldNonce)
+		}
+	}
+
+	for _, addr := range diff.StorageDiffs.Keys() {
+		if redeployed.Contains(addr) {
+			continue
+		}
+		storageDiffs, _ := diff.StorageDiffs.Get(addr)
+		storage, err := s.getContractStorage(addr, txn)
+		if err != nil {
+			return nil, err
+		}
+
+		var seen core.FeltSet
+		for _, pair := range storageDiffs {
+			if seen.Contains(pair.Key) {
+				continue
+			}
+			seen.Add(pair.Key)
+
+			oldValue, err := storage.Get(pair.Key)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				oldValue = new(felt.Felt)
+			} else if err != nil {
+				return nil, err
+			}
+			reversed, _ := reverse.StorageDiffs.Get(addr)
+			reverse.StorageDiffs.Set(addr, append(reversed, core.StorageDiff{
+				Key:   pair.Key,
+				Value: oldValue,
+			}))
+		}
+	}
+
+	if len(diff.DeclaredV1Classes) > 0 {
+		classes, err := s.getClassesStorage(txn)
+		if err != nil {
+			return nil, err
+		}
+		for _, class := range diff.DeclaredV1Classes {
+			if _, err = classes.Get(class.ClassHash); errors.Is(err, badger.ErrKeyNotFound) {
+				reverse.RemovedV1Classes = append(reverse.RemovedV1Classes, class.ClassHash)
+			} else if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return reverse, nil
+}
+
+// DeferCommitments makes subsequent calls to [State.Update] accumulate
+// updates in memory rather than applying them, which is done by
+// [State.Commit] in a single pass, recalculating every commitment once.
+// This speeds up syncing when intermediate roots are not needed, but the
+// accumulated updates are neither visible nor persisted before Commit.
+func (s *State) DeferCommitments() {
+	s.deferred = true
+}
+
+// deferUpdate adds update to the pending updates. Its old root must match
+// the new root of the last pending update, otherwise [ErrMismatchedRoot]
+// is returned.
+//
+// The pending updates are committed first if update deploys a contract
+// they deploy too: the contract may be deployed again with the class it
+// had before them, which a single deployment cannot replace.
+func (s *State) deferUpdate(blockNumber uint64, update *core.StateUpdate) error {
+	if s.pending != nil {
+		if !update.OldRoot.Equal(s.pending.NewRoot) {
+			return &ErrMismatchedRoot{
+				Want:  update.OldRoot,
+				Got:   s.pending.NewRoot,
+				IsOld: true,
+			}
+		}
+		if redeploysContracts(s.pending.StateDiff, update.StateDiff) {
+			if err := s.Commit(); err != nil {
+				return err
+			}
+		}
 	}
 
-	commitment := CalculateContractCommitment(storageRoot, classHash, nonce)
+	if s.pending == nil {
+		s.pending = &core.StateUpdate{
+			OldRoot:   update.OldRoot,
+			StateDiff: new(core.StateDiff),
+		}
+	}
+
+	s.pending.BlockHash = update.BlockHash
+	s.pending.NewRoot = update.NewRoot
+	s.pending.StateDiff = core.MergeStateDiffs(s.pending.StateDiff, update.StateDiff)
+	s.pendingBlocks = append(s.pendingBlocks, numberedUpdate{blockNumber: blockNumber, update: update})
+	return nil
+}
+
+// redeploysContracts reports whether overlay deploys a contract that base
+// deploys too
+func redeploysContracts(base, overlay *core.StateDiff) bool {
+	if overlay == nil || len(overlay.DeployedContracts) == 0 {
+		return false
+	}
+
+	deployed := core.NewFeltSet()
+	for _, contract := range base.DeployedContracts {
+		deployed.Add(contract.Address)
+	}
+	for _, contract := range overlay.DeployedContracts {
+		if deployed.Contains(contract.Address) {
+			return true
+		}
+	}
+	return false
+}
+
+// Commit applies the updates accumulated since [State.DeferCommitments]
+// was called, or since the last Commit, as a single update. The pending
+// updates are dropped even if an error is returned.
+func (s *State) Commit() error {
+	if s.pending == nil {
+		return nil
+	}
+
+	pending, pendingBlocks := s.pending, s.pendingBlocks
+	s.pending, s.pendingBlocks = nil, nil
+
+	return s.checkedUpdate(context.Background(), pending, nil, func(txn *badger.Txn) error {
+		for _, block := range pendingBlocks {
+			if err := putStateUpdate(block.blockNumber, block.update, txn); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SimulateUpdate returns the state commitment that would result from
+// applying update, without modifying the State. Only the old root of
+// update is checked, the returned root can be compared with its new root.
+func (s *State) SimulateUpdate(update *core.StateUpdate) (*felt.Felt, error) {
+	if s.db.Opts().ReadOnly {
+		return nil, db.ErrReadOnly
+	}
+
+	txn := s.db.NewTransaction(true)
+	// changes are never committed
+	defer txn.Discard()
+
+	return s.applyUpdate(context.Background(), update, txn)
+}
+
+// applyUpdate applies update to the State in the given Txn context and
+// returns the new state commitment. If update's old root does not match
+// the state's root, [ErrMismatchedRoot] is returned, or
+// [ErrGenesisOnPopulatedState] if the old root is zero.
+func (s *State) applyUpdate(ctx context.Context, update *core.StateUpdate, txn *badger.Txn) (*felt.Felt, error) {
+	currentRoot, err := s.root(txn)
+	if err != nil {
+		return nil, err
+	}
+	if update.OldRoot.IsZero() && !currentRoot.IsZero() {
+		return nil, ErrGenesisOnPopulatedState
+	}
+	if !update.OldRoot.Equal(currentRoot) {
+		return nil, &ErrMismatchedRoot{
+			Want:  update.OldRoot,
+			Got:   currentRoot,
+			IsOld: true,
+		}
+	}
+
+	if err = s.applyDiff(ctx, update.StateDiff, txn); err != nil {
+		return nil, err
+	}
+	return s.root(txn)
+}
+
+// applyDiff applies diff to the State in the given Txn context, without
+// checking or calculating the state commitment. It returns ctx.Err() if
+// ctx is cancelled before all contracts are updated.
+//
+// The storage of every contract is updated once with all of its storage
+// diffs, and the commitment of every touched contract is put into the
+// state trie once, after all of its changes are applied. Changes are
+// applied in the order documented on [State.Update].
+func (s *State) applyDiff(ctx context.Context, diff *core.StateDiff, txn *badger.Txn) error {
+	// storageRoots holds the storage root of every touched contract, nil
+	// if its storage is unchanged
+	storageRoots := make(map[felt.Felt]*felt.Felt,
+		len(diff.DeployedContracts)+len(diff.Nonces)+len(diff.StorageDiffs))
+
+	var err error
+	// register deployed contracts
+	for _, contract := range diff.DeployedContracts {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = s.replaceContract(contract.Address, contract.ClassHash, txn); err != nil {
+			return err
+		}
+		if err = s.registerContract(contract.Address, contract.ClassHash, txn); err != nil {
+			return err
+		}
+		storageRoots[*contract.Address] = nil
+	}
+
+	// update contract nonces, of contracts deployed by now
+	for _, addr := range diff.Nonces.Keys() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = s.checkDeployed(addr, txn); err != nil {
+			return err
+		}
+		nonce, _ := diff.Nonces.Get(addr)
+		if err = s.txnSet(txn, db.ContractNonce.Key(addr.Marshal()), nonce.Marshal()); err != nil {
+			return err
+		}
+		storageRoots[*addr] = nil
+	}
+
+	// update contract storages, of contracts deployed by now
+	for _, addr := range diff.StorageDiffs.Keys() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = s.checkDeployed(addr, txn); err != nil {
+			return err
+		}
+		storageDiffs, _ := diff.StorageDiffs.Get(addr)
+		if storageRoots[*addr], err = s.updateContractStorage(addr, storageDiffs, txn); err != nil {
+			return err
+		}
+	}
+
+	// commit to the touched contracts, hashing every changed node of the
+	// state trie once
 	state, err := s.getStateStorage(txn)
 	if err != nil {
 		return err
 	}
+	if err = withinBoundary(state, func() error {
+		state.DeferCommitment()
+		for addr, storageRoot := range storageRoots {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-	if err = state.Put(addr, commitment); err != nil {
+			addr := addr
+			commitment, err := s.contractCommitment(&addr, storageRoot, txn)
+			if err != nil {
+				return err
+			}
+			if err = state.Put(&addr, commitment); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err = s.putStateStorage(state, txn); err != nil {
 		return err
 	}
 
-	return s.putStateStorage(state, txn)
+	// commit to the compiled class hashes of declared classes
+	if err = s.putDeclaredV1Classes(diff.DeclaredV1Classes, txn); err != nil {
+		return err
+	}
+
+	// undo deployments and declarations of reverse diffs
+	for _, addr := range diff.RemovedContracts {
+		if err = s.removeContract(addr, txn); err != nil {
+			return err
+		}
+	}
+	return s.removeV1Classes(diff.RemovedV1Classes, txn)
+}
+
+// checkDeployed returns [ErrContractNotFound] if no contract is deployed at
+// addr in the given Txn context.
+func (s *State) checkDeployed(addr *felt.Felt, txn *badger.Txn) error {
+	_, err := s.getContractClass(addr, txn)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return fmt.Errorf("%w: %s", ErrContractNotFound, addr.Text(16))
+	}
+	return err
+}
+
+// withinBoundary calls fn within a boundary of t, see [trie.Trie.Begin],
+// so that the changes fn makes to t are committed at once if it succeeds
+// and rolled back otherwise.
+func withinBoundary(t *trie.Trie, fn func() error) error {
+	if err := t.Begin(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if rollbackErr := t.Rollback(); rollbackErr != nil {
+			return rollbackErr
+		}
+		return err
+	}
+	return t.Commit()
+}
+
+// contractCommitment returns the commitment of the contract at the given
+// address in the given Txn context. The storage root of the contract is
+// read from its storage if storageRoot is nil.
+func (s *State) contractCommitment(addr, storageRoot *felt.Felt, txn *badger.Txn) (*felt.Felt, error) {
+	classHash, err := s.getContractClass(addr, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := s.getContractNonce(addr, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	if storageRoot == nil {
+		storage, err := s.getContractStorage(addr, txn)
+		if err != nil {
+			return nil, err
+		}
+		if storageRoot, err = storage.Root(); err != nil {
+			return nil, err
+		}
+	}
+	return CalculateContractCommitment(storageRoot, classHash, nonce), nil
+}
+
+// getContractStorage returns the [core.Trie] that represents the
+// storage of the contract at the given address in the given Txn
+// context.
+func (s *State) getContractStorage(addr *felt.Felt, txn *badger.Txn) (*trie.Trie, error) {
+	if err := s.checkTrieHeights(txn); err != nil {
+		return nil, err
+	}
+	contractRootKey, err := s.contractRootKey(addr, txn)
+	if err != nil {
+		return nil, err
+	}
+	generation, err := s.storageGeneration(addr, txn)
+	if err != nil {
+		return nil, err
+	}
+	storage := s.trieStorage(txn, contractStoragePrefix(addr, generation))
+	return s.newTrie(contractStorageTrie, storage, contractRootKey, crypto.Pedersen), nil
+}
+
+// storageGenerationMarker starts the prefix of the storage of a contract
+// after the first generation. Keys encoded with [trie.MarshalKey] start
+// with a zero byte, so the nodes of the first generation never share a
+// prefix with the later ones.
+const storageGenerationMarker = 0xff
+
+// storageGeneration returns the generation of the storage of the contract
+// at addr in the given Txn context, which is increased every time the
+// contract is replaced, see [State.replaceContract].
+func (s *State) storageGeneration(addr *felt.Felt, txn *badger.Txn) (uint64, error) {
+	var generation uint64
+	err := s.txnGet(txn, db.StorageGeneration.Key(addr.Marshal()), func(val []byte) error {
+		generation = binary.BigEndian.Uint64(val)
+		return nil
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, nil
+	}
+	return generation, err
+}
+
+// contractStoragePrefix returns the prefix of the storage nodes of the
+// contract at addr in the given generation. The first generation is
+// stored right after the address, as it was before contracts could be
+// replaced.
+func contractStoragePrefix(addr *felt.Felt, generation uint64) []byte {
+	if generation == 0 {
+		return db.ContractStorage.Key(addr.Marshal())
+	}
+	generationBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(generationBytes, generation)
+	return db.ContractStorage.Key(addr.Marshal(), []byte{storageGenerationMarker}, generationBytes)
+}
+
+// storageNodesPrefix returns the prefix shared by the storage nodes of
+// the contract at addr in the given generation, and by no other keys
+func storageNodesPrefix(addr *felt.Felt, generation uint64) []byte {
+	prefix := contractStoragePrefix(addr, generation)
+	if generation == 0 {
+		// leave out the later generations, see storageGenerationMarker
+		prefix = append(prefix, 0)
+	}
+	return prefix
+}
+
+// contractRootKey returns the key of the root of the storage [core.Trie]
+// of the contract at the given address in the given Txn context, nil if
+// its storage is empty.
+func (s *State) contractRootKey(addr *felt.Felt, txn *badger.Txn) (*bitset.BitSet, error) {
+	var contractRootKey *bitset.BitSet
+	if err := s.txnGet(txn, db.ContractRootKey.Key(addr.Marshal()), func(val []byte) error {
+		var err error
+		contractRootKey, err = trie.UnmarshalKey(val)
+		return err
+	}); err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		// Don't continue normal operation with arbitrary
+		// database error.
+		return nil, err
+	}
+	return contractRootKey, nil
+}
+
+// updateContractStorage applies the diff set to the Trie of the
+// contract at the given address in the given Txn context and returns the
+// new storage root of the contract. The commitment of the contract in the
+// state trie is not updated.
+func (s *State) updateContractStorage(addr *felt.Felt, diff []core.StorageDiff, txn *badger.Txn) (*felt.Felt, error) {
+	storage, err := s.getContractStorage(addr, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply the diff, hashing every changed node once
+	if err = withinBoundary(storage, func() error {
+		storage.DeferCommitment()
+		for _, pair := range diff {
+			if err := storage.Put(pair.Key, pair.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// update contract storage root in the database
+	rootKeyDbKey := db.ContractRootKey.Key(addr.Marshal())
+	if rootKey := storage.RootKey(); rootKey != nil {
+		if err = s.txnSet(txn, rootKeyDbKey, trie.MarshalKey(rootKey)); err != nil {
+			return nil, err
+		}
+	} else if err = s.txnDelete(txn, rootKeyDbKey); err != nil {
+		return nil, err
+	}
+
+	return storage.Root()
+}
+
+// PutClass stores the class with the given hash to be queried later on
+// with [GetClass].
+func (s *State) PutClass(classHash *felt.Felt, class *core.Class) error {
+	classBytes, err := json.Marshal(class)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(txn *badger.Txn) error {
+		return txn.Set(db.Class.Key(classHash.Marshal()), classBytes)
+	})
+}
+
+// GetClass returns the class with the given hash.
+func (s *State) GetClass(classHash *felt.Felt) (*core.Class, error) {
+	var class *core.Class
+
+	return class, s.db.View(func(txn *badger.Txn) error {
+		var err error
+		class, err = getClass(classHash, txn)
+		return err
+	})
+}
+
+// getClass returns the class with the given hash in the given Txn
+// context.
+func getClass(classHash *felt.Felt, txn *badger.Txn) (*core.Class, error) {
+	var class *core.Class
+
+	item, err := txn.Get(db.Class.Key(classHash.Marshal()))
+	if err != nil {
+		return nil, err
+	}
+	return class, item.Value(func(val []byte) error {
+		class = new(core.Class)
+		return json.Unmarshal(val, class)
+	})
 }
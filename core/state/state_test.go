@@ -1,11 +1,16 @@
 package state
 
 import (
+	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
+	"math/rand"
 	"testing"
 
 	"github.com/NethermindEth/juno/clients"
 	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/crypto"
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/juno/core/trie"
 	"github.com/NethermindEth/juno/db"
@@ -26,7 +31,7 @@ func TestState_PutNewContract(t *testing.T) {
 
 	testDb.Update(func(txn *badger.Txn) error {
 		assert.Equal(t, nil, state.putNewContract(addr, classHash, txn))
-		assert.EqualError(t, state.putNewContract(addr, classHash, txn), "existing contract")
+		assert.ErrorIs(t, state.putNewContract(addr, classHash, txn), ErrContractAlreadyDeployed)
 		return nil
 	})
 
@@ -35,6 +40,27 @@ func TestState_PutNewContract(t *testing.T) {
 	assert.Equal(t, true, classHash.Equal(got))
 }
 
+func TestInvalidContractAddress(t *testing.T) {
+	classHash := new(felt.Felt).SetUint64(37)
+	outOfRange, err := new(felt.Felt).SetString("0x7ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff00")
+	assert.NoError(t, err)
+
+	for _, addr := range []*felt.Felt{new(felt.Felt), outOfRange} {
+		state := NewState(db.NewTestDb())
+		err := state.Update(0, &core.StateUpdate{
+			OldRoot: new(felt.Felt),
+			NewRoot: new(felt.Felt),
+			StateDiff: &core.StateDiff{
+				DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: classHash}},
+			},
+		})
+		assert.ErrorIs(t, err, ErrInvalidContractAddress)
+
+		_, err = state.GetContractClass(addr)
+		assert.Error(t, err)
+	}
+}
+
 func TestState_Root(t *testing.T) {
 	testDb := db.NewTestDb()
 
@@ -60,13 +86,12 @@ func TestState_Root(t *testing.T) {
 		t.Error(err)
 	}
 
+	// version 1 encoding of a leaf
 	expectedRootNode := new(trie.Node)
-	if err := expectedRootNode.UnmarshalBinary(value.Marshal()); err != nil {
+	if err := expectedRootNode.UnmarshalBinary(append([]byte{1}, value.Marshal()...)); err != nil {
 		t.Error(err)
 	}
-
-	expectedRootNode.UnmarshalBinary(value.Marshal())
-	expectedRoot := expectedRootNode.Hash(trie.Path(newRootPath, nil))
+	expectedRoot := expectedRootNode.Hash(trie.Path(newRootPath, nil), crypto.Pedersen)
 
 	actualRoot, err := state.Root()
 	assert.Equal(t, nil, err)
@@ -230,7 +255,237 @@ func TestUpdate(t *testing.T) {
 	testDb := db.NewTestDb()
 	state := NewState(testDb)
 
-	assert.Equal(t, nil, state.Update(coreUpdate))
+	assert.Equal(t, nil, state.Update(0, coreUpdate))
+}
+
+func TestGenesisUpdate(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	update0 := coreStateUpdate(t, mainnetStateUpdate0)
+	assert.Equal(t, true, update0.OldRoot.IsZero())
+
+	assert.NoError(t, state.Update(0, update0))
+	root, err := state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, update0.NewRoot.Equal(root))
+
+	// a populated state can not be re-initialised, not even with the
+	// genesis update it was initialised with
+	for _, update := range []*core.StateUpdate{coreStateUpdate(t, mainnetStateUpdate0), {
+		OldRoot:   new(felt.Felt),
+		NewRoot:   new(felt.Felt),
+		StateDiff: new(core.StateDiff),
+	}} {
+		assert.ErrorIs(t, state.Update(0, update), ErrGenesisOnPopulatedState)
+	}
+	root, err = state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, update0.NewRoot.Equal(root))
+}
+
+func TestUpdateOrderIndependence(t *testing.T) {
+	const runs = 20
+	var roots []*felt.Felt
+	for run := 0; run < runs; run++ {
+		state := NewState(db.NewTestDb())
+		for idx, raw := range [][]byte{mainnetStateUpdate0, mainnetStateUpdate1, mainnetStateUpdate2} {
+			update := coreStateUpdate(t, raw)
+			// nonces and storage diffs are applied in address order
+			deployed := update.StateDiff.DeployedContracts
+			rand.Shuffle(len(deployed), func(i, j int) {
+				deployed[i], deployed[j] = deployed[j], deployed[i]
+			})
+			if !assert.NoError(t, state.Update(uint64(idx), update)) {
+				t.FailNow()
+			}
+		}
+
+		root, err := state.Root()
+		assert.NoError(t, err)
+		roots = append(roots, root)
+	}
+
+	for _, root := range roots[1:] {
+		assert.Equal(t, true, roots[0].Equal(root))
+	}
+}
+
+func TestUpdateApplicationOrder(t *testing.T) {
+	addr, _ := new(felt.Felt).SetString("0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+	classHash, _ := new(felt.Felt).SetString("0x10455c752b86932ce552f2b0fe81a880746649b9aee7e0d842bf3f52378f9f8")
+	slot, value := new(felt.Felt).SetUint64(5), new(felt.Felt).SetUint64(7)
+	update := &core.StateUpdate{
+		OldRoot: new(felt.Felt),
+		StateDiff: &core.StateDiff{
+			StorageDiffs:      core.FeltMap[[]core.StorageDiff]{*addr: {{Key: slot, Value: value}}},
+			Nonces:            core.FeltMap[*felt.Felt]{*addr: new(felt.Felt).SetUint64(1)},
+			DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: classHash}},
+		},
+	}
+
+	t.Run("storage and nonce of a contract deployed by the same update", func(t *testing.T) {
+		replayed := NewState(db.NewTestDb())
+		assert.NoError(t, replayed.ReplayUpdate(0, update))
+		var err error
+		update.NewRoot, err = replayed.Root()
+		assert.NoError(t, err)
+
+		state := NewState(db.NewTestDb())
+		assert.NoError(t, state.Update(0, update))
+		storage, err := state.ContractStorage(addr)
+		assert.NoError(t, err)
+		assert.Equal(t, map[felt.Felt]*felt.Felt{*slot: value}, storage)
+		nonce, err := state.GetContractNonce(addr)
+		assert.NoError(t, err)
+		assert.Equal(t, true, new(felt.Felt).SetUint64(1).Equal(nonce))
+	})
+
+	t.Run("storage and nonce of a contract never deployed", func(t *testing.T) {
+		for _, diff := range []*core.StateDiff{
+			{StorageDiffs: update.StateDiff.StorageDiffs},
+			{Nonces: update.StateDiff.Nonces},
+		} {
+			state := NewState(db.NewTestDb())
+			err := state.Update(0, &core.StateUpdate{OldRoot: new(felt.Felt), NewRoot: new(felt.Felt), StateDiff: diff})
+			assert.ErrorIs(t, err, ErrContractNotFound)
+		}
+	})
+}
+
+func TestUpdateDuplicateStorageKeys(t *testing.T) {
+	update0 := coreStateUpdate(t, mainnetStateUpdate0)
+	addr := update0.StateDiff.DeployedContracts[0].Address
+	key := new(felt.Felt).SetUint64(37)
+	withDiffs := func(diffs ...core.StorageDiff) *core.StateUpdate {
+		return &core.StateUpdate{
+			OldRoot: update0.NewRoot,
+			StateDiff: &core.StateDiff{
+				StorageDiffs: map[felt.Felt][]core.StorageDiff{*addr: diffs},
+			},
+		}
+	}
+
+	var roots []*felt.Felt
+	for _, update := range []*core.StateUpdate{
+		withDiffs(core.StorageDiff{Key: key, Value: new(felt.Felt).SetUint64(2)}),
+		withDiffs(
+			core.StorageDiff{Key: key, Value: new(felt.Felt).SetUint64(1)},
+			core.StorageDiff{Key: key, Value: new(felt.Felt).SetUint64(2)},
+		),
+		// a zero value written first does not delete the last one
+		withDiffs(
+			core.StorageDiff{Key: key, Value: new(felt.Felt)},
+			core.StorageDiff{Key: key, Value: new(felt.Felt).SetUint64(2)},
+		),
+	} {
+		state := NewState(db.NewTestDb())
+		assert.NoError(t, state.Update(0, coreStateUpdate(t, mainnetStateUpdate0)))
+
+		var err error
+		update.NewRoot, err = ExpectedRoot(state, update.StateDiff)
+		assert.NoError(t, err)
+		assert.NoError(t, state.Update(1, update))
+
+		slots, err := state.ContractStorage(addr)
+		assert.NoError(t, err)
+		assert.Equal(t, true, new(felt.Felt).SetUint64(2).Equal(slots[*key]))
+		roots = append(roots, update.NewRoot)
+	}
+
+	for _, root := range roots[1:] {
+		assert.Equal(t, true, roots[0].Equal(root))
+	}
+}
+
+func TestRedeploy(t *testing.T) {
+	testDb := db.NewTestDb()
+	state := NewState(testDb)
+	update0 := coreStateUpdate(t, mainnetStateUpdate0)
+	assert.NoError(t, state.Update(0, update0))
+
+	addr := update0.StateDiff.DeployedContracts[0].Address
+	root, err := state.Root()
+	assert.NoError(t, err)
+	sameClass := &core.StateUpdate{
+		OldRoot: update0.NewRoot,
+		NewRoot: update0.NewRoot,
+		StateDiff: &core.StateDiff{
+			DeployedContracts: update0.StateDiff.DeployedContracts[:1],
+		},
+	}
+	assert.ErrorIs(t, state.Update(1, sameClass), ErrContractAlreadyDeployed)
+	got, err := state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, root.Equal(got))
+
+	classHash := new(felt.Felt).SetUint64(37)
+	key := new(felt.Felt).SetUint64(38)
+	redeploy := &core.StateUpdate{
+		OldRoot: update0.NewRoot,
+		StateDiff: &core.StateDiff{
+			StorageDiffs: map[felt.Felt][]core.StorageDiff{
+				*addr: {{Key: key, Value: new(felt.Felt).SetUint64(39)}},
+			},
+			DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: classHash}},
+		},
+	}
+	redeploy.NewRoot, err = ExpectedRoot(state, redeploy.StateDiff)
+	assert.NoError(t, err)
+	reverse, err := state.UpdateWithReverseDiff(1, redeploy)
+	assert.NoError(t, err)
+
+	got, err = state.GetContractClass(addr)
+	assert.NoError(t, err)
+	assert.Equal(t, true, classHash.Equal(got))
+	slots, err := state.ContractStorage(addr)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(slots))
+	assert.Equal(t, true, new(felt.Felt).SetUint64(39).Equal(slots[*key]))
+
+	// countNodes returns the number of nodes of the storage of the
+	// contract, and of the nodes stored under its address
+	countNodes := func() (nodes, stored int) {
+		assert.NoError(t, testDb.View(func(txn *badger.Txn) error {
+			storage, err := state.getContractStorage(addr, txn)
+			if err != nil {
+				return err
+			}
+			if err = storage.IterateNodes(func(*bitset.BitSet, *trie.Node) (bool, error) {
+				nodes++
+				return true, nil
+			}); err != nil {
+				return err
+			}
+
+			for _, prefix := range [][]byte{db.ContractStorage.Key(addr.Marshal()), db.StaleStorage.Key()} {
+				it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+				for it.Rewind(); it.Valid(); it.Next() {
+					stored++
+				}
+				it.Close()
+			}
+			return nil
+		}))
+		return nodes, stored
+	}
+
+	// only the nodes of the new storage are left
+	nodes, stored := countNodes()
+	assert.Equal(t, 1, nodes)
+	assert.Equal(t, nodes, stored)
+
+	// the redeploy is undone by the reverse diff
+	assert.NoError(t, state.checkedUpdate(context.Background(), &core.StateUpdate{
+		OldRoot:   redeploy.NewRoot,
+		NewRoot:   update0.NewRoot,
+		StateDiff: reverse,
+	}, nil, func(*badger.Txn) error { return nil }))
+	slots, err = state.ContractStorage(addr)
+	assert.NoError(t, err)
+	for _, diff := range update0.StateDiff.StorageDiffs[*addr] {
+		assert.Equal(t, true, diff.Value.Equal(slots[*diff.Key]))
+	}
+	nodes, stored = countNodes()
+	assert.Equal(t, nodes, stored)
 }
 
 func TestUpdateNonce(t *testing.T) {
@@ -249,7 +504,10 @@ func TestUpdateNonce(t *testing.T) {
 	testDb := db.NewTestDb()
 	state := NewState(testDb)
 
-	assert.NoError(t, state.Update(coreUpdate))
+	_, err := state.GetContractNonce(addr)
+	assert.ErrorIs(t, err, ErrContractNotFound)
+
+	assert.NoError(t, state.Update(0, coreUpdate))
 
 	nonce, err := state.GetContractNonce(addr)
 	assert.NoError(t, err)
@@ -263,9 +521,883 @@ func TestUpdateNonce(t *testing.T) {
 
 	nonce.SetUint64(1)
 	coreUpdate.StateDiff.Nonces[*addr] = nonce
-	assert.NoError(t, state.Update(coreUpdate))
+	assert.NoError(t, state.Update(1, coreUpdate))
 
 	newNonce, err := state.GetContractNonce(addr)
 	assert.NoError(t, err)
 	assert.Equal(t, true, nonce.Equal(newNonce))
 }
+
+func TestGetContractsBatch(t *testing.T) {
+	state := NewState(db.NewTestDb())
+
+	deployed := make([]core.DeployedContract, 2)
+	for idx := range deployed {
+		deployed[idx].Address, _ = new(felt.Felt).SetRandom()
+		deployed[idx].ClassHash, _ = new(felt.Felt).SetRandom()
+	}
+	assert.NoError(t, state.db.Update(func(txn *badger.Txn) error {
+		for _, contract := range deployed {
+			if err := state.putNewContract(contract.Address, contract.ClassHash, txn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	t.Run("all deployed", func(t *testing.T) {
+		addrs := []*felt.Felt{deployed[1].Address, deployed[0].Address}
+		classHashes, err := state.GetContractClasses(addrs)
+		assert.NoError(t, err)
+		assert.Equal(t, true, deployed[1].ClassHash.Equal(classHashes[0]))
+		assert.Equal(t, true, deployed[0].ClassHash.Equal(classHashes[1]))
+
+		nonces, err := state.GetContractNonces(addrs)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(nonces))
+		for _, nonce := range nonces {
+			assert.Equal(t, true, nonce.IsZero())
+		}
+	})
+
+	t.Run("some not deployed", func(t *testing.T) {
+		unknown, _ := new(felt.Felt).SetRandom()
+		addrs := []*felt.Felt{deployed[0].Address, unknown}
+
+		for name, get := range map[string]func([]*felt.Felt) ([]*felt.Felt, error){
+			"classes": state.GetContractClasses,
+			"nonces":  state.GetContractNonces,
+		} {
+			t.Run(name, func(t *testing.T) {
+				values, err := get(addrs)
+				assert.ErrorIs(t, err, ErrContractNotFound)
+				notFound, ok := err.(*ErrContractsNotFound)
+				assert.Equal(t, true, ok)
+				assert.Equal(t, []*felt.Felt{unknown}, notFound.Addresses)
+
+				assert.Equal(t, 2, len(values))
+				assert.NotNil(t, values[0])
+				assert.Nil(t, values[1])
+			})
+		}
+	})
+}
+
+func TestIterateContracts(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	update0, update1 := coreStateUpdate(t, mainnetStateUpdate0), coreStateUpdate(t, mainnetStateUpdate1)
+	assert.NoError(t, state.Update(0, update0))
+	assert.NoError(t, state.Update(1, update1))
+
+	deployed := make(map[felt.Felt]*felt.Felt)
+	for _, update := range []*core.StateUpdate{update0, update1} {
+		for _, contract := range update.StateDiff.DeployedContracts {
+			deployed[*contract.Address] = contract.ClassHash
+		}
+	}
+
+	visited := 0
+	assert.NoError(t, state.IterateContracts(func(addr, classHash, nonce, storageRoot *felt.Felt) (bool, error) {
+		visited++
+		assert.Equal(t, true, deployed[*addr].Equal(classHash))
+		assert.Equal(t, true, nonce.IsZero())
+
+		// the contract commitment in the state trie must match
+		return true, state.db.View(func(txn *badger.Txn) error {
+			storage, err := state.getStateStorage(txn)
+			if err != nil {
+				return err
+			}
+			commitment, err := storage.Get(addr)
+			assert.Equal(t, true, CalculateContractCommitment(storageRoot, classHash, nonce).Equal(commitment))
+			return err
+		})
+	}))
+	assert.Equal(t, len(deployed), visited)
+
+	visited = 0
+	assert.NoError(t, state.IterateContracts(func(_, _, _, _ *felt.Felt) (bool, error) {
+		visited++
+		return false, nil
+	}))
+	assert.Equal(t, 1, visited)
+}
+
+func TestContractStorage(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	update0 := coreStateUpdate(t, mainnetStateUpdate0)
+	assert.NoError(t, state.Update(0, update0))
+
+	for _, contract := range update0.StateDiff.DeployedContracts {
+		want := make(map[felt.Felt]*felt.Felt)
+		for _, diff := range update0.StateDiff.StorageDiffs[*contract.Address] {
+			if diff.Value.IsZero() {
+				delete(want, *diff.Key)
+			} else {
+				want[*diff.Key] = diff.Value
+			}
+		}
+
+		slots, err := state.ContractStorage(contract.Address)
+		assert.NoError(t, err)
+		assert.Equal(t, len(want), len(slots))
+		for key, value := range want {
+			assert.Equal(t, true, value.Equal(slots[key]))
+		}
+	}
+
+	t.Run("contract without storage", func(t *testing.T) {
+		addr := new(felt.Felt).SetUint64(37)
+		deploy := &core.StateDiff{
+			DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: addr}},
+		}
+		newRoot, err := ExpectedRoot(state, deploy)
+		assert.NoError(t, err)
+		assert.NoError(t, state.Update(1, &core.StateUpdate{
+			OldRoot:   update0.NewRoot,
+			NewRoot:   newRoot,
+			StateDiff: deploy,
+		}))
+
+		slots, err := state.ContractStorage(addr)
+		assert.NoError(t, err)
+		assert.NotNil(t, slots)
+		assert.Equal(t, 0, len(slots))
+	})
+
+	t.Run("missing contract", func(t *testing.T) {
+		_, err := state.ContractStorage(new(felt.Felt).SetUint64(38))
+		assert.ErrorIs(t, err, ErrContractNotFound)
+	})
+
+	t.Run("storage limit", func(t *testing.T) {
+		limited := NewState(state.db).WithStorageLimit(2)
+		addr := update0.StateDiff.DeployedContracts[0].Address
+		want, err := state.ContractStorage(addr)
+		assert.NoError(t, err)
+		assert.Equal(t, true, len(want) > 2)
+
+		_, err = limited.ContractStorage(addr)
+		assert.ErrorIs(t, err, ErrStorageLimitExceeded)
+
+		// the pages hold every slot once
+		got := make(map[felt.Felt]*felt.Felt)
+		var start *felt.Felt
+		for pages := 1; ; pages++ {
+			slots, next, err := limited.ContractStoragePage(addr, start)
+			assert.NoError(t, err)
+			assert.Equal(t, true, len(slots) <= 2)
+			for key, value := range slots {
+				assert.NotContains(t, got, key)
+				got[key] = value
+			}
+			if next == nil {
+				assert.Equal(t, (len(want)+1)/2, pages)
+				break
+			}
+			start = next
+		}
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestRecomputeRoot(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	root, err := state.RecomputeRoot()
+	assert.NoError(t, err)
+	assert.Equal(t, true, root.IsZero())
+
+	for idx, updateJson := range [][]byte{mainnetStateUpdate0, mainnetStateUpdate1, mainnetStateUpdate2} {
+		update := coreStateUpdate(t, updateJson)
+		assert.NoError(t, state.Update(uint64(idx), update))
+
+		root, err = state.RecomputeRoot()
+		assert.NoError(t, err)
+		assert.Equal(t, true, update.NewRoot.Equal(root), idx)
+	}
+	want := root
+
+	// a leaf of the contract trie that is not backed by a contract
+	assert.NoError(t, state.db.Update(func(txn *badger.Txn) error {
+		storage, err := state.getStateStorage(txn)
+		if err != nil {
+			return err
+		}
+		if err = storage.Put(new(felt.Felt).SetUint64(37), new(felt.Felt).SetUint64(38)); err != nil {
+			return err
+		}
+		return state.putStateStorage(storage, txn)
+	}))
+
+	stored, err := state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, false, want.Equal(stored))
+	root, err = state.RecomputeRoot()
+	assert.NoError(t, err)
+	assert.Equal(t, true, want.Equal(root))
+}
+
+func TestTrieHeights(t *testing.T) {
+	heights := TrieHeights{Global: 3, ContractStorage: 2}
+	state := NewState(db.NewTestDb()).WithTrieHeights(heights)
+	classHash := new(felt.Felt).SetUint64(37)
+
+	// every key of every trie is set, up to the largest ones, but for the
+	// zero address where no contract can be deployed
+	diff := &core.StateDiff{StorageDiffs: make(map[felt.Felt][]core.StorageDiff)}
+	contracts := trie.NewTrie(trie.NewMapStorage(), heights.Global, nil)
+	for addr := uint64(1); addr < 1<<heights.Global; addr++ {
+		addrFelt := new(felt.Felt).SetUint64(addr)
+		diff.DeployedContracts = append(diff.DeployedContracts,
+			core.DeployedContract{Address: addrFelt, ClassHash: classHash})
+
+		storage := trie.NewTrie(trie.NewMapStorage(), heights.ContractStorage, nil)
+		for key := uint64(0); key < 1<<heights.ContractStorage; key++ {
+			keyFelt := new(felt.Felt).SetUint64(key)
+			value := new(felt.Felt).SetUint64(addr<<8 | key + 1)
+			diff.StorageDiffs[*addrFelt] = append(diff.StorageDiffs[*addrFelt],
+				core.StorageDiff{Key: keyFelt, Value: value})
+			assert.NoError(t, storage.Put(keyFelt, value))
+		}
+		storageRoot, err := storage.Root()
+		assert.NoError(t, err)
+		assert.NoError(t, contracts.Put(addrFelt, CalculateContractCommitment(storageRoot, classHash, new(felt.Felt))))
+	}
+	want, err := contracts.Root()
+	assert.NoError(t, err)
+
+	assert.NoError(t, state.Update(0, &core.StateUpdate{OldRoot: new(felt.Felt), NewRoot: want, StateDiff: diff}))
+	root, err := state.RecomputeRoot()
+	assert.NoError(t, err)
+	assert.Equal(t, true, want.Equal(root))
+
+	t.Run("default heights", func(t *testing.T) {
+		state := NewState(db.NewTestDb())
+		var mismatch *ErrMismatchedRoot
+		err := state.Update(0, &core.StateUpdate{OldRoot: new(felt.Felt), NewRoot: want, StateDiff: diff})
+		assert.Equal(t, true, errors.As(err, &mismatch))
+	})
+
+	t.Run("database written with other heights", func(t *testing.T) {
+		reopened := NewState(state.db)
+		_, err := reopened.Root()
+		assert.ErrorIs(t, err, ErrTrieHeightsMismatch)
+		_, err = reopened.ContractStorage(new(felt.Felt).SetUint64(1))
+		assert.ErrorIs(t, err, ErrTrieHeightsMismatch)
+
+		reopened = NewState(state.db).WithTrieHeights(TrieHeights{Global: heights.Global, ContractStorage: 251})
+		_, err = reopened.ContractStorage(new(felt.Felt).SetUint64(1))
+		assert.ErrorIs(t, err, ErrTrieHeightsMismatch)
+
+		got, err := NewState(state.db).WithTrieHeights(heights).Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, want.Equal(got))
+	})
+}
+
+func TestSimulateUpdate(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	update0 := coreStateUpdate(t, mainnetStateUpdate0)
+
+	newRoot, err := state.SimulateUpdate(update0)
+	assert.NoError(t, err)
+	assert.Equal(t, true, update0.NewRoot.Equal(newRoot))
+
+	// state is left untouched
+	root, err := state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, root.IsZero())
+	_, err = state.GetContractNonce(update0.StateDiff.DeployedContracts[0].Address)
+	assert.ErrorIs(t, err, ErrContractNotFound)
+
+	// a mismatching new root is not an error
+	update0.NewRoot = new(felt.Felt).SetUint64(37)
+	newRoot, err = state.SimulateUpdate(update0)
+	assert.NoError(t, err)
+	assert.Equal(t, false, update0.NewRoot.Equal(newRoot))
+
+	// old root is still checked
+	update1 := coreStateUpdate(t, mainnetStateUpdate1)
+	_, err = state.SimulateUpdate(update1)
+	var mismatch *ErrMismatchedRoot
+	assert.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, true, mismatch.IsOld)
+
+	assert.NoError(t, state.Update(0, coreStateUpdate(t, mainnetStateUpdate0)))
+	newRoot, err = state.SimulateUpdate(update1)
+	assert.NoError(t, err)
+	assert.NoError(t, state.Update(1, update1))
+	root, err = state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, newRoot.Equal(root))
+}
+
+func TestUpdateWithReverseDiff(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	updates := []*core.StateUpdate{
+		coreStateUpdate(t, mainnetStateUpdate0),
+		coreStateUpdate(t, mainnetStateUpdate1),
+		coreStateUpdate(t, mainnetStateUpdate2),
+	}
+
+	// overwrite and clear storage, bump a nonce and declare a class
+	addr := updates[0].StateDiff.DeployedContracts[0].Address
+	written := updates[0].StateDiff.StorageDiffs[*addr][0]
+	update3 := &core.StateUpdate{
+		OldRoot: updates[2].NewRoot,
+		StateDiff: &core.StateDiff{
+			StorageDiffs: map[felt.Felt][]core.StorageDiff{
+				*addr: {
+					{Key: written.Key, Value: new(felt.Felt)},
+					{Key: new(felt.Felt).SetUint64(37), Value: new(felt.Felt).SetUint64(44)},
+				},
+			},
+			Nonces: map[felt.Felt]*felt.Felt{*addr: new(felt.Felt).SetUint64(1)},
+			DeclaredV1Classes: []core.DeclaredV1Class{
+				{ClassHash: new(felt.Felt).SetUint64(1), CompiledClassHash: new(felt.Felt).SetUint64(2)},
+			},
+		},
+	}
+
+	reverses := make([]*core.StateDiff, 0, len(updates)+1)
+	for idx, update := range updates {
+		reverse, err := state.UpdateWithReverseDiff(uint64(idx), update)
+		assert.NoError(t, err)
+		reverses = append(reverses, reverse)
+	}
+	var err error
+	update3.NewRoot, err = state.SimulateUpdate(update3)
+	assert.NoError(t, err)
+	reverse, err := state.UpdateWithReverseDiff(3, update3)
+	assert.NoError(t, err)
+	updates, reverses = append(updates, update3), append(reverses, reverse)
+
+	assert.Equal(t, true, reverse.Equal(&core.StateDiff{
+		StorageDiffs: map[felt.Felt][]core.StorageDiff{
+			*addr: {
+				{Key: written.Key, Value: written.Value},
+				{Key: new(felt.Felt).SetUint64(37), Value: new(felt.Felt)},
+			},
+		},
+		Nonces:           map[felt.Felt]*felt.Felt{*addr: new(felt.Felt)},
+		RemovedV1Classes: []*felt.Felt{new(felt.Felt).SetUint64(1)},
+	}))
+	assert.Equal(t, len(updates[0].StateDiff.DeployedContracts), len(reverses[0].RemovedContracts))
+
+	// reverse diffs are applied without being persisted as block updates
+	for idx := len(updates) - 1; idx >= 0; idx-- {
+		err = state.checkedUpdate(context.Background(), &core.StateUpdate{
+			OldRoot:   updates[idx].NewRoot,
+			NewRoot:   updates[idx].OldRoot,
+			StateDiff: reverses[idx],
+		}, nil, func(*badger.Txn) error { return nil })
+		assert.NoError(t, err)
+	}
+
+	root, err := state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, root.IsZero())
+	_, err = state.GetContractNonce(addr)
+	assert.ErrorIs(t, err, ErrContractNotFound)
+
+	// reverted updates can be applied again
+	for idx, update := range updates {
+		assert.NoError(t, state.Update(uint64(idx), update))
+	}
+
+	state.DeferCommitments()
+	_, err = state.UpdateWithReverseDiff(4, updates[0])
+	assert.Error(t, err)
+}
+
+func TestReplayUpdate(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	updates := []*core.StateUpdate{
+		coreStateUpdate(t, mainnetStateUpdate0),
+		coreStateUpdate(t, mainnetStateUpdate1),
+		coreStateUpdate(t, mainnetStateUpdate2),
+	}
+
+	// roots are not checked
+	for idx, update := range updates {
+		replayed := *update
+		replayed.OldRoot = new(felt.Felt).SetUint64(1)
+		replayed.NewRoot = new(felt.Felt).SetUint64(2)
+		assert.NoError(t, state.ReplayUpdate(uint64(idx), &replayed))
+	}
+
+	root, err := state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, updates[2].NewRoot.Equal(root))
+
+	height, err := state.Height()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), height)
+
+	state.DeferCommitments()
+	assert.Error(t, state.ReplayUpdate(3, updates[0]))
+}
+
+// cancelAfter is a context that is cancelled once its error has been
+// checked checks times
+type cancelAfter struct {
+	context.Context
+	checks int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.checks == 0 {
+		return context.Canceled
+	}
+	c.checks--
+	return nil
+}
+
+func TestUpdateCtx(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	update0, update1 := coreStateUpdate(t, mainnetStateUpdate0), coreStateUpdate(t, mainnetStateUpdate1)
+	assert.NoError(t, state.UpdateCtx(context.Background(), 0, update0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, state.UpdateCtx(ctx, 1, update1), context.Canceled)
+
+	// cancelled midway, after the first contract is updated
+	assert.ErrorIs(t, state.UpdateCtx(&cancelAfter{Context: context.Background(), checks: 2}, 1, update1),
+		context.Canceled)
+
+	root, err := state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, update0.NewRoot.Equal(root))
+	height, err := state.Height()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), height)
+
+	assert.NoError(t, state.UpdateCtx(context.Background(), 1, update1))
+	root, err = state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, update1.NewRoot.Equal(root))
+}
+
+func TestHeight(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	height, err := state.Height()
+	assert.ErrorIs(t, err, ErrNotSynced)
+	assert.Equal(t, uint64(0), height)
+
+	assert.NoError(t, state.Update(0, coreStateUpdate(t, mainnetStateUpdate0)))
+	height, err = state.Height()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), height)
+
+	// failed updates do not advance the height
+	assert.Error(t, state.Update(2, coreStateUpdate(t, mainnetStateUpdate2)))
+	assert.NoError(t, state.Update(1, coreStateUpdate(t, mainnetStateUpdate1)))
+	height, err = state.Height()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), height)
+
+	// pending updates are applied on Commit
+	state.DeferCommitments()
+	assert.NoError(t, state.Update(2, coreStateUpdate(t, mainnetStateUpdate2)))
+	height, err = state.Height()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), height)
+	assert.NoError(t, state.Commit())
+	height, err = state.Height()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), height)
+}
+
+func TestStateAtBlock(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	update0, update1 := coreStateUpdate(t, mainnetStateUpdate0), coreStateUpdate(t, mainnetStateUpdate1)
+
+	_, err := state.StateAtBlockNumber(0)
+	assert.ErrorIs(t, err, ErrStateUpdateNotFound)
+	_, err = state.StateAtBlockHash(update0.BlockHash)
+	assert.ErrorIs(t, err, ErrStateUpdateNotFound)
+
+	assert.NoError(t, state.Update(0, update0))
+	assert.NoError(t, state.Update(1, update1))
+
+	got, err := state.StateAtBlockNumber(1)
+	assert.NoError(t, err)
+	assert.Equal(t, state, got)
+	got, err = state.StateAtBlockHash(update1.BlockHash)
+	assert.NoError(t, err)
+	assert.Equal(t, state, got)
+
+	_, err = state.StateAtBlockNumber(0)
+	assert.ErrorIs(t, err, ErrHistoricalStateUnavailable)
+	_, err = state.StateAtBlockHash(update0.BlockHash)
+	assert.ErrorIs(t, err, ErrHistoricalStateUnavailable)
+
+	_, err = state.StateAtBlockNumber(2)
+	assert.ErrorIs(t, err, ErrStateUpdateNotFound)
+	_, err = state.StateAtBlockHash(new(felt.Felt).SetUint64(37))
+	assert.ErrorIs(t, err, ErrStateUpdateNotFound)
+}
+
+func TestRootAtBlock(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	update0, update1 := coreStateUpdate(t, mainnetStateUpdate0), coreStateUpdate(t, mainnetStateUpdate1)
+
+	_, err := state.RootAtBlock(0)
+	assert.ErrorIs(t, err, ErrStateUpdateNotFound)
+
+	assert.NoError(t, state.Update(0, update0))
+	assert.NoError(t, state.Update(1, update1))
+
+	root, err := state.RootAtBlock(0)
+	assert.NoError(t, err)
+	assert.Equal(t, true, update0.NewRoot.Equal(root))
+	root, err = state.RootAtBlock(1)
+	assert.NoError(t, err)
+	assert.Equal(t, true, update1.NewRoot.Equal(root))
+
+	_, err = state.RootAtBlock(2)
+	assert.ErrorIs(t, err, ErrStateUpdateNotFound)
+}
+
+func TestDeferCommitments(t *testing.T) {
+	updates := []*core.StateUpdate{
+		coreStateUpdate(t, mainnetStateUpdate0),
+		coreStateUpdate(t, mainnetStateUpdate1),
+		coreStateUpdate(t, mainnetStateUpdate2),
+	}
+
+	state := NewState(db.NewTestDb())
+	state.DeferCommitments()
+	for idx, update := range updates {
+		assert.NoError(t, state.Update(uint64(idx), update))
+	}
+
+	// nothing is applied before Commit
+	root, err := state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, root.IsZero())
+
+	// updates must follow each other
+	var mismatch *ErrMismatchedRoot
+	assert.ErrorAs(t, state.Update(1, updates[1]), &mismatch)
+
+	assert.NoError(t, state.Commit())
+	root, err = state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, updates[2].NewRoot.Equal(root))
+
+	t.Run("mismatching new root", func(t *testing.T) {
+		state := NewState(db.NewTestDb())
+		state.DeferCommitments()
+
+		update0 := coreStateUpdate(t, mainnetStateUpdate0)
+		update1 := coreStateUpdate(t, mainnetStateUpdate1)
+		update1.NewRoot = new(felt.Felt).SetUint64(37)
+		assert.NoError(t, state.Update(0, update0))
+		assert.NoError(t, state.Update(1, update1))
+
+		assert.ErrorAs(t, state.Commit(), &mismatch)
+		assert.Equal(t, false, mismatch.IsOld)
+		// pending updates are dropped and state is untouched
+		assert.NoError(t, state.Commit())
+		root, err := state.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, root.IsZero())
+	})
+
+	t.Run("redeploy", func(t *testing.T) {
+		immediate := NewState(db.NewTestDb())
+		update0 := coreStateUpdate(t, mainnetStateUpdate0)
+		assert.NoError(t, immediate.Update(0, update0))
+
+		// a contract writes a slot and bumps its nonce, is replaced by a
+		// contract of another class, and then by one of its first class
+		deployed := update0.StateDiff.DeployedContracts[0]
+		diffs := []*core.StateDiff{
+			{
+				StorageDiffs: map[felt.Felt][]core.StorageDiff{
+					*deployed.Address: {{Key: new(felt.Felt).SetUint64(37), Value: new(felt.Felt).SetUint64(38)}},
+				},
+				Nonces: map[felt.Felt]*felt.Felt{*deployed.Address: new(felt.Felt).SetUint64(1)},
+			},
+			{
+				DeployedContracts: []core.DeployedContract{
+					{Address: deployed.Address, ClassHash: new(felt.Felt).SetUint64(39)},
+				},
+			},
+			{
+				DeployedContracts: []core.DeployedContract{deployed},
+			},
+		}
+		updates := []*core.StateUpdate{update0}
+		for idx, diff := range diffs {
+			update := &core.StateUpdate{OldRoot: updates[idx].NewRoot, StateDiff: diff}
+			var err error
+			update.NewRoot, err = ExpectedRoot(immediate, diff)
+			assert.NoError(t, err)
+			assert.NoError(t, immediate.Update(uint64(idx+1), update))
+			updates = append(updates, update)
+		}
+
+		for _, count := range []int{3, 4} {
+			state := NewState(db.NewTestDb())
+			state.DeferCommitments()
+			for idx, update := range updates[:count] {
+				assert.NoError(t, state.Update(uint64(idx), update))
+			}
+			assert.NoError(t, state.Commit())
+			root, err := state.Root()
+			assert.NoError(t, err)
+			assert.Equal(t, true, updates[count-1].NewRoot.Equal(root), count)
+		}
+	})
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	updates := []*core.StateUpdate{
+		coreStateUpdate(b, mainnetStateUpdate0),
+		coreStateUpdate(b, mainnetStateUpdate1),
+		coreStateUpdate(b, mainnetStateUpdate2),
+	}
+
+	for name, deferCommitments := range map[string]bool{"immediate": false, "deferred": true} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				state := NewState(db.NewTestDb())
+				if deferCommitments {
+					state.DeferCommitments()
+				}
+				for idx, update := range updates {
+					if err := state.Update(uint64(idx), update); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := state.Commit(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUpdateWideContract(b *testing.B) {
+	state := NewState(db.NewTestDb())
+	update0 := coreStateUpdate(b, mainnetStateUpdate0)
+	if err := state.Update(0, update0); err != nil {
+		b.Fatal(err)
+	}
+
+	// every deployed contract bumps its nonce and writes many slots
+	const slots = 1000
+	diff := &core.StateDiff{
+		StorageDiffs: make(map[felt.Felt][]core.StorageDiff),
+		Nonces:       make(map[felt.Felt]*felt.Felt),
+	}
+	for _, contract := range update0.StateDiff.DeployedContracts {
+		storageDiffs := make([]core.StorageDiff, 0, slots)
+		for slot := uint64(1); slot <= slots; slot++ {
+			storageDiffs = append(storageDiffs, core.StorageDiff{
+				Key:   new(felt.Felt).SetUint64(slot),
+				Value: new(felt.Felt).SetUint64(slot),
+			})
+		}
+		diff.StorageDiffs[*contract.Address] = storageDiffs
+		diff.Nonces[*contract.Address] = new(felt.Felt).SetUint64(1)
+	}
+	update := &core.StateUpdate{OldRoot: update0.NewRoot, StateDiff: diff}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := state.SimulateUpdate(update); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	path := t.TempDir()
+	testDb, err := db.NewDb(path)
+	assert.NoError(t, err)
+	assert.NoError(t, NewState(testDb).Update(0, coreStateUpdate(t, mainnetStateUpdate0)))
+	assert.NoError(t, testDb.Close())
+
+	readOnlyDb, err := db.NewReadOnly(path)
+	assert.NoError(t, err)
+	defer readOnlyDb.Close()
+	state := NewState(readOnlyDb)
+
+	root, err := state.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, coreStateUpdate(t, mainnetStateUpdate0).NewRoot.Equal(root))
+
+	assert.ErrorIs(t, state.Update(1, coreStateUpdate(t, mainnetStateUpdate1)), db.ErrReadOnly)
+	assert.ErrorIs(t, state.PutClass(root, new(core.Class)), db.ErrReadOnly)
+
+	// tries opened in a read-only Txn reject writes as well
+	assert.ErrorIs(t, readOnlyDb.View(func(txn *badger.Txn) error {
+		storage, err := state.getStateStorage(txn)
+		if err != nil {
+			return err
+		}
+		if _, err = storage.Proof(root); err != nil {
+			return err
+		}
+		return storage.Put(root, root)
+	}), db.ErrReadOnly)
+}
+
+func TestClass(t *testing.T) {
+	state := NewState(db.NewTestDb())
+
+	classHash, _ := new(felt.Felt).SetRandom()
+	_, err := state.GetClass(classHash)
+	assert.EqualError(t, err, "Key not found")
+
+	selector, _ := new(felt.Felt).SetRandom()
+	offset := new(felt.Felt).SetUint64(37)
+	class := &core.Class{
+		APIVersion:   new(felt.Felt),
+		Externals:    []core.EntryPoint{{Selector: selector, Offset: offset}},
+		Constructors: []core.EntryPoint{{Selector: offset, Offset: selector}},
+		Builtins:     []*felt.Felt{new(felt.Felt).SetBytes([]byte("pedersen"))},
+		ProgramHash:  selector,
+		Bytecode:     []*felt.Felt{offset, selector, offset},
+	}
+	assert.NoError(t, state.PutClass(classHash, class))
+
+	got, err := state.GetClass(classHash)
+	assert.NoError(t, err)
+	assert.Equal(t, class, got)
+	assert.Equal(t, true, class.Hash().Equal(got.Hash()))
+}
+
+var (
+	//go:embed testdata/mainnet_state_update_0.json
+	mainnetStateUpdate0 []byte
+	//go:embed testdata/mainnet_state_update_1.json
+	mainnetStateUpdate1 []byte
+	//go:embed testdata/mainnet_state_update_2.json
+	mainnetStateUpdate2 []byte
+)
+
+func coreStateUpdate(t testing.TB, updateJson []byte) *core.StateUpdate {
+	var gatewayUpdate clients.StateUpdate
+	assert.NoError(t, json.Unmarshal(updateJson, &gatewayUpdate))
+
+	coreUpdate := &core.StateUpdate{
+		BlockHash: gatewayUpdate.BlockHash,
+		NewRoot:   gatewayUpdate.NewRoot,
+		OldRoot:   gatewayUpdate.OldRoot,
+		StateDiff: &core.StateDiff{
+			StorageDiffs: make(map[felt.Felt][]core.StorageDiff),
+		},
+	}
+	for _, contract := range gatewayUpdate.StateDiff.DeployedContracts {
+		coreUpdate.StateDiff.DeployedContracts = append(coreUpdate.StateDiff.DeployedContracts, core.DeployedContract{
+			Address:   contract.Address,
+			ClassHash: contract.ClassHash,
+		})
+	}
+	for addrStr, diffs := range gatewayUpdate.StateDiff.StorageDiffs {
+		addr, err := new(felt.Felt).SetString(addrStr)
+		assert.NoError(t, err)
+		for _, diff := range diffs {
+			coreUpdate.StateDiff.StorageDiffs[*addr] = append(coreUpdate.StateDiff.StorageDiffs[*addr], core.StorageDiff{
+				Key:   diff.Key,
+				Value: diff.Value,
+			})
+		}
+	}
+	return coreUpdate
+}
+
+func TestClassesTrie(t *testing.T) {
+	state := NewState(db.NewTestDb())
+
+	for idx, updateJson := range [][]byte{mainnetStateUpdate0, mainnetStateUpdate1, mainnetStateUpdate2} {
+		assert.NoError(t, state.Update(uint64(idx), coreStateUpdate(t, updateJson)))
+	}
+
+	// without declared v1 classes, the state root is the contract trie root
+	oldRoot, err := state.Root()
+	assert.NoError(t, err)
+	contractRoot, _ := new(felt.Felt).SetString("0x3ceee867d50b5926bb88c0ec7e0b9c20ae6b537e74aac44b8fcf6bb6da138d9")
+	assert.Equal(t, true, contractRoot.Equal(oldRoot))
+
+	classHash, _ := new(felt.Felt).SetString("0xDEADBEEF")
+	compiledClassHash, _ := new(felt.Felt).SetString("0xBEEFDEAD")
+	newRoot, _ := new(felt.Felt).SetString("0x46f1033cfb8e0b2e16e1ad6f95c41fd3a123f168fe72665452b6cddbc1d8e7a")
+	// on both sides of the upgrade, the class trie is empty
+	for _, version := range []string{"", "0.10.3", "0.11.0"} {
+		root, err := state.RootAtVersion(version)
+		assert.NoError(t, err)
+		assert.Equal(t, true, contractRoot.Equal(root))
+	}
+
+	declaration := &core.StateDiff{
+		DeclaredContracts: []*felt.Felt{classHash},
+		DeclaredV1Classes: []core.DeclaredV1Class{
+			{ClassHash: classHash, CompiledClassHash: compiledClassHash},
+		},
+	}
+	assert.NoError(t, state.Update(3, &core.StateUpdate{
+		OldRoot:   oldRoot,
+		NewRoot:   newRoot,
+		StateDiff: declaration,
+	}))
+
+	classesRoot := func() *felt.Felt {
+		var root *felt.Felt
+		assert.NoError(t, state.db.View(func(txn *badger.Txn) error {
+			classes, err := state.getClassesStorage(txn)
+			if err != nil {
+				return err
+			}
+			root, err = classes.Root()
+			return err
+		}))
+		return root
+	}
+	declaredRoot := classesRoot()
+
+	for version, want := range map[string]*felt.Felt{
+		"0.10.3":   contractRoot,
+		"0.11.0":   newRoot,
+		"0.11.0.2": newRoot,
+	} {
+		root, err := state.RootAtVersion(version)
+		assert.NoError(t, err)
+		assert.Equal(t, true, want.Equal(root), version)
+	}
+
+	// declaring the same classes again is a no-op, e.g. when an update
+	// is re-applied after a restart
+	assert.NoError(t, state.Update(4, &core.StateUpdate{
+		OldRoot:   newRoot,
+		NewRoot:   newRoot,
+		StateDiff: declaration,
+	}))
+	assert.Equal(t, true, declaredRoot.Equal(classesRoot()))
+}
+
+func TestCommitsToClassTrie(t *testing.T) {
+	for version, want := range map[string]bool{
+		"":         false,
+		"0":        false,
+		"0.9.1":    false,
+		"0.10.3":   false,
+		"0.11":     true,
+		"0.11.0":   true,
+		"0.11.0.2": true,
+		"0.12.0":   true,
+		"1.0.0":    true,
+	} {
+		got, err := commitsToClassTrie(version)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, version)
+	}
+
+	_, err := commitsToClassTrie("v0.11.0")
+	assert.Error(t, err)
+}
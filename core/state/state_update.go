@@ -0,0 +1,245 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// ErrStateUpdateNotFound is returned when no state update is stored for a
+// block
+var ErrStateUpdateNotFound = errors.New("state update not found")
+
+// StateDiffReader reads the state updates persisted by [State.Update]
+type StateDiffReader struct {
+	db *badger.DB
+}
+
+func NewStateDiffReader(db *badger.DB) StateDiffReader {
+	return StateDiffReader{db: db}
+}
+
+// DiffReader returns a [StateDiffReader] over the state updates applied
+// to the State.
+func (s *State) DiffReader() StateDiffReader {
+	return NewStateDiffReader(s.db)
+}
+
+// StateUpdate returns the state update of the block with the given
+// number, or [ErrStateUpdateNotFound] if it has not been applied.
+func (r StateDiffReader) StateUpdate(blockNumber uint64) (*core.StateUpdate, error) {
+	var update *core.StateUpdate
+	return update, r.db.View(func(txn *badger.Txn) error {
+		var err error
+		update, err = getStateUpdate(blockNumber, txn)
+		return err
+	})
+}
+
+// StateUpdateByHash returns the state update of the block with the given
+// hash, or [ErrStateUpdateNotFound] if it has not been applied.
+func (r StateDiffReader) StateUpdateByHash(blockHash *felt.Felt) (*core.StateUpdate, error) {
+	var update *core.StateUpdate
+	return update, r.db.View(func(txn *badger.Txn) error {
+		blockNumber, err := blockNumberByHash(blockHash, txn)
+		if err != nil {
+			return err
+		}
+
+		update, err = getStateUpdate(blockNumber, txn)
+		return err
+	})
+}
+
+// LatestStateUpdate returns the state update of the last applied block
+// along with its number, or [ErrStateUpdateNotFound] if no update has
+// been applied.
+func (r StateDiffReader) LatestStateUpdate() (uint64, *core.StateUpdate, error) {
+	var blockNumber uint64
+	var update *core.StateUpdate
+	return blockNumber, update, r.db.View(func(txn *badger.Txn) error {
+		var err error
+		if blockNumber, err = latestBlockNumber(txn); err != nil {
+			return err
+		}
+		update, err = getStateUpdate(blockNumber, txn)
+		return err
+	})
+}
+
+// latestBlockNumber returns the number of the last applied block in the
+// given Txn context, or [ErrStateUpdateNotFound] if no block has been
+// applied.
+func latestBlockNumber(txn *badger.Txn) (uint64, error) {
+	item, err := txn.Get(db.State.Key([]byte(heightKey)))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, ErrStateUpdateNotFound
+	} else if err != nil {
+		return 0, err
+	}
+
+	var blockNumber uint64
+	return blockNumber, item.Value(func(val []byte) error {
+		blockNumber = binary.BigEndian.Uint64(val)
+		return nil
+	})
+}
+
+// blockNumberByHash returns the number of the applied block with the given
+// hash in the given Txn context, or [ErrStateUpdateNotFound] if no such
+// block has been applied.
+func blockNumberByHash(blockHash *felt.Felt, txn *badger.Txn) (uint64, error) {
+	item, err := txn.Get(db.BlockNumbers.Key(blockHash.Marshal()))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, ErrStateUpdateNotFound
+	} else if err != nil {
+		return 0, err
+	}
+
+	var blockNumber uint64
+	return blockNumber, item.Value(func(val []byte) error {
+		blockNumber = binary.BigEndian.Uint64(val)
+		return nil
+	})
+}
+
+// stateRoot returns the state commitment recorded for the given block in
+// the given Txn context. Blocks stored before commitments were recorded
+// on their own fall back to the new root of their state update.
+func stateRoot(blockNumber uint64, txn *badger.Txn) (*felt.Felt, error) {
+	numberBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(numberBytes, blockNumber)
+
+	item, err := txn.Get(db.StateRoots.Key(numberBytes))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		update, err := getStateUpdate(blockNumber, txn)
+		if err != nil {
+			return nil, err
+		}
+		if update.NewRoot == nil {
+			return nil, ErrStateUpdateNotFound
+		}
+		return update.NewRoot, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var root *felt.Felt
+	return root, item.Value(func(val []byte) error {
+		root = new(felt.Felt).SetBytes(val)
+		return nil
+	})
+}
+
+// storedStateUpdate is the form [core.StateUpdate]s were stored in before
+// [core.StateUpdate.MarshalCompact], maps keyed by felts are flattened to
+// lists. It is only read back for databases written by earlier versions.
+type storedStateUpdate struct {
+	BlockHash         *felt.Felt
+	NewRoot           *felt.Felt
+	OldRoot           *felt.Felt
+	StorageDiffs      []storedStorageDiffs
+	Nonces            []storedNonce
+	DeployedContracts []core.DeployedContract
+	DeclaredContracts []*felt.Felt
+	DeclaredV1Classes []core.DeclaredV1Class
+}
+
+type storedStorageDiffs struct {
+	Address *felt.Felt
+	Diffs   []core.StorageDiff
+}
+
+type storedNonce struct {
+	Address *felt.Felt
+	Nonce   *felt.Felt
+}
+
+// putStateUpdate stores the state update of the given block, encoded with
+// [core.StateUpdate.MarshalCompact] and indexed by both the number and the
+// hash of the block, and records the block as the last applied one in the
+// given Txn context.
+func putStateUpdate(blockNumber uint64, update *core.StateUpdate, txn *badger.Txn) error {
+	updateBytes, err := update.MarshalCompact()
+	if err != nil {
+		return err
+	}
+
+	numberBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(numberBytes, blockNumber)
+	if err = txn.Set(db.StateUpdates.Key(numberBytes), updateBytes); err != nil {
+		return err
+	}
+	if err = txn.Set(db.State.Key([]byte(heightKey)), numberBytes); err != nil {
+		return err
+	}
+	if update.NewRoot != nil {
+		if err = txn.Set(db.StateRoots.Key(numberBytes), update.NewRoot.Marshal()); err != nil {
+			return err
+		}
+	}
+	if update.BlockHash != nil {
+		return txn.Set(db.BlockNumbers.Key(update.BlockHash.Marshal()), numberBytes)
+	}
+	return nil
+}
+
+// getStateUpdate returns the state update of the given block in the
+// given Txn context.
+func getStateUpdate(blockNumber uint64, txn *badger.Txn) (*core.StateUpdate, error) {
+	numberBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(numberBytes, blockNumber)
+
+	item, err := txn.Get(db.StateUpdates.Key(numberBytes))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrStateUpdateNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var update *core.StateUpdate
+	return update, item.Value(func(val []byte) error {
+		var err error
+		update, err = decodeStateUpdate(val)
+		return err
+	})
+}
+
+// decodeStateUpdate decodes a stored state update, either in the compact
+// encoding or in the JSON encoding of [storedStateUpdate] used before.
+func decodeStateUpdate(val []byte) (*core.StateUpdate, error) {
+	if len(val) == 0 || val[0] != '{' {
+		update := new(core.StateUpdate)
+		return update, update.UnmarshalCompact(val)
+	}
+
+	var stored storedStateUpdate
+	if err := json.Unmarshal(val, &stored); err != nil {
+		return nil, err
+	}
+
+	update := &core.StateUpdate{
+		BlockHash: stored.BlockHash,
+		NewRoot:   stored.NewRoot,
+		OldRoot:   stored.OldRoot,
+		StateDiff: &core.StateDiff{
+			StorageDiffs:      make(core.FeltMap[[]core.StorageDiff], len(stored.StorageDiffs)),
+			Nonces:            make(core.FeltMap[*felt.Felt], len(stored.Nonces)),
+			DeployedContracts: stored.DeployedContracts,
+			DeclaredContracts: stored.DeclaredContracts,
+			DeclaredV1Classes: stored.DeclaredV1Classes,
+		},
+	}
+	for _, diffs := range stored.StorageDiffs {
+		update.StateDiff.StorageDiffs.Set(diffs.Address, diffs.Diffs)
+	}
+	for _, nonce := range stored.Nonces {
+		update.StateDiff.Nonces.Set(nonce.Address, nonce.Nonce)
+	}
+	return update, nil
+}
@@ -0,0 +1,109 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateDiffReader(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	reader := state.DiffReader()
+
+	_, _, err := reader.LatestStateUpdate()
+	assert.ErrorIs(t, err, ErrStateUpdateNotFound)
+
+	updates := []*core.StateUpdate{
+		coreStateUpdate(t, mainnetStateUpdate0),
+		coreStateUpdate(t, mainnetStateUpdate1),
+	}
+	// nonces are not part of the mainnet fixtures
+	addr := updates[0].StateDiff.DeployedContracts[0].Address
+	update2 := coreStateUpdate(t, mainnetStateUpdate2)
+	update2.StateDiff.Nonces = map[felt.Felt]*felt.Felt{*addr: new(felt.Felt).SetUint64(1)}
+	for idx, update := range updates {
+		assert.NoError(t, state.Update(uint64(idx), update))
+	}
+	update2.NewRoot, err = state.SimulateUpdate(update2)
+	assert.NoError(t, err)
+	assert.NoError(t, state.Update(2, update2))
+	updates = append(updates, update2)
+
+	for idx, want := range updates {
+		got, err := reader.StateUpdate(uint64(idx))
+		assert.NoError(t, err)
+		assert.Equal(t, true, want.BlockHash.Equal(got.BlockHash))
+		assert.Equal(t, true, want.OldRoot.Equal(got.OldRoot))
+		assert.Equal(t, true, want.NewRoot.Equal(got.NewRoot))
+		assert.Equal(t, true, want.StateDiff.Equal(got.StateDiff))
+
+		got, err = reader.StateUpdateByHash(want.BlockHash)
+		assert.NoError(t, err)
+		assert.Equal(t, true, want.NewRoot.Equal(got.NewRoot))
+	}
+
+	number, latest, err := reader.LatestStateUpdate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), number)
+	assert.Equal(t, true, update2.StateDiff.Equal(latest.StateDiff))
+
+	_, err = reader.StateUpdate(3)
+	assert.ErrorIs(t, err, ErrStateUpdateNotFound)
+	_, err = reader.StateUpdateByHash(new(felt.Felt).SetUint64(37))
+	assert.ErrorIs(t, err, ErrStateUpdateNotFound)
+}
+
+func TestCompactStateUpdateSize(t *testing.T) {
+	// the fixture of TestUpdate, which deploys five contracts with the same
+	// class
+	update := coreStateUpdate(t, mainnetStateUpdate0)
+
+	compact, err := update.MarshalCompact()
+	assert.NoError(t, err)
+	diffBytes, err := update.StateDiff.MarshalBinary()
+	assert.NoError(t, err)
+	// the block hash and the roots take 32 bytes each as well
+	naiveLen := 3*felt.Bytes + len(diffBytes)
+
+	t.Logf("compact: %d bytes, naive: %d bytes", len(compact), naiveLen)
+	// four of the five class hashes of deployed contracts are replaced by an
+	// index, on top of the leading zeros trimmed off small felts
+	assert.GreaterOrEqual(t, naiveLen-len(compact), 4*felt.Bytes)
+}
+
+func TestLegacyStoredStateUpdate(t *testing.T) {
+	testDb := db.NewTestDb()
+	state := NewState(testDb)
+	update := coreStateUpdate(t, mainnetStateUpdate0)
+	assert.NoError(t, state.Update(0, update))
+
+	// overwrite the update with the JSON encoding of earlier versions
+	stored := storedStateUpdate{
+		BlockHash:         update.BlockHash,
+		NewRoot:           update.NewRoot,
+		OldRoot:           update.OldRoot,
+		DeployedContracts: update.StateDiff.DeployedContracts,
+	}
+	for addr, diffs := range update.StateDiff.StorageDiffs {
+		addr := addr
+		stored.StorageDiffs = append(stored.StorageDiffs, storedStorageDiffs{Address: &addr, Diffs: diffs})
+	}
+	legacyBytes, err := json.Marshal(stored)
+	assert.NoError(t, err)
+	assert.NoError(t, testDb.Update(func(txn *badger.Txn) error {
+		numberBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(numberBytes, 0)
+		return txn.Set(db.StateUpdates.Key(numberBytes), legacyBytes)
+	}))
+
+	got, err := state.DiffReader().StateUpdate(0)
+	assert.NoError(t, err)
+	assert.Equal(t, true, update.NewRoot.Equal(got.NewRoot))
+	assert.Equal(t, true, update.StateDiff.Equal(got.StateDiff))
+}
@@ -0,0 +1,138 @@
+package state
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// diffHeaderLen is the length of the header of every record of a diff
+// stream: the block number, the old and new roots and the length of the
+// encoded diff
+const diffHeaderLen = 8 + 2*felt.Bytes + 4
+
+// MaxStreamedDiffLen is the maximum length of an encoded diff in a diff
+// stream, far above the size of the diffs of real blocks. It bounds the
+// memory [ReadDiffs] allocates for a record, whatever its header says.
+const MaxStreamedDiffLen = 64 << 20
+
+// ErrDiffTooLarge is returned by [StateDiffReader.StreamDiffs] and
+// [ReadDiffs] for an encoded diff longer than [MaxStreamedDiffLen]
+var ErrDiffTooLarge = errors.New("state diff too large")
+
+// ErrBrokenDiffStream is returned by [ReadDiffs] when a record does not
+// follow the previous one, either by block number or by root
+var ErrBrokenDiffStream = errors.New("broken state diff stream")
+
+// StreamDiffs writes the state diffs of the blocks from through to to w, as
+// records made of a header followed by the diff encoded with
+// [core.StateDiff.MarshalBinary]. The header holds the block number as a
+// big endian uint64, the old and new roots of the block and the length of
+// the encoded diff as a big endian uint32. The records can be read back
+// with [ReadDiffs].
+//
+// to is capped at the last applied block, so that a range running past the
+// synced height writes the blocks applied so far. All of them are read in
+// a single transaction, hence the stream is consistent even if blocks are
+// applied meanwhile.
+func (r StateDiffReader) StreamDiffs(from, to uint64, w io.Writer) error {
+	return r.db.View(func(txn *badger.Txn) error {
+		latest, err := latestBlockNumber(txn)
+		if errors.Is(err, ErrStateUpdateNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if to > latest {
+			to = latest
+		}
+
+		for blockNumber := from; blockNumber <= to; blockNumber++ {
+			update, err := getStateUpdate(blockNumber, txn)
+			if err != nil {
+				return err
+			}
+			if err = writeDiff(w, blockNumber, update); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func writeDiff(w io.Writer, blockNumber uint64, update *core.StateUpdate) error {
+	diffBytes, err := update.StateDiff.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if len(diffBytes) > MaxStreamedDiffLen {
+		return fmt.Errorf("%w: block %d diff is %d bytes long", ErrDiffTooLarge, blockNumber, len(diffBytes))
+	}
+
+	header := make([]byte, diffHeaderLen)
+	binary.BigEndian.PutUint64(header, blockNumber)
+	for idx, root := range []*felt.Felt{update.OldRoot, update.NewRoot} {
+		if root != nil {
+			copy(header[8+idx*felt.Bytes:], root.Marshal())
+		}
+	}
+	binary.BigEndian.PutUint32(header[8+2*felt.Bytes:], uint32(len(diffBytes)))
+
+	if _, err = w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(diffBytes)
+	return err
+}
+
+// ReadDiffs reads the records written by [StateDiffReader.StreamDiffs] out
+// of r and calls fn with every diff, until r is exhausted or fn returns an
+// error. Records are expected to follow each other, the block number of
+// every record being the next one and its old root being the new root of
+// the previous record, or [ErrBrokenDiffStream] is returned. Records whose
+// header announces a diff longer than [MaxStreamedDiffLen] are rejected
+// with [ErrDiffTooLarge] before anything is allocated for them.
+func ReadDiffs(r io.Reader, fn func(blockNum uint64, d *core.StateDiff) error) error {
+	header := make([]byte, diffHeaderLen)
+	var prevNumber uint64
+	var prevRoot *felt.Felt
+	for {
+		if _, err := io.ReadFull(r, header); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		blockNumber := binary.BigEndian.Uint64(header)
+		oldRoot := new(felt.Felt).SetBytes(header[8 : 8+felt.Bytes])
+		newRoot := new(felt.Felt).SetBytes(header[8+felt.Bytes : 8+2*felt.Bytes])
+		if prevRoot != nil && (blockNumber != prevNumber+1 || !oldRoot.Equal(prevRoot)) {
+			return fmt.Errorf("%w: block %d does not follow block %d", ErrBrokenDiffStream, blockNumber, prevNumber)
+		}
+
+		diffLen := binary.BigEndian.Uint32(header[8+2*felt.Bytes:])
+		if diffLen > MaxStreamedDiffLen {
+			return fmt.Errorf("%w: block %d diff is %d bytes long", ErrDiffTooLarge, blockNumber, diffLen)
+		}
+		diffBytes := make([]byte, diffLen)
+		if _, err := io.ReadFull(r, diffBytes); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		diff := new(core.StateDiff)
+		if err := diff.UnmarshalBinary(diffBytes); err != nil {
+			return err
+		}
+		if err := fn(blockNumber, diff); err != nil {
+			return err
+		}
+		prevNumber, prevRoot = blockNumber, newRoot
+	}
+}
@@ -0,0 +1,93 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamDiffs(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	reader := state.DiffReader()
+
+	var buf bytes.Buffer
+	assert.NoError(t, reader.StreamDiffs(0, 10, &buf))
+	assert.Equal(t, 0, buf.Len())
+
+	var updates []*core.StateUpdate
+	for idx, updateJson := range [][]byte{mainnetStateUpdate0, mainnetStateUpdate1, mainnetStateUpdate2} {
+		update := coreStateUpdate(t, updateJson)
+		assert.NoError(t, state.Update(uint64(idx), update))
+		updates = append(updates, update)
+	}
+
+	readAll := func(t *testing.T, r io.Reader) ([]uint64, error) {
+		var numbers []uint64
+		return numbers, ReadDiffs(r, func(blockNum uint64, d *core.StateDiff) error {
+			numbers = append(numbers, blockNum)
+			assert.Equal(t, true, updates[blockNum].StateDiff.Equal(d))
+			return nil
+		})
+	}
+
+	t.Run("range past the synced height", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, reader.StreamDiffs(1, 100, &buf))
+		numbers, err := readAll(t, &buf)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2}, numbers)
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, reader.StreamDiffs(3, 100, &buf))
+		assert.NoError(t, reader.StreamDiffs(2, 1, &buf))
+		assert.Equal(t, 0, buf.Len())
+	})
+
+	t.Run("broken streams", func(t *testing.T) {
+		var first, last bytes.Buffer
+		assert.NoError(t, reader.StreamDiffs(0, 0, &first))
+		assert.NoError(t, reader.StreamDiffs(2, 2, &last))
+		_, err := readAll(t, io.MultiReader(&first, &last))
+		assert.ErrorIs(t, err, ErrBrokenDiffStream)
+
+		var buf bytes.Buffer
+		assert.NoError(t, reader.StreamDiffs(0, 2, &buf))
+		_, err = readAll(t, bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("malformed headers", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, reader.StreamDiffs(0, 0, &buf))
+		record := buf.Bytes()
+
+		_, err := readAll(t, bytes.NewReader(record[:diffHeaderLen-1]))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+		oversized := append([]byte{}, record[:diffHeaderLen]...)
+		binary.BigEndian.PutUint32(oversized[diffHeaderLen-4:], math.MaxUint32)
+		_, err = readAll(t, bytes.NewReader(oversized))
+		assert.ErrorIs(t, err, ErrDiffTooLarge)
+	})
+
+	t.Run("errors of fn are returned", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, reader.StreamDiffs(0, 2, &buf))
+		stop := errors.New("stop")
+		calls := 0
+		assert.ErrorIs(t, ReadDiffs(&buf, func(uint64, *core.StateDiff) error {
+			calls++
+			return stop
+		}), stop)
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,163 @@
+package state
+
+import (
+	"context"
+	"errors"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// StateWitness proves the transition of a [core.StateUpdate] from its old
+// root to its new root. It holds the proofs of every contract and storage
+// slot written by the update, before and after the update is applied.
+// Declared classes are not covered.
+type StateWitness struct {
+	OldRoot *felt.Felt
+	NewRoot *felt.Felt
+	// Contracts are sorted by address
+	Contracts []ContractWitness
+	// Storage is sorted by address, then by key
+	Storage []StorageWitness
+}
+
+// ContractWitness proves the leaf of a contract in the state trie before
+// and after an update. A proof of a contract that is not deployed proves
+// its absence.
+type ContractWitness struct {
+	Address  *felt.Felt
+	OldProof []*trie.Node
+	NewProof []*trie.Node
+}
+
+// StorageWitness proves a storage slot of a contract against the storage
+// root of the contract before and after an update. Absent slots have a
+// zero value.
+type StorageWitness struct {
+	Address  *felt.Felt
+	Key      *felt.Felt
+	OldValue *felt.Felt
+	NewValue *felt.Felt
+	OldProof []*trie.Node
+	NewProof []*trie.Node
+}
+
+// UpdateWithWitness applies a StateUpdate to the State object like
+// [State.Update] does, and returns the [StateWitness] of the transition.
+// Collecting the proofs walks the tries twice for every written slot, so
+// it is noticeably slower than [State.Update]. It is not available while
+// commitments are deferred.
+func (s *State) UpdateWithWitness(blockNumber uint64, update *core.StateUpdate) (*StateWitness, error) {
+	if s.deferred {
+		return nil, errors.New("witnesses are not recorded while commitments are deferred")
+	}
+
+	witness := &StateWitness{OldRoot: update.OldRoot, NewRoot: update.NewRoot}
+	addrs, keys := writeSet(update.StateDiff)
+	if err := s.checkedUpdate(context.Background(), update, func(txn *badger.Txn) error {
+		return s.recordWitness(witness, addrs, keys, txn, false)
+	}, func(txn *badger.Txn) error {
+		if err := s.recordWitness(witness, addrs, keys, txn, true); err != nil {
+			return err
+		}
+		return putStateUpdate(blockNumber, update, txn)
+	}); err != nil {
+		return nil, err
+	}
+	return witness, nil
+}
+
+// writeSet returns the sorted addresses of the contracts written by diff
+// and, for every address, the sorted keys of its written storage slots.
+func writeSet(diff *core.StateDiff) ([]*felt.Felt, map[felt.Felt][]*felt.Felt) {
+	var addrs core.FeltSet
+	for _, contract := range diff.DeployedContracts {
+		addrs.Add(contract.Address)
+	}
+	for addr := range diff.Nonces {
+		addr := addr
+		addrs.Add(&addr)
+	}
+	addrs.Add(diff.RemovedContracts...)
+
+	keys := make(map[felt.Felt][]*felt.Felt, len(diff.StorageDiffs))
+	for addr, storageDiffs := range diff.StorageDiffs {
+		addr := addr
+		addrs.Add(&addr)
+
+		var addrKeys core.FeltSet
+		for _, pair := range storageDiffs {
+			addrKeys.Add(pair.Key)
+		}
+		keys[addr] = addrKeys.Slice()
+	}
+	return addrs.Slice(), keys
+}
+
+// recordWitness fills witness with the proofs of the given contracts and
+// storage slots in the given Txn context. The proofs after the update are
+// recorded if after is set, the ones before otherwise.
+func (s *State) recordWitness(witness *StateWitness, addrs []*felt.Felt, keys map[felt.Felt][]*felt.Felt,
+	txn *badger.Txn, after bool,
+) error {
+	state, err := s.getStateStorage(txn)
+	if err != nil {
+		return err
+	}
+
+	if !after {
+		witness.Contracts = make([]ContractWitness, len(addrs))
+	}
+	for idx, addr := range addrs {
+		proof, err := state.Proof(addr)
+		if err != nil {
+			return err
+		}
+		if after {
+			witness.Contracts[idx].NewProof = proof
+		} else {
+			witness.Contracts[idx] = ContractWitness{Address: addr, OldProof: proof}
+		}
+	}
+
+	slot := 0
+	for _, addr := range addrs {
+		addrKeys := keys[*addr]
+		if len(addrKeys) == 0 {
+			continue
+		}
+
+		storage, err := s.getContractStorage(addr, txn)
+		if err != nil {
+			return err
+		}
+		for _, key := range addrKeys {
+			value, err := storage.Get(key)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				value = new(felt.Felt)
+			} else if err != nil {
+				return err
+			}
+			proof, err := storage.Proof(key)
+			if err != nil {
+				return err
+			}
+
+			if after {
+				witness.Storage[slot].NewValue = value
+				witness.Storage[slot].NewProof = proof
+			} else {
+				witness.Storage = append(witness.Storage, StorageWitness{
+					Address:  addr,
+					Key:      key,
+					OldValue: value,
+					OldProof: proof,
+				})
+			}
+			slot++
+		}
+	}
+	return nil
+}
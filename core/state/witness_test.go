@@ -0,0 +1,101 @@
+package state
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/trie"
+	"github.com/NethermindEth/juno/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// storageRoots returns the storage roots of the contracts of the State
+func storageRoots(t *testing.T, state *State) map[felt.Felt]*felt.Felt {
+	roots := make(map[felt.Felt]*felt.Felt)
+	assert.NoError(t, state.IterateContracts(func(addr, _, _, storageRoot *felt.Felt) (bool, error) {
+		roots[*addr] = storageRoot
+		return true, nil
+	}))
+	return roots
+}
+
+// provenValue returns the value of key proven by proof against root
+func provenValue(t *testing.T, root, key *felt.Felt, proof []*trie.Node) *felt.Felt {
+	partial, err := trie.TrieFromProof(root, [][]*trie.Node{proof}, globalTrieHeight)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	value, err := partial.Get(key)
+	if err != nil {
+		// the proof shows the key is absent
+		return new(felt.Felt)
+	}
+	return value
+}
+
+func TestUpdateWithWitness(t *testing.T) {
+	state := NewState(db.NewTestDb())
+	updates := []*core.StateUpdate{
+		coreStateUpdate(t, mainnetStateUpdate0),
+		coreStateUpdate(t, mainnetStateUpdate1),
+	}
+
+	for idx, update := range updates {
+		oldStorageRoots := storageRoots(t, state)
+		witness, err := state.UpdateWithWitness(uint64(idx), update)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		newStorageRoots := storageRoots(t, state)
+
+		root, err := state.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, update.NewRoot.Equal(root))
+		assert.Equal(t, true, update.OldRoot.Equal(witness.OldRoot))
+		assert.Equal(t, true, update.NewRoot.Equal(witness.NewRoot))
+
+		for i, contract := range witness.Contracts {
+			if i > 0 {
+				assert.Equal(t, -1, bytes.Compare(witness.Contracts[i-1].Address.Marshal(), contract.Address.Marshal()))
+			}
+			// before class trie commitments, the state root is the root of the state trie
+			newCommitment := provenValue(t, witness.NewRoot, contract.Address, contract.NewProof)
+			assert.Equal(t, false, newCommitment.IsZero())
+			provenValue(t, witness.OldRoot, contract.Address, contract.OldProof)
+		}
+
+		written := 0
+		for _, diffs := range update.StateDiff.StorageDiffs {
+			written += len(diffs)
+		}
+		assert.Equal(t, written, len(witness.Storage))
+
+		for _, slot := range witness.Storage {
+			oldRoot, ok := oldStorageRoots[*slot.Address]
+			if !ok {
+				oldRoot = new(felt.Felt)
+			}
+			assert.Equal(t, true, slot.OldValue.Equal(provenValue(t, oldRoot, slot.Key, slot.OldProof)))
+			assert.Equal(t, true, slot.NewValue.Equal(provenValue(t, newStorageRoots[*slot.Address], slot.Key, slot.NewProof)))
+		}
+	}
+
+	height, err := state.Height()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(len(updates)-1), height)
+
+	t.Run("mismatched root leaves the state untouched", func(t *testing.T) {
+		state := NewState(db.NewTestDb())
+		mismatched := *updates[0]
+		mismatched.NewRoot = new(felt.Felt).SetUint64(1)
+		_, err := state.UpdateWithWitness(0, &mismatched)
+		var mismatch *ErrMismatchedRoot
+		assert.ErrorAs(t, err, &mismatch)
+
+		root, err := state.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, root.IsZero())
+	})
+}
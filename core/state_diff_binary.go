@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// ErrMalformedStateDiff is returned when unmarshalling a [StateDiff] out of
+// bytes that are not a valid encoding
+var ErrMalformedStateDiff = errors.New("malformed state diff")
+
+// MarshalBinary serializes a [StateDiff]. Every collection is prefixed with
+// its length as a big endian uint32 and felts take 32 bytes each, in the
+// order of the fields of [StateDiff]. Storage diffs and nonces are sorted
+// by address so that the encoding of a diff is deterministic.
+func (d *StateDiff) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	writeLen := func(n int) {
+		var lenBytes [4]byte
+		binary.BigEndian.PutUint32(lenBytes[:], uint32(n))
+		buf.Write(lenBytes[:])
+	}
+	writeFelts := func(felts ...*felt.Felt) error {
+		for _, f := range felts {
+			if f == nil {
+				return errNilFelt
+			}
+			buf.Write(f.Marshal())
+		}
+		return nil
+	}
+	writeFeltList := func(felts []*felt.Felt) error {
+		writeLen(len(felts))
+		return writeFelts(felts...)
+	}
+
+	addresses := d.StorageDiffs.Keys()
+	writeLen(len(addresses))
+	for _, addr := range addresses {
+		diffs, _ := d.StorageDiffs.Get(addr)
+		writeLen(len(diffs))
+		if err := writeFelts(addr); err != nil {
+			return nil, err
+		}
+		for _, diff := range diffs {
+			if err := writeFelts(diff.Key, diff.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	addresses = d.Nonces.Keys()
+	writeLen(len(addresses))
+	for _, addr := range addresses {
+		nonce, _ := d.Nonces.Get(addr)
+		if err := writeFelts(addr, nonce); err != nil {
+			return nil, err
+		}
+	}
+
+	writeLen(len(d.DeployedContracts))
+	for _, contract := range d.DeployedContracts {
+		if err := writeFelts(contract.Address, contract.ClassHash); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFeltList(d.DeclaredContracts); err != nil {
+		return nil, err
+	}
+	writeLen(len(d.DeclaredV1Classes))
+	for _, class := range d.DeclaredV1Classes {
+		if err := writeFelts(class.ClassHash, class.CompiledClassHash); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFeltList(d.RemovedContracts); err != nil {
+		return nil, err
+	}
+	if err := writeFeltList(d.RemovedV1Classes); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary deserializes a [StateDiff] encoded by
+// [StateDiff.MarshalBinary], returning [ErrMalformedStateDiff] if data is
+// truncated or has trailing bytes.
+func (d *StateDiff) UnmarshalBinary(data []byte) error {
+	var err error
+	readLen := func() int {
+		if err != nil {
+			return 0
+		}
+		if len(data) < 4 {
+			err = fmt.Errorf("%w: truncated length", ErrMalformedStateDiff)
+			return 0
+		}
+		n := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		return int(n)
+	}
+	readFelt := func() *felt.Felt {
+		if err != nil {
+			return nil
+		}
+		if len(data) < felt.Bytes {
+			err = fmt.Errorf("%w: truncated felt", ErrMalformedStateDiff)
+			return nil
+		}
+		f := new(felt.Felt).SetBytes(data[:felt.Bytes])
+		data = data[felt.Bytes:]
+		return f
+	}
+	readFeltList := func() []*felt.Felt {
+		var felts []*felt.Felt
+		for n := readLen(); n > 0 && err == nil; n-- {
+			felts = append(felts, readFelt())
+		}
+		return felts
+	}
+
+	diff := StateDiff{
+		StorageDiffs: make(FeltMap[[]StorageDiff]),
+		Nonces:       make(FeltMap[*felt.Felt]),
+	}
+	for n := readLen(); n > 0 && err == nil; n-- {
+		diffsLen := readLen()
+		addr := readFelt()
+		var diffs []StorageDiff
+		for ; diffsLen > 0 && err == nil; diffsLen-- {
+			diffs = append(diffs, StorageDiff{Key: readFelt(), Value: readFelt()})
+		}
+		if err == nil {
+			diff.StorageDiffs.Set(addr, diffs)
+		}
+	}
+	for n := readLen(); n > 0 && err == nil; n-- {
+		addr, nonce := readFelt(), readFelt()
+		if err == nil {
+			diff.Nonces.Set(addr, nonce)
+		}
+	}
+	for n := readLen(); n > 0 && err == nil; n-- {
+		diff.DeployedContracts = append(diff.DeployedContracts, DeployedContract{Address: readFelt(), ClassHash: readFelt()})
+	}
+	diff.DeclaredContracts = readFeltList()
+	for n := readLen(); n > 0 && err == nil; n-- {
+		diff.DeclaredV1Classes = append(diff.DeclaredV1Classes, DeclaredV1Class{
+			ClassHash: readFelt(), CompiledClassHash: readFelt(),
+		})
+	}
+	diff.RemovedContracts = readFeltList()
+	diff.RemovedV1Classes = readFeltList()
+
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrMalformedStateDiff, len(data))
+	}
+	*d = diff
+	return nil
+}
+
+func sortFelts(felts []*felt.Felt) {
+	sort.Slice(felts, func(i, j int) bool {
+		return bytes.Compare(felts[i].Marshal(), felts[j].Marshal()) < 0
+	})
+}
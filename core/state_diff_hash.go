@@ -0,0 +1,129 @@
+package core
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+var errNilFelt = errors.New("state diff holds a nil felt")
+
+// Hash returns a content hash of the [StateDiff], such that diffs that are
+// [StateDiff.Equal] hash identically. The diff is first canonicalised the
+// way Equal compares diffs: collections are sorted, duplicates are dropped,
+// storage keys written more than once keep the value of their last write
+// and contracts without storage diffs are left out. Every collection is
+// prefixed with its length and the resulting felts are hashed with
+// [crypto.PoseidonArray].
+//
+// The hash is meant for caching and deduplication, it is not a commitment
+// defined by the protocol.
+func (d *StateDiff) Hash() (*felt.Felt, error) {
+	if d == nil {
+		return nil, errors.New("nil state diff")
+	}
+
+	var elems []*felt.Felt
+	appendLen := func(n int) {
+		elems = append(elems, new(felt.Felt).SetUint64(uint64(n)))
+	}
+	appendPairs := func(pairs [][2]felt.Felt) {
+		appendLen(len(pairs))
+		for idx := range pairs {
+			elems = append(elems, &pairs[idx][0], &pairs[idx][1])
+		}
+	}
+	appendFelts := func(felts []*felt.Felt) error {
+		for _, f := range felts {
+			if f == nil {
+				return errNilFelt
+			}
+		}
+		sorted := NewFeltSet(felts...).Slice()
+		appendLen(len(sorted))
+		elems = append(elems, sorted...)
+		return nil
+	}
+
+	storagePairs := make(FeltMap[[][2]felt.Felt], len(d.StorageDiffs))
+	for addr, storageDiffs := range d.StorageDiffs {
+		if len(storageDiffs) == 0 {
+			continue
+		}
+		for _, diff := range storageDiffs {
+			if diff.Key == nil || diff.Value == nil {
+				return nil, errNilFelt
+			}
+		}
+		// only the last write of every key counts
+		set := make(map[[2]felt.Felt]struct{}, len(storageDiffs))
+		for key, value := range lastStorageValues(storageDiffs) {
+			set[[2]felt.Felt{key, value}] = struct{}{}
+		}
+		storagePairs[addr] = sortedPairs(set)
+	}
+	appendLen(len(storagePairs))
+	for _, addr := range storagePairs.Keys() {
+		pairs, _ := storagePairs.Get(addr)
+		elems = append(elems, addr)
+		appendPairs(pairs)
+	}
+
+	nonces := make(map[[2]felt.Felt]struct{}, len(d.Nonces))
+	for addr, nonce := range d.Nonces {
+		if nonce == nil {
+			return nil, errNilFelt
+		}
+		nonces[[2]felt.Felt{addr, *nonce}] = struct{}{}
+	}
+	appendPairs(sortedPairs(nonces))
+
+	deployed := make(map[[2]felt.Felt]struct{}, len(d.DeployedContracts))
+	for _, contract := range d.DeployedContracts {
+		if contract.Address == nil || contract.ClassHash == nil {
+			return nil, errNilFelt
+		}
+		deployed[[2]felt.Felt{*contract.Address, *contract.ClassHash}] = struct{}{}
+	}
+	appendPairs(sortedPairs(deployed))
+
+	if err := appendFelts(d.DeclaredContracts); err != nil {
+		return nil, err
+	}
+
+	declared := make(map[[2]felt.Felt]struct{}, len(d.DeclaredV1Classes))
+	for _, class := range d.DeclaredV1Classes {
+		if class.ClassHash == nil || class.CompiledClassHash == nil {
+			return nil, errNilFelt
+		}
+		declared[[2]felt.Felt{*class.ClassHash, *class.CompiledClassHash}] = struct{}{}
+	}
+	appendPairs(sortedPairs(declared))
+
+	if err := appendFelts(d.RemovedContracts); err != nil {
+		return nil, err
+	}
+	if err := appendFelts(d.RemovedV1Classes); err != nil {
+		return nil, err
+	}
+
+	return crypto.PoseidonArray(elems...), nil
+}
+
+// sortedPairs returns the pairs of set ordered by their first felt, then
+// by their second felt
+func sortedPairs(set map[[2]felt.Felt]struct{}) [][2]felt.Felt {
+	pairs := make([][2]felt.Felt, 0, len(set))
+	for pair := range set {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if cmp := compareFelts(&pairs[i][0], &pairs[j][0]); cmp != 0 {
+			return cmp < 0
+		}
+		return compareFelts(&pairs[i][1], &pairs[j][1]) < 0
+	})
+	return pairs
+}
@@ -10,10 +10,18 @@ type StateUpdate struct {
 }
 
 type StateDiff struct {
-	StorageDiffs      map[felt.Felt][]StorageDiff
-	Nonces            map[felt.Felt]*felt.Felt
+	// StorageDiffs are the storage writes of every contract, a key
+	// written more than once takes the value of its last write.
+	StorageDiffs      FeltMap[[]StorageDiff]
+	Nonces            FeltMap[*felt.Felt]
 	DeployedContracts []DeployedContract
 	DeclaredContracts []*felt.Felt
+	DeclaredV1Classes []DeclaredV1Class
+	// RemovedContracts and RemovedV1Classes are only set on reverse diffs,
+	// they undo the deployment of contracts and the declaration of v1
+	// classes.
+	RemovedContracts []*felt.Felt
+	RemovedV1Classes []*felt.Felt
 }
 
 type StorageDiff struct {
@@ -25,3 +33,239 @@ type DeployedContract struct {
 	Address   *felt.Felt
 	ClassHash *felt.Felt
 }
+
+// DeclaredV1Class is a Cairo 1 class declared along with the hash of its
+// compiled (CASM) form, which is committed to in the class trie.
+type DeclaredV1Class struct {
+	ClassHash         *felt.Felt
+	CompiledClassHash *felt.Felt
+}
+
+// Equal checks for equality of two [StateDiff]s. The order of storage
+// diffs, deployed contracts, declared contracts or classes and removed
+// contracts or classes does not affect the result, and nil collections
+// are considered equal to empty ones. Storage keys written more than once
+// are compared by the value of their last write, which they are left with.
+func (d *StateDiff) Equal(other *StateDiff) bool {
+	if d == nil || other == nil {
+		return d == other
+	}
+
+	return storageDiffsEqual(d.StorageDiffs, other.StorageDiffs) &&
+		noncesEqual(d.Nonces, other.Nonces) &&
+		deployedContractsEqual(d.DeployedContracts, other.DeployedContracts) &&
+		feltSetsEqual(d.DeclaredContracts, other.DeclaredContracts) &&
+		declaredV1ClassesEqual(d.DeclaredV1Classes, other.DeclaredV1Classes) &&
+		feltSetsEqual(d.RemovedContracts, other.RemovedContracts) &&
+		feltSetsEqual(d.RemovedV1Classes, other.RemovedV1Classes)
+}
+
+func storageDiffsEqual(a, b map[felt.Felt][]StorageDiff) bool {
+	toValues := func(diffs map[felt.Felt][]StorageDiff) map[felt.Felt]map[felt.Felt]felt.Felt {
+		values := make(map[felt.Felt]map[felt.Felt]felt.Felt, len(diffs))
+		for addr, contractDiffs := range diffs {
+			// contracts without storage diffs are equivalent to absent ones
+			if len(contractDiffs) == 0 {
+				continue
+			}
+			values[addr] = lastStorageValues(contractDiffs)
+		}
+		return values
+	}
+
+	aValues, bValues := toValues(a), toValues(b)
+	if len(aValues) != len(bValues) {
+		return false
+	}
+	for addr, aSlots := range aValues {
+		bSlots, ok := bValues[addr]
+		if !ok || len(aSlots) != len(bSlots) {
+			return false
+		}
+		for key, aValue := range aSlots {
+			if bValue, ok := bSlots[key]; !ok || !aValue.Equal(&bValue) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lastStorageValues returns the value every key of diffs is left with,
+// the value of its last write
+func lastStorageValues(diffs []StorageDiff) map[felt.Felt]felt.Felt {
+	values := make(map[felt.Felt]felt.Felt, len(diffs))
+	for _, diff := range diffs {
+		values[*diff.Key] = *diff.Value
+	}
+	return values
+}
+
+func noncesEqual(a, b map[felt.Felt]*felt.Felt) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for addr, aNonce := range a {
+		if bNonce, ok := b[addr]; !ok || !aNonce.Equal(bNonce) {
+			return false
+		}
+	}
+	return true
+}
+
+func deployedContractsEqual(a, b []DeployedContract) bool {
+	toSet := func(contracts []DeployedContract) map[[2]felt.Felt]struct{} {
+		set := make(map[[2]felt.Felt]struct{}, len(contracts))
+		for _, contract := range contracts {
+			set[[2]felt.Felt{*contract.Address, *contract.ClassHash}] = struct{}{}
+		}
+		return set
+	}
+
+	aSet, bSet := toSet(a), toSet(b)
+	if len(aSet) != len(bSet) {
+		return false
+	}
+	for contract := range aSet {
+		if _, ok := bSet[contract]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func feltSetsEqual(a, b []*felt.Felt) bool {
+	aSet, bSet := NewFeltSet(a...), NewFeltSet(b...)
+	if aSet.Len() != bSet.Len() {
+		return false
+	}
+	for _, f := range a {
+		if !bSet.Contains(f) {
+			return false
+		}
+	}
+	return true
+}
+
+func declaredV1ClassesEqual(a, b []DeclaredV1Class) bool {
+	toSet := func(classes []DeclaredV1Class) map[[2]felt.Felt]struct{} {
+		set := make(map[[2]felt.Felt]struct{}, len(classes))
+		for _, class := range classes {
+			set[[2]felt.Felt{*class.ClassHash, *class.CompiledClassHash}] = struct{}{}
+		}
+		return set
+	}
+
+	aSet, bSet := toSet(a), toSet(b)
+	if len(aSet) != len(bSet) {
+		return false
+	}
+	for class := range aSet {
+		if _, ok := bSet[class]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeStateDiffs composes two [StateDiff]s, as if overlay was applied
+// after base. The result is a new [StateDiff] that shares the felts of
+// its inputs. The following rules apply:
+//   - storage values and nonces of overlay win over the ones of base.
+//   - a contract deployed by overlay replaces the one at its address,
+//     which starts over with an empty storage and a zero nonce: the
+//     storage diffs and nonce of the address in base are dropped, and if
+//     base deployed it too, it takes the class hash deployed by overlay.
+//   - declared contracts are the union of both diffs, a class declared
+//     in both is listed once.
+//   - declared v1 classes are the union of both diffs, a class declared
+//     in both takes the compiled class hash declared by overlay.
+//   - removed contracts and removed v1 classes are the union of both
+//     diffs.
+func MergeStateDiffs(base, overlay *StateDiff) *StateDiff {
+	merged := &StateDiff{
+		StorageDiffs: make(FeltMap[[]StorageDiff]),
+		Nonces:       make(FeltMap[*felt.Felt]),
+	}
+	// deployedIndices and declaredIndices hold the index of every merged
+	// deployed contract and declared v1 class, by address and class hash
+	deployedIndices := make(FeltMap[int])
+	declaredIndices := make(FeltMap[int])
+
+	for _, diff := range []*StateDiff{base, overlay} {
+		if diff == nil {
+			continue
+		}
+
+		// deployments come first, so that they drop the earlier changes of
+		// the contracts they replace and not the ones of diff
+		for _, deployed := range diff.DeployedContracts {
+			delete(merged.StorageDiffs, *deployed.Address)
+			delete(merged.Nonces, *deployed.Address)
+			if idx, ok := deployedIndices.Get(deployed.Address); ok {
+				merged.DeployedContracts[idx].ClassHash = deployed.ClassHash
+			} else {
+				deployedIndices.Set(deployed.Address, len(merged.DeployedContracts))
+				merged.DeployedContracts = append(merged.DeployedContracts, deployed)
+			}
+		}
+
+		for addr, storageDiffs := range diff.StorageDiffs {
+			merged.StorageDiffs[addr] = mergeStorageDiffs(merged.StorageDiffs[addr], storageDiffs)
+		}
+
+		for addr, nonce := range diff.Nonces {
+			merged.Nonces[addr] = nonce
+		}
+
+		merged.DeclaredContracts = feltSetUnion(merged.DeclaredContracts, diff.DeclaredContracts)
+
+		for _, declared := range diff.DeclaredV1Classes {
+			if idx, ok := declaredIndices.Get(declared.ClassHash); ok {
+				merged.DeclaredV1Classes[idx].CompiledClassHash = declared.CompiledClassHash
+			} else {
+				declaredIndices.Set(declared.ClassHash, len(merged.DeclaredV1Classes))
+				merged.DeclaredV1Classes = append(merged.DeclaredV1Classes, declared)
+			}
+		}
+
+		merged.RemovedContracts = feltSetUnion(merged.RemovedContracts, diff.RemovedContracts)
+		merged.RemovedV1Classes = feltSetUnion(merged.RemovedV1Classes, diff.RemovedV1Classes)
+	}
+
+	return merged
+}
+
+// feltSetUnion appends the felts of overlay that are not in base to base.
+func feltSetUnion(base, overlay []*felt.Felt) []*felt.Felt {
+	set := NewFeltSet(base...)
+	for _, f := range overlay {
+		if !set.Contains(f) {
+			set.Add(f)
+			base = append(base, f)
+		}
+	}
+	return base
+}
+
+// mergeStorageDiffs returns the storage diffs of a contract after
+// applying overlay on base, overlay values win.
+func mergeStorageDiffs(base, overlay []StorageDiff) []StorageDiff {
+	merged := make([]StorageDiff, 0, len(base)+len(overlay))
+	merged = append(merged, base...)
+
+	indices := make(map[felt.Felt]int, len(merged))
+	for idx, diff := range merged {
+		indices[*diff.Key] = idx
+	}
+
+	for _, diff := range overlay {
+		if idx, ok := indices[*diff.Key]; ok {
+			merged[idx].Value = diff.Value
+		} else {
+			indices[*diff.Key] = len(merged)
+			merged = append(merged, diff)
+		}
+	}
+	return merged
+}
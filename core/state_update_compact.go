@@ -0,0 +1,256 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// compactVersion1 is the first byte of the compact encoding of a
+// [StateUpdate], so that later versions can be told apart
+const compactVersion1 byte = 1
+
+// nilFeltLen is the length byte of an absent felt in the compact encoding
+const nilFeltLen byte = 0xff
+
+// MarshalCompact serializes a [StateUpdate] in a compact form meant for
+// storage, see [StateUpdate.UnmarshalCompact]. Unlike
+// [StateDiff.MarshalBinary], felts are prefixed with their length in bytes
+// without their leading zeros, lengths are varints and the class hashes of
+// deployed contracts are listed once and then referred to by index, as many
+// contracts are deployed with the same class. Storage diffs and nonces are
+// sorted by address so that the encoding is deterministic.
+func (u *StateUpdate) MarshalCompact() ([]byte, error) {
+	w := compactWriter{buf: bytes.NewBuffer([]byte{compactVersion1})}
+	w.optionalFelt(u.BlockHash)
+	w.optionalFelt(u.NewRoot)
+	w.optionalFelt(u.OldRoot)
+
+	diff := u.StateDiff
+	if diff == nil {
+		diff = new(StateDiff)
+	}
+
+	addresses := diff.StorageDiffs.Keys()
+	w.uvarint(len(addresses))
+	for _, addr := range addresses {
+		diffs, _ := diff.StorageDiffs.Get(addr)
+		w.felt(addr)
+		w.uvarint(len(diffs))
+		for _, storageDiff := range diffs {
+			w.felt(storageDiff.Key)
+			w.felt(storageDiff.Value)
+		}
+	}
+
+	addresses = diff.Nonces.Keys()
+	w.uvarint(len(addresses))
+	for _, addr := range addresses {
+		nonce, _ := diff.Nonces.Get(addr)
+		w.felt(addr)
+		w.felt(nonce)
+	}
+
+	// class hashes of deployed contracts, in order of first use
+	var classHashes []*felt.Felt
+	classIndices := make(map[felt.Felt]int)
+	for _, contract := range diff.DeployedContracts {
+		if contract.ClassHash == nil {
+			return nil, errNilFelt
+		}
+		if _, ok := classIndices[*contract.ClassHash]; !ok {
+			classIndices[*contract.ClassHash] = len(classHashes)
+			classHashes = append(classHashes, contract.ClassHash)
+		}
+	}
+	w.feltList(classHashes)
+	w.uvarint(len(diff.DeployedContracts))
+	for _, contract := range diff.DeployedContracts {
+		w.felt(contract.Address)
+		w.uvarint(classIndices[*contract.ClassHash])
+	}
+
+	w.feltList(diff.DeclaredContracts)
+	w.uvarint(len(diff.DeclaredV1Classes))
+	for _, class := range diff.DeclaredV1Classes {
+		w.felt(class.ClassHash)
+		w.felt(class.CompiledClassHash)
+	}
+	w.feltList(diff.RemovedContracts)
+	w.feltList(diff.RemovedV1Classes)
+
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalCompact deserializes a [StateUpdate] encoded by
+// [StateUpdate.MarshalCompact], returning [ErrMalformedStateDiff] if data
+// is not a valid encoding.
+func (u *StateUpdate) UnmarshalCompact(data []byte) error {
+	if len(data) == 0 || data[0] != compactVersion1 {
+		return fmt.Errorf("%w: unknown compact encoding version", ErrMalformedStateDiff)
+	}
+	r := compactReader{data: data[1:]}
+
+	update := StateUpdate{
+		BlockHash: r.optionalFelt(),
+		NewRoot:   r.optionalFelt(),
+		OldRoot:   r.optionalFelt(),
+		StateDiff: &StateDiff{
+			StorageDiffs: make(FeltMap[[]StorageDiff]),
+			Nonces:       make(FeltMap[*felt.Felt]),
+		},
+	}
+	diff := update.StateDiff
+
+	for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+		addr := r.felt()
+		var diffs []StorageDiff
+		for diffsLen := r.uvarint(); diffsLen > 0 && r.err == nil; diffsLen-- {
+			diffs = append(diffs, StorageDiff{Key: r.felt(), Value: r.felt()})
+		}
+		if r.err == nil {
+			diff.StorageDiffs.Set(addr, diffs)
+		}
+	}
+	for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+		addr, nonce := r.felt(), r.felt()
+		if r.err == nil {
+			diff.Nonces.Set(addr, nonce)
+		}
+	}
+
+	classHashes := r.feltList()
+	for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+		addr, classIdx := r.felt(), r.uvarint()
+		if r.err == nil && classIdx >= uint64(len(classHashes)) {
+			r.err = fmt.Errorf("%w: class index %d out of range", ErrMalformedStateDiff, classIdx)
+		}
+		if r.err == nil {
+			diff.DeployedContracts = append(diff.DeployedContracts, DeployedContract{
+				Address:   addr,
+				ClassHash: classHashes[classIdx],
+			})
+		}
+	}
+
+	diff.DeclaredContracts = r.feltList()
+	for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+		diff.DeclaredV1Classes = append(diff.DeclaredV1Classes, DeclaredV1Class{
+			ClassHash: r.felt(), CompiledClassHash: r.felt(),
+		})
+	}
+	diff.RemovedContracts = r.feltList()
+	diff.RemovedV1Classes = r.feltList()
+
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrMalformedStateDiff, len(r.data))
+	}
+	*u = update
+	return nil
+}
+
+// compactWriter writes the compact encoding of a [StateUpdate], keeping
+// the first error encountered
+type compactWriter struct {
+	buf *bytes.Buffer
+	err error
+}
+
+func (w *compactWriter) uvarint(n int) {
+	var varint [binary.MaxVarintLen64]byte
+	w.buf.Write(varint[:binary.PutUvarint(varint[:], uint64(n))])
+}
+
+func (w *compactWriter) felt(f *felt.Felt) {
+	if f == nil {
+		w.err = errNilFelt
+		return
+	}
+	w.optionalFelt(f)
+}
+
+// optionalFelt writes the length of the felt without its leading zero
+// bytes followed by these bytes, or [nilFeltLen] if f is nil
+func (w *compactWriter) optionalFelt(f *felt.Felt) {
+	if f == nil {
+		w.buf.WriteByte(nilFeltLen)
+		return
+	}
+	feltBytes := f.Bytes()
+	trimmed := bytes.TrimLeft(feltBytes[:], "\x00")
+	w.buf.WriteByte(byte(len(trimmed)))
+	w.buf.Write(trimmed)
+}
+
+func (w *compactWriter) feltList(felts []*felt.Felt) {
+	w.uvarint(len(felts))
+	for _, f := range felts {
+		w.felt(f)
+	}
+}
+
+// compactReader reads the compact encoding of a [StateUpdate], keeping the
+// first error encountered
+type compactReader struct {
+	data []byte
+	err  error
+}
+
+func (r *compactReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	n, read := binary.Uvarint(r.data)
+	if read <= 0 {
+		r.err = fmt.Errorf("%w: invalid length", ErrMalformedStateDiff)
+		return 0
+	}
+	r.data = r.data[read:]
+	return n
+}
+
+func (r *compactReader) felt() *felt.Felt {
+	f := r.optionalFelt()
+	if f == nil && r.err == nil {
+		r.err = fmt.Errorf("%w: missing felt", ErrMalformedStateDiff)
+	}
+	return f
+}
+
+func (r *compactReader) optionalFelt() *felt.Felt {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) == 0 {
+		r.err = fmt.Errorf("%w: truncated felt", ErrMalformedStateDiff)
+		return nil
+	}
+	feltLen := r.data[0]
+	r.data = r.data[1:]
+	if feltLen == nilFeltLen {
+		return nil
+	}
+	if feltLen > felt.Bytes || int(feltLen) > len(r.data) {
+		r.err = fmt.Errorf("%w: invalid felt length %d", ErrMalformedStateDiff, feltLen)
+		return nil
+	}
+	f := new(felt.Felt).SetBytes(r.data[:feltLen])
+	r.data = r.data[feltLen:]
+	return f
+}
+
+func (r *compactReader) feltList() []*felt.Felt {
+	var felts []*felt.Felt
+	for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+		felts = append(felts, r.felt())
+	}
+	return felts
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// String renders the [StateUpdate] as readable text, see [StateDiff.String]
+func (u *StateUpdate) String() string {
+	if u == nil {
+		return "<nil>"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "block hash: %s\n", hexFelt(u.BlockHash))
+	fmt.Fprintf(&sb, "old root: %s\n", hexFelt(u.OldRoot))
+	fmt.Fprintf(&sb, "new root: %s\n", hexFelt(u.NewRoot))
+	sb.WriteString(u.StateDiff.String())
+	return sb.String()
+}
+
+// String renders the [StateDiff] as readable text with one line per
+// contract or class, felts are hex encoded. Contracts, classes and storage
+// keys are sorted, so that equal diffs render the same way regardless of
+// the order of their collections. Empty sections are left out.
+func (d *StateDiff) String() string {
+	if d == nil {
+		return "<nil>\n"
+	}
+
+	var sb strings.Builder
+	if len(d.StorageDiffs) > 0 {
+		sb.WriteString("storage diffs:\n")
+		for _, addr := range d.StorageDiffs.Keys() {
+			storageDiffs, _ := d.StorageDiffs.Get(addr)
+			storageDiffs = append([]StorageDiff(nil), storageDiffs...)
+			// stable, so that writes to the same key keep their order
+			sort.SliceStable(storageDiffs, func(i, j int) bool {
+				return compareFelts(storageDiffs[i].Key, storageDiffs[j].Key) < 0
+			})
+
+			pairs := make([]string, 0, len(storageDiffs))
+			for _, diff := range storageDiffs {
+				pairs = append(pairs, hexFelt(diff.Key)+": "+hexFelt(diff.Value))
+			}
+			fmt.Fprintf(&sb, "  %s: [%s]\n", hexFelt(addr), strings.Join(pairs, ", "))
+		}
+	}
+
+	if len(d.Nonces) > 0 {
+		sb.WriteString("nonces:\n")
+		for _, addr := range d.Nonces.Keys() {
+			nonce, _ := d.Nonces.Get(addr)
+			fmt.Fprintf(&sb, "  %s: %s\n", hexFelt(addr), hexFelt(nonce))
+		}
+	}
+
+	if len(d.DeployedContracts) > 0 {
+		deployed := append([]DeployedContract(nil), d.DeployedContracts...)
+		sort.SliceStable(deployed, func(i, j int) bool {
+			return compareFelts(deployed[i].Address, deployed[j].Address) < 0
+		})
+
+		sb.WriteString("deployed contracts:\n")
+		for _, contract := range deployed {
+			fmt.Fprintf(&sb, "  %s: %s\n", hexFelt(contract.Address), hexFelt(contract.ClassHash))
+		}
+	}
+
+	writeFelts(&sb, "declared contracts", d.DeclaredContracts)
+
+	if len(d.DeclaredV1Classes) > 0 {
+		declared := append([]DeclaredV1Class(nil), d.DeclaredV1Classes...)
+		sort.SliceStable(declared, func(i, j int) bool {
+			return compareFelts(declared[i].ClassHash, declared[j].ClassHash) < 0
+		})
+
+		sb.WriteString("declared v1 classes:\n")
+		for _, class := range declared {
+			fmt.Fprintf(&sb, "  %s: %s\n", hexFelt(class.ClassHash), hexFelt(class.CompiledClassHash))
+		}
+	}
+
+	writeFelts(&sb, "removed contracts", d.RemovedContracts)
+	writeFelts(&sb, "removed v1 classes", d.RemovedV1Classes)
+	return sb.String()
+}
+
+// writeFelts writes the sorted felts as a section titled name, unless
+// there are none
+func writeFelts(sb *strings.Builder, name string, felts []*felt.Felt) {
+	if len(felts) == 0 {
+		return
+	}
+
+	sorted := append([]*felt.Felt(nil), felts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareFelts(sorted[i], sorted[j]) < 0
+	})
+
+	hexFelts := make([]string, 0, len(sorted))
+	for _, f := range sorted {
+		hexFelts = append(hexFelts, hexFelt(f))
+	}
+	fmt.Fprintf(sb, "%s: [%s]\n", name, strings.Join(hexFelts, ", "))
+}
+
+// compareFelts orders felts by value, nil felts come first
+func compareFelts(a, b *felt.Felt) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return bytes.Compare(a.Marshal(), b.Marshal())
+}
+
+// hexFelt returns the 0x prefixed hex encoding of f
+func hexFelt(f *felt.Felt) string {
+	if f == nil {
+		return "<nil>"
+	}
+	return "0x" + f.Text(16)
+}
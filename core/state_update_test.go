@@ -0,0 +1,399 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/stretchr/testify/assert"
+)
+
+func feltFromUint(v uint64) *felt.Felt {
+	return new(felt.Felt).SetUint64(v)
+}
+
+func testStateDiff() *StateDiff {
+	return &StateDiff{
+		StorageDiffs: map[felt.Felt][]StorageDiff{
+			*feltFromUint(1): {
+				{Key: feltFromUint(2), Value: feltFromUint(3)},
+				{Key: feltFromUint(4), Value: feltFromUint(5)},
+			},
+		},
+		Nonces: map[felt.Felt]*felt.Felt{
+			*feltFromUint(1): feltFromUint(6),
+		},
+		DeployedContracts: []DeployedContract{
+			{Address: feltFromUint(1), ClassHash: feltFromUint(7)},
+			{Address: feltFromUint(8), ClassHash: feltFromUint(7)},
+		},
+		DeclaredContracts: []*felt.Felt{feltFromUint(7), feltFromUint(9)},
+		DeclaredV1Classes: []DeclaredV1Class{
+			{ClassHash: feltFromUint(11), CompiledClassHash: feltFromUint(12)},
+		},
+	}
+}
+
+func TestStateDiffEqual(t *testing.T) {
+	t.Run("same diff", func(t *testing.T) {
+		assert.Equal(t, true, testStateDiff().Equal(testStateDiff()))
+	})
+
+	t.Run("order independent", func(t *testing.T) {
+		reordered := testStateDiff()
+		storage := reordered.StorageDiffs[*feltFromUint(1)]
+		storage[0], storage[1] = storage[1], storage[0]
+		reordered.DeployedContracts[0], reordered.DeployedContracts[1] = reordered.DeployedContracts[1],
+			reordered.DeployedContracts[0]
+		reordered.DeclaredContracts[0], reordered.DeclaredContracts[1] = reordered.DeclaredContracts[1],
+			reordered.DeclaredContracts[0]
+
+		assert.Equal(t, true, testStateDiff().Equal(reordered))
+	})
+
+	t.Run("nil and empty collections", func(t *testing.T) {
+		empty := &StateDiff{
+			StorageDiffs: map[felt.Felt][]StorageDiff{*feltFromUint(1): {}},
+			Nonces:       map[felt.Felt]*felt.Felt{},
+		}
+		assert.Equal(t, true, new(StateDiff).Equal(empty))
+		assert.Equal(t, true, empty.Equal(new(StateDiff)))
+	})
+
+	t.Run("different diffs", func(t *testing.T) {
+		for name, modify := range map[string]func(*StateDiff){
+			"storage value": func(d *StateDiff) {
+				d.StorageDiffs[*feltFromUint(1)][0].Value = feltFromUint(10)
+			},
+			"storage contract": func(d *StateDiff) {
+				d.StorageDiffs[*feltFromUint(10)] = []StorageDiff{{Key: feltFromUint(2), Value: feltFromUint(3)}}
+			},
+			"nonce": func(d *StateDiff) {
+				d.Nonces[*feltFromUint(1)] = feltFromUint(10)
+			},
+			"missing nonce": func(d *StateDiff) {
+				d.Nonces = nil
+			},
+			"deployed class hash": func(d *StateDiff) {
+				d.DeployedContracts[0].ClassHash = feltFromUint(10)
+			},
+			"declared contract": func(d *StateDiff) {
+				d.DeclaredContracts = d.DeclaredContracts[1:]
+			},
+			"compiled class hash": func(d *StateDiff) {
+				d.DeclaredV1Classes[0].CompiledClassHash = feltFromUint(10)
+			},
+			"removed contract": func(d *StateDiff) {
+				d.RemovedContracts = []*felt.Felt{feltFromUint(10)}
+			},
+			"removed class": func(d *StateDiff) {
+				d.RemovedV1Classes = []*felt.Felt{feltFromUint(10)}
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				other := testStateDiff()
+				modify(other)
+				assert.Equal(t, false, testStateDiff().Equal(other))
+				assert.Equal(t, false, other.Equal(testStateDiff()))
+			})
+		}
+	})
+}
+
+func TestMergeStateDiffs(t *testing.T) {
+	t.Run("nil diffs", func(t *testing.T) {
+		assert.Equal(t, true, new(StateDiff).Equal(MergeStateDiffs(nil, nil)))
+		assert.Equal(t, true, testStateDiff().Equal(MergeStateDiffs(testStateDiff(), nil)))
+		assert.Equal(t, true, testStateDiff().Equal(MergeStateDiffs(nil, testStateDiff())))
+	})
+
+	t.Run("overlay wins", func(t *testing.T) {
+		overlay := &StateDiff{
+			StorageDiffs: map[felt.Felt][]StorageDiff{
+				*feltFromUint(1): {
+					{Key: feltFromUint(2), Value: feltFromUint(20)},
+					{Key: feltFromUint(21), Value: feltFromUint(22)},
+				},
+				*feltFromUint(8): {
+					{Key: feltFromUint(2), Value: feltFromUint(23)},
+				},
+			},
+			Nonces: map[felt.Felt]*felt.Felt{
+				*feltFromUint(1): feltFromUint(24),
+				*feltFromUint(8): feltFromUint(25),
+			},
+			DeployedContracts: []DeployedContract{
+				{Address: feltFromUint(8), ClassHash: feltFromUint(26)},
+				{Address: feltFromUint(27), ClassHash: feltFromUint(7)},
+			},
+			DeclaredContracts: []*felt.Felt{feltFromUint(9), feltFromUint(26)},
+			RemovedContracts:  []*felt.Felt{feltFromUint(28)},
+			RemovedV1Classes:  []*felt.Felt{feltFromUint(29)},
+		}
+
+		want := &StateDiff{
+			StorageDiffs: map[felt.Felt][]StorageDiff{
+				*feltFromUint(1): {
+					{Key: feltFromUint(2), Value: feltFromUint(20)},
+					{Key: feltFromUint(4), Value: feltFromUint(5)},
+					{Key: feltFromUint(21), Value: feltFromUint(22)},
+				},
+				*feltFromUint(8): {
+					{Key: feltFromUint(2), Value: feltFromUint(23)},
+				},
+			},
+			Nonces: map[felt.Felt]*felt.Felt{
+				*feltFromUint(1): feltFromUint(24),
+				*feltFromUint(8): feltFromUint(25),
+			},
+			DeployedContracts: []DeployedContract{
+				{Address: feltFromUint(1), ClassHash: feltFromUint(7)},
+				{Address: feltFromUint(8), ClassHash: feltFromUint(26)},
+				{Address: feltFromUint(27), ClassHash: feltFromUint(7)},
+			},
+			DeclaredContracts: []*felt.Felt{feltFromUint(7), feltFromUint(9), feltFromUint(26)},
+			DeclaredV1Classes: []DeclaredV1Class{
+				{ClassHash: feltFromUint(11), CompiledClassHash: feltFromUint(12)},
+			},
+			RemovedContracts: []*felt.Felt{feltFromUint(28)},
+			RemovedV1Classes: []*felt.Felt{feltFromUint(29)},
+		}
+
+		base := testStateDiff()
+		merged := MergeStateDiffs(base, overlay)
+		assert.Equal(t, true, want.Equal(merged))
+		assert.Equal(t, 3, len(merged.DeclaredContracts))
+
+		// inputs are left untouched
+		assert.Equal(t, true, testStateDiff().Equal(base))
+	})
+
+	t.Run("redeploy drops earlier changes", func(t *testing.T) {
+		// 1 is replaced by a contract of class 26, which writes a slot
+		overlay := &StateDiff{
+			StorageDiffs: map[felt.Felt][]StorageDiff{
+				*feltFromUint(1): {{Key: feltFromUint(4), Value: feltFromUint(20)}},
+			},
+			DeployedContracts: []DeployedContract{
+				{Address: feltFromUint(1), ClassHash: feltFromUint(26)},
+			},
+		}
+
+		want := testStateDiff()
+		want.StorageDiffs[*feltFromUint(1)] = overlay.StorageDiffs[*feltFromUint(1)]
+		delete(want.Nonces, *feltFromUint(1))
+		want.DeployedContracts[0].ClassHash = feltFromUint(26)
+		assert.Equal(t, true, want.Equal(MergeStateDiffs(testStateDiff(), overlay)))
+	})
+}
+
+func TestStateUpdateString(t *testing.T) {
+	diff := testStateDiff()
+	diff.StorageDiffs[*feltFromUint(0x10)] = []StorageDiff{
+		{Key: feltFromUint(0xb), Value: feltFromUint(1)},
+		{Key: feltFromUint(0xa), Value: feltFromUint(2)},
+	}
+	diff.RemovedContracts = []*felt.Felt{feltFromUint(0x20), feltFromUint(0x1f)}
+	update := &StateUpdate{
+		BlockHash: feltFromUint(0xabc),
+		OldRoot:   feltFromUint(0),
+		NewRoot:   feltFromUint(0xdef),
+		StateDiff: diff,
+	}
+
+	want := `block hash: 0xabc
+old root: 0x0
+new root: 0xdef
+storage diffs:
+  0x1: [0x2: 0x3, 0x4: 0x5]
+  0x10: [0xa: 0x2, 0xb: 0x1]
+nonces:
+  0x1: 0x6
+deployed contracts:
+  0x1: 0x7
+  0x8: 0x7
+declared contracts: [0x7, 0x9]
+declared v1 classes:
+  0xb: 0xc
+removed contracts: [0x1f, 0x20]
+`
+	assert.Equal(t, want, update.String())
+
+	// reordered collections render the same way
+	diff.DeployedContracts[0], diff.DeployedContracts[1] = diff.DeployedContracts[1], diff.DeployedContracts[0]
+	diff.DeclaredContracts[0], diff.DeclaredContracts[1] = diff.DeclaredContracts[1], diff.DeclaredContracts[0]
+	assert.Equal(t, want, update.String())
+
+	assert.Equal(t, "<nil>\n", (*StateDiff)(nil).String())
+	assert.Equal(t, "", new(StateDiff).String())
+}
+
+func TestStateDiffHash(t *testing.T) {
+	hash := func(t *testing.T, diff *StateDiff) *felt.Felt {
+		h, err := diff.Hash()
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return h
+	}
+	want := hash(t, testStateDiff())
+
+	t.Run("reordered diff", func(t *testing.T) {
+		reordered := testStateDiff()
+		storage := reordered.StorageDiffs[*feltFromUint(1)]
+		storage[0], storage[1] = storage[1], storage[0]
+		reordered.DeployedContracts[0], reordered.DeployedContracts[1] = reordered.DeployedContracts[1],
+			reordered.DeployedContracts[0]
+		reordered.DeclaredContracts[0], reordered.DeclaredContracts[1] = reordered.DeclaredContracts[1],
+			reordered.DeclaredContracts[0]
+		// duplicates and contracts without storage diffs are ignored by Equal
+		reordered.DeclaredContracts = append(reordered.DeclaredContracts, feltFromUint(9))
+		reordered.StorageDiffs[*feltFromUint(10)] = nil
+
+		assert.Equal(t, true, testStateDiff().Equal(reordered))
+		assert.Equal(t, true, want.Equal(hash(t, reordered)))
+	})
+
+	t.Run("nil and empty collections", func(t *testing.T) {
+		empty := &StateDiff{
+			StorageDiffs: map[felt.Felt][]StorageDiff{*feltFromUint(1): {}},
+			Nonces:       map[felt.Felt]*felt.Felt{},
+		}
+		assert.Equal(t, true, hash(t, new(StateDiff)).Equal(hash(t, empty)))
+	})
+
+	t.Run("different diffs", func(t *testing.T) {
+		changedValue := testStateDiff()
+		changedValue.StorageDiffs[*feltFromUint(1)][0].Value = feltFromUint(37)
+		// the same felts in a different section
+		removed := testStateDiff()
+		removed.RemovedContracts, removed.DeclaredContracts = removed.DeclaredContracts, nil
+
+		for _, diff := range []*StateDiff{changedValue, removed, new(StateDiff)} {
+			assert.Equal(t, false, want.Equal(hash(t, diff)))
+		}
+	})
+
+	t.Run("duplicate storage keys", func(t *testing.T) {
+		// a key written twice is left with the value of its last write
+		writes := func(values ...uint64) *StateDiff {
+			diff := &StateDiff{StorageDiffs: map[felt.Felt][]StorageDiff{*feltFromUint(1): {}}}
+			for _, value := range values {
+				diff.StorageDiffs[*feltFromUint(1)] = append(diff.StorageDiffs[*feltFromUint(1)],
+					StorageDiff{Key: feltFromUint(5), Value: feltFromUint(value)})
+			}
+			return diff
+		}
+		lastIsTwo, lastIsThree := writes(3, 2), writes(2, 3)
+
+		assert.Equal(t, false, lastIsTwo.Equal(lastIsThree))
+		assert.Equal(t, false, hash(t, lastIsTwo).Equal(hash(t, lastIsThree)))
+		assert.Equal(t, true, lastIsTwo.Equal(writes(2)))
+		assert.Equal(t, true, hash(t, lastIsTwo).Equal(hash(t, writes(2))))
+	})
+
+	t.Run("nil felts", func(t *testing.T) {
+		diff := testStateDiff()
+		diff.Nonces[*feltFromUint(1)] = nil
+		_, err := diff.Hash()
+		assert.Error(t, err)
+
+		_, err = (*StateDiff)(nil).Hash()
+		assert.Error(t, err)
+	})
+}
+
+func TestStateDiffMarshalBinary(t *testing.T) {
+	diff := testStateDiff()
+	diff.StorageDiffs[*feltFromUint(13)] = []StorageDiff{{Key: feltFromUint(2), Value: feltFromUint(14)}}
+	diff.RemovedContracts = []*felt.Felt{feltFromUint(15)}
+	diff.RemovedV1Classes = []*felt.Felt{feltFromUint(16)}
+
+	data, err := diff.MarshalBinary()
+	assert.NoError(t, err)
+	got := new(StateDiff)
+	assert.NoError(t, got.UnmarshalBinary(data))
+	assert.Equal(t, true, diff.Equal(got))
+
+	// the encoding does not depend on the order maps are iterated in
+	for i := 0; i < 10; i++ {
+		again, err := diff.MarshalBinary()
+		assert.NoError(t, err)
+		assert.Equal(t, data, again)
+	}
+
+	t.Run("empty diff", func(t *testing.T) {
+		data, err := new(StateDiff).MarshalBinary()
+		assert.NoError(t, err)
+		got := new(StateDiff)
+		assert.NoError(t, got.UnmarshalBinary(data))
+		assert.Equal(t, true, new(StateDiff).Equal(got))
+	})
+
+	t.Run("malformed data", func(t *testing.T) {
+		for _, malformed := range [][]byte{nil, data[:len(data)-1], append(data, 0)} {
+			assert.ErrorIs(t, new(StateDiff).UnmarshalBinary(malformed), ErrMalformedStateDiff)
+		}
+	})
+
+	t.Run("nil felts", func(t *testing.T) {
+		diff := testStateDiff()
+		diff.DeclaredContracts = append(diff.DeclaredContracts, nil)
+		_, err := diff.MarshalBinary()
+		assert.Error(t, err)
+	})
+}
+
+func TestStateUpdateMarshalCompact(t *testing.T) {
+	diff := testStateDiff()
+	diff.RemovedContracts = []*felt.Felt{feltFromUint(15)}
+	diff.RemovedV1Classes = []*felt.Felt{feltFromUint(16)}
+	update := &StateUpdate{
+		BlockHash: feltFromUint(17),
+		NewRoot:   new(felt.Felt).Sub(new(felt.Felt), feltFromUint(1)),
+		OldRoot:   new(felt.Felt),
+		StateDiff: diff,
+	}
+
+	data, err := update.MarshalCompact()
+	assert.NoError(t, err)
+	got := new(StateUpdate)
+	assert.NoError(t, got.UnmarshalCompact(data))
+	assert.Equal(t, true, update.BlockHash.Equal(got.BlockHash))
+	assert.Equal(t, true, update.NewRoot.Equal(got.NewRoot))
+	assert.Equal(t, true, update.OldRoot.Equal(got.OldRoot))
+	assert.Equal(t, true, diff.Equal(got.StateDiff))
+	// deployed contracts share their class hash once decoded
+	assert.Equal(t, got.StateDiff.DeployedContracts[0].ClassHash, got.StateDiff.DeployedContracts[1].ClassHash)
+
+	// the encoding does not depend on the order maps are iterated in
+	for i := 0; i < 10; i++ {
+		again, err := update.MarshalCompact()
+		assert.NoError(t, err)
+		assert.Equal(t, data, again)
+	}
+
+	t.Run("absent header felts", func(t *testing.T) {
+		data, err := (&StateUpdate{StateDiff: new(StateDiff)}).MarshalCompact()
+		assert.NoError(t, err)
+		got := new(StateUpdate)
+		assert.NoError(t, got.UnmarshalCompact(data))
+		assert.Nil(t, got.BlockHash)
+		assert.Nil(t, got.NewRoot)
+		assert.Nil(t, got.OldRoot)
+		assert.Equal(t, true, new(StateDiff).Equal(got.StateDiff))
+	})
+
+	t.Run("malformed data", func(t *testing.T) {
+		badVersion := append([]byte{compactVersion1 + 1}, data[1:]...)
+		for _, malformed := range [][]byte{nil, badVersion, data[:len(data)-1], append(data, 0)} {
+			assert.ErrorIs(t, new(StateUpdate).UnmarshalCompact(malformed), ErrMalformedStateDiff)
+		}
+	})
+
+	t.Run("nil felts", func(t *testing.T) {
+		diff := testStateDiff()
+		diff.DeployedContracts[0].ClassHash = nil
+		_, err := (&StateUpdate{StateDiff: diff}).MarshalCompact()
+		assert.Error(t, err)
+	})
+}
@@ -53,6 +53,9 @@ const (
 )
 
 type TransactionReceipt struct {
+	// The hash and number of the block the transaction is included in.
+	BlockHash          *felt.Felt
+	BlockNumber        uint64
 	ActualFee          *felt.Felt
 	Events             []*Event
 	ExecutionResources *ExecutionResources
@@ -65,7 +68,7 @@ type TransactionReceipt struct {
 }
 
 type Transaction interface {
-	Hash() *felt.Felt
+	Hash(chainId []byte) (*felt.Felt, error)
 }
 
 type DeployTransaction struct {
@@ -93,13 +96,13 @@ func (d *DeployTransaction) Hash(chainId []byte) (*felt.Felt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return crypto.PedersenArray(
+	return crypto.PedersenArrayWith(
 		new(felt.Felt).SetBytes([]byte("deploy")),
 		d.Version,
 		d.ContractAddress,
 		snKeccakConstructor,
 		crypto.PedersenArray(d.ConstructorCallData...),
-		new(felt.Felt),
+		&felt.Zero,
 		new(felt.Felt).SetBytes(chainId),
 	), nil
 }
@@ -131,7 +134,7 @@ type InvokeTransaction struct {
 func (i *InvokeTransaction) Hash(chainId []byte) (*felt.Felt, error) {
 	invokeFelt := new(felt.Felt).SetBytes([]byte("invoke"))
 	if i.Version.IsZero() {
-		return crypto.PedersenArray(
+		return crypto.PedersenArrayWith(
 			invokeFelt,
 			i.ContractAddress,
 			i.EntryPointSelector,
@@ -139,11 +142,11 @@ func (i *InvokeTransaction) Hash(chainId []byte) (*felt.Felt, error) {
 			new(felt.Felt).SetBytes(chainId),
 		), nil
 	} else if i.Version.IsOne() {
-		return crypto.PedersenArray(
+		return crypto.PedersenArrayWith(
 			invokeFelt,
 			i.Version,
 			i.SenderAddress,
-			new(felt.Felt),
+			&felt.Zero,
 			crypto.PedersenArray(i.CallData...),
 			i.MaxFee,
 			new(felt.Felt).SetBytes(chainId),
@@ -156,6 +159,9 @@ func (i *InvokeTransaction) Hash(chainId []byte) (*felt.Felt, error) {
 type DeclareTransaction struct {
 	// The class object.
 	Class Class
+	// The hash of the class. When set, it is used instead of hashing Class,
+	// which is not known for transactions fetched from the feeder gateway.
+	ClassHash *felt.Felt
 	// The address of the account initiating the transaction.
 	SenderAddress *felt.Felt
 	// The maximum fee that the sender is willing to pay for the transaction.
@@ -174,24 +180,28 @@ type DeclareTransaction struct {
 
 func (d *DeclareTransaction) Hash(chainId []byte) (*felt.Felt, error) {
 	declareFelt := new(felt.Felt).SetBytes([]byte("declare"))
+	classHash := d.ClassHash
+	if classHash == nil {
+		classHash = d.Class.Hash()
+	}
 	if d.Version.IsZero() {
-		return crypto.PedersenArray(
+		return crypto.PedersenArrayWith(
 			declareFelt,
 			d.Version,
 			d.SenderAddress,
-			new(felt.Felt),
+			&felt.Zero,
 			crypto.PedersenArray(make([]*felt.Felt, 0)...),
 			d.MaxFee,
 			new(felt.Felt).SetBytes(chainId),
-			d.Class.Hash(),
+			classHash,
 		), nil
 	} else if d.Version.IsOne() {
-		return crypto.PedersenArray(
+		return crypto.PedersenArrayWith(
 			declareFelt,
 			d.Version,
 			d.SenderAddress,
-			new(felt.Felt),
-			crypto.PedersenArray(d.Class.Hash()),
+			&felt.Zero,
+			crypto.PedersenArray(classHash),
 			d.MaxFee,
 			new(felt.Felt).SetBytes(chainId),
 			d.Nonce,
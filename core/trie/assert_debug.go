@@ -0,0 +1,22 @@
+//go:build debug
+
+package trie
+
+import (
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// assertCanonicalKey panics if the representation of key is not smaller
+// than the field modulus, which no arithmetic of the felt package produces
+// and hence means that the felt was built from a mishandled element, such
+// as a regular value taken for a Montgomery one. Such a key would be
+// silently reduced and land elsewhere in the [Trie]. A mishandled element
+// that happens to be below the modulus can not be told apart. The check
+// is only compiled in with the debug build tag.
+func assertCanonicalKey(key *felt.Felt) {
+	if !key.IsCanonical() {
+		panic(fmt.Sprintf("non-canonical trie key %v", key.Impl()))
+	}
+}
@@ -0,0 +1,27 @@
+//go:build debug
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/consensys/gnark-crypto/ecc/stark-curve/fp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssertCanonicalKey(t *testing.T) {
+	trie := NewTrie(nil, 251, nil)
+	assert.NotPanics(t, func() {
+		trie.FeltToBitSet(new(felt.Felt).SetUint64(37))
+	})
+
+	// raw words of the modulus itself
+	var atModulus fp.Element
+	for idx, word := range felt.Modulus().Bits() {
+		atModulus[idx] = uint64(word)
+	}
+	assert.Panics(t, func() {
+		trie.FeltToBitSet(felt.NewFelt(&atModulus))
+	})
+}
@@ -0,0 +1,9 @@
+//go:build !debug
+
+package trie
+
+import "github.com/NethermindEth/juno/core/felt"
+
+// assertCanonicalKey is a no-op unless built with the debug build tag, see
+// the debug version.
+func assertCanonicalKey(*felt.Felt) {}
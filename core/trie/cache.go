@@ -0,0 +1,169 @@
+package trie
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// CachingStorage is a [Storage] that keeps the most recently used [Node]s
+// of a base [Storage] in memory, which saves both the read from the base
+// and the decoding of the [Node] for hot nodes, such as the ones close to
+// the root. Nodes are put in and deleted from the base as well, so all
+// writes to the base must go through the CachingStorage for the cache to
+// stay consistent.
+//
+// Concurrent Gets are safe as long as they are safe on the base.
+type CachingStorage struct {
+	base   Storage
+	size   int
+	policy CachePolicy
+
+	mu sync.Mutex
+	// lru holds the cached *cacheEntry values, most recently used first
+	lru     *list.List
+	entries map[string]*list.Element
+	// pinned holds the nodes that are never evicted, see [CachePolicy]
+	pinned map[string]Node
+}
+
+// CachePolicy decides which [Node]s a [CachingStorage] evicts once it is
+// full. The least recently used [Node] is evicted, except for [Node]s
+// above PinDepth, that is whose keys are shorter than PinDepth bits. These
+// are on the path to many keys, so pinning them pays off under reads
+// spread over the whole trie, as under RPC load, whereas plain LRU suits
+// bulk imports. Pinned [Node]s do not count towards the size of the
+// cache, there are at most 2^PinDepth-1 of them.
+type CachePolicy struct {
+	PinDepth uint
+}
+
+// LRUPolicy is the [CachePolicy] that evicts the least recently used
+// [Node] regardless of its depth.
+var LRUPolicy = CachePolicy{}
+
+// PinnedLRUPolicy returns the [CachePolicy] that never evicts [Node]s
+// above the given depth.
+func PinnedLRUPolicy(depth uint) CachePolicy {
+	return CachePolicy{PinDepth: depth}
+}
+
+// pins checks whether the [Node] under key is never evicted
+func (p CachePolicy) pins(key *bitset.BitSet) bool {
+	return key.Len() < p.PinDepth
+}
+
+type cacheEntry struct {
+	key  string
+	node Node
+}
+
+// NewCachingStorage creates a [CachingStorage] holding up to size [Node]s
+// of base, evicting them with [LRUPolicy].
+func NewCachingStorage(base Storage, size int) (*CachingStorage, error) {
+	return NewCachingStorageWithPolicy(base, size, LRUPolicy)
+}
+
+// NewCachingStorageWithPolicy creates a [CachingStorage] holding up to
+// size [Node]s of base, evicting them with the given [CachePolicy].
+func NewCachingStorageWithPolicy(base Storage, size int, policy CachePolicy) (*CachingStorage, error) {
+	if size <= 0 {
+		return nil, errors.New("cache size must be positive")
+	}
+
+	return &CachingStorage{
+		base:    base,
+		size:    size,
+		policy:  policy,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element, size),
+		pinned:  make(map[string]Node),
+	}, nil
+}
+
+// Put puts value in the base and caches a copy of it, so that later
+// changes to the fields of value do not affect the cache.
+func (c *CachingStorage) Put(key *bitset.BitSet, value *Node) error {
+	if err := c.base.Put(key, value); err != nil {
+		c.evict(keyString(key))
+		return err
+	}
+
+	c.add(keyString(key), c.policy.pins(key), value)
+	return nil
+}
+
+// Get returns a copy of the cached [Node], the [Node] is read from the
+// base and cached if it is not.
+func (c *CachingStorage) Get(key *bitset.BitSet) (*Node, error) {
+	cacheKey := keyString(key)
+	c.mu.Lock()
+	if node, ok := c.pinned[cacheKey]; ok {
+		c.mu.Unlock()
+		return &node, nil
+	}
+	if elem, ok := c.entries[cacheKey]; ok {
+		c.lru.MoveToFront(elem)
+		node := elem.Value.(*cacheEntry).node
+		c.mu.Unlock()
+		return &node, nil
+	}
+	c.mu.Unlock()
+
+	node, err := c.base.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	c.add(cacheKey, c.policy.pins(key), node)
+	return node, nil
+}
+
+func (c *CachingStorage) Delete(key *bitset.BitSet) error {
+	c.evict(keyString(key))
+	return c.base.Delete(key)
+}
+
+// Len returns the number of cached [Node]s, pinned ones included
+func (c *CachingStorage) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len() + len(c.pinned)
+}
+
+// add caches a copy of node under key, evicting the least recently used
+// [Node] if the cache is full and node is not pinned
+func (c *CachingStorage) add(key string, pinned bool, node *Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if pinned {
+		c.pinned[key] = *node
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).node = *node
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	if c.lru.Len() >= c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, node: *node})
+}
+
+// evict drops the [Node] cached under key, if any
+func (c *CachingStorage) evict(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pinned, key)
+	if elem, ok := c.entries[key]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,231 @@
+package trie
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/bits-and-blooms/bitset"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachingStorage(t *testing.T) {
+	_, err := NewCachingStorage(NewMapStorage(), 0)
+	assert.Error(t, err)
+
+	base := &countingStorage{Storage: NewMapStorage()}
+	cache, err := NewCachingStorage(base, 2)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	key := func(k uint64) *bitset.BitSet {
+		return bitset.From([]uint64{k})
+	}
+	node := func(v uint64) *Node {
+		return &Node{value: new(felt.Felt).SetUint64(v)}
+	}
+
+	t.Run("cached nodes are not read from the base", func(t *testing.T) {
+		assert.NoError(t, cache.Put(key(1), node(10)))
+		got, err := cache.Get(key(1))
+		assert.NoError(t, err)
+		assert.Equal(t, true, node(10).Equal(got))
+		assert.Equal(t, 0, base.gets)
+	})
+
+	t.Run("returned nodes are copies", func(t *testing.T) {
+		got, err := cache.Get(key(1))
+		assert.NoError(t, err)
+		got.value = new(felt.Felt).SetUint64(37)
+
+		got, err = cache.Get(key(1))
+		assert.NoError(t, err)
+		assert.Equal(t, true, node(10).Equal(got))
+	})
+
+	t.Run("least recently used nodes are evicted", func(t *testing.T) {
+		assert.NoError(t, cache.Put(key(2), node(20)))
+		_, err := cache.Get(key(1))
+		assert.NoError(t, err)
+		assert.NoError(t, cache.Put(key(3), node(30)))
+		assert.Equal(t, 2, cache.Len())
+
+		// 2 was evicted and is read from the base, evicting 1
+		got, err := cache.Get(key(2))
+		assert.NoError(t, err)
+		assert.Equal(t, true, node(20).Equal(got))
+		assert.Equal(t, 1, base.gets)
+		_, err = cache.Get(key(3))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, base.gets)
+	})
+
+	t.Run("invalidated on put and delete", func(t *testing.T) {
+		assert.NoError(t, cache.Put(key(3), node(31)))
+		got, err := cache.Get(key(3))
+		assert.NoError(t, err)
+		assert.Equal(t, true, node(31).Equal(got))
+
+		assert.NoError(t, cache.Delete(key(3)))
+		_, err = cache.Get(key(3))
+		assert.ErrorIs(t, err, ErrNodeNotFound)
+	})
+
+	t.Run("concurrent gets", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := uint64(1); k <= 2; k++ {
+					_, err := cache.Get(key(k))
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func TestCachingStoragePinning(t *testing.T) {
+	base := &countingStorage{Storage: NewMapStorage()}
+	cache, err := NewCachingStorageWithPolicy(base, 1, PinnedLRUPolicy(2))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// keys of depth 0 and 1 are pinned, 2 and 3 are not
+	keys := make([]*bitset.BitSet, 4)
+	for depth := range keys {
+		keys[depth] = bitset.New(uint(depth))
+		assert.NoError(t, cache.Put(keys[depth], &Node{value: new(felt.Felt).SetUint64(uint64(depth))}))
+	}
+	assert.Equal(t, 3, cache.Len())
+
+	for depth := range keys[:2] {
+		got, err := cache.Get(keys[depth])
+		assert.NoError(t, err)
+		assert.Equal(t, true, new(felt.Felt).SetUint64(uint64(depth)).Equal(got.value))
+	}
+	assert.Equal(t, 0, base.gets)
+
+	// depth 2 was evicted by depth 3
+	_, err = cache.Get(keys[2])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, base.gets)
+
+	assert.NoError(t, cache.Delete(keys[0]))
+	_, err = cache.Get(keys[0])
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestCachingStorageTrie(t *testing.T) {
+	keys := make([]*felt.Felt, 100)
+	for idx := range keys {
+		keys[idx] = new(felt.Felt).SetUint64(uint64(idx * 7919))
+	}
+
+	uncached := NewTrie(NewMapStorage(), 251, nil)
+	// small enough for nodes to be evicted while the trie is built
+	cache, err := NewCachingStorage(NewMapStorage(), 16)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cached := NewTrie(cache, 251, nil)
+	uncached.DeferCommitment()
+	cached.DeferCommitment()
+	for _, key := range keys {
+		assert.NoError(t, uncached.Put(key, key))
+		assert.NoError(t, cached.Put(key, key))
+	}
+	// deleting keys goes through the cache as well
+	for _, key := range keys[:30] {
+		assert.NoError(t, uncached.Put(key, new(felt.Felt)))
+		assert.NoError(t, cached.Put(key, new(felt.Felt)))
+	}
+
+	assert.NoError(t, uncached.Commit())
+	assert.NoError(t, cached.Commit())
+
+	want, err := uncached.Root()
+	assert.NoError(t, err)
+	got, err := cached.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, want.Equal(got))
+}
+
+func BenchmarkCachingStorageReads(b *testing.B) {
+	testDb := db.NewTestDb()
+	prefix := []byte{37}
+
+	keys := make([]*felt.Felt, 2000)
+	var rootKey *bitset.BitSet
+	if err := testDb.Update(func(txn *badger.Txn) error {
+		trie := NewTrie(NewTrieBadgerTxn(txn, prefix), 251, nil)
+		trie.DeferCommitment()
+		for idx := range keys {
+			var err error
+			if keys[idx], err = new(felt.Felt).SetRandom(); err != nil {
+				return err
+			}
+			if err = trie.Put(keys[idx], keys[idx]); err != nil {
+				return err
+			}
+		}
+		rootKey = trie.RootKey()
+		return trie.Commit()
+	}); err != nil {
+		b.Fatal(err)
+	}
+
+	// as under RPC load, values of a hot set of keys are read, which only
+	// reads their leaves, interleaved with proofs of any key, which read
+	// the nodes on the path from the root
+	hot := keys[:500]
+	policies := []struct {
+		name   string
+		policy *CachePolicy
+	}{
+		{"uncached", nil},
+		{"lru", &LRUPolicy},
+		{"pinned", &CachePolicy{PinDepth: 8}},
+	}
+	for _, p := range policies {
+		p := p
+		b.Run(p.name, func(b *testing.B) {
+			txn := testDb.NewTransaction(false)
+			defer txn.Discard()
+
+			// base reads are counted as timings are dominated by badger
+			base := &countingStorage{Storage: NewTrieBadgerTxn(txn, prefix)}
+			var storage Storage = base
+			if p.policy != nil {
+				var err error
+				if storage, err = NewCachingStorageWithPolicy(storage, 512, *p.policy); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			trie := NewTrie(storage, 251, rootKey)
+			rng := rand.New(rand.NewSource(37))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var err error
+				if rng.Intn(4) == 0 {
+					_, err = trie.Proof(keys[rng.Intn(len(keys))])
+				} else {
+					_, err = trie.Get(hot[rng.Intn(len(hot))])
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(base.gets)/float64(b.N), "reads/op")
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package trie
+
+import (
+	"errors"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/bits-and-blooms/bitset"
+)
+
+// DiffTries calls visit on every `key` whose value differs between the
+// [Trie]s a and b, in ascending order of keys, with its value in each of
+// them, which is zero if the `key` is absent. Both [Trie]s must have the
+// same height and use the same hash function.
+//
+// The [Trie]s are traversed side by side and subtrees with the same key
+// and commitment are skipped without being loaded, so the cost of a diff
+// grows with the number of differing keys rather than the size of the
+// [Trie]s.
+func DiffTries(a, b *Trie, visit func(key, aValue, bValue *felt.Felt) error) error {
+	if a.height != b.height {
+		return errors.New("tries of different heights")
+	}
+	return diffNodes(a, b, a.rootKey, b.rootKey, visit)
+}
+
+// diffNodes visits the keys whose value differs between the subtree of a
+// under aKey and the subtree of b under bKey, either of which may be nil
+// for an empty subtree.
+func diffNodes(a, b *Trie, aKey, bKey *bitset.BitSet, visit func(key, aValue, bValue *felt.Felt) error) error {
+	switch {
+	case aKey == nil && bKey == nil:
+		return nil
+	case aKey == nil:
+		return visitLeaves(b, bKey, func(key, value *felt.Felt) error {
+			return visit(key, new(felt.Felt), value)
+		})
+	case bKey == nil:
+		return visitLeaves(a, aKey, func(key, value *felt.Felt) error {
+			return visit(key, value, new(felt.Felt))
+		})
+	}
+
+	aNode, err := a.storage.Get(aKey)
+	if err != nil {
+		return err
+	}
+	bNode, err := b.storage.Get(bKey)
+	if err != nil {
+		return err
+	}
+
+	common := commonPrefixLen(aKey, bKey)
+	switch {
+	case common == aKey.Len() && common == bKey.Len():
+		if aNode.value.Equal(bNode.value) {
+			return nil
+		}
+		if aNode.IsLeaf() {
+			return visit(bitSetToFelt(aKey), aNode.value, bNode.value)
+		}
+		if err = diffNodes(a, b, aNode.left, bNode.left, visit); err != nil {
+			return err
+		}
+		return diffNodes(a, b, aNode.right, bNode.right, visit)
+	case common == aKey.Len():
+		// b is on one side of a
+		if bKey.Test(bKey.Len() - common - 1) {
+			if err = diffNodes(a, b, aNode.left, nil, visit); err != nil {
+				return err
+			}
+			return diffNodes(a, b, aNode.right, bKey, visit)
+		}
+		if err = diffNodes(a, b, aNode.left, bKey, visit); err != nil {
+			return err
+		}
+		return diffNodes(a, b, aNode.right, nil, visit)
+	case common == bKey.Len():
+		// a is on one side of b
+		if aKey.Test(aKey.Len() - common - 1) {
+			if err = diffNodes(a, b, nil, bNode.left, visit); err != nil {
+				return err
+			}
+			return diffNodes(a, b, aKey, bNode.right, visit)
+		}
+		if err = diffNodes(a, b, aKey, bNode.left, visit); err != nil {
+			return err
+		}
+		return diffNodes(a, b, nil, bNode.right, visit)
+	default:
+		// the subtrees are disjoint, the one on the left comes first
+		if bKey.Test(bKey.Len() - common - 1) {
+			if err = diffNodes(a, b, aKey, nil, visit); err != nil {
+				return err
+			}
+			return diffNodes(a, b, nil, bKey, visit)
+		}
+		if err = diffNodes(a, b, nil, bKey, visit); err != nil {
+			return err
+		}
+		return diffNodes(a, b, aKey, nil, visit)
+	}
+}
+
+// visitLeaves calls visit on every `key` and `value` under the [Node] with
+// the given storage key, in ascending order of keys
+func visitLeaves(t *Trie, nodeKey *bitset.BitSet, visit func(key, value *felt.Felt) error) error {
+	_, err := t.iterate(nodeKey, nil, nil, func(key, value *felt.Felt) (bool, error) {
+		return true, visit(key, value)
+	})
+	return err
+}
+
+// commonPrefixLen returns the number of leading bits two keys have in
+// common
+func commonPrefixLen(a, b *bitset.BitSet) uint {
+	var common uint
+	for common < a.Len() && common < b.Len() &&
+		a.Test(a.Len()-common-1) == b.Test(b.Len()-common-1) {
+		common++
+	}
+	return common
+}
@@ -0,0 +1,143 @@
+package trie
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/stretchr/testify/assert"
+)
+
+// diffEntry is a key whose value differs between two tries
+type diffEntry struct {
+	key, a, b uint64
+}
+
+func diffOf(t *testing.T, a, b *Trie) []diffEntry {
+	var diff []diffEntry
+	assert.NoError(t, DiffTries(a, b, func(key, aValue, bValue *felt.Felt) error {
+		diff = append(diff, diffEntry{key.Impl().Uint64(), aValue.Impl().Uint64(), bValue.Impl().Uint64()})
+		return nil
+	}))
+	return diff
+}
+
+func TestDiffTries(t *testing.T) {
+	build := func(values map[uint64]uint64) *Trie {
+		trie := NewTrie(NewMapStorage(), 8, nil)
+		for key, value := range values {
+			assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(key), new(felt.Felt).SetUint64(value)))
+		}
+		return trie
+	}
+
+	tests := map[string]struct {
+		a, b map[uint64]uint64
+		want []diffEntry
+	}{
+		"empty": {},
+		"equal": {
+			a: map[uint64]uint64{1: 1, 2: 2, 200: 3},
+			b: map[uint64]uint64{1: 1, 2: 2, 200: 3},
+		},
+		"changed value": {
+			a:    map[uint64]uint64{1: 1, 2: 2, 200: 3},
+			b:    map[uint64]uint64{1: 1, 2: 5, 200: 3},
+			want: []diffEntry{{2, 2, 5}},
+		},
+		"one empty": {
+			a:    map[uint64]uint64{1: 1, 200: 3},
+			want: []diffEntry{{1, 1, 0}, {200, 3, 0}},
+		},
+		"b below a": {
+			a:    map[uint64]uint64{1: 1, 2: 2, 200: 3},
+			b:    map[uint64]uint64{1: 1, 2: 2},
+			want: []diffEntry{{200, 3, 0}},
+		},
+		"a below b": {
+			a:    map[uint64]uint64{200: 3},
+			b:    map[uint64]uint64{1: 1, 200: 3, 201: 4},
+			want: []diffEntry{{1, 0, 1}, {201, 0, 4}},
+		},
+		"disjoint": {
+			a:    map[uint64]uint64{200: 3, 201: 4},
+			b:    map[uint64]uint64{1: 1, 2: 2},
+			want: []diffEntry{{1, 0, 1}, {2, 0, 2}, {200, 3, 0}, {201, 4, 0}},
+		},
+		"single keys": {
+			a:    map[uint64]uint64{37: 1},
+			b:    map[uint64]uint64{38: 1},
+			want: []diffEntry{{37, 1, 0}, {38, 0, 1}},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			a, b := build(test.a), build(test.b)
+			assert.Equal(t, test.want, diffOf(t, a, b))
+
+			var reversed []diffEntry
+			for _, entry := range test.want {
+				reversed = append(reversed, diffEntry{entry.key, entry.b, entry.a})
+			}
+			assert.Equal(t, reversed, diffOf(t, b, a))
+		})
+	}
+
+	t.Run("random", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(37))
+		aValues, bValues := make(map[uint64]uint64), make(map[uint64]uint64)
+		for i := 0; i < 100; i++ {
+			aValues[uint64(rng.Intn(256))] = uint64(rng.Intn(4) + 1)
+			bValues[uint64(rng.Intn(256))] = uint64(rng.Intn(4) + 1)
+		}
+
+		var want []diffEntry
+		for key := uint64(0); key < 256; key++ {
+			if aValues[key] != bValues[key] {
+				want = append(want, diffEntry{key, aValues[key], bValues[key]})
+			}
+		}
+		assert.Equal(t, want, diffOf(t, build(aValues), build(bValues)))
+	})
+
+	t.Run("different heights", func(t *testing.T) {
+		err := DiffTries(NewTrie(NewMapStorage(), 8, nil), NewTrie(NewMapStorage(), 251, nil),
+			func(_, _, _ *felt.Felt) error { return nil })
+		assert.Error(t, err)
+	})
+}
+
+func TestDiffTriesSkipsEqualSubtrees(t *testing.T) {
+	aStorage := &countingStorage{Storage: NewMapStorage()}
+	bStorage := &countingStorage{Storage: NewMapStorage()}
+	a, b := NewTrie(aStorage, 251, nil), NewTrie(bStorage, 251, nil)
+	a.DeferCommitment()
+	b.DeferCommitment()
+
+	keys := make([]*felt.Felt, 1000)
+	for idx := range keys {
+		var err error
+		keys[idx], err = new(felt.Felt).SetRandom()
+		assert.NoError(t, err)
+		assert.NoError(t, a.Put(keys[idx], keys[idx]))
+		assert.NoError(t, b.Put(keys[idx], keys[idx]))
+	}
+	assert.NoError(t, b.Put(keys[37], new(felt.Felt).SetUint64(37)))
+	assert.NoError(t, a.Commit())
+	assert.NoError(t, b.Commit())
+
+	aStorage.gets, bStorage.gets = 0, 0
+	var diffKeys []*felt.Felt
+	assert.NoError(t, DiffTries(a, b, func(key, aValue, bValue *felt.Felt) error {
+		diffKeys = append(diffKeys, key)
+		assert.Equal(t, true, aValue.Equal(keys[37]))
+		assert.Equal(t, true, bValue.Equal(new(felt.Felt).SetUint64(37)))
+		return nil
+	}))
+	if assert.Equal(t, 1, len(diffKeys)) {
+		assert.Equal(t, true, diffKeys[0].Equal(keys[37]))
+	}
+	// only the nodes along the path to the changed key and their siblings
+	assert.Less(t, aStorage.gets, 100)
+	assert.Less(t, bStorage.gets, 100)
+}
@@ -0,0 +1,104 @@
+package trie
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// flatHeight is the height of the tries built by [FlatCommitment]
+const flatHeight = 64
+
+// flatLeaf is a non-zero value of a trie built by [FlatCommitment]
+type flatLeaf struct {
+	key   uint64
+	value *felt.Felt
+}
+
+// IndexKey returns the key of the value at index i in the height 64 tries
+// of transaction and event commitments, see [FlatCommitment]. The key of
+// index 0 is the zero felt, whose key in the trie is 64 zero bits rather
+// than the empty key of the root.
+func IndexKey(i uint64) *felt.Felt {
+	return new(felt.Felt).SetUint64(i)
+}
+
+// FlatCommitment returns the commitment of the height 64 [Trie] that maps
+// the [IndexKey] of every value to the value, as used by transaction and
+// event commitments, with the Pedersen hash. It computes the same root as
+// putting the values in a [Trie] without going through storage. Like in a
+// [Trie], zero values are absent.
+func FlatCommitment(values []*felt.Felt) (*felt.Felt, error) {
+	return FlatCommitmentWithHash(values, crypto.Pedersen)
+}
+
+// FlatCommitmentWithHash returns the commitment [FlatCommitment] returns,
+// using the given hash function like a [Trie] created by
+// [NewTrieWithHash] does.
+func FlatCommitmentWithHash(values []*felt.Felt, hash HashFunc) (*felt.Felt, error) {
+	leaves := make([]flatLeaf, 0, len(values))
+	for idx, value := range values {
+		if !value.IsZero() {
+			leaves = append(leaves, flatLeaf{key: flatKey(IndexKey(uint64(idx))), value: value})
+		}
+	}
+	if len(leaves) == 0 {
+		return new(felt.Felt), nil
+	}
+
+	value, path, pathLen := flatNode(leaves, flatHeight-1, hash)
+	return flatEdgeHash(value, path, pathLen, hash), nil
+}
+
+// flatKey returns the bits of a key of a trie built by [FlatCommitment],
+// such as an [IndexKey], which fits in its 64 least significant bits
+func flatKey(key *felt.Felt) uint64 {
+	keyBytes := key.Bytes()
+	return binary.BigEndian.Uint64(keyBytes[felt.Bytes-8:])
+}
+
+// flatNode returns the value of the node where the given leaves, sorted
+// by key, diverge along with the path from bit down to that node. The bits
+// of the keys above bit are shared by all leaves.
+func flatNode(leaves []flatLeaf, bit int, hash HashFunc) (*felt.Felt, uint64, uint) {
+	first, last := leaves[0].key, leaves[len(leaves)-1].key
+	if len(leaves) == 1 {
+		pathLen := uint(bit + 1)
+		return leaves[0].value, first & lowBitsMask(pathLen), pathLen
+	}
+
+	// the highest bit the keys differ on, where the node branches
+	branch := bits.Len64(first^last) - 1
+	pathLen := uint(bit - branch)
+	path := (first >> (branch + 1)) & lowBitsMask(pathLen)
+
+	split := 0
+	for leaves[split].key&(1<<branch) == 0 {
+		split++
+	}
+	leftValue, leftPath, leftLen := flatNode(leaves[:split], branch-1, hash)
+	rightValue, rightPath, rightLen := flatNode(leaves[split:], branch-1, hash)
+
+	value := hash(flatEdgeHash(leftValue, leftPath, leftLen, hash), flatEdgeHash(rightValue, rightPath, rightLen, hash))
+	return value, path, pathLen
+}
+
+// flatEdgeHash is [Node.Hash] for a node reached by a path of the given
+// length
+func flatEdgeHash(value *felt.Felt, path uint64, pathLen uint, hash HashFunc) *felt.Felt {
+	if pathLen == 0 {
+		return value
+	}
+	pathHash := hash(value, new(felt.Felt).SetUint64(path))
+	return pathHash.Add(pathHash, new(felt.Felt).SetUint64(uint64(pathLen)))
+}
+
+// lowBitsMask returns a mask of the n least significant bits
+func lowBitsMask(n uint) uint64 {
+	if n >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<n - 1
+}
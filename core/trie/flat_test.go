@@ -0,0 +1,108 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/stretchr/testify/assert"
+)
+
+// trieCommitment is the commitment [FlatCommitment] must match
+func trieCommitment(values []*felt.Felt) (*felt.Felt, error) {
+	var root *felt.Felt
+	return root, RunOnTempTrie(flatHeight, func(trie *Trie) error {
+		for idx, value := range values {
+			if err := trie.Put(IndexKey(uint64(idx)), value); err != nil {
+				return err
+			}
+		}
+		var err error
+		root, err = trie.Root()
+		return err
+	})
+}
+
+func TestIndexKey(t *testing.T) {
+	assert.Equal(t, true, IndexKey(0).IsZero())
+	assert.Equal(t, true, new(felt.Felt).SetUint64(37).Equal(IndexKey(37)))
+
+	trie := NewTrie(nil, flatHeight, nil)
+	for _, i := range []uint64{0, 1, 37, 1<<63 + 1, ^uint64(0)} {
+		key := trie.FeltToBitSet(IndexKey(i))
+		assert.Equal(t, uint(flatHeight), key.Len())
+		for bit := uint(0); bit < flatHeight; bit++ {
+			assert.Equal(t, i&(1<<bit) != 0, key.Test(bit), "index %d bit %d", i, bit)
+		}
+	}
+}
+
+func TestFlatCommitment(t *testing.T) {
+	randomValues := func(n int) []*felt.Felt {
+		values := make([]*felt.Felt, n)
+		for idx := range values {
+			values[idx], _ = new(felt.Felt).SetRandom()
+		}
+		return values
+	}
+
+	zeroes := randomValues(10)
+	for _, idx := range []int{0, 3, 4, 9} {
+		zeroes[idx] = new(felt.Felt)
+	}
+
+	tests := map[string][]*felt.Felt{
+		"empty":           nil,
+		"all zero":        {new(felt.Felt), new(felt.Felt)},
+		"single value":    randomValues(1),
+		"two values":      randomValues(2),
+		"single non-zero": {new(felt.Felt), new(felt.Felt), new(felt.Felt).SetUint64(7)},
+		"with zeroes":     zeroes,
+		"odd count":       randomValues(37),
+		"power of two":    randomValues(64),
+	}
+	for name, values := range tests {
+		t.Run(name, func(t *testing.T) {
+			want, err := trieCommitment(values)
+			assert.NoError(t, err)
+			got, err := FlatCommitment(values)
+			assert.NoError(t, err)
+			assert.Equal(t, true, want.Equal(got), "want %s, got %s", want.Text(16), got.Text(16))
+
+			poseidonTrie := NewTrieWithHash(NewMapStorage(), flatHeight, nil, crypto.Poseidon)
+			for idx, value := range values {
+				assert.NoError(t, poseidonTrie.Put(IndexKey(uint64(idx)), value))
+			}
+			want, err = poseidonTrie.Root()
+			assert.NoError(t, err)
+			got, err = FlatCommitmentWithHash(values, crypto.Poseidon)
+			assert.NoError(t, err)
+			assert.Equal(t, true, want.Equal(got), "want %s, got %s", want.Text(16), got.Text(16))
+		})
+	}
+}
+
+func BenchmarkFlatCommitment(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		values := make([]*felt.Felt, n)
+		for idx := range values {
+			values[idx], _ = new(felt.Felt).SetRandom()
+		}
+
+		b.Run(fmt.Sprintf("flat/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := FlatCommitment(values); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("trie/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := trieCommitment(values); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package trie
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// keyWordBytes is the size of the length and of every word of an encoded
+// key
+const keyWordBytes = 8
+
+// ErrMalformedKey is returned by [UnmarshalKey] when the data is not an
+// encoded key
+var ErrMalformedKey = errors.New("malformed key")
+
+// MarshalKey encodes a key of a [Trie] the way it is stored, as database
+// keys and in the encoding of [Node]s. The encoding is the length of the
+// key in bits followed by the 64-bit words of the key, least significant
+// first, each as a big-endian uint64. It is defined here rather than left
+// to the bitset library, so that swapping the library does not change the
+// data on disk; it matches the binary encoding of bitset v1.4, which data
+// has been stored with so far.
+func MarshalKey(key *bitset.BitSet) []byte {
+	return appendKey(make([]byte, 0, keySize(key.Len())), key)
+}
+
+// UnmarshalKey decodes a key encoded with [MarshalKey], data must hold
+// the key only.
+func UnmarshalKey(data []byte) (*bitset.BitSet, error) {
+	key, rest, err := readKey(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: trailing bytes", ErrMalformedKey)
+	}
+	return key, nil
+}
+
+// keyString returns the encoding of [MarshalKey] as a string, which is the
+// form keys take wherever they are used as map keys, such as in
+// [MapStorage], [MemoryOverlay] and [CachingStorage].
+func keyString(key *bitset.BitSet) string {
+	return string(MarshalKey(key))
+}
+
+// keySize returns the size of the encoding of a key of the given length
+func keySize(length uint) int {
+	return keyWordBytes * (1 + keyWords(uint64(length)))
+}
+
+// keyWords returns the number of words of a key of the given length
+func keyWords(length uint64) int {
+	return int((length + 63) / 64)
+}
+
+// appendKey appends the encoding of key to dst, see [MarshalKey]
+func appendKey(dst []byte, key *bitset.BitSet) []byte {
+	var word [keyWordBytes]byte
+	binary.BigEndian.PutUint64(word[:], uint64(key.Len()))
+	dst = append(dst, word[:]...)
+
+	words := key.Bytes()
+	for idx := 0; idx < keyWords(uint64(key.Len())); idx++ {
+		// words past the ones the key holds are zero
+		var w uint64
+		if idx < len(words) {
+			w = words[idx]
+		}
+		binary.BigEndian.PutUint64(word[:], w)
+		dst = append(dst, word[:]...)
+	}
+	return dst
+}
+
+// readKey decodes the key encoded at the start of data, see [MarshalKey],
+// and returns the bytes that follow it
+func readKey(data []byte) (*bitset.BitSet, []byte, error) {
+	if len(data) < keyWordBytes {
+		return nil, nil, fmt.Errorf("%w: truncated length", ErrMalformedKey)
+	}
+	length := binary.BigEndian.Uint64(data)
+	data = data[keyWordBytes:]
+
+	if length > uint64(len(data))*8 {
+		return nil, nil, fmt.Errorf("%w: truncated words", ErrMalformedKey)
+	}
+	words := make([]uint64, keyWords(length))
+	if len(data) < keyWordBytes*len(words) {
+		return nil, nil, fmt.Errorf("%w: truncated words", ErrMalformedKey)
+	}
+	for idx := range words {
+		words[idx] = binary.BigEndian.Uint64(data)
+		data = data[keyWordBytes:]
+	}
+	return bitset.FromWithLength(uint(length), words), data, nil
+}
@@ -0,0 +1,53 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/bits-and-blooms/bitset"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalKey(t *testing.T) {
+	keys := []*bitset.BitSet{
+		bitset.New(0),
+		bitset.FromWithLength(3, []uint64{5}),
+		bitset.FromWithLength(64, []uint64{1 << 63}),
+		bitset.FromWithLength(251, []uint64{1, 2, 3, 1 << 58}),
+		// words the key does not hold are zero
+		bitset.FromWithLength(130, []uint64{7}),
+	}
+
+	for _, key := range keys {
+		got := MarshalKey(key)
+		assert.Equal(t, keyString(key), string(got))
+
+		decoded, err := UnmarshalKey(got)
+		assert.NoError(t, err)
+		assert.Equal(t, true, key.Equal(decoded))
+		assert.Equal(t, key.Len(), decoded.Len())
+	}
+
+	t.Run("matches the encoding of bitset v1.4", func(t *testing.T) {
+		for _, key := range keys[:4] {
+			want, err := key.MarshalBinary()
+			assert.NoError(t, err)
+			assert.Equal(t, want, MarshalKey(key))
+		}
+		assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 5}, MarshalKey(keys[1]))
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		encoded := MarshalKey(keys[3])
+		for _, data := range [][]byte{
+			nil,
+			encoded[:7],
+			encoded[:len(encoded)-1],
+			append(encoded, 0),
+			// a length too large for the data
+			{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		} {
+			_, err := UnmarshalKey(data)
+			assert.ErrorIs(t, err, ErrMalformedKey)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package trie
+
+import (
+	"errors"
+
+	"github.com/bits-and-blooms/bitset"
+)
+
+// ErrNodeNotFound is returned by [MapStorage] when a node is not present
+var ErrNodeNotFound = errors.New("node not found")
+
+// MapStorage is an in-memory [Storage] backed by a map. It is meant for
+// short-lived tries, such as the ones built from proofs.
+type MapStorage struct {
+	nodes map[string]*Node
+}
+
+func NewMapStorage() *MapStorage {
+	return &MapStorage{
+		nodes: make(map[string]*Node),
+	}
+}
+
+func (m *MapStorage) Put(key *bitset.BitSet, value *Node) error {
+	m.nodes[keyString(key)] = value
+	return nil
+}
+
+func (m *MapStorage) Get(key *bitset.BitSet) (*Node, error) {
+	node, ok := m.nodes[keyString(key)]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+	return node, nil
+}
+
+func (m *MapStorage) Delete(key *bitset.BitSet) error {
+	delete(m.nodes, keyString(key))
+	return nil
+}
@@ -0,0 +1,89 @@
+package trie
+
+import (
+	"fmt"
+
+	"github.com/NethermindEth/juno/db"
+	"github.com/NethermindEth/juno/utils"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// nodeBuckets are the buckets the nodes of the [Trie]s of the state are
+// stored in
+var nodeBuckets = []db.Bucket{db.StateTrie, db.ContractStorage, db.ClassesTrie}
+
+// migrateProgressInterval is the number of nodes between two progress
+// reports of [MigrateNodes]
+const migrateProgressInterval = 100_000
+
+// MigrateNodes re-encodes every stored [Node] from version from to version
+// to of the encoding. Writes are batched in transactions of bounded size,
+// so the migration is not atomic: nodes already in version to are skipped,
+// which makes it safe to run again after an interruption. Nodes stored
+// before encodings were versioned are in version 0.
+func MigrateNodes(badgerDB *badger.DB, from, to byte, log utils.Logger) error {
+	if _, ok := nodeCodecs[from]; !ok {
+		return fmt.Errorf("unknown node encoding version %d", from)
+	}
+	if _, ok := nodeCodecs[to]; !ok {
+		return fmt.Errorf("unknown node encoding version %d", to)
+	}
+	if from == to {
+		return nil
+	}
+
+	batch := badgerDB.NewWriteBatch()
+	defer batch.Cancel()
+
+	var migrated, skipped uint64
+	for _, bucket := range nodeBuckets {
+		if err := badgerDB.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = bucket.Key()
+			it := txn.NewIterator(opts)
+			defer it.Close()
+
+			for it.Rewind(); it.Valid(); it.Next() {
+				item := it.Item()
+				data, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+
+				node := new(Node)
+				version, err := node.unmarshal(data)
+				switch {
+				case err != nil:
+					return fmt.Errorf("node at key %x: %w", item.Key(), err)
+				case version == to:
+					skipped++
+					continue
+				case version != from:
+					return fmt.Errorf("node at key %x is not encoded with version %d", item.Key(), from)
+				}
+
+				encoded, err := node.marshal(to)
+				if err != nil {
+					return err
+				}
+				if err = batch.Set(item.KeyCopy(nil), encoded); err != nil {
+					return err
+				}
+
+				migrated++
+				if migrated%migrateProgressInterval == 0 {
+					log.Info("Migrating trie nodes", "migrated", migrated, "skipped", skipped)
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := batch.Flush(); err != nil {
+		return err
+	}
+	log.Info("Migrated trie nodes", "from", from, "to", to, "migrated", migrated, "skipped", skipped)
+	return nil
+}
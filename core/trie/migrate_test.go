@@ -0,0 +1,123 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/NethermindEth/juno/utils"
+	"github.com/bits-and-blooms/bitset"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateNodes(t *testing.T) {
+	// testVersion is version 1 followed by a marker
+	const testVersion = 2
+	nodeCodecs[testVersion] = nodeCodec{
+		encode: func(n *Node) ([]byte, error) {
+			data, err := n.marshalV1()
+			return append(data, 'v'), err
+		},
+		decode: func(n *Node, data []byte) error {
+			return n.unmarshalV1(data[:len(data)-1])
+		},
+	}
+	defer delete(nodeCodecs, testVersion)
+
+	testDb := db.NewTestDb()
+	prefixes := [][]byte{db.StateTrie.Key(), db.ContractStorage.Key([]byte{1}), db.ClassesTrie.Key()}
+	roots := make([]*felt.Felt, len(prefixes))
+	assert.NoError(t, testDb.Update(func(txn *badger.Txn) error {
+		for idx, prefix := range prefixes {
+			trie := NewTrie(NewTrieBadgerTxn(txn, prefix), 8, nil)
+			for _, key := range []uint64{1, 2, 128} {
+				assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(key), new(felt.Felt).SetUint64(key+uint64(idx))))
+			}
+			var err error
+			if roots[idx], err = trie.Root(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	versions := func() map[byte]int {
+		counts := make(map[byte]int)
+		assert.NoError(t, testDb.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				assert.NoError(t, it.Item().Value(func(val []byte) error {
+					counts[val[0]]++
+					return nil
+				}))
+			}
+			return nil
+		}))
+		return counts
+	}
+	// 3 leaves and 2 internal nodes per trie
+	assert.Equal(t, map[byte]int{nodeVersion1: 15}, versions())
+
+	t.Run("unknown versions", func(t *testing.T) {
+		assert.EqualError(t, MigrateNodes(testDb, 3, testVersion, utils.NopLogger{}), "unknown node encoding version 3")
+		assert.EqualError(t, MigrateNodes(testDb, nodeVersion1, 3, utils.NopLogger{}), "unknown node encoding version 3")
+	})
+
+	t.Run("migrate", func(t *testing.T) {
+		assert.NoError(t, MigrateNodes(testDb, nodeVersion1, testVersion, utils.NopLogger{}))
+		assert.Equal(t, map[byte]int{testVersion: 15}, versions())
+
+		// running again is a no-op
+		assert.NoError(t, MigrateNodes(testDb, nodeVersion1, testVersion, utils.NopLogger{}))
+		assert.Equal(t, map[byte]int{testVersion: 15}, versions())
+
+		assert.NoError(t, testDb.View(func(txn *badger.Txn) error {
+			for idx, prefix := range prefixes {
+				root, err := NewTrie(NewTrieBadgerTxn(txn, prefix), 8, bitset.New(0)).Root()
+				assert.NoError(t, err)
+				assert.Equal(t, true, roots[idx].Equal(root))
+			}
+			return nil
+		}))
+	})
+
+	t.Run("resume and migrate back", func(t *testing.T) {
+		// a migration back to version 1 interrupted after rewriting a root
+		assert.NoError(t, testDb.Update(func(txn *badger.Txn) error {
+			storage := NewTrieBadgerTxn(txn, prefixes[0])
+			root, err := storage.Get(bitset.New(0))
+			if err != nil {
+				return err
+			}
+			return storage.Put(bitset.New(0), root)
+		}))
+		assert.Equal(t, map[byte]int{nodeVersion1: 1, testVersion: 14}, versions())
+
+		assert.NoError(t, MigrateNodes(testDb, testVersion, nodeVersion1, utils.NopLogger{}))
+		assert.Equal(t, map[byte]int{nodeVersion1: 15}, versions())
+	})
+
+	t.Run("from version 0", func(t *testing.T) {
+		checkRoots := func() {
+			assert.NoError(t, testDb.View(func(txn *badger.Txn) error {
+				for idx, prefix := range prefixes {
+					root, err := NewTrie(NewTrieBadgerTxn(txn, prefix), 8, bitset.New(0)).Root()
+					assert.NoError(t, err)
+					assert.Equal(t, true, roots[idx].Equal(root))
+				}
+				return nil
+			}))
+		}
+
+		// nodes stored before encodings were versioned start with the
+		// first byte of their value, which is a version for some of them
+		assert.NoError(t, MigrateNodes(testDb, nodeVersion1, nodeVersion0, utils.NopLogger{}))
+		checkRoots()
+
+		assert.NoError(t, MigrateNodes(testDb, nodeVersion0, nodeVersion1, utils.NopLogger{}))
+		assert.Equal(t, map[byte]int{nodeVersion1: 15}, versions())
+		checkRoots()
+	})
+}
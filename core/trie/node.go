@@ -1,11 +1,9 @@
 package trie
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 
-	"github.com/NethermindEth/juno/core/crypto"
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/bits-and-blooms/bitset"
 )
@@ -18,6 +16,28 @@ func (e ErrMalformedNode) Error() string {
 	return fmt.Sprintf("malformed node: %s", e.reason)
 }
 
+// nodeVersion1 is the encoding of a [Node] as its value followed by the
+// keys of its children, each prefixed with 'l' or 'r'. Encoded [Node]s
+// start with the version of their encoding, so that the format can evolve.
+const nodeVersion1 byte = 1
+
+// nodeVersion0 is the encoding of [Node]s stored before encodings were
+// versioned: version 1 without the version byte, see [Node.unmarshal].
+const nodeVersion0 byte = 0
+
+// nodeCodec encodes and decodes [Node]s with a version of the encoding,
+// the version byte excluded
+type nodeCodec struct {
+	encode func(n *Node) ([]byte, error)
+	decode func(n *Node, data []byte) error
+}
+
+// nodeCodecs holds the supported versions of the encoding of [Node]s
+var nodeCodecs = map[byte]nodeCodec{
+	nodeVersion0: {encode: (*Node).marshalV1, decode: (*Node).unmarshalV1},
+	nodeVersion1: {encode: (*Node).marshalV1, decode: (*Node).unmarshalV1},
+}
+
 // A Node represents a node in the [Trie]
 type Node struct {
 	value *felt.Felt
@@ -25,30 +45,35 @@ type Node struct {
 	right *bitset.BitSet
 }
 
-// Hash calculates the hash of a [Node]
-func (n *Node) Hash(path *bitset.BitSet) *felt.Felt {
+// Hash calculates the hash of a [Node] using the given hash function
+func (n *Node) Hash(path *bitset.BitSet, hash HashFunc) *felt.Felt {
 	if path.Len() == 0 {
 		return n.value
 	}
 
-	pathWords := path.Bytes()
-	if len(pathWords) > 4 {
+	pathFelt := bitSetToFelt(path)
+
+	// https://docs.starknet.io/documentation/develop/State/starknet-state/
+	pathHash := hash(n.value, pathFelt)
+
+	pathFelt.SetUint64(uint64(path.Len()))
+	return pathHash.Add(pathHash, pathFelt)
+}
+
+// bitSetToFelt converts a key or path to the felt it represents, it is the
+// inverse of [Trie.FeltToBitSet]
+func bitSetToFelt(key *bitset.BitSet) *felt.Felt {
+	keyWords := key.Bytes()
+	if len(keyWords) > 4 {
 		panic("key too long to fit in Felt")
 	}
 
-	var pathBytes [32]byte
-	for idx, word := range pathWords {
+	var keyBytes [32]byte
+	for idx, word := range keyWords {
 		startBytes := 24 - (idx * 8)
-		binary.BigEndian.PutUint64(pathBytes[startBytes:startBytes+8], word)
+		binary.BigEndian.PutUint64(keyBytes[startBytes:startBytes+8], word)
 	}
-
-	pathFelt := new(felt.Felt).SetBytes(pathBytes[:])
-
-	// https://docs.starknet.io/documentation/develop/State/starknet-state/
-	hash := crypto.Pedersen(n.value, pathFelt)
-
-	pathFelt.SetUint64(uint64(path.Len()))
-	return hash.Add(hash, pathFelt)
+	return new(felt.Felt).SetBytes(keyBytes[:])
 }
 
 // Equal checks for equality of two [Node]s
@@ -56,8 +81,44 @@ func (n *Node) Equal(other *Node) bool {
 	return n.value.Equal(other.value) && n.left.Equal(other.left) && n.right.Equal(n.right)
 }
 
-// MarshalBinary serializes a [Node] into a byte array
+// Left returns the storage key of the left child of a [Node], nil for leaves
+func (n *Node) Left() *bitset.BitSet {
+	return n.left
+}
+
+// Right returns the storage key of the right child of a [Node], nil for leaves
+func (n *Node) Right() *bitset.BitSet {
+	return n.right
+}
+
+// IsLeaf checks if a [Node] has no children
+func (n *Node) IsLeaf() bool {
+	return n.left == nil && n.right == nil
+}
+
+// MarshalBinary serializes a [Node] into a byte array, using the latest
+// version of the encoding
 func (n *Node) MarshalBinary() ([]byte, error) {
+	return n.marshal(nodeVersion1)
+}
+
+// marshal serializes a [Node] with the given version of the encoding
+func (n *Node) marshal(version byte) ([]byte, error) {
+	codec, ok := nodeCodecs[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown node encoding version %d", version)
+	}
+
+	data, err := codec.encode(n)
+	if err != nil || version == nodeVersion0 {
+		return data, err
+	}
+	return append([]byte{version}, data...), nil
+}
+
+// marshalV1 serializes a [Node] with version 1 of the encoding, without
+// the version byte
+func (n *Node) marshalV1() ([]byte, error) {
 	if n.value == nil {
 		return nil, ErrMalformedNode{"cannot marshal node with nil value"}
 	}
@@ -67,39 +128,69 @@ func (n *Node) MarshalBinary() ([]byte, error) {
 	ret = append(ret, valueB[:]...)
 
 	if n.left != nil {
-		ret = append(ret, 'l')
-		leftB, err := n.left.MarshalBinary()
-		if err != nil {
-			return nil, err
-		}
-		ret = append(ret, leftB...)
+		ret = appendKey(append(ret, 'l'), n.left)
 	}
-
 	if n.right != nil {
-		ret = append(ret, 'r')
-		rightB, err := n.right.MarshalBinary()
-		if err != nil {
-			return nil, err
-		}
-		ret = append(ret, rightB...)
+		ret = appendKey(append(ret, 'r'), n.right)
 	}
 	return ret, nil
 }
 
 // UnmarshalBinary deserializes a [Node] from a byte array
 func (n *Node) UnmarshalBinary(data []byte) error {
+	_, err := n.unmarshal(data)
+	return err
+}
+
+// unmarshal deserializes a [Node] from a byte array and returns the
+// version of its encoding.
+//
+// Nodes in version 0 start with their value rather than a version byte,
+// and the first byte of a felt can be a version too. Such nodes never
+// decode in version 1 though: leaves are a byte short of a value, and
+// other nodes would have the 'l' prefix of their left child taken into
+// their value, leaving the first byte of its key, zero, where a prefix is
+// expected. Nodes are therefore decoded in the version they start with
+// and, if that fails, in version 0. Later versions must keep nodes in
+// version 0 from decoding in them as well.
+func (n *Node) unmarshal(data []byte) (byte, error) {
+	if len(data) == 0 {
+		return 0, ErrMalformedNode{"empty input data"}
+	}
+
+	version := data[0]
+	codec, ok := nodeCodecs[version]
+	var err error
+	if ok && version != nodeVersion0 {
+		if err = codec.decode(n, data[1:]); err == nil {
+			return version, nil
+		}
+		*n = Node{}
+	} else if !ok {
+		err = ErrMalformedNode{fmt.Sprintf("unknown encoding version %d", version)}
+	}
+
+	if legacyErr := nodeCodecs[nodeVersion0].decode(n, data); legacyErr != nil {
+		*n = Node{}
+		if err == nil {
+			err = legacyErr
+		}
+		return 0, err
+	}
+	return nodeVersion0, nil
+}
+
+// unmarshalV1 deserializes a [Node] encoded with version 1
+func (n *Node) unmarshalV1(data []byte) error {
 	if len(data) < felt.Bytes {
 		return ErrMalformedNode{"size of input data is less than felt size"}
 	}
 	n.value = new(felt.Felt).SetBytes(data[:felt.Bytes])
 	data = data[felt.Bytes:]
 
-	stream := bytes.NewReader(data)
-	for stream.Len() > 0 {
-		head, err := stream.ReadByte()
-		if err != nil {
-			return err
-		}
+	for len(data) > 0 {
+		head := data[0]
+		data = data[1:]
 
 		var pathP **bitset.BitSet
 		switch head {
@@ -114,12 +205,24 @@ func (n *Node) UnmarshalBinary(data []byte) error {
 			return ErrMalformedNode{"multiple children are not supported"}
 		}
 
-		*pathP = new(bitset.BitSet)
-		_, err = (*pathP).ReadFrom(stream)
-		if err != nil {
-			return err
+		var err error
+		if *pathP, data, err = readKey(data); err != nil {
+			return ErrMalformedNode{fmt.Sprintf("cannot read child key: %v", err)}
 		}
 	}
 
 	return nil
 }
+
+// Validate checks that a [Node] is well-formed, i.e. it has a value and
+// either both or none of its children. Nodes read from storage are
+// validated so that corrupted data is reported where it is loaded.
+func (n *Node) Validate() error {
+	if n.value == nil {
+		return ErrMalformedNode{"nil value"}
+	}
+	if (n.left == nil) != (n.right == nil) {
+		return ErrMalformedNode{"node has a single child"}
+	}
+	return nil
+}
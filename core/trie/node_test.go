@@ -5,8 +5,11 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/NethermindEth/juno/core/crypto"
 	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
 	"github.com/bits-and-blooms/bitset"
+	"github.com/dgraph-io/badger/v3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -99,7 +102,7 @@ func TestNodeMarshalAndUnmarshalBinary(t *testing.T) {
 		path3 := bitset.FromWithLength(22, []uint64{33})
 		path4 := bitset.FromWithLength(22, []uint64{44})
 		flexibleMarshal := func(val *felt.Felt, left []bitset.BitSet, right []bitset.BitSet) []byte {
-			var ret []byte
+			ret := []byte{nodeVersion1}
 			valueB := val.Bytes()
 			ret = append(ret, valueB[:]...)
 			for _, ele := range left {
@@ -145,15 +148,17 @@ func TestNodeMarshalAndUnmarshalBinary(t *testing.T) {
 		}
 	})
 	t.Run("error when unmarshalling malformed node", func(t *testing.T) {
-		malformedNode1 := new([felt.Bytes + 1]byte)
-		malformedNode1[felt.Bytes] = 'l'
-		malformedNode2 := new([felt.Bytes + 1]byte)
-		malformedNode2[felt.Bytes] = 'z'
+		malformedNode1 := new([felt.Bytes + 2]byte)
+		malformedNode1[0] = nodeVersion1
+		malformedNode1[felt.Bytes+1] = 'l'
+		malformedNode2 := new([felt.Bytes + 2]byte)
+		malformedNode2[0] = nodeVersion1
+		malformedNode2[felt.Bytes+1] = 'z'
 		tests := [...]struct {
 			name string
 			node []byte
 		}{
-			{"input size less than expected felt size", malformedNode1[2:]},
+			{"input size less than expected felt size", malformedNode1[:felt.Bytes-1]},
 			{"incomplete node", malformedNode1[:]},
 			{"unknown child node prefix", malformedNode2[:]},
 		}
@@ -167,6 +172,82 @@ func TestNodeMarshalAndUnmarshalBinary(t *testing.T) {
 	})
 }
 
+func TestNodeEncodingVersion(t *testing.T) {
+	value := new(felt.Felt).SetUint64(1)
+	left := bitset.FromWithLength(44, []uint64{44})
+	right := bitset.FromWithLength(22, []uint64{22})
+
+	for _, node := range []*Node{{value: value}, {value: value, left: left, right: right}} {
+		data, err := node.MarshalBinary()
+		assert.NoError(t, err)
+		assert.Equal(t, nodeVersion1, data[0])
+
+		unmarshalled := new(Node)
+		assert.NoError(t, unmarshalled.UnmarshalBinary(data))
+		assert.Equal(t, node, unmarshalled)
+
+		data[0] = 2
+		assert.EqualError(t, new(Node).UnmarshalBinary(data), "malformed node: unknown encoding version 2")
+	}
+
+	t.Run("version 0", func(t *testing.T) {
+		// values whose first byte is a version, or not
+		for _, value := range []*felt.Felt{value, new(felt.Felt).SetBytes([]byte{1, 2}), new(felt.Felt).SetBytes(
+			append([]byte{1}, make([]byte, felt.Bytes-1)...))} {
+			for _, node := range []*Node{{value: value}, {value: value, left: left, right: right}} {
+				data, err := node.marshal(nodeVersion0)
+				assert.NoError(t, err)
+				data1, err := node.MarshalBinary()
+				assert.NoError(t, err)
+				assert.Equal(t, data1[1:], data)
+
+				unmarshalled := new(Node)
+				version, err := unmarshalled.unmarshal(data)
+				assert.NoError(t, err)
+				assert.Equal(t, nodeVersion0, version)
+				assert.Equal(t, node, unmarshalled)
+			}
+		}
+	})
+}
+
+func TestNodeValidate(t *testing.T) {
+	value := new(felt.Felt).SetUint64(1)
+	left := bitset.FromWithLength(44, []uint64{44})
+	right := bitset.FromWithLength(22, []uint64{22})
+
+	assert.NoError(t, (&Node{value: value}).Validate())
+	assert.NoError(t, (&Node{value: value, left: left, right: right}).Validate())
+
+	var malformed ErrMalformedNode
+	assert.ErrorAs(t, new(Node).Validate(), &malformed)
+	assert.EqualError(t, (&Node{value: value, left: left}).Validate(), "malformed node: node has a single child")
+	assert.EqualError(t, (&Node{value: value, right: right}).Validate(), "malformed node: node has a single child")
+
+	t.Run("truncated input", func(t *testing.T) {
+		data, err := (&Node{value: value, left: left, right: right}).MarshalBinary()
+		assert.NoError(t, err)
+
+		// a value without the version byte is a leaf in version 0
+		for _, size := range []int{0, 1, felt.Bytes - 1, felt.Bytes + 2, felt.Bytes + 6, len(data) - 1} {
+			assert.ErrorAs(t, new(Node).UnmarshalBinary(data[:size]), &malformed, size)
+		}
+	})
+
+	t.Run("half-child node in storage", func(t *testing.T) {
+		testDb := db.NewTestDb()
+		key := bitset.New(44)
+		assert.NoError(t, testDb.Update(func(txn *badger.Txn) error {
+			return NewTrieBadgerTxn(txn, nil).Put(key, &Node{value: value, left: left})
+		}))
+		assert.NoError(t, testDb.View(func(txn *badger.Txn) error {
+			_, err := NewTrieBadgerTxn(txn, nil).Get(key)
+			assert.EqualError(t, err, "malformed node: node has a single child")
+			return nil
+		}))
+	})
+}
+
 func TestNodeHash(t *testing.T) {
 	// https://github.com/eqlabs/pathfinder/blob/5e0f4423ed9e9385adbe8610643140e1a82eaef6/crates/pathfinder/src/state/merkle_node.rs#L350-L374
 	valueBytes, _ := hex.DecodeString("1234ABCD")
@@ -177,5 +258,20 @@ func TestNodeHash(t *testing.T) {
 	}
 	path := bitset.FromWithLength(6, []uint64{42})
 
-	assert.Equal(t, true, expected.Equal(node.Hash(path)), "TestTrieNode_Hash failed")
+	assert.Equal(t, true, expected.Equal(node.Hash(path, crypto.Pedersen)), "TestTrieNode_Hash failed")
+}
+
+func TestNodeChildren(t *testing.T) {
+	left := bitset.FromWithLength(44, []uint64{44})
+	right := bitset.FromWithLength(22, []uint64{22})
+
+	leaf := &Node{value: new(felt.Felt).SetUint64(1)}
+	assert.Equal(t, true, leaf.IsLeaf())
+	assert.Nil(t, leaf.Left())
+	assert.Nil(t, leaf.Right())
+
+	internal := &Node{value: new(felt.Felt).SetUint64(1), left: left, right: right}
+	assert.Equal(t, false, internal.IsLeaf())
+	assert.Equal(t, true, left.Equal(internal.Left()))
+	assert.Equal(t, true, right.Equal(internal.Right()))
 }
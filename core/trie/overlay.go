@@ -0,0 +1,102 @@
+package trie
+
+import (
+	"sort"
+
+	"github.com/bits-and-blooms/bitset"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// MemoryOverlay is a [Storage] that keeps all changes in memory on top of
+// a base [Storage], which is only read from. This allows changing a [Trie]
+// opened in a read-only transaction; the changes are dropped along with
+// the MemoryOverlay.
+type MemoryOverlay struct {
+	base Storage
+	// changes holds the encoded nodes put in the overlay, nil for deleted
+	// nodes
+	changes map[string][]byte
+}
+
+func NewMemoryOverlay(base Storage) *MemoryOverlay {
+	return &MemoryOverlay{
+		base:    base,
+		changes: make(map[string][]byte),
+	}
+}
+
+// Put stores an encoded copy of value, so that later changes to value do
+// not affect the overlay, as with any other [Storage].
+func (o *MemoryOverlay) Put(key *bitset.BitSet, value *Node) error {
+	valueBytes, err := value.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	o.changes[keyString(key)] = valueBytes
+	return nil
+}
+
+func (o *MemoryOverlay) Get(key *bitset.BitSet) (*Node, error) {
+	valueBytes, ok := o.changes[keyString(key)]
+	if !ok {
+		// the base may hand out the nodes it holds, such as a [MapStorage],
+		// which must not be changed through the overlay
+		node, err := o.base.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if valueBytes, err = node.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	} else if valueBytes == nil {
+		return nil, badger.ErrKeyNotFound
+	}
+
+	node := new(Node)
+	if err := node.UnmarshalBinary(valueBytes); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (o *MemoryOverlay) Delete(key *bitset.BitSet) error {
+	o.changes[keyString(key)] = nil
+	return nil
+}
+
+// flush puts the changes of the overlay in its base [Storage], in
+// ascending order of keys, and empties the overlay.
+func (o *MemoryOverlay) flush() error {
+	keys := make([]string, 0, len(o.changes))
+	for keyBytes := range o.changes {
+		keys = append(keys, keyBytes)
+	}
+	sort.Strings(keys)
+
+	for _, keyBytes := range keys {
+		key, err := UnmarshalKey([]byte(keyBytes))
+		if err != nil {
+			return err
+		}
+
+		valueBytes := o.changes[keyBytes]
+		if valueBytes == nil {
+			if err := o.base.Delete(key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		node := new(Node)
+		if err := node.UnmarshalBinary(valueBytes); err != nil {
+			return err
+		}
+		if err := o.base.Put(key, node); err != nil {
+			return err
+		}
+	}
+
+	o.changes = make(map[string][]byte)
+	return nil
+}
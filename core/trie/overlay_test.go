@@ -0,0 +1,66 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/db"
+	"github.com/bits-and-blooms/bitset"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryOverlay(t *testing.T) {
+	testDb := db.NewTestDb()
+	prefix := []byte{37}
+
+	put := func(trie *Trie, keys ...uint64) {
+		for _, key := range keys {
+			assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(key), new(felt.Felt).SetUint64(key+1)))
+		}
+	}
+
+	var baseRoot, wantRoot *felt.Felt
+	var rootKey *bitset.BitSet
+	assert.NoError(t, testDb.Update(func(txn *badger.Txn) error {
+		trie := NewTrie(NewTrieBadgerTxn(txn, prefix), 8, nil)
+		put(trie, 1, 2, 128)
+		rootKey = trie.RootKey()
+		var err error
+		if baseRoot, err = trie.Root(); err != nil {
+			return err
+		}
+
+		// the expected root after the changes made on the overlay below
+		expected := NewTrie(NewMapStorage(), 8, nil)
+		put(expected, 2, 128, 129, 240)
+		wantRoot, err = expected.Root()
+		return err
+	}))
+
+	assert.NoError(t, testDb.View(func(txn *badger.Txn) error {
+		base := NewTrie(NewTrieBadgerTxn(txn, prefix), 8, rootKey)
+		trie := NewTrie(NewMemoryOverlay(NewTrieBadgerTxn(txn, prefix)), 8, rootKey)
+		// reads go through to the base storage
+		value, err := trie.Get(new(felt.Felt).SetUint64(128))
+		assert.NoError(t, err)
+		assert.Equal(t, true, new(felt.Felt).SetUint64(129).Equal(value))
+
+		// writes and deletes stay in memory
+		_, err = base.Get(new(felt.Felt).SetUint64(128))
+		assert.NoError(t, err)
+		put(trie, 129, 240)
+		assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(1), new(felt.Felt)))
+		root, err := trie.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, wantRoot.Equal(root))
+		return nil
+	}))
+
+	// the base storage is untouched
+	assert.NoError(t, testDb.View(func(txn *badger.Txn) error {
+		root, err := NewTrie(NewTrieBadgerTxn(txn, prefix), 8, rootKey).Root()
+		assert.Equal(t, true, baseRoot.Equal(root))
+		return err
+	}))
+}
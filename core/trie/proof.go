@@ -0,0 +1,563 @@
+package trie
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/bits-and-blooms/bitset"
+)
+
+type ErrInvalidProof struct {
+	reason string
+}
+
+func (e ErrInvalidProof) Error() string {
+	return fmt.Sprintf("invalid proof: %s", e.reason)
+}
+
+// Proof returns the [Node]s needed to verify the value of a `key`, or its
+// absence, against the commitment of the [Trie].
+//
+// The proof starts with the root, followed by a (sibling, child) pair for
+// every [Node] on the path to `key` that has children. The child is the
+// next [Node] on the path and the sibling is its counterpart, which is
+// only needed for its hash. The proof of an empty [Trie] is empty.
+//
+// Only the [Node]s in the proof are read from storage, so the cost of a
+// proof grows with the depth of `key` rather than the size of the [Trie].
+func (t *Trie) Proof(key *felt.Felt) ([]*Node, error) {
+	if len(t.dirty) > 0 {
+		return nil, ErrUncommitted
+	}
+	if t.rootKey == nil {
+		return nil, nil
+	}
+
+	nodes, err := t.nodesFromRoot(t.FeltToBitSet(key))
+	if err != nil {
+		return nil, err
+	}
+
+	proof := make([]*Node, 0, 2*len(nodes)-1)
+	proof = append(proof, nodes[0].node)
+	for idx := 1; idx < len(nodes); idx++ {
+		parent, child := nodes[idx-1], nodes[idx]
+
+		siblingKey := parent.node.left
+		if siblingKey.Equal(child.key) {
+			siblingKey = parent.node.right
+		}
+		sibling, err := t.storage.Get(siblingKey)
+		if err != nil {
+			return nil, err
+		}
+
+		proof = append(proof, sibling, child.node)
+	}
+	return proof, nil
+}
+
+// ProofBatch returns the [Trie.Proof] of every key, generated concurrently
+// by up to workers goroutines, at least one. The proofs only read the
+// [Trie], which must not be modified meanwhile, and every proof is
+// generated on its own, so the result is the same as generating them one
+// after the other. The [Storage] of the [Trie] must support concurrent
+// Gets, as [TrieBadgerTxn], [MapStorage] and a [CachingStorage] over
+// either of them do. The first error encountered is returned.
+func (t *Trie) ProofBatch(keys []*felt.Felt, workers int) (map[felt.Felt][]*Node, error) {
+	if len(t.dirty) > 0 {
+		return nil, ErrUncommitted
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+
+	// every worker only writes the proofs of the indices it takes
+	proofs := make([][]*Node, len(keys))
+	indices := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				proof, err := t.Proof(keys[idx])
+				if err != nil {
+					errs <- err
+					return
+				}
+				proofs[idx] = proof
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for idx := range keys {
+		select {
+		case indices <- idx:
+		case err = <-errs:
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
+	if err == nil && len(errs) > 0 {
+		err = <-errs
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	batch := make(map[felt.Felt][]*Node, len(keys))
+	for idx, key := range keys {
+		batch[*key] = proofs[idx]
+	}
+	return batch, nil
+}
+
+// TrieFromProof builds a partial [Trie], that uses the Pedersen hash to
+// calculate its commitment, out of proofs returned by [Trie.Proof].
+func TrieFromProof(root *felt.Felt, proofs [][]*Node, height uint) (*Trie, error) {
+	return TrieFromProofWithHash(root, proofs, height, crypto.Pedersen)
+}
+
+// TrieFromProofWithHash builds a partial [Trie], that uses the given hash
+// function to calculate its commitment, out of proofs returned by
+// [Trie.Proof]. Every proof is verified against `root` and
+// [ErrInvalidProof] is returned if any of them is inconsistent with it.
+//
+// The resulting [Trie] is backed by a [MapStorage] and answers [Trie.Get]
+// and [Trie.Has] for the proven keys, for other keys [ErrNodeNotFound] is
+// returned. It must not be modified.
+//
+// The key of a root without children can not be derived from its proof,
+// hence proofs of a [Trie] holding a single key are rejected.
+func TrieFromProofWithHash(root *felt.Felt, proofs [][]*Node, height uint, hash HashFunc) (*Trie, error) {
+	t := NewTrieWithHash(NewMapStorage(), height, nil, hash)
+	for _, proof := range proofs {
+		if err := t.putProof(root, proof); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// putProof verifies the proof against the root and puts the verified
+// [Node]s in the storage of the [Trie].
+func (t *Trie) putProof(root *felt.Felt, proof []*Node) error {
+	if len(proof) == 0 {
+		if !root.IsZero() {
+			return ErrInvalidProof{"empty proof of a non-empty trie"}
+		}
+		return nil
+	}
+
+	parent := proof[0]
+	if parent.left == nil || parent.right == nil {
+		return ErrInvalidProof{"cannot derive the key of a root without children"}
+	}
+	parentKey, err := internalNodeKey(parent)
+	if err != nil {
+		return err
+	}
+	if !parent.Hash(Path(parentKey, nil), t.hash).Equal(root) {
+		return ErrInvalidProof{"root mismatch"}
+	}
+	t.rootKey = parentKey
+
+	if len(proof)%2 == 0 {
+		return ErrInvalidProof{"sibling without a child"}
+	}
+	for idx := 1; idx < len(proof); idx += 2 {
+		sibling, child := proof[idx], proof[idx+1]
+		if parent.left == nil || parent.right == nil {
+			return ErrInvalidProof{"node without children has a child"}
+		}
+
+		// find out which side of the parent the child is on
+		childIsLeft := false
+		if child.left != nil || child.right != nil {
+			derivedKey, err := internalNodeKey(child)
+			if err != nil {
+				return err
+			}
+			childIsLeft = keysEqual(derivedKey, parent.left)
+			if !childIsLeft && !keysEqual(derivedKey, parent.right) {
+				return ErrInvalidProof{"child is not linked to its parent"}
+			}
+		} else {
+			childIsLeft = !t.verifyChildren(parent, parentKey, sibling, child)
+		}
+
+		// keys are taken from the parent, the way the trie is traversed
+		left, right := sibling, child
+		childKey, siblingKey := parent.right, parent.left
+		if childIsLeft {
+			left, right = child, sibling
+			childKey, siblingKey = parent.left, parent.right
+		}
+		if !t.verifyChildren(parent, parentKey, left, right) {
+			return ErrInvalidProof{"hash mismatch"}
+		}
+
+		if err = t.putProofNode(parentKey, parent, true); err != nil {
+			return err
+		}
+		// children of the sibling are unknown, so only the leaves are kept
+		if sibling.IsLeaf() {
+			if err = t.putProofNode(siblingKey, sibling, true); err != nil {
+				return err
+			}
+		}
+		parent, parentKey = child, childKey
+	}
+
+	// the last node on the path terminates it; if it has children they are
+	// unknown, so it is only kept to prove the absence of diverging keys
+	return t.putProofNode(parentKey, parent, parent.IsLeaf())
+}
+
+// verifyChildren checks that the value of an internal [Node] is the
+// commitment of the given left and right children.
+func (t *Trie) verifyChildren(parent *Node, parentKey *bitset.BitSet, left, right *Node) bool {
+	leftPath := Path(parent.left, parentKey)
+	rightPath := Path(parent.right, parentKey)
+	return parent.value.Equal(t.hash(left.Hash(leftPath, t.hash), right.Hash(rightPath, t.hash)))
+}
+
+// RootNodeKey derives the storage key of rootNode, the root [Node] of a
+// [Trie] that uses the given hash function, and verifies that its
+// commitment is `root`. As with proofs, the key of a root without children
+// can not be derived.
+func RootNodeKey(root *felt.Felt, rootNode *Node, hash HashFunc) (*bitset.BitSet, error) {
+	if err := rootNode.Validate(); err != nil {
+		return nil, err
+	}
+	if rootNode.IsLeaf() {
+		return nil, ErrInvalidProof{"cannot derive the key of a root without children"}
+	}
+
+	rootKey, err := internalNodeKey(rootNode)
+	if err != nil {
+		return nil, err
+	}
+	if !rootNode.Hash(Path(rootKey, nil), hash).Equal(root) {
+		return nil, ErrInvalidProof{"root mismatch"}
+	}
+	return rootKey, nil
+}
+
+// VerifyChildren checks that left and right are the children of parent,
+// an internal [Node] stored under parentKey in a [Trie] of the given
+// height that uses the given hash function. The children must be at the
+// keys parent links to and their commitments must add up to the one of
+// parent, otherwise [ErrInvalidProof] is returned.
+func VerifyChildren(parent *Node, parentKey *bitset.BitSet, left, right *Node, height uint, hash HashFunc) error {
+	if parent.IsLeaf() {
+		return ErrInvalidProof{"node without children has a child"}
+	}
+
+	for _, child := range []storageNode{{key: parent.left, node: left}, {key: parent.right, node: right}} {
+		if err := child.node.Validate(); err != nil {
+			return err
+		}
+		if child.node.IsLeaf() != (child.key.Len() == height) {
+			return ErrInvalidProof{"node at an unexpected height"}
+		}
+		if !child.node.IsLeaf() {
+			derivedKey, err := internalNodeKey(child.node)
+			if err != nil {
+				return err
+			}
+			if !keysEqual(derivedKey, child.key) {
+				return ErrInvalidProof{"child is not linked to its parent"}
+			}
+		}
+	}
+
+	t := &Trie{height: height, hash: hash}
+	if !t.verifyChildren(parent, parentKey, left, right) {
+		return ErrInvalidProof{"hash mismatch"}
+	}
+	return nil
+}
+
+// putProofNode puts a verified [Node] in the storage of the [Trie]. Nodes
+// whose children are not verified do not overwrite an existing copy, which
+// might have been verified by another proof, and are stripped of children
+// that are not right below them.
+func (t *Trie) putProofNode(key *bitset.BitSet, node *Node, verified bool) error {
+	isLeaf := node.IsLeaf()
+	if isLeaf != (key.Len() == t.height) {
+		return ErrInvalidProof{"node at an unexpected height"}
+	}
+
+	if verified {
+		return t.storage.Put(key, node)
+	}
+	if _, err := t.storage.Get(key); err == nil {
+		return nil
+	}
+	// children keys that branch right below the node only lead to keys the
+	// partial trie knows nothing about, so they are kept for the node to
+	// be told apart from a leaf in proofs of the partial trie
+	if derivedKey, err := internalNodeKey(node); err == nil && keysEqual(derivedKey, key) {
+		return t.storage.Put(key, &Node{value: node.value, left: node.left, right: node.right})
+	}
+	return t.storage.Put(key, &Node{value: node.value})
+}
+
+// keysEqual checks for equality of two keys, which, unlike
+// [bitset.BitSet.Equal], does not require them to be backed by the same
+// number of words.
+func keysEqual(a, b *bitset.BitSet) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	for i := uint(0); i < a.Len(); i++ {
+		if a.Test(i) != b.Test(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// internalNodeKey derives the storage key of a [Node] with children,
+// which is the common prefix of the keys of its children.
+func internalNodeKey(node *Node) (*bitset.BitSet, error) {
+	if node.left == nil || node.right == nil {
+		return nil, ErrInvalidProof{"node has a single child"}
+	}
+
+	longer, shorter := node.left, node.right
+	if longer.Len() < shorter.Len() {
+		longer, shorter = shorter, longer
+	}
+	key, _ := FindCommonKey(longer, shorter)
+
+	// the children must branch to the left and right right after the key
+	if node.left.Len() <= key.Len() || node.right.Len() <= key.Len() ||
+		node.left.Test(node.left.Len()-key.Len()-1) ||
+		!node.right.Test(node.right.Len()-key.Len()-1) {
+		return nil, ErrInvalidProof{"malformed children keys"}
+	}
+	return key, nil
+}
+
+// MultiProof returns the [Node]s needed to verify the values of all of
+// `keys`, or their absence, against the commitment of the [Trie]. Unlike
+// separate proofs, ancestors shared by several keys are included once.
+//
+// The [Node]s are listed in depth-first order, starting with the root.
+// Only [Node]s on the path to one of the keys are followed by their left
+// and right subtrees, others are needed just for their hash.
+func (t *Trie) MultiProof(keys []*felt.Felt) ([]*Node, error) {
+	if len(t.dirty) > 0 {
+		return nil, ErrUncommitted
+	}
+	if t.rootKey == nil {
+		return nil, nil
+	}
+
+	nodeKeys := make([]*bitset.BitSet, 0, len(keys))
+	for _, key := range keys {
+		nodeKeys = append(nodeKeys, t.FeltToBitSet(key))
+	}
+
+	var proof []*Node
+	var walk func(key *bitset.BitSet, keysUnder []*bitset.BitSet) error
+	walk = func(key *bitset.BitSet, keysUnder []*bitset.BitSet) error {
+		node, err := t.storage.Get(key)
+		if err != nil {
+			return err
+		}
+		proof = append(proof, node)
+
+		if keysUnder = keysStrictlyUnder(key, keysUnder); len(keysUnder) == 0 {
+			return nil
+		}
+		if err = walk(node.left, keysUnder); err != nil {
+			return err
+		}
+		return walk(node.right, keysUnder)
+	}
+	if err := walk(t.rootKey, nodeKeys); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// Subtrie returns the [Node]s a partial [Trie] needs to answer [Trie.Get],
+// [Trie.Has] and [Trie.Proof] for `keys`, along with the commitment of the
+// [Trie]. The [Node]s are the ones of [Trie.MultiProof], so that ancestors
+// shared by several keys are included once, and [TrieFromSubtrie] builds
+// the partial [Trie] back out of them.
+func (t *Trie) Subtrie(keys []*felt.Felt) ([]*Node, *felt.Felt, error) {
+	nodes, err := t.MultiProof(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := t.Root()
+	if err != nil {
+		return nil, nil, err
+	}
+	return nodes, root, nil
+}
+
+// TrieFromSubtrie builds a partial [Trie], that uses the Pedersen hash to
+// calculate its commitment, out of the [Node]s returned by [Trie.Subtrie].
+func TrieFromSubtrie(root *felt.Felt, keys []*felt.Felt, nodes []*Node, height uint) (*Trie, error) {
+	return TrieFromSubtrieWithHash(root, keys, nodes, height, crypto.Pedersen)
+}
+
+// TrieFromSubtrieWithHash builds a partial [Trie], that uses the given hash
+// function to calculate its commitment, out of the [Node]s returned by
+// [Trie.Subtrie] for `keys`. The [Node]s are verified against `root` and
+// [ErrInvalidProof] is returned if they are inconsistent with it.
+//
+// Like a [Trie] built by [TrieFromProofWithHash], the resulting [Trie]
+// answers [Trie.Get], [Trie.Has] and [Trie.Proof] for `keys`, while
+// [Trie.Has] returns [ErrNodeNotFound] for keys it can not tell about. It
+// must not be modified.
+func TrieFromSubtrieWithHash(root *felt.Felt, keys []*felt.Felt, nodes []*Node, height uint,
+	hash HashFunc,
+) (*Trie, error) {
+	t := NewTrieWithHash(NewMapStorage(), height, nil, hash)
+	if err := t.putMultiProof(root, keys, nodes); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// VerifyMultiProof verifies a proof returned by [Trie.MultiProof], with a
+// [Trie] of the given height that uses the Pedersen hash, against `root`
+// and returns the proven value of each of `keys`. Keys that are proven to
+// be absent have a zero value. [ErrInvalidProof] is returned if the proof
+// is inconsistent with `root` or does not cover all of `keys`.
+func VerifyMultiProof(root *felt.Felt, keys []*felt.Felt, nodes []*Node, height uint) (map[felt.Felt]*felt.Felt, error) {
+	t := NewTrie(NewMapStorage(), height, nil)
+	if err := t.putMultiProof(root, keys, nodes); err != nil {
+		return nil, err
+	}
+
+	values := make(map[felt.Felt]*felt.Felt, len(keys))
+	for _, key := range keys {
+		has, err := t.Has(key)
+		if err != nil {
+			return nil, ErrInvalidProof{"proof does not cover all keys"}
+		}
+
+		value := new(felt.Felt)
+		if has {
+			if value, err = t.Get(key); err != nil {
+				return nil, err
+			}
+		}
+		values[*key] = value
+	}
+	return values, nil
+}
+
+// putMultiProof verifies a proof returned by [Trie.MultiProof] against the
+// root and puts its [Node]s in the storage of the [Trie].
+func (t *Trie) putMultiProof(root *felt.Felt, keys []*felt.Felt, nodes []*Node) error {
+	if len(nodes) == 0 {
+		if !root.IsZero() {
+			return ErrInvalidProof{"empty proof of a non-empty trie"}
+		}
+		return nil
+	}
+
+	nodeKeys := make([]*bitset.BitSet, 0, len(keys))
+	for _, key := range keys {
+		nodeKeys = append(nodeKeys, t.FeltToBitSet(key))
+	}
+
+	rootNode := nodes[0]
+	var rootKey *bitset.BitSet
+	if rootNode.IsLeaf() {
+		// a root without children can only be matched with one of the keys
+		for _, key := range nodeKeys {
+			if rootNode.Hash(Path(key, nil), t.hash).Equal(root) {
+				rootKey = key
+				break
+			}
+		}
+		if rootKey == nil {
+			return ErrInvalidProof{"cannot derive the key of a root without children"}
+		}
+	} else {
+		var err error
+		if rootKey, err = internalNodeKey(rootNode); err != nil {
+			return err
+		}
+	}
+
+	next := 0
+	var walk func(key *bitset.BitSet, keysUnder []*bitset.BitSet) (*Node, error)
+	walk = func(key *bitset.BitSet, keysUnder []*bitset.BitSet) (*Node, error) {
+		if next >= len(nodes) {
+			return nil, ErrInvalidProof{"missing nodes"}
+		}
+		node := nodes[next]
+		next++
+
+		isLeaf := node.IsLeaf()
+		if keysUnder = keysStrictlyUnder(key, keysUnder); isLeaf || len(keysUnder) == 0 {
+			return node, t.putProofNode(key, node, isLeaf)
+		}
+
+		if derivedKey, err := internalNodeKey(node); err != nil {
+			return nil, err
+		} else if !keysEqual(derivedKey, key) {
+			return nil, ErrInvalidProof{"child is not linked to its parent"}
+		}
+
+		left, err := walk(node.left, keysUnder)
+		if err != nil {
+			return nil, err
+		}
+		right, err := walk(node.right, keysUnder)
+		if err != nil {
+			return nil, err
+		}
+		if !t.verifyChildren(node, key, left, right) {
+			return nil, ErrInvalidProof{"hash mismatch"}
+		}
+		return node, t.putProofNode(key, node, true)
+	}
+
+	if _, err := walk(rootKey, nodeKeys); err != nil {
+		return err
+	}
+	if next != len(nodes) {
+		return ErrInvalidProof{"unexpected nodes"}
+	}
+	if !rootNode.Hash(Path(rootKey, nil), t.hash).Equal(root) {
+		return ErrInvalidProof{"root mismatch"}
+	}
+	t.rootKey = rootKey
+	return nil
+}
+
+// keysStrictlyUnder returns the keys that go through the [Node] at nodeKey
+// and continue below it.
+func keysStrictlyUnder(nodeKey *bitset.BitSet, keys []*bitset.BitSet) []*bitset.BitSet {
+	var under []*bitset.BitSet
+	for _, key := range keys {
+		if key.Len() <= nodeKey.Len() {
+			continue
+		}
+		if _, subset := FindCommonKey(key, nodeKey); subset {
+			under = append(under, key)
+		}
+	}
+	return under
+}
@@ -0,0 +1,466 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrieFromProof(t *testing.T) {
+	proofs := make(map[uint64][]*Node)
+	var root *felt.Felt
+	assert.NoError(t, RunOnTempTrie(8, func(trie *Trie) error {
+		putTestKeys(t, trie)
+
+		// 130 is absent, its path diverges at the parent of 128 and 129
+		for _, key := range []uint64{1, 130} {
+			proof, err := trie.Proof(new(felt.Felt).SetUint64(key))
+			assert.NoError(t, err)
+			proofs[key] = proof
+		}
+
+		var err error
+		root, err = trie.Root()
+		return err
+	}))
+	// root, sibling and child, sibling and child
+	assert.Equal(t, 5, len(proofs[1]))
+	assert.Equal(t, 5, len(proofs[130]))
+
+	t.Run("proven keys", func(t *testing.T) {
+		partial, err := TrieFromProof(root, [][]*Node{proofs[1], proofs[130]}, 8)
+		assert.NoError(t, err)
+
+		partialRoot, err := partial.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, root.Equal(partialRoot))
+
+		// 2 and 240 are proven as siblings on the paths of 1 and 130
+		for _, key := range []uint64{1, 2, 240} {
+			got, err := partial.Get(new(felt.Felt).SetUint64(key))
+			assert.NoError(t, err)
+			assert.Equal(t, true, testValue(key).Equal(got))
+
+			has, err := partial.Has(new(felt.Felt).SetUint64(key))
+			assert.NoError(t, err)
+			assert.Equal(t, true, has)
+		}
+
+		// absent keys
+		for _, key := range []uint64{3, 64, 130} {
+			has, err := partial.Has(new(felt.Felt).SetUint64(key))
+			assert.NoError(t, err)
+			assert.Equal(t, false, has)
+		}
+	})
+
+	t.Run("unproven keys", func(t *testing.T) {
+		partial, err := TrieFromProof(root, [][]*Node{proofs[1]}, 8)
+		assert.NoError(t, err)
+
+		for _, key := range []uint64{128, 129, 240} {
+			_, err = partial.Get(new(felt.Felt).SetUint64(key))
+			assert.ErrorIs(t, err, ErrNodeNotFound)
+
+			_, err = partial.Has(new(felt.Felt).SetUint64(key))
+			assert.ErrorIs(t, err, ErrNodeNotFound)
+		}
+
+		// children of the node where the path of 130 diverges are unknown
+		partial, err = TrieFromProof(root, [][]*Node{proofs[130]}, 8)
+		assert.NoError(t, err)
+		_, err = partial.Has(new(felt.Felt).SetUint64(128))
+		assert.ErrorIs(t, err, ErrNodeNotFound)
+	})
+
+	t.Run("invalid proofs", func(t *testing.T) {
+		_, err := TrieFromProof(new(felt.Felt).SetUint64(37), [][]*Node{proofs[1]}, 8)
+		assert.EqualError(t, err, "invalid proof: root mismatch")
+
+		_, err = TrieFromProof(root, [][]*Node{nil}, 8)
+		assert.EqualError(t, err, "invalid proof: empty proof of a non-empty trie")
+
+		_, err = TrieFromProof(root, [][]*Node{proofs[1][:4]}, 8)
+		assert.EqualError(t, err, "invalid proof: sibling without a child")
+
+		_, err = TrieFromProof(root, [][]*Node{proofs[1]}, 16)
+		assert.EqualError(t, err, "invalid proof: node at an unexpected height")
+
+		tampered := make([]*Node, len(proofs[1]))
+		copy(tampered, proofs[1])
+		tampered[4] = &Node{value: new(felt.Felt).SetUint64(37)}
+		_, err = TrieFromProof(root, [][]*Node{proofs[1], tampered}, 8)
+		assert.EqualError(t, err, "invalid proof: hash mismatch")
+
+		swapped := &Node{value: proofs[1][0].value, left: proofs[1][0].right, right: proofs[1][0].left}
+		_, err = TrieFromProof(root, [][]*Node{append([]*Node{swapped}, proofs[1][1:]...)}, 8)
+		assert.EqualError(t, err, "invalid proof: malformed children keys")
+	})
+}
+
+func TestTrieFromProofEdgeCases(t *testing.T) {
+	t.Run("empty trie", func(t *testing.T) {
+		assert.NoError(t, RunOnTempTrie(251, func(trie *Trie) error {
+			proof, err := trie.Proof(new(felt.Felt).SetUint64(1))
+			assert.NoError(t, err)
+			assert.Equal(t, 0, len(proof))
+
+			partial, err := TrieFromProof(new(felt.Felt), [][]*Node{proof}, 251)
+			assert.NoError(t, err)
+			has, err := partial.Has(new(felt.Felt).SetUint64(1))
+			assert.NoError(t, err)
+			assert.Equal(t, false, has)
+			return nil
+		}))
+	})
+
+	t.Run("single key", func(t *testing.T) {
+		assert.NoError(t, RunOnTempTrie(251, func(trie *Trie) error {
+			assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(2)))
+			proof, err := trie.Proof(new(felt.Felt).SetUint64(1))
+			assert.NoError(t, err)
+			root, err := trie.Root()
+			assert.NoError(t, err)
+
+			_, err = TrieFromProof(root, [][]*Node{proof}, 251)
+			assert.EqualError(t, err, "invalid proof: cannot derive the key of a root without children")
+			return nil
+		}))
+	})
+
+	t.Run("random keys", func(t *testing.T) {
+		assert.NoError(t, RunOnTempTrie(251, func(trie *Trie) error {
+			keys := make([]*felt.Felt, 0, 32)
+			for i := 0; i < 32; i++ {
+				key, _ := new(felt.Felt).SetRandom()
+				value, _ := new(felt.Felt).SetRandom()
+				assert.NoError(t, trie.Put(key, value))
+				keys = append(keys, key)
+			}
+			root, err := trie.Root()
+			assert.NoError(t, err)
+
+			for _, key := range keys {
+				proof, err := trie.Proof(key)
+				assert.NoError(t, err)
+
+				partial, err := TrieFromProofWithHash(root, [][]*Node{proof}, 251, crypto.Pedersen)
+				assert.NoError(t, err)
+
+				want, err := trie.Get(key)
+				assert.NoError(t, err)
+				got, err := partial.Get(key)
+				assert.NoError(t, err)
+				assert.Equal(t, true, want.Equal(got))
+			}
+			return nil
+		}))
+	})
+}
+
+func TestProofBatch(t *testing.T) {
+	keys := make([]*felt.Felt, 200)
+	for idx := range keys {
+		keys[idx], _ = new(felt.Felt).SetRandom()
+	}
+
+	assert.NoError(t, RunOnTempTrie(251, func(trie *Trie) error {
+		batch, err := trie.ProofBatch(keys, 4)
+		assert.NoError(t, err)
+		for _, key := range keys {
+			assert.Empty(t, batch[*key])
+		}
+
+		// half of the keys are absent
+		for _, key := range keys[:len(keys)/2] {
+			assert.NoError(t, trie.Put(key, key))
+		}
+
+		for _, workers := range []int{0, 1, 8, 1000} {
+			batch, err = trie.ProofBatch(keys, workers)
+			assert.NoError(t, err)
+			assert.Equal(t, len(keys), len(batch))
+			for _, key := range keys {
+				want, err := trie.Proof(key)
+				assert.NoError(t, err)
+				assert.Equal(t, want, batch[*key], workers)
+			}
+		}
+
+		batch, err = trie.ProofBatch(nil, 4)
+		assert.NoError(t, err)
+		assert.Empty(t, batch)
+
+		trie.DeferCommitment()
+		assert.NoError(t, trie.Put(keys[len(keys)-1], keys[0]))
+		_, err = trie.ProofBatch(keys, 4)
+		assert.ErrorIs(t, err, ErrUncommitted)
+		return trie.Commit()
+	}))
+
+	t.Run("storage errors", func(t *testing.T) {
+		storage := NewMapStorage()
+		trie := NewTrie(storage, 251, nil)
+		for _, key := range keys {
+			assert.NoError(t, trie.Put(key, key))
+		}
+		assert.NoError(t, storage.Delete(trie.FeltToBitSet(keys[0])))
+
+		_, err := trie.ProofBatch(keys, 4)
+		assert.ErrorIs(t, err, ErrNodeNotFound)
+	})
+}
+
+func BenchmarkProofBatch(b *testing.B) {
+	keys := make([]*felt.Felt, 500)
+	for idx := range keys {
+		keys[idx], _ = new(felt.Felt).SetRandom()
+	}
+
+	if err := RunOnTempTrie(251, func(trie *Trie) error {
+		for _, key := range keys {
+			if err := trie.Put(key, key); err != nil {
+				return err
+			}
+		}
+
+		b.Run("sequential", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, key := range keys {
+					if _, err := trie.Proof(key); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		for _, workers := range []int{4, 16} {
+			b.Run(fmt.Sprintf("batch/%d", workers), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := trie.ProofBatch(keys, workers); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+		return nil
+	}); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func TestMultiProof(t *testing.T) {
+	feltKeys := func(keys ...uint64) []*felt.Felt {
+		felts := make([]*felt.Felt, 0, len(keys))
+		for _, key := range keys {
+			felts = append(felts, new(felt.Felt).SetUint64(key))
+		}
+		return felts
+	}
+
+	var root *felt.Felt
+	var multiProof, singleKeyProof []*Node
+	separateProofsLen := 0
+	// 130 is absent
+	proven := feltKeys(1, 2, 130, 240)
+	assert.NoError(t, RunOnTempTrie(8, func(trie *Trie) error {
+		putTestKeys(t, trie)
+
+		var err error
+		multiProof, err = trie.MultiProof(proven)
+		assert.NoError(t, err)
+		singleKeyProof, err = trie.MultiProof(feltKeys(1))
+		assert.NoError(t, err)
+
+		for _, key := range proven {
+			proof, err := trie.Proof(key)
+			assert.NoError(t, err)
+			separateProofsLen += len(proof)
+		}
+
+		root, err = trie.Root()
+		return err
+	}))
+	// every node but the leaves 128 and 129 is needed, once
+	assert.Equal(t, 7, len(multiProof))
+	assert.Less(t, len(multiProof), separateProofsLen)
+
+	t.Run("valid proof", func(t *testing.T) {
+		values, err := VerifyMultiProof(root, proven, multiProof, 8)
+		assert.NoError(t, err)
+		assert.Equal(t, len(proven), len(values))
+		for _, key := range []uint64{1, 2, 240} {
+			assert.Equal(t, true, testValue(key).Equal(values[*new(felt.Felt).SetUint64(key)]))
+		}
+		assert.Equal(t, true, values[*new(felt.Felt).SetUint64(130)].IsZero())
+
+		// a subset of the keys can be verified as long as they are expanded alike
+		values, err = VerifyMultiProof(root, feltKeys(1), singleKeyProof, 8)
+		assert.NoError(t, err)
+		assert.Equal(t, true, testValue(1).Equal(values[*new(felt.Felt).SetUint64(1)]))
+	})
+
+	t.Run("invalid proofs", func(t *testing.T) {
+		_, err := VerifyMultiProof(new(felt.Felt).SetUint64(37), proven, multiProof, 8)
+		assert.EqualError(t, err, "invalid proof: root mismatch")
+
+		_, err = VerifyMultiProof(root, feltKeys(1, 128), singleKeyProof, 8)
+		assert.EqualError(t, err, "invalid proof: missing nodes")
+
+		_, err = VerifyMultiProof(root, feltKeys(1), multiProof, 8)
+		assert.EqualError(t, err, "invalid proof: unexpected nodes")
+
+		_, err = VerifyMultiProof(root, proven, nil, 8)
+		assert.EqualError(t, err, "invalid proof: empty proof of a non-empty trie")
+
+		tampered := make([]*Node, len(multiProof))
+		copy(tampered, multiProof)
+		tampered[len(tampered)-1] = &Node{value: new(felt.Felt).SetUint64(37)}
+		_, err = VerifyMultiProof(root, proven, tampered, 8)
+		assert.EqualError(t, err, "invalid proof: hash mismatch")
+	})
+
+	t.Run("empty and single key tries", func(t *testing.T) {
+		assert.NoError(t, RunOnTempTrie(251, func(trie *Trie) error {
+			proof, err := trie.MultiProof(proven)
+			assert.NoError(t, err)
+			values, err := VerifyMultiProof(new(felt.Felt), proven, proof, 251)
+			assert.NoError(t, err)
+			assert.Equal(t, true, values[*proven[0]].IsZero())
+
+			assert.NoError(t, trie.Put(proven[0], proven[1]))
+			proof, err = trie.MultiProof(proven)
+			assert.NoError(t, err)
+			root, err := trie.Root()
+			assert.NoError(t, err)
+
+			values, err = VerifyMultiProof(root, proven, proof, 251)
+			assert.NoError(t, err)
+			assert.Equal(t, true, proven[1].Equal(values[*proven[0]]))
+			assert.Equal(t, true, values[*proven[1]].IsZero())
+
+			// the key of the root can not be found without its own key
+			_, err = VerifyMultiProof(root, proven[1:], proof, 251)
+			assert.EqualError(t, err, "invalid proof: cannot derive the key of a root without children")
+			return nil
+		}))
+	})
+}
+
+func TestSubtrie(t *testing.T) {
+	// 1 and 2 share their path down to their parent, 130 is absent
+	served := []*felt.Felt{
+		new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(2),
+		new(felt.Felt).SetUint64(2), new(felt.Felt).SetUint64(130),
+	}
+
+	var nodes []*Node
+	var root *felt.Felt
+	proofs := make(map[uint64][]*Node)
+	assert.NoError(t, RunOnTempTrie(8, func(trie *Trie) error {
+		putTestKeys(t, trie)
+		for _, key := range []uint64{1, 2, 130} {
+			proof, err := trie.Proof(new(felt.Felt).SetUint64(key))
+			assert.NoError(t, err)
+			proofs[key] = proof
+		}
+
+		var err error
+		nodes, root, err = trie.Subtrie(served)
+		assert.NoError(t, err)
+		want, err := trie.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, want.Equal(root))
+		return nil
+	}))
+	// the root, both subtrees of the root, the parent of 1 and 2, both
+	// leaves and the parent of 128 and 129, each once
+	assert.Equal(t, 7, len(nodes))
+
+	partial, err := TrieFromSubtrie(root, served, nodes, 8)
+	assert.NoError(t, err)
+	got, err := partial.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, root.Equal(got))
+
+	for _, key := range []uint64{1, 2} {
+		value, err := partial.Get(new(felt.Felt).SetUint64(key))
+		assert.NoError(t, err)
+		assert.Equal(t, true, testValue(key).Equal(value))
+	}
+	has, err := partial.Has(new(felt.Felt).SetUint64(130))
+	assert.NoError(t, err)
+	assert.Equal(t, false, has)
+
+	// the proofs served by the partial trie are the ones of the full trie
+	for key, want := range proofs {
+		proof, err := partial.Proof(new(felt.Felt).SetUint64(key))
+		assert.NoError(t, err)
+		assert.Equal(t, len(want), len(proof), key)
+		for idx := range want {
+			assert.Equal(t, true, want[idx].value.Equal(proof[idx].value), key)
+		}
+		_, err = TrieFromProof(root, [][]*Node{proof}, 8)
+		assert.NoError(t, err, key)
+	}
+
+	// keys under the parent of 128 and 129 are unknown to the partial
+	// trie, while 131 diverges from it and is known to be absent
+	has, err = partial.Has(new(felt.Felt).SetUint64(131))
+	assert.NoError(t, err)
+	assert.Equal(t, false, has)
+	for _, key := range []uint64{128, 129} {
+		_, err = partial.Has(new(felt.Felt).SetUint64(key))
+		assert.ErrorIs(t, err, ErrNodeNotFound, key)
+		_, err = partial.Get(new(felt.Felt).SetUint64(key))
+		assert.ErrorIs(t, err, ErrNodeNotFound, key)
+	}
+
+	_, err = TrieFromSubtrie(new(felt.Felt).SetUint64(37), served, nodes, 8)
+	var invalid ErrInvalidProof
+	assert.ErrorAs(t, err, &invalid)
+}
+
+func TestProofLoadsPathOnly(t *testing.T) {
+	const height = 251
+	storage := &countingStorage{Storage: NewMapStorage()}
+	trie := NewTrie(storage, height, nil)
+	trie.DeferCommitment()
+
+	// every power of two branches off the path of 0 at a different depth,
+	// the other keys fill up the trie away from that path
+	var keys []*felt.Felt
+	for bit := 0; bit < 200; bit++ {
+		powerOfTwo := make([]byte, 32)
+		powerOfTwo[31-bit/8] = 1 << (bit % 8)
+		keys = append(keys, new(felt.Felt).SetBytes(powerOfTwo))
+	}
+	for idx := 0; idx < 2000; idx++ {
+		key, err := new(felt.Felt).SetRandom()
+		assert.NoError(t, err)
+		keys = append(keys, key)
+	}
+	for idx, key := range keys {
+		assert.NoError(t, trie.Put(key, new(felt.Felt).SetUint64(uint64(idx+1))))
+	}
+	assert.NoError(t, trie.Commit())
+
+	for _, key := range []*felt.Felt{new(felt.Felt).SetUint64(1), new(felt.Felt), keys[len(keys)-1]} {
+		storage.gets = 0
+		proof, err := trie.Proof(key)
+		assert.NoError(t, err)
+		// one read for every node on the path and one for its sibling, no
+		// matter how many keys the trie holds
+		assert.Equal(t, len(proof), storage.gets)
+		assert.LessOrEqual(t, len(proof), 2*height+1)
+	}
+
+	// the deepest path goes through every power of two
+	storage.gets = 0
+	proof, err := trie.Proof(new(felt.Felt).SetUint64(1))
+	assert.NoError(t, err)
+	assert.Greater(t, len(proof), 2*200)
+	assert.Less(t, storage.gets, len(keys))
+}
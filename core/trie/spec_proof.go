@@ -0,0 +1,200 @@
+package trie
+
+import (
+	"encoding/binary"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/bits-and-blooms/bitset"
+)
+
+// ProofNode is a node of a proof in the format of the [specification],
+// which, unlike [Node]s, does not depend on how keys are represented in
+// storage. Exactly one of Binary and Edge is set.
+//
+// [specification]: https://docs.starknet.io/documentation/develop/State/starknet-state/
+type ProofNode struct {
+	Binary *BinaryNode `json:"binary,omitempty"`
+	Edge   *EdgeNode   `json:"edge,omitempty"`
+}
+
+// BinaryNode is a node with two children, given by their hashes
+type BinaryNode struct {
+	Left  *felt.Felt `json:"left"`
+	Right *felt.Felt `json:"right"`
+}
+
+// EdgeNode is a path of Len bits leading to the node whose hash is Child,
+// the bottom of the edge. The first bit of the path is the most
+// significant bit of Path.
+type EdgeNode struct {
+	Child *felt.Felt `json:"child"`
+	Path  *felt.Felt `json:"path"`
+	Len   uint       `json:"len"`
+}
+
+// Hash calculates the hash of a [ProofNode] using the given hash function,
+// the hash of an edge is calculated from its bottom, path and length the
+// way [Node.Hash] does.
+func (n *ProofNode) Hash(hash HashFunc) (*felt.Felt, error) {
+	switch {
+	case n.Binary != nil && n.Edge == nil:
+		if n.Binary.Left == nil || n.Binary.Right == nil {
+			return nil, ErrInvalidProof{"binary node without children"}
+		}
+		return hash(n.Binary.Left, n.Binary.Right), nil
+	case n.Edge != nil && n.Binary == nil:
+		if n.Edge.Child == nil || n.Edge.Path == nil {
+			return nil, ErrInvalidProof{"edge node without child or path"}
+		}
+		if n.Edge.Len == 0 {
+			return nil, ErrInvalidProof{"edge node of length 0"}
+		}
+		path, ok := feltToPath(n.Edge.Path, n.Edge.Len)
+		if !ok {
+			return nil, ErrInvalidProof{"edge path longer than its length"}
+		}
+		return (&Node{value: n.Edge.Child}).Hash(path, hash), nil
+	default:
+		return nil, ErrInvalidProof{"node must be either binary or edge"}
+	}
+}
+
+// SpecProof returns the proof of the value of `key`, or of its absence, in
+// the format of the specification, see [ProofNode]. The proof starts with
+// the node at the root and follows the path to `key`: every [Node] on the
+// path is an edge node, if the path to it from its parent is not empty,
+// followed by a binary node unless it is the last one. The proof of an
+// empty [Trie] is empty.
+func (t *Trie) SpecProof(key *felt.Felt) ([]ProofNode, error) {
+	if len(t.dirty) > 0 {
+		return nil, ErrUncommitted
+	}
+	if t.rootKey == nil {
+		return nil, nil
+	}
+
+	nodes, err := t.nodesFromRoot(t.FeltToBitSet(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var proof []ProofNode
+	var parentKey *bitset.BitSet
+	for idx, cur := range nodes {
+		if path := Path(cur.key, parentKey); path.Len() > 0 {
+			proof = append(proof, ProofNode{Edge: &EdgeNode{
+				Child: cur.node.value,
+				Path:  bitSetToFelt(path),
+				Len:   path.Len(),
+			}})
+		}
+		// the last node is either the leaf of `key` or the bottom of an
+		// edge that diverges from it
+		if idx == len(nodes)-1 {
+			break
+		}
+
+		left, err := t.storage.Get(cur.node.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := t.storage.Get(cur.node.right)
+		if err != nil {
+			return nil, err
+		}
+		proof = append(proof, ProofNode{Binary: &BinaryNode{
+			Left:  left.Hash(Path(cur.node.left, cur.key), t.hash),
+			Right: right.Hash(Path(cur.node.right, cur.key), t.hash),
+		}})
+		parentKey = cur.key
+	}
+	return proof, nil
+}
+
+// VerifySpecProof verifies a proof returned by [Trie.SpecProof], of a
+// [Trie] of the given height that uses the given hash function, against
+// `root` and returns the proven value of `key`, which is zero if `key` is
+// proven to be absent. [ErrInvalidProof] is returned if the proof is
+// inconsistent with `root` or does not lead to `key`.
+func VerifySpecProof(root, key *felt.Felt, proof []ProofNode, height uint, hash HashFunc) (*felt.Felt, error) {
+	keyBits, ok := feltToPath(key, height)
+	if !ok {
+		return nil, ErrInvalidProof{"key does not fit in the trie"}
+	}
+	// keyBit returns the bit of the key at the given depth
+	keyBit := func(depth uint) bool {
+		return keyBits.Test(height - depth - 1)
+	}
+
+	if len(proof) == 0 {
+		if !root.IsZero() {
+			return nil, ErrInvalidProof{"empty proof of a non-empty trie"}
+		}
+		return new(felt.Felt), nil
+	}
+
+	expected := root
+	depth := uint(0)
+	for idx := range proof {
+		node := &proof[idx]
+		if depth >= height {
+			return nil, ErrInvalidProof{"nodes below the leaf"}
+		}
+
+		nodeHash, err := node.Hash(hash)
+		if err != nil {
+			return nil, err
+		}
+		if !nodeHash.Equal(expected) {
+			return nil, ErrInvalidProof{"hash mismatch"}
+		}
+
+		if node.Binary != nil {
+			expected = node.Binary.Left
+			if keyBit(depth) {
+				expected = node.Binary.Right
+			}
+			depth++
+			continue
+		}
+
+		edge := node.Edge
+		if depth+edge.Len > height {
+			return nil, ErrInvalidProof{"edge goes past the leaves"}
+		}
+		path, _ := feltToPath(edge.Path, edge.Len)
+		for i := uint(0); i < edge.Len; i++ {
+			if path.Test(edge.Len-i-1) != keyBit(depth+i) {
+				// the path diverges from the key, which is hence absent
+				if idx != len(proof)-1 {
+					return nil, ErrInvalidProof{"nodes after a diverging edge"}
+				}
+				return new(felt.Felt), nil
+			}
+		}
+		expected = edge.Child
+		depth += edge.Len
+	}
+
+	if depth != height {
+		return nil, ErrInvalidProof{"proof does not reach the key"}
+	}
+	return expected, nil
+}
+
+// feltToPath converts a felt to a path of the given length, the first bit
+// of which is the most significant one. It fails if the felt does not fit
+// in the path.
+func feltToPath(f *felt.Felt, length uint) (*bitset.BitSet, bool) {
+	fBytes := f.Bytes()
+	// bitsets take the least significant word first
+	words := make([]uint64, felt.Limbs)
+	for idx := range words {
+		startBytes := felt.Bytes - (idx+1)*8
+		words[idx] = binary.BigEndian.Uint64(fBytes[startBytes : startBytes+8])
+	}
+	if _, found := bitset.From(words).NextSet(length); found {
+		return nil, false
+	}
+	return bitset.FromWithLength(length, words[:(length+63)/64]), true
+}
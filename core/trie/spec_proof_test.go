@@ -0,0 +1,120 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/juno/core/crypto"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecProof(t *testing.T) {
+	trie := newTestTrie(t)
+	root, err := trie.Root()
+	assert.NoError(t, err)
+
+	proofOf := func(key uint64) []ProofNode {
+		proof, err := trie.SpecProof(new(felt.Felt).SetUint64(key))
+		assert.NoError(t, err)
+		return proof
+	}
+
+	t.Run("present and absent keys", func(t *testing.T) {
+		for key := uint64(0); key < 256; key++ {
+			want := new(felt.Felt)
+			for _, present := range testKeys {
+				if key == present {
+					want = testValue(key)
+				}
+			}
+
+			got, err := VerifySpecProof(root, new(felt.Felt).SetUint64(key), proofOf(key), 8, crypto.Pedersen)
+			assert.NoError(t, err, key)
+			assert.Equal(t, true, want.Equal(got), key)
+		}
+	})
+
+	t.Run("spec encoding", func(t *testing.T) {
+		// the root branches right away, 1 is below a binary node at depth
+		// 6 reached through an edge of 5 bits, then the leaf is a direct
+		// child
+		proof := proofOf(1)
+		assert.Equal(t, 4, len(proof))
+		assert.NotNil(t, proof[0].Binary)
+		assert.Equal(t, uint(5), proof[1].Edge.Len)
+		assert.Equal(t, true, proof[1].Edge.Path.IsZero())
+		assert.NotNil(t, proof[2].Binary)
+		assert.Equal(t, uint(1), proof[3].Edge.Len)
+		assert.Equal(t, true, proof[3].Edge.Path.Equal(new(felt.Felt).SetUint64(1)))
+		assert.Equal(t, true, proof[3].Edge.Child.Equal(testValue(1)))
+
+		// the hash of an edge is the hash of its bottom along its path
+		edgeHash, err := proof[3].Hash(crypto.Pedersen)
+		assert.NoError(t, err)
+		wantHash := crypto.Pedersen(testValue(1), new(felt.Felt).SetUint64(1))
+		assert.Equal(t, true, wantHash.Add(wantHash, new(felt.Felt).SetUint64(1)).Equal(edgeHash))
+	})
+
+	t.Run("invalid proofs", func(t *testing.T) {
+		key := new(felt.Felt).SetUint64(129)
+
+		_, err := VerifySpecProof(new(felt.Felt).SetUint64(1), key, proofOf(129), 8, crypto.Pedersen)
+		assert.ErrorIs(t, err, ErrInvalidProof{"hash mismatch"})
+
+		tampered := proofOf(1)
+		last := *tampered[len(tampered)-1].Edge
+		last.Child = new(felt.Felt).SetUint64(1)
+		tampered[len(tampered)-1].Edge = &last
+		_, err = VerifySpecProof(root, new(felt.Felt).SetUint64(1), tampered, 8, crypto.Pedersen)
+		assert.ErrorIs(t, err, ErrInvalidProof{"hash mismatch"})
+
+		truncated := proofOf(129)
+		_, err = VerifySpecProof(root, key, truncated[:len(truncated)-1], 8, crypto.Pedersen)
+		assert.ErrorIs(t, err, ErrInvalidProof{"proof does not reach the key"})
+
+		_, err = VerifySpecProof(root, key, nil, 8, crypto.Pedersen)
+		assert.ErrorIs(t, err, ErrInvalidProof{"empty proof of a non-empty trie"})
+
+		_, err = VerifySpecProof(root, key, []ProofNode{{}}, 8, crypto.Pedersen)
+		assert.ErrorIs(t, err, ErrInvalidProof{"node must be either binary or edge"})
+
+		overlong := []ProofNode{{Edge: &EdgeNode{Child: root, Path: new(felt.Felt).SetUint64(2), Len: 1}}}
+		_, err = VerifySpecProof(root, key, overlong, 8, crypto.Pedersen)
+		assert.ErrorIs(t, err, ErrInvalidProof{"edge path longer than its length"})
+
+		_, err = VerifySpecProof(root, new(felt.Felt).SetUint64(256), proofOf(129), 8, crypto.Pedersen)
+		assert.ErrorIs(t, err, ErrInvalidProof{"key does not fit in the trie"})
+	})
+
+	t.Run("single key", func(t *testing.T) {
+		// the whole key is the path of the root
+		single := NewTrieWithHash(NewMapStorage(), 251, nil, crypto.Poseidon)
+		key := new(felt.Felt).SetUint64(37)
+		assert.NoError(t, single.Put(key, testValue(37)))
+		root, err := single.Root()
+		assert.NoError(t, err)
+
+		proof, err := single.SpecProof(key)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(proof))
+		assert.Equal(t, uint(251), proof[0].Edge.Len)
+
+		got, err := VerifySpecProof(root, key, proof, 251, crypto.Poseidon)
+		assert.NoError(t, err)
+		assert.Equal(t, true, testValue(37).Equal(got))
+
+		got, err = VerifySpecProof(root, new(felt.Felt).SetUint64(38), proof, 251, crypto.Poseidon)
+		assert.NoError(t, err)
+		assert.Equal(t, true, got.IsZero())
+	})
+
+	t.Run("empty trie", func(t *testing.T) {
+		proof, err := NewTrie(NewMapStorage(), 8, nil).SpecProof(new(felt.Felt).SetUint64(1))
+		assert.NoError(t, err)
+		assert.Empty(t, proof)
+
+		got, err := VerifySpecProof(new(felt.Felt), new(felt.Felt).SetUint64(1), proof, 8, crypto.Pedersen)
+		assert.NoError(t, err)
+		assert.Equal(t, true, got.IsZero())
+	})
+}
@@ -2,7 +2,11 @@
 package trie
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/NethermindEth/juno/core/crypto"
@@ -10,8 +14,45 @@ import (
 	"github.com/NethermindEth/juno/db"
 	// Todo: Go.19 introduced math/bits library. Replace bits-and-blooms/bitset with the math/bits.
 	"github.com/bits-and-blooms/bitset"
+	"github.com/dgraph-io/badger/v3"
 )
 
+// ErrUncommitted is returned when the commitment of a [Trie] is requested
+// while some of its changes are not committed, see [Trie.DeferCommitment].
+var ErrUncommitted = errors.New("trie has uncommitted changes")
+
+// ErrInvalidKeyLength is returned when a bitset key given to a [Trie] is not
+// as long as the height of the [Trie].
+var ErrInvalidKeyLength = errors.New("key length does not match trie height")
+
+// ErrBoundary is returned by [Trie.Begin] when a boundary is already open
+// and by [Trie.Rollback] when none is.
+var ErrBoundary = errors.New("invalid trie boundary")
+
+// ErrMissingNode is returned when a [Trie] follows a child of a [Node] that
+// is not in its [Storage]. It happens when the [Trie] is modified by someone
+// else during the traversal, which a [Trie] does not support, or when the
+// [Storage] is inconsistent, and on partial tries built by [TrieFromProof].
+// Callers can retry on a fresh [Storage], e.g. a new transaction. The error
+// of the [Storage] is wrapped.
+type ErrMissingNode struct {
+	Key    *bitset.BitSet
+	Parent *bitset.BitSet
+	err    error
+}
+
+func (e ErrMissingNode) Error() string {
+	return fmt.Sprintf("node %s referenced by node %s is missing from storage: %v", e.Key.DumpAsBits(),
+		e.Parent.DumpAsBits(), e.err)
+}
+
+func (e ErrMissingNode) Unwrap() error {
+	return e.err
+}
+
+// HashFunc is the hash function used to calculate the commitment of a [Trie]
+type HashFunc func(*felt.Felt, *felt.Felt) *felt.Felt
+
 // Storage is the Persistent storage for the [Trie]
 type Storage interface {
 	Put(key *bitset.BitSet, value *Node) error
@@ -19,6 +60,13 @@ type Storage interface {
 	Delete(key *bitset.BitSet) error
 }
 
+// PrefixDeleter is implemented by [Storage]s that can delete all the nodes
+// whose storage key starts with a prefix at once. [Trie.Clear] uses it
+// rather than deleting nodes one by one.
+type PrefixDeleter interface {
+	DeletePrefix(prefix []byte) error
+}
+
 // Trie is a dense Merkle Patricia Trie (i.e., all internal nodes have two children).
 //
 // This implementation allows for a "flat" storage by keying nodes on their path rather than
@@ -35,19 +83,42 @@ type Storage interface {
 //   - key: represents the storage key for trie [Node]s. It is the full path to the node from the
 //     root.
 //
+// A Trie is not safe for concurrent use while it is modified, a traversal
+// reaching a node that was just deleted fails with [ErrMissingNode].
+//
 // [specification]: https://docs.starknet.io/documentation/develop/State/starknet-state/
 type Trie struct {
 	height  uint
 	rootKey *bitset.BitSet
 	storage Storage
+	hash    HashFunc
+
+	// dirty holds the keys of the internal nodes whose commitment is
+	// outdated, it is nil unless commitment calculation is deferred.
+	dirty map[string]*bitset.BitSet
+
+	// boundary buffers the changes made since [Trie.Begin], it is nil
+	// outside of a boundary. The root key and the dirty keys at the time
+	// of [Trie.Begin] are kept to roll the changes back.
+	boundary     *MemoryOverlay
+	beginRootKey *bitset.BitSet
+	beginDirty   map[string]*bitset.BitSet
 }
 
+// NewTrie creates a [Trie] that uses the Pedersen hash to calculate its commitment.
 func NewTrie(storage Storage, height uint, rootKey *bitset.BitSet) *Trie {
+	return NewTrieWithHash(storage, height, rootKey, crypto.Pedersen)
+}
+
+// NewTrieWithHash creates a [Trie] that uses the given hash function to
+// calculate its commitment.
+func NewTrieWithHash(storage Storage, height uint, rootKey *bitset.BitSet, hash HashFunc) *Trie {
 	// Todo: set max height to 251 and set max key value accordingly
 	return &Trie{
 		storage: storage,
 		height:  height,
 		rootKey: rootKey,
+		hash:    hash,
 	}
 }
 
@@ -69,8 +140,21 @@ func RunOnTempTrie(height uint, do func(*Trie) error) error {
 // FeltToBitSet Converts a key, given in felt, to a bitset which when followed on a [Trie],
 // leads to the corresponding [Node]
 func (t *Trie) FeltToBitSet(k *felt.Felt) *bitset.BitSet {
-	regularK := k.ToRegular()
-	return bitset.FromWithLength(t.height, regularK.Impl()[:])
+	assertCanonicalKey(k)
+	kBytes := k.Bytes()
+	// bitsets take the least significant word first
+	words := make([]uint64, felt.Limbs)
+	for idx := range words {
+		startBytes := felt.Bytes - (idx+1)*8
+		words[idx] = binary.BigEndian.Uint64(kBytes[startBytes : startBytes+8])
+	}
+	// only as many words as a key of the trie needs, like the keys decoded
+	// from storage, otherwise comparing them with [bitset.BitSet.Equal]
+	// panics on tries lower than 193
+	if needed := int(t.height+63) / 64; needed < len(words) {
+		words = words[:needed]
+	}
+	return bitset.FromWithLength(t.height, words)
 }
 
 // FindCommonKey finds the set of common MSB bits in two key bitsets.
@@ -120,6 +204,9 @@ func (t *Trie) nodesFromRoot(key *bitset.BitSet) ([]storageNode, error) {
 	for cur != nil {
 		node, err := t.storage.Get(cur)
 		if err != nil {
+			if len(nodes) > 0 && isNotFound(err) {
+				err = ErrMissingNode{Key: cur, Parent: nodes[len(nodes)-1].key, err: err}
+			}
 			return nil, err
 		}
 
@@ -143,20 +230,263 @@ func (t *Trie) nodesFromRoot(key *bitset.BitSet) ([]storageNode, error) {
 	return nodes, nil
 }
 
+// isNotFound tells whether err is the error of a [Storage] missing a node
+func isNotFound(err error) bool {
+	return errors.Is(err, badger.ErrKeyNotFound) || errors.Is(err, ErrNodeNotFound)
+}
+
 // Get the corresponding `value` for a `key`
 func (t *Trie) Get(key *felt.Felt) (*felt.Felt, error) {
-	value, err := t.storage.Get(t.FeltToBitSet(key))
+	return t.get(t.FeltToBitSet(key))
+}
+
+// GetKey is [Trie.Get] for a key already converted with
+// [Trie.FeltToBitSet], it returns [ErrInvalidKeyLength] if the length of
+// key is not the height of the [Trie].
+func (t *Trie) GetKey(key *bitset.BitSet) (*felt.Felt, error) {
+	if err := t.checkKeyLength(key); err != nil {
+		return nil, err
+	}
+	return t.get(key)
+}
+
+func (t *Trie) get(nodeKey *bitset.BitSet) (*felt.Felt, error) {
+	value, err := t.storage.Get(nodeKey)
 	if err != nil {
 		return nil, err
 	}
 	return value.value, nil
 }
 
+// Has checks whether a `key` has a value in the [Trie]. It returns an error
+// if the [Trie] is missing a node needed to tell, which can only happen on
+// a partial [Trie] (see [TrieFromProof]).
+func (t *Trie) Has(key *felt.Felt) (bool, error) {
+	if t.rootKey == nil {
+		return false, nil
+	}
+
+	nodeKey := t.FeltToBitSet(key)
+	nodes, err := t.nodesFromRoot(nodeKey)
+	if err != nil {
+		return false, err
+	}
+
+	last := nodes[len(nodes)-1]
+	if last.key.Equal(nodeKey) {
+		return true, nil
+	}
+	// the walk stopped on an ancestor of key, whose children are unknown
+	if _, subset := FindCommonKey(nodeKey, last.key); subset {
+		return false, ErrNodeNotFound
+	}
+	return false, nil
+}
+
+// Iterate calls visit on every `key` and `value` of the [Trie] in ascending
+// order of keys, until visit returns false or an error.
+func (t *Trie) Iterate(visit func(key, value *felt.Felt) (bool, error)) error {
+	return t.IterateRange(nil, nil, visit)
+}
+
+// IterateRange calls visit on every `key` and `value` of the [Trie] with
+// start <= key < end in ascending order of keys, until visit returns false
+// or an error. A nil start or end leaves the range unbounded on that side.
+// Subtrees outside the range are not loaded.
+func (t *Trie) IterateRange(start, end *felt.Felt, visit func(key, value *felt.Felt) (bool, error)) error {
+	if t.rootKey == nil {
+		return nil
+	}
+
+	var startInt, endInt *big.Int
+	if start != nil {
+		startInt = feltToBigInt(start)
+	}
+	if end != nil {
+		endInt = feltToBigInt(end)
+	}
+	_, err := t.iterate(t.rootKey, startInt, endInt, visit)
+	return err
+}
+
+// iterate visits the keys in [start, end) under the [Node] with the given
+// storage key, it returns false if the iteration should stop.
+func (t *Trie) iterate(nodeKey *bitset.BitSet, start, end *big.Int,
+	visit func(key, value *felt.Felt) (bool, error),
+) (bool, error) {
+	if start != nil || end != nil {
+		// the keys under the node are in [lowest, lowest + 2^(height - len))
+		subtreeHeight := t.height - nodeKey.Len()
+		lowest := feltToBigInt(bitSetToFelt(nodeKey))
+		lowest.Lsh(lowest, subtreeHeight)
+		if end != nil && lowest.Cmp(end) >= 0 {
+			// so are the keys of every following node
+			return false, nil
+		}
+
+		upper := new(big.Int).Lsh(big.NewInt(1), subtreeHeight)
+		if start != nil && upper.Add(upper, lowest).Cmp(start) <= 0 {
+			return true, nil
+		}
+	}
+
+	node, err := t.storage.Get(nodeKey)
+	if err != nil {
+		return false, err
+	}
+
+	if node.IsLeaf() {
+		return visit(bitSetToFelt(nodeKey), node.value)
+	}
+	if next, err := t.iterate(node.left, start, end, visit); err != nil || !next {
+		return false, err
+	}
+	return t.iterate(node.right, start, end, visit)
+}
+
+// IterateNodes calls visit on every [Node] of the [Trie] along with its
+// storage key, internal nodes and leaves alike, until visit returns false
+// or an error. Nodes are visited depth first, every node before its
+// children and left children before right ones, so that memory use is
+// bounded by the height of the [Trie] whatever its size.
+func (t *Trie) IterateNodes(visit func(key *bitset.BitSet, node *Node) (bool, error)) error {
+	if t.rootKey == nil {
+		return nil
+	}
+	_, err := t.iterateNodes(t.rootKey, visit)
+	return err
+}
+
+// iterateNodes visits the [Node] with the given storage key and the nodes
+// under it, it returns false if the iteration should stop.
+func (t *Trie) iterateNodes(nodeKey *bitset.BitSet, visit func(key *bitset.BitSet, node *Node) (bool, error)) (bool, error) {
+	node, err := t.storage.Get(nodeKey)
+	if err != nil {
+		return false, err
+	}
+
+	if next, err := visit(nodeKey, node); err != nil || !next {
+		return false, err
+	}
+	if node.IsLeaf() {
+		return true, nil
+	}
+	if next, err := t.iterateNodes(node.left, visit); err != nil || !next {
+		return false, err
+	}
+	return t.iterateNodes(node.right, visit)
+}
+
+// keySpaceHeight is the height of the tries whose key space is split by
+// [SplitKeyRange], i.e. of the global and contract storage tries
+const keySpaceHeight = 251
+
+// SplitKeyRange splits the key space of a [Trie] of height 251 into n
+// contiguous, non-overlapping [start, end) ranges covering all of it, to
+// be iterated independently with [Trie.IterateRange]. It returns nil if n
+// is not positive.
+func SplitKeyRange(n int) [][2]*felt.Felt {
+	if n <= 0 {
+		return nil
+	}
+
+	keySpace := new(big.Int).Lsh(big.NewInt(1), keySpaceHeight)
+	boundary := func(idx int) *felt.Felt {
+		bound := new(big.Int).Mul(keySpace, big.NewInt(int64(idx)))
+		return new(felt.Felt).SetBytes(bound.Div(bound, big.NewInt(int64(n))).Bytes())
+	}
+
+	ranges := make([][2]*felt.Felt, 0, n)
+	start := boundary(0)
+	for idx := 1; idx <= n; idx++ {
+		end := boundary(idx)
+		ranges = append(ranges, [2]*felt.Felt{start, end})
+		start = end
+	}
+	return ranges
+}
+
+// feltToBigInt converts a felt to a big.Int, in regular form
+func feltToBigInt(f *felt.Felt) *big.Int {
+	b := f.Bytes()
+	return new(big.Int).SetBytes(b[:])
+}
+
+// TrieStats describes the shape of a [Trie]
+type TrieStats struct {
+	Leaves        uint64
+	InternalNodes uint64
+	// MaxDepth is the largest number of edges from the root to a leaf
+	MaxDepth uint
+	// AveragePathLength is the average len, as defined in the specification,
+	// of the [Node]s. The larger it is, the more the edges are compressed.
+	AveragePathLength float64
+}
+
+// Stats traverses the [Trie] once to describe its shape
+func (t *Trie) Stats() (TrieStats, error) {
+	var stats TrieStats
+	if t.rootKey == nil {
+		return stats, nil
+	}
+
+	var totalPathLength uint64
+	var walk func(key, parentKey *bitset.BitSet, depth uint) error
+	walk = func(key, parentKey *bitset.BitSet, depth uint) error {
+		node, err := t.storage.Get(key)
+		if err != nil {
+			return err
+		}
+		totalPathLength += uint64(Path(key, parentKey).Len())
+
+		if node.IsLeaf() {
+			stats.Leaves++
+			if depth > stats.MaxDepth {
+				stats.MaxDepth = depth
+			}
+			return nil
+		}
+
+		stats.InternalNodes++
+		if err = walk(node.left, key, depth+1); err != nil {
+			return err
+		}
+		return walk(node.right, key, depth+1)
+	}
+	if err := walk(t.rootKey, nil, 0); err != nil {
+		return TrieStats{}, err
+	}
+
+	stats.AveragePathLength = float64(totalPathLength) / float64(stats.Leaves+stats.InternalNodes)
+	return stats, nil
+}
+
 // Put updates the corresponding `value` for a `key`
 func (t *Trie) Put(key *felt.Felt, value *felt.Felt) error {
 	// Todo: check key is not bigger than max key value for a trie height.
+	return t.put(t.FeltToBitSet(key), value)
+}
 
-	nodeKey := t.FeltToBitSet(key)
+// PutKey is [Trie.Put] for a key already converted with
+// [Trie.FeltToBitSet], which spares the conversion to callers holding
+// bitset keys, such as commitment tries keyed by index. It returns
+// [ErrInvalidKeyLength] if the length of key is not the height of the
+// [Trie].
+func (t *Trie) PutKey(key *bitset.BitSet, value *felt.Felt) error {
+	if err := t.checkKeyLength(key); err != nil {
+		return err
+	}
+	return t.put(key, value)
+}
+
+func (t *Trie) checkKeyLength(key *bitset.BitSet) error {
+	if key.Len() != t.height {
+		return fmt.Errorf("%w: %d bits for a height of %d", ErrInvalidKeyLength, key.Len(), t.height)
+	}
+	return nil
+}
+
+func (t *Trie) put(nodeKey *bitset.BitSet, value *felt.Felt) error {
 	node := &Node{
 		value: value,
 	}
@@ -255,6 +585,7 @@ func (t *Trie) deleteLast(affectedNodes []storageNode) error {
 		if err := t.storage.Delete(parent.key); err != nil {
 			return err
 		}
+		t.unmarkDirty(parent.key)
 
 		var siblingKey *bitset.BitSet
 		if parent.node.left.Equal(last.key) {
@@ -302,37 +633,180 @@ func (t *Trie) propagateValues(affectedNodes []storageNode) error {
 		cur := affectedNodes[idx]
 
 		if (cur.node.left == nil) != (cur.node.right == nil) {
-			panic("should not happen")
+			return ErrMalformedNode{fmt.Sprintf("node with key 0x%s of length %d has a single child",
+				bitSetToFelt(cur.key).Text(16), cur.key.Len())}
 		}
 
-		if cur.node.left != nil || cur.node.right != nil {
-			// todo: one of the children is already in affectedNodes, use that instead of fetching from storage
-			left, err := t.storage.Get(cur.node.left)
-			if err != nil {
-				return err
+		if t.dirty != nil && cur.node.left != nil {
+			// recalculated on Commit
+			t.markDirty(cur.key)
+		} else if cur.node.left != nil || cur.node.right != nil {
+			// the next affected node is one of the children and is already
+			// loaded, only its sibling is fetched from storage
+			var loadedChild *storageNode
+			if idx+1 < len(affectedNodes) {
+				loadedChild = &affectedNodes[idx+1]
 			}
-
-			right, err := t.storage.Get(cur.node.right)
-			if err != nil {
+			if err := t.updateValue(cur.key, cur.node, loadedChild); err != nil {
 				return err
 			}
+		}
+
+		if err := t.storage.Put(cur.key, cur.node); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeferCommitment makes subsequent changes to the [Trie] skip the
+// recalculation of its commitment, which is done once for all of them by
+// [Trie.Commit]. This is significantly faster when many keys are changed,
+// since their common ancestors are hashed only once.
+func (t *Trie) DeferCommitment() {
+	if t.dirty == nil {
+		t.dirty = make(map[string]*bitset.BitSet)
+	}
+}
 
-			leftPath := Path(cur.node.left, cur.key)
-			rightPath := Path(cur.node.right, cur.key)
+// Begin opens a boundary around the subsequent changes to the [Trie],
+// which are buffered in memory rather than put in its [Storage] until
+// [Trie.Commit] flushes them all at once, or [Trie.Rollback] drops them.
+// Reads within the boundary see the buffered changes. Boundaries do not
+// nest.
+func (t *Trie) Begin() error {
+	if t.boundary != nil {
+		return fmt.Errorf("%w: a boundary is already open", ErrBoundary)
+	}
 
-			cur.node.value = crypto.Pedersen(left.Hash(leftPath), right.Hash(rightPath))
+	t.boundary = NewMemoryOverlay(t.storage)
+	t.beginRootKey = t.rootKey
+	if t.dirty != nil {
+		t.beginDirty = make(map[string]*bitset.BitSet, len(t.dirty))
+		for keyBytes, key := range t.dirty {
+			t.beginDirty[keyBytes] = key
 		}
+	}
+	t.storage = t.boundary
+	return nil
+}
 
-		if err := t.storage.Put(cur.key, cur.node); err != nil {
+// Rollback drops the changes made since [Trie.Begin], restoring the root
+// of the [Trie] to what it was then.
+func (t *Trie) Rollback() error {
+	if t.boundary == nil {
+		return fmt.Errorf("%w: no boundary is open", ErrBoundary)
+	}
+
+	t.storage = t.boundary.base
+	t.rootKey, t.dirty = t.beginRootKey, t.beginDirty
+	t.closeBoundary()
+	return nil
+}
+
+func (t *Trie) closeBoundary() {
+	t.boundary, t.beginRootKey, t.beginDirty = nil, nil, nil
+}
+
+// Commit recalculates the commitment of the [Node]s changed since
+// [Trie.DeferCommitment] was called or since the last Commit. Within a
+// boundary opened by [Trie.Begin], the changes are then put in the
+// [Storage] of the [Trie] and the boundary is closed.
+func (t *Trie) Commit() error {
+	if err := t.commitDirty(); err != nil {
+		return err
+	}
+	if t.boundary == nil {
+		return nil
+	}
+
+	if err := t.boundary.flush(); err != nil {
+		return err
+	}
+	t.storage = t.boundary.base
+	t.closeBoundary()
+	return nil
+}
+
+// commitDirty recalculates the commitment of the dirty [Node]s
+func (t *Trie) commitDirty() error {
+	if len(t.dirty) == 0 {
+		return nil
+	}
+
+	// children have longer keys than their parents, so they come first
+	keys := make([]*bitset.BitSet, 0, len(t.dirty))
+	for _, key := range t.dirty {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Len() > keys[j].Len()
+	})
+
+	for _, key := range keys {
+		node, err := t.storage.Get(key)
+		if err != nil {
+			return err
+		}
+		if err = t.updateValue(key, node, nil); err != nil {
 			return err
 		}
+		if err = t.storage.Put(key, node); err != nil {
+			return err
+		}
+	}
+
+	t.dirty = make(map[string]*bitset.BitSet)
+	return nil
+}
+
+// markDirty records that the commitment of the [Node] at key is outdated
+func (t *Trie) markDirty(key *bitset.BitSet) {
+	t.dirty[keyString(key)] = key
+}
+
+// unmarkDirty forgets about a deleted [Node]
+func (t *Trie) unmarkDirty(key *bitset.BitSet) {
+	if t.dirty != nil {
+		delete(t.dirty, keyString(key))
+	}
+}
+
+// updateValue sets the value of an internal [Node] to the commitment of
+// its children. A child that is already loaded can be given to save
+// fetching it from storage.
+func (t *Trie) updateValue(key *bitset.BitSet, node *Node, loadedChild *storageNode) error {
+	getChild := func(childKey *bitset.BitSet) (*Node, error) {
+		if loadedChild != nil && keysEqual(loadedChild.key, childKey) {
+			return loadedChild.node, nil
+		}
+		return t.storage.Get(childKey)
+	}
+
+	left, err := getChild(node.left)
+	if err != nil {
+		return err
+	}
+
+	right, err := getChild(node.right)
+	if err != nil {
+		return err
 	}
 
+	leftPath := Path(node.left, key)
+	rightPath := Path(node.right, key)
+
+	node.value = t.hash(left.Hash(leftPath, t.hash), right.Hash(rightPath, t.hash))
 	return nil
 }
 
-// Root returns the commitment of a [Trie]
+// Root returns the commitment of a [Trie]. It fails if commitment
+// calculation is deferred and there are changes that are not committed.
 func (t *Trie) Root() (*felt.Felt, error) {
+	if len(t.dirty) > 0 {
+		return nil, ErrUncommitted
+	}
 	if t.rootKey == nil {
 		return new(felt.Felt), nil
 	}
@@ -343,7 +817,52 @@ func (t *Trie) Root() (*felt.Felt, error) {
 	}
 
 	path := Path(t.rootKey, nil)
-	return root.Hash(path), nil
+	return root.Hash(path, t.hash), nil
+}
+
+// Clear deletes every [Node] of the [Trie], leaving it empty. Callers that
+// persist the key of the root are responsible for resetting it. Nodes are
+// deleted in the transaction of the storage, if any, so Clear is bound by
+// its size limits; large tries are deleted in chunks with
+// [db.DeletePrefix] instead.
+func (t *Trie) Clear() error {
+	deleter, ok := t.storage.(PrefixDeleter)
+	if ok {
+		// all nodes in the storage belong to the trie, unless the storage
+		// has no prefix, in which case they are deleted one by one
+		err := deleter.DeletePrefix(nil)
+		if err != nil && !errors.Is(err, db.ErrEmptyPrefix) {
+			return err
+		}
+		ok = err == nil
+	}
+	if !ok && t.rootKey != nil {
+		var clear func(key *bitset.BitSet) error
+		clear = func(key *bitset.BitSet) error {
+			node, err := t.storage.Get(key)
+			if err != nil {
+				return err
+			}
+			if !node.IsLeaf() {
+				if err = clear(node.left); err != nil {
+					return err
+				}
+				if err = clear(node.right); err != nil {
+					return err
+				}
+			}
+			return t.storage.Delete(key)
+		}
+		if err := clear(t.rootKey); err != nil {
+			return err
+		}
+	}
+
+	t.rootKey = nil
+	if t.dirty != nil {
+		t.dirty = make(map[string]*bitset.BitSet)
+	}
+	return nil
 }
 
 // RootKey returns db key of the [Trie] root node
@@ -351,6 +870,15 @@ func (t *Trie) RootKey() *bitset.BitSet {
 	return t.rootKey
 }
 
+// RootNode returns the decoded root [Node] of the [Trie], or nil if the
+// [Trie] is empty.
+func (t *Trie) RootNode() (*Node, error) {
+	if t.rootKey == nil {
+		return nil, nil
+	}
+	return t.storage.Get(t.rootKey)
+}
+
 func (t *Trie) Dump() {
 	t.dump(0, nil)
 }
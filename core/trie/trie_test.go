@@ -1,7 +1,9 @@
 package trie
 
 import (
+	"bytes"
 	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/NethermindEth/juno/core/crypto"
@@ -12,6 +14,29 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// testKeys are the keys of the tries built by [putTestKeys], in binary:
+// 00000001, 00000010, 10000000, 10000001, 11110000
+var testKeys = []uint64{1, 2, 128, 129, 240}
+
+// testValue is the value of key in the tries built by [putTestKeys]
+func testValue(key uint64) *felt.Felt {
+	return new(felt.Felt).SetUint64(key + 1000)
+}
+
+// putTestKeys puts testKeys, with their testValue, in a trie of height 8
+func putTestKeys(t *testing.T, trie *Trie) {
+	for _, key := range testKeys {
+		assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(key), testValue(key)))
+	}
+}
+
+// newTestTrie returns an in-memory trie of height 8 holding testKeys
+func newTestTrie(t *testing.T) *Trie {
+	trie := NewTrie(NewMapStorage(), 8, nil)
+	putTestKeys(t, trie)
+	return trie
+}
+
 // Todo: Refactor:
 //   - Test names should not have "_"
 //   - Table test are being used incorrectly: they should be separated into subsets, see node_test.go
@@ -430,3 +455,607 @@ func TestPutZero(t *testing.T) {
 	it.Rewind()
 	assert.Equal(t, false, it.Valid()) // storage should be empty
 }
+
+func TestRootNode(t *testing.T) {
+	RunOnTempTrie(251, func(trie *Trie) error {
+		root, err := trie.RootNode()
+		assert.NoError(t, err)
+		assert.Nil(t, root)
+
+		one := new(felt.Felt).SetUint64(1)
+		two := new(felt.Felt).SetUint64(2)
+		assert.NoError(t, trie.Put(one, one))
+
+		// single leaf is the root
+		root, err = trie.RootNode()
+		assert.NoError(t, err)
+		assert.Equal(t, true, root.value.Equal(one))
+		assert.Nil(t, root.left)
+		assert.Nil(t, root.right)
+
+		assert.NoError(t, trie.Put(two, two))
+
+		root, err = trie.RootNode()
+		assert.NoError(t, err)
+		assert.Equal(t, true, root.left.Equal(trie.FeltToBitSet(one)))
+		assert.Equal(t, true, root.right.Equal(trie.FeltToBitSet(two)))
+
+		rootHash, err := trie.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, rootHash.Equal(root.Hash(Path(trie.RootKey(), nil), crypto.Pedersen)))
+		return nil
+	})
+}
+
+func TestTrieHash(t *testing.T) {
+	one := new(felt.Felt).SetUint64(1)
+	two := new(felt.Felt).SetUint64(2)
+
+	// nodeHash hashes a node as described in the specification
+	nodeHash := func(hash HashFunc, value *felt.Felt, path, length uint64) *felt.Felt {
+		h := hash(value, new(felt.Felt).SetUint64(path))
+		return h.Add(h, new(felt.Felt).SetUint64(length))
+	}
+
+	// keys 1 and 2 share the first 249 bits, their parent is the root
+	rootFor := func(hash HashFunc) *felt.Felt {
+		left := nodeHash(hash, one, 1, 1)
+		right := nodeHash(hash, two, 0, 1)
+		return nodeHash(hash, hash(left, right), 0, 249)
+	}
+
+	tests := map[string]HashFunc{
+		"pedersen": crypto.Pedersen,
+		"addition": func(a, b *felt.Felt) *felt.Felt {
+			return new(felt.Felt).Add(a, b)
+		},
+	}
+
+	for name, hash := range tests {
+		t.Run(name, func(t *testing.T) {
+			testDb := db.NewTestDb()
+			defer testDb.Close()
+
+			txn := testDb.NewTransaction(true)
+			defer txn.Discard()
+
+			trie := NewTrieWithHash(NewTrieBadgerTxn(txn, nil), 251, nil, hash)
+			assert.NoError(t, trie.Put(one, one))
+			assert.NoError(t, trie.Put(two, two))
+
+			root, err := trie.Root()
+			assert.NoError(t, err)
+			assert.Equal(t, true, rootFor(hash).Equal(root))
+		})
+	}
+
+	// default hash is Pedersen
+	RunOnTempTrie(251, func(trie *Trie) error {
+		assert.NoError(t, trie.Put(one, one))
+		assert.NoError(t, trie.Put(two, two))
+
+		root, err := trie.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, rootFor(crypto.Pedersen).Equal(root))
+		return nil
+	})
+}
+
+func TestIterate(t *testing.T) {
+	assert.NoError(t, RunOnTempTrie(251, func(trie *Trie) error {
+		// empty trie
+		assert.NoError(t, trie.Iterate(func(key, value *felt.Felt) (bool, error) {
+			t.Error("visited an empty trie")
+			return true, nil
+		}))
+
+		values := make(map[felt.Felt]*felt.Felt)
+		for i := 0; i < 32; i++ {
+			key, _ := new(felt.Felt).SetRandom()
+			value, _ := new(felt.Felt).SetRandom()
+			assert.NoError(t, trie.Put(key, value))
+			values[*key] = value
+		}
+
+		var keys []*felt.Felt
+		assert.NoError(t, trie.Iterate(func(key, value *felt.Felt) (bool, error) {
+			assert.Equal(t, true, values[*key].Equal(value))
+			keys = append(keys, key)
+			return true, nil
+		}))
+		assert.Equal(t, len(values), len(keys))
+		for idx := 1; idx < len(keys); idx++ {
+			prev, cur := keys[idx-1].Bytes(), keys[idx].Bytes()
+			assert.Equal(t, -1, bytes.Compare(prev[:], cur[:]))
+		}
+
+		visited := 0
+		assert.NoError(t, trie.Iterate(func(key, value *felt.Felt) (bool, error) {
+			visited++
+			return visited < 3, nil
+		}))
+		assert.Equal(t, 3, visited)
+		return nil
+	}))
+}
+
+func TestIterateRange(t *testing.T) {
+	assert.NoError(t, RunOnTempTrie(8, func(trie *Trie) error {
+		putTestKeys(t, trie)
+
+		for _, test := range []struct {
+			start, end *felt.Felt
+			want       []uint64
+		}{
+			{start: new(felt.Felt).SetUint64(2), end: new(felt.Felt).SetUint64(129), want: []uint64{2, 128}},
+			{start: new(felt.Felt).SetUint64(3), end: new(felt.Felt).SetUint64(128), want: nil},
+			{start: nil, end: new(felt.Felt).SetUint64(2), want: []uint64{1}},
+			{start: new(felt.Felt).SetUint64(129), end: nil, want: []uint64{129, 240}},
+		} {
+			var got []uint64
+			assert.NoError(t, trie.IterateRange(test.start, test.end, func(key, value *felt.Felt) (bool, error) {
+				got = append(got, feltToBigInt(key).Uint64())
+				return true, nil
+			}))
+			assert.Equal(t, test.want, got)
+		}
+		return nil
+	}))
+}
+
+func TestPutKey(t *testing.T) {
+	assert.NoError(t, RunOnTempTrie(251, func(byKey *Trie) error {
+		return RunOnTempTrie(251, func(byFelt *Trie) error {
+			for _, k := range []uint64{0, 1, 2, 1 << 40} {
+				key, value := new(felt.Felt).SetUint64(k), new(felt.Felt).SetUint64(k+1)
+				assert.NoError(t, byFelt.Put(key, value))
+				assert.NoError(t, byKey.PutKey(byKey.FeltToBitSet(key), value))
+
+				got, err := byKey.GetKey(byKey.FeltToBitSet(key))
+				assert.NoError(t, err)
+				assert.Equal(t, true, value.Equal(got))
+				got, err = byKey.Get(key)
+				assert.NoError(t, err)
+				assert.Equal(t, true, value.Equal(got))
+			}
+
+			want, err := byFelt.Root()
+			assert.NoError(t, err)
+			got, err := byKey.Root()
+			assert.NoError(t, err)
+			assert.Equal(t, true, want.Equal(got))
+
+			for _, length := range []uint{0, 250, 252} {
+				assert.ErrorIs(t, byKey.PutKey(bitset.New(length), new(felt.Felt).SetUint64(1)), ErrInvalidKeyLength)
+				_, err = byKey.GetKey(bitset.New(length))
+				assert.ErrorIs(t, err, ErrInvalidKeyLength)
+			}
+			return nil
+		})
+	}))
+}
+
+func TestIterateNodes(t *testing.T) {
+	assert.NoError(t, RunOnTempTrie(8, func(trie *Trie) error {
+		// empty trie
+		assert.NoError(t, trie.IterateNodes(func(key *bitset.BitSet, node *Node) (bool, error) {
+			t.Error("visited an empty trie")
+			return true, nil
+		}))
+
+		putTestKeys(t, trie)
+
+		var leaves []uint64
+		var visited []*bitset.BitSet
+		assert.NoError(t, trie.IterateNodes(func(key *bitset.BitSet, node *Node) (bool, error) {
+			// every node but the root comes after its parent
+			if len(visited) > 0 {
+				hasParent := false
+				for _, prev := range visited {
+					hasParent = hasParent || prev.Len() < key.Len() && commonPrefixLen(prev, key) == prev.Len()
+				}
+				assert.Equal(t, true, hasParent)
+			}
+			visited = append(visited, key)
+
+			stored, err := trie.storage.Get(key)
+			assert.NoError(t, err)
+			assert.Equal(t, true, stored.Hash(key, crypto.Pedersen).Equal(node.Hash(key, crypto.Pedersen)))
+			if node.IsLeaf() {
+				assert.Equal(t, uint(8), key.Len())
+				leaf := feltToBigInt(bitSetToFelt(key)).Uint64()
+				assert.Equal(t, true, testValue(leaf).Equal(node.value))
+				leaves = append(leaves, leaf)
+			}
+			return true, nil
+		}))
+		// 5 leaves and 4 internal nodes, see TestStats
+		assert.Equal(t, 9, len(visited))
+		assert.Equal(t, testKeys, leaves)
+
+		count := 0
+		assert.NoError(t, trie.IterateNodes(func(key *bitset.BitSet, node *Node) (bool, error) {
+			count++
+			return count < 3, nil
+		}))
+		assert.Equal(t, 3, count)
+		return nil
+	}))
+}
+
+func TestSplitKeyRange(t *testing.T) {
+	assert.Nil(t, SplitKeyRange(0))
+
+	assert.NoError(t, RunOnTempTrie(251, func(trie *Trie) error {
+		for i := 0; i < 64; i++ {
+			key, _ := new(felt.Felt).SetRandom()
+			value, _ := new(felt.Felt).SetRandom()
+			assert.NoError(t, trie.Put(key, value))
+		}
+
+		var all []*felt.Felt
+		assert.NoError(t, trie.Iterate(func(key, _ *felt.Felt) (bool, error) {
+			all = append(all, key)
+			return true, nil
+		}))
+
+		for _, n := range []int{1, 3, 7, 64} {
+			ranges := SplitKeyRange(n)
+			assert.Equal(t, n, len(ranges))
+			assert.Equal(t, true, ranges[0][0].IsZero())
+			keySpace := new(felt.Felt).SetBytes(new(big.Int).Lsh(big.NewInt(1), 251).Bytes())
+			assert.Equal(t, true, keySpace.Equal(ranges[n-1][1]))
+
+			var concatenated []*felt.Felt
+			for idx, keyRange := range ranges {
+				if idx > 0 {
+					assert.Equal(t, true, ranges[idx-1][1].Equal(keyRange[0]))
+				}
+				assert.NoError(t, trie.IterateRange(keyRange[0], keyRange[1], func(key, _ *felt.Felt) (bool, error) {
+					concatenated = append(concatenated, key)
+					return true, nil
+				}))
+			}
+			assert.Equal(t, all, concatenated)
+		}
+		return nil
+	}))
+}
+
+func TestStats(t *testing.T) {
+	assert.NoError(t, RunOnTempTrie(8, func(trie *Trie) error {
+		stats, err := trie.Stats()
+		assert.NoError(t, err)
+		assert.Equal(t, TrieStats{}, stats)
+
+		putTestKeys(t, trie)
+
+		stats, err = trie.Stats()
+		assert.NoError(t, err)
+		assert.Equal(t, TrieStats{
+			Leaves:        5,
+			InternalNodes: 4,
+			// root -> 1 -> 1000000 -> 1000000x
+			MaxDepth: 3,
+			// paths of 000000 and 1000000 have len 5, 0000000x have len 1 and
+			// 11110000 has len 6, the others are empty
+			AveragePathLength: float64(5+1+1+5+6) / 9,
+		}, stats)
+		return nil
+	}))
+}
+
+func TestDeferCommitment(t *testing.T) {
+	keys := make([]*felt.Felt, 64)
+	values := make([]*felt.Felt, len(keys))
+	for idx := range keys {
+		keys[idx], _ = new(felt.Felt).SetRandom()
+		values[idx], _ = new(felt.Felt).SetRandom()
+	}
+
+	// puts and deletes the keys, returning the root after every quarter
+	checkpoints := func(trie *Trie) []*felt.Felt {
+		var roots []*felt.Felt
+		for quarter := 0; quarter < 4; quarter++ {
+			for idx := quarter * 16; idx < (quarter+1)*16; idx++ {
+				assert.NoError(t, trie.Put(keys[idx], values[idx]))
+			}
+			// delete some of the keys put so far
+			for idx := quarter; idx < (quarter+1)*16; idx += 5 {
+				assert.NoError(t, trie.Put(keys[idx], new(felt.Felt)))
+			}
+
+			if trie.dirty != nil {
+				_, err := trie.Root()
+				assert.ErrorIs(t, err, ErrUncommitted)
+				assert.NoError(t, trie.Commit())
+			}
+			root, err := trie.Root()
+			assert.NoError(t, err)
+			roots = append(roots, root)
+		}
+		return roots
+	}
+
+	var immediate, deferred []*felt.Felt
+	assert.NoError(t, RunOnTempTrie(251, func(trie *Trie) error {
+		immediate = checkpoints(trie)
+		return nil
+	}))
+	assert.NoError(t, RunOnTempTrie(251, func(trie *Trie) error {
+		trie.DeferCommitment()
+		deferred = checkpoints(trie)
+		return nil
+	}))
+	assert.Equal(t, immediate, deferred)
+}
+
+func BenchmarkTriePut(b *testing.B) {
+	keys := make([]*felt.Felt, 500)
+	for idx := range keys {
+		keys[idx], _ = new(felt.Felt).SetRandom()
+	}
+
+	for name, deferCommitment := range map[string]bool{"immediate": false, "deferred": true} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := RunOnTempTrie(251, func(trie *Trie) error {
+					if deferCommitment {
+						trie.DeferCommitment()
+					}
+					for _, key := range keys {
+						if err := trie.Put(key, key); err != nil {
+							return err
+						}
+					}
+					return trie.Commit()
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// countingStorage counts the Gets made to the underlying [Storage]
+type countingStorage struct {
+	Storage
+	gets int
+}
+
+func (c *countingStorage) Get(key *bitset.BitSet) (*Node, error) {
+	c.gets++
+	return c.Storage.Get(key)
+}
+
+func BenchmarkTriePutStorageReads(b *testing.B) {
+	keys := make([]*felt.Felt, 500)
+	for idx := range keys {
+		keys[idx], _ = new(felt.Felt).SetRandom()
+	}
+
+	var gets int
+	for i := 0; i < b.N; i++ {
+		storage := &countingStorage{Storage: NewMapStorage()}
+		trie := NewTrie(storage, 251, nil)
+		for _, key := range keys {
+			if err := trie.Put(key, key); err != nil {
+				b.Fatal(err)
+			}
+		}
+		gets += storage.gets
+	}
+	b.ReportMetric(float64(gets)/float64(b.N*len(keys)), "gets/put")
+}
+
+func TestBoundary(t *testing.T) {
+	storage := NewMapStorage()
+	trie := NewTrie(storage, 8, nil)
+	for _, key := range []uint64{1, 2, 128} {
+		assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(key), new(felt.Felt).SetUint64(key+10)))
+	}
+	before, err := trie.Root()
+	assert.NoError(t, err)
+
+	change := func(t *testing.T) *felt.Felt {
+		assert.NoError(t, trie.Begin())
+		assert.ErrorIs(t, trie.Begin(), ErrBoundary)
+		assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(2), new(felt.Felt)))
+		assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(200), new(felt.Felt).SetUint64(5)))
+
+		// the changes are visible within the boundary only
+		value, err := trie.Get(new(felt.Felt).SetUint64(200))
+		assert.NoError(t, err)
+		assert.Equal(t, true, new(felt.Felt).SetUint64(5).Equal(value))
+		_, err = NewTrie(storage, 8, trie.RootKey()).Get(new(felt.Felt).SetUint64(200))
+		assert.ErrorIs(t, err, ErrNodeNotFound)
+
+		root, err := trie.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, false, before.Equal(root))
+		return root
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		change(t)
+		assert.NoError(t, trie.Rollback())
+		assert.ErrorIs(t, trie.Rollback(), ErrBoundary)
+
+		root, err := trie.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, before.Equal(root))
+		value, err := trie.Get(new(felt.Felt).SetUint64(2))
+		assert.NoError(t, err)
+		assert.Equal(t, true, new(felt.Felt).SetUint64(12).Equal(value))
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		want := change(t)
+		assert.NoError(t, trie.Commit())
+
+		// a trie reading the storage directly sees the changes
+		got, err := NewTrie(storage, 8, trie.RootKey()).Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, want.Equal(got))
+		assert.NoError(t, RunOnTempTrie(8, func(expected *Trie) error {
+			for _, key := range []uint64{1, 128, 200} {
+				value, err := trie.Get(new(felt.Felt).SetUint64(key))
+				assert.NoError(t, err)
+				assert.NoError(t, expected.Put(new(felt.Felt).SetUint64(key), value))
+			}
+			root, err := expected.Root()
+			assert.NoError(t, err)
+			assert.Equal(t, true, want.Equal(root))
+			return nil
+		}))
+	})
+
+	t.Run("deferred commitment", func(t *testing.T) {
+		assert.NoError(t, trie.Begin())
+		trie.DeferCommitment()
+		assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(3), new(felt.Felt).SetUint64(7)))
+		_, err := trie.Root()
+		assert.ErrorIs(t, err, ErrUncommitted)
+		assert.NoError(t, trie.Commit())
+		_, err = trie.Root()
+		assert.NoError(t, err)
+		assert.ErrorIs(t, trie.Rollback(), ErrBoundary)
+	})
+}
+
+func TestPutOnMalformedNode(t *testing.T) {
+	storage := NewMapStorage()
+	trie := NewTrie(storage, 8, nil)
+	assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(2)))
+	assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(128), new(felt.Felt).SetUint64(3)))
+
+	// corrupt the root, which is the parent of both keys
+	root, err := storage.Get(trie.RootKey())
+	assert.NoError(t, err)
+	root.right = nil
+
+	assert.NotPanics(t, func() {
+		err = trie.Put(new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(4))
+	})
+	assert.EqualError(t, err, "malformed node: node with key 0x0 of length 0 has a single child")
+}
+
+func TestMissingNode(t *testing.T) {
+	for name, storage := range map[string]Storage{
+		"map storage": NewMapStorage(),
+		"badger txn":  nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			test := func(trie *Trie, storage Storage) error {
+				assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(2)))
+				assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(128), new(felt.Felt).SetUint64(3)))
+
+				// a concurrent writer deletes a child of the root
+				root, err := storage.Get(trie.RootKey())
+				assert.NoError(t, err)
+				assert.NoError(t, storage.Delete(root.Left()))
+
+				var missing ErrMissingNode
+				err = trie.Put(new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(4))
+				if assert.ErrorAs(t, err, &missing) {
+					assert.Equal(t, true, missing.Key.Equal(root.Left()))
+					assert.Equal(t, true, missing.Parent.Equal(trie.RootKey()))
+				}
+				_, err = trie.Has(new(felt.Felt).SetUint64(1))
+				assert.ErrorAs(t, err, &missing)
+				assert.Equal(t, true, isNotFound(err))
+				return nil
+			}
+
+			if storage != nil {
+				assert.NoError(t, test(NewTrie(storage, 8, nil), storage))
+				return
+			}
+			assert.NoError(t, db.NewTestDb().Update(func(txn *badger.Txn) error {
+				storage := NewTrieBadgerTxn(txn, nil)
+				return test(NewTrie(storage, 8, nil), storage)
+			}))
+		})
+	}
+}
+
+func TestClear(t *testing.T) {
+	storage := NewMapStorage()
+	trie := NewTrie(storage, 8, nil)
+	assert.NoError(t, trie.Clear())
+
+	putTestKeys(t, trie)
+	assert.Equal(t, 9, len(storage.nodes))
+
+	assert.NoError(t, trie.Clear())
+	assert.Equal(t, 0, len(storage.nodes))
+	assert.Nil(t, trie.RootKey())
+
+	root, err := trie.Root()
+	assert.NoError(t, err)
+	assert.Equal(t, true, root.IsZero())
+	stats, err := trie.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, TrieStats{}, stats)
+
+	// the trie is usable after being cleared
+	assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(1), new(felt.Felt).SetUint64(2)))
+	value, err := trie.Get(new(felt.Felt).SetUint64(1))
+	assert.NoError(t, err)
+	assert.Equal(t, true, new(felt.Felt).SetUint64(2).Equal(value))
+}
+
+func TestFeltToBitSetLimbBoundaries(t *testing.T) {
+	bitKey := func(bits ...uint) *felt.Felt {
+		k := new(big.Int)
+		for _, bit := range bits {
+			k.SetBit(k, int(bit), 1)
+		}
+		return new(felt.Felt).SetBytes(k.Bytes())
+	}
+
+	// bits on both sides of each 64-bit limb boundary, and the MSB of a key
+	// of a trie of height 251
+	keyBits := [][]uint{{0}, {63}, {64}, {63, 64}, {127}, {128}, {191}, {192}, {191, 192}, {249}, {250}, {0, 250}}
+	keys := make([]*felt.Felt, 0, len(keyBits))
+	for _, bits := range keyBits {
+		keys = append(keys, bitKey(bits...))
+	}
+
+	trie := NewTrie(NewMapStorage(), 251, nil)
+	for idx, key := range keys {
+		path := trie.FeltToBitSet(key)
+		assert.Equal(t, uint(251), path.Len())
+		assert.Equal(t, uint(len(keyBits[idx])), path.Count(), keyBits[idx])
+		for _, bit := range keyBits[idx] {
+			assert.Equal(t, true, path.Test(bit), keyBits[idx])
+		}
+		assert.Equal(t, true, key.Equal(bitSetToFelt(path)), keyBits[idx])
+
+		assert.NoError(t, trie.Put(key, new(felt.Felt).SetUint64(uint64(idx+1))))
+	}
+
+	for idx, key := range keys {
+		value, err := trie.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, true, new(felt.Felt).SetUint64(uint64(idx+1)).Equal(value), keyBits[idx])
+
+		// the walk from the root ends on the leaf of the key
+		path := trie.FeltToBitSet(key)
+		nodes, err := trie.nodesFromRoot(path)
+		assert.NoError(t, err)
+		assert.Equal(t, true, keysEqual(path, nodes[len(nodes)-1].key), keyBits[idx])
+	}
+
+	// keys with bit 250 set are on the right of the root, the others on its left
+	root, err := trie.RootNode()
+	assert.NoError(t, err)
+	var right []*felt.Felt
+	assert.NoError(t, trie.IterateRange(bitKey(250), nil, func(key, _ *felt.Felt) (bool, error) {
+		right = append(right, key)
+		return true, nil
+	}))
+	assert.Equal(t, 2, len(right))
+	assert.Equal(t, true, root.Right().Test(root.Right().Len()-1))
+	assert.Equal(t, false, root.Left().Test(root.Left().Len()-1))
+}
@@ -1,6 +1,9 @@
 package trie
 
 import (
+	"errors"
+
+	"github.com/NethermindEth/juno/db"
 	"github.com/bits-and-blooms/bitset"
 	"github.com/dgraph-io/badger/v3"
 )
@@ -20,49 +23,56 @@ func NewTrieBadgerTxn(badgerTxn *badger.Txn, prefix []byte) *TrieBadgerTxn {
 
 // dbKey creates a byte array to be used as a key to our KV store
 // it simply appends the given key to the configured prefix
-func (t *TrieBadgerTxn) dbKey(key *bitset.BitSet) ([]byte, error) {
-	keyBytes, err := key.MarshalBinary()
-	if err != nil {
-		return nil, err
-	}
-
-	return append(t.prefix, keyBytes...), nil
+func (t *TrieBadgerTxn) dbKey(key *bitset.BitSet) []byte {
+	// a new slice, so that concurrent calls never share the spare capacity
+	// of the prefix
+	dbKey := make([]byte, 0, len(t.prefix)+keySize(key.Len()))
+	return appendKey(append(dbKey, t.prefix...), key)
 }
 
 func (t *TrieBadgerTxn) Put(key *bitset.BitSet, value *Node) error {
-	dbKey, err := t.dbKey(key)
-	if err != nil {
-		return err
-	}
-
 	valueBytes, err := value.MarshalBinary()
 	if err != nil {
 		return err
 	}
 
-	return t.badgerTxn.Set(dbKey, valueBytes)
+	return readOnlyErr(t.badgerTxn.Set(t.dbKey(key), valueBytes))
 }
 
 func (t *TrieBadgerTxn) Get(key *bitset.BitSet) (*Node, error) {
-	dbKey, err := t.dbKey(key)
-	if err != nil {
-		return nil, err
-	}
-
-	if item, err := t.badgerTxn.Get(dbKey); err != nil {
+	if item, err := t.badgerTxn.Get(t.dbKey(key)); err != nil {
 		return nil, err
 	} else {
 		node := new(Node)
-		return node, item.Value(func(val []byte) error {
+		if err = item.Value(func(val []byte) error {
 			return node.UnmarshalBinary(val)
-		})
+		}); err != nil {
+			return nil, err
+		}
+		return node, node.Validate()
 	}
 }
 
 func (t *TrieBadgerTxn) Delete(key *bitset.BitSet) error {
-	dbKey, err := t.dbKey(key)
-	if err != nil {
-		return err
+	return readOnlyErr(t.badgerTxn.Delete(t.dbKey(key)))
+}
+
+// DeletePrefix deletes every node whose db key starts with the given
+// prefix, appended to the configured prefix. It is bound by the size limits
+// of the underlying transaction, large numbers of nodes are deleted in
+// chunks with [db.DeletePrefix] instead. [db.ErrEmptyPrefix] is returned
+// if both prefixes are empty, rather than deleting the whole database.
+func (t *TrieBadgerTxn) DeletePrefix(prefix []byte) error {
+	dbPrefix := make([]byte, 0, len(t.prefix)+len(prefix))
+	dbPrefix = append(append(dbPrefix, t.prefix...), prefix...)
+	return readOnlyErr(db.DeletePrefixTxn(t.badgerTxn, dbPrefix))
+}
+
+// readOnlyErr replaces the error of badger for writes in a read-only
+// transaction with [db.ErrReadOnly].
+func readOnlyErr(err error) error {
+	if errors.Is(err, badger.ErrReadOnlyTxn) {
+		return db.ErrReadOnly
 	}
-	return t.badgerTxn.Delete(dbKey)
+	return err
 }
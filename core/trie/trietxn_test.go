@@ -18,7 +18,8 @@ func TestTrieTxn(t *testing.T) {
 	key := bitset.New(44)
 	node := new(Node)
 	value, _ := new(felt.Felt).SetRandom()
-	assert.NoError(t, node.UnmarshalBinary(value.Marshal()))
+	// version 1 encoding of a leaf
+	assert.NoError(t, node.UnmarshalBinary(append([]byte{nodeVersion1}, value.Marshal()...)))
 
 	// put a node
 	assert.NoError(t, testDb.Update(func(txn *badger.Txn) error {
@@ -71,3 +72,59 @@ func TestTrieTxn(t *testing.T) {
 		return err
 	}), "Key not found")
 }
+
+func TestTrieTxnClear(t *testing.T) {
+	testDb := db.NewTestDb()
+	prefix, otherPrefix := []byte{37, 44}, []byte{37, 45}
+
+	putKeys := func(trie *Trie) {
+		for _, key := range []uint64{1, 2, 128} {
+			assert.NoError(t, trie.Put(new(felt.Felt).SetUint64(key), new(felt.Felt).SetUint64(key)))
+		}
+	}
+
+	var otherRoot *felt.Felt
+	assert.NoError(t, testDb.Update(func(txn *badger.Txn) error {
+		trie := NewTrie(NewTrieBadgerTxn(txn, prefix), 8, nil)
+		other := NewTrie(NewTrieBadgerTxn(txn, otherPrefix), 8, nil)
+		putKeys(trie)
+		putKeys(other)
+
+		assert.NoError(t, trie.Clear())
+		root, err := trie.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, root.IsZero())
+
+		otherRoot, err = other.Root()
+		return err
+	}))
+
+	assert.NoError(t, testDb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		it.Rewind()
+		assert.Equal(t, false, it.Valid())
+
+		// the nodes of the other trie are kept, its root has an empty key
+		root, err := NewTrie(NewTrieBadgerTxn(txn, otherPrefix), 8, bitset.New(0)).Root()
+		assert.Equal(t, true, otherRoot.Equal(root))
+		return err
+	}))
+
+	t.Run("without a prefix", func(t *testing.T) {
+		assert.NoError(t, testDb.Update(func(txn *badger.Txn) error {
+			storage := NewTrieBadgerTxn(txn, nil)
+			assert.ErrorIs(t, storage.DeletePrefix(nil), db.ErrEmptyPrefix)
+
+			// only the nodes of the trie are deleted
+			trie := NewTrie(storage, 8, nil)
+			putKeys(trie)
+			assert.NoError(t, trie.Clear())
+			root, err := NewTrie(NewTrieBadgerTxn(txn, otherPrefix), 8, bitset.New(0)).Root()
+			assert.Equal(t, true, otherRoot.Equal(root))
+			return err
+		}))
+	})
+}
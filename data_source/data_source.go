@@ -8,6 +8,20 @@ import (
 type DataSource interface {
 	GetBlockByNumber(blockNumber uint64) (*core.Block, error)
 	GetTransaction(transactionHash *felt.Felt) (*core.Transaction, error)
+	GetTransactionReceipt(transactionHash *felt.Felt) (*core.TransactionReceipt, error)
 	GetClass(classHash *felt.Felt) (*core.Class, error)
 	GetStateUpdate(blockNumber uint64) (*core.StateUpdate, error)
 }
+
+// PendingSource is implemented by DataSources that can serve the block the
+// sequencer is currently building, which is not sealed yet.
+type PendingSource interface {
+	GetPendingBlock() (*core.Block, error)
+	GetPendingStateUpdate() (*core.StateUpdate, error)
+}
+
+// HeadSource is implemented by DataSources that can tell the number of the
+// latest block of the chain.
+type HeadSource interface {
+	GetLatestBlockNumber() (uint64, error)
+}
@@ -2,39 +2,112 @@ package datasource
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/NethermindEth/juno/clients"
 	"github.com/NethermindEth/juno/core"
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/juno/utils"
+	"github.com/ethereum/go-ethereum/common"
 )
 
+// ErrTransactionNotFound is returned when the feeder gateway has not received
+// a transaction with the requested hash.
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// ErrTransactionHashMismatch is returned when the hash of a transaction
+// fetched from the feeder gateway, computed with the chain id of the
+// gateway, is not the requested one.
+var ErrTransactionHashMismatch = errors.New("transaction hash mismatch")
+
 type Gateway struct {
 	client *clients.GatewayClient
 }
 
 func NewGateway(n utils.Network) *Gateway {
-	return &Gateway{
-		client: clients.NewGatewayClient(n.URL()),
+	gateway, err := NewGatewayWithConfig(clients.NetworkConfig(n))
+	if err != nil {
+		// This should never happen, public networks have a chain id
+		panic(err)
+	}
+	return gateway
+}
+
+// NewGatewayWithConfig creates a [Gateway] that fetches data from the
+// gateway configured by cfg, such as the one of a local devnet, see
+// [clients.NewGatewayClientWithConfig].
+func NewGatewayWithConfig(cfg clients.Config) (*Gateway, error) {
+	client, err := clients.NewGatewayClientWithConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
+	return &Gateway{client: client}, nil
 }
 
 // GetBlockByNumber gets the block for a given block number from the feeder gateway,
 // then adapts it to the core.Block type.
 func (g *Gateway) GetBlockByNumber(blockNumber uint64) (*core.Block, error) {
-	return nil, errors.New("not implemented")
+	response, err := g.client.GetBlock(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return adaptBlock(response)
 }
 
 // GetTransaction gets the transaction for a given transaction hash from the feeder gateway,
-// then adapts it to the appropriate core.Transaction types.
+// then adapts it to the appropriate core.Transaction types. When the chain id of
+// the gateway is known, the hash of the transaction is checked against the
+// requested one, a mismatch is reported with [ErrTransactionHashMismatch].
 func (g *Gateway) GetTransaction(transactionHash *felt.Felt) (*core.Transaction, error) {
-	return nil, errors.New("not implemented")
+	response, err := g.client.GetTransaction(transactionHash)
+	if err != nil {
+		return nil, err
+	}
+	if response.Status == "NOT_RECEIVED" || response.Transaction == nil {
+		return nil, ErrTransactionNotFound
+	}
+
+	transaction, err := adaptTransaction(response.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	if chainId := g.client.ChainId(); chainId != nil {
+		hash, err := transaction.Hash(chainId.Marshal())
+		if err != nil {
+			return nil, err
+		}
+		if !hash.Equal(transactionHash) {
+			return nil, fmt.Errorf("%w: computed %s", ErrTransactionHashMismatch, hash.Text(16))
+		}
+	}
+	return &transaction, nil
+}
+
+// GetTransactionReceipt gets the receipt for a given transaction hash from the
+// feeder gateway, then adapts it to the core.TransactionReceipt type.
+func (g *Gateway) GetTransactionReceipt(transactionHash *felt.Felt) (*core.TransactionReceipt, error) {
+	response, err := g.client.GetTransactionReceipt(transactionHash)
+	if err != nil {
+		return nil, err
+	}
+	if response.Status == "NOT_RECEIVED" {
+		return nil, ErrTransactionNotFound
+	}
+
+	return adaptTransactionReceipt(response), nil
 }
 
 // GetClass gets the class for a given class hash from the feeder gateway,
-// then adapts it to the core.Class type.
+// then adapts it to the core.Class type. The ProgramHash of the class is
+// not set, so its hash can not be calculated.
 func (g *Gateway) GetClass(classHash *felt.Felt) (*core.Class, error) {
-	return nil, errors.New("not implemented")
+	response, err := g.client.GetClassDefinition(classHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return adaptClass(response), nil
 }
 
 // GetStateUpdate gets the state update for a given block number from the feeder gateway,
@@ -48,9 +121,99 @@ func (g *Gateway) GetStateUpdate(blockNumber uint64) (*core.StateUpdate, error)
 	return adaptStateUpdate(response)
 }
 
+// GetLatestBlockNumber gets the number of the latest block from the feeder
+// gateway.
+func (g *Gateway) GetLatestBlockNumber() (uint64, error) {
+	response, err := g.client.GetLatestBlock()
+	if err != nil {
+		return 0, err
+	}
+
+	return response.Number, nil
+}
+
+// GetPendingBlock gets the pending block from the feeder gateway, then
+// adapts it to the core.Block type. The pending block has no number, so
+// the Number of the returned block is zero.
+func (g *Gateway) GetPendingBlock() (*core.Block, error) {
+	response, err := g.client.GetPendingBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return adaptBlock(response)
+}
+
+// GetPendingStateUpdate gets the state update of the pending block from the
+// feeder gateway, then adapts it to the core.StateUpdate type.
+func (g *Gateway) GetPendingStateUpdate() (*core.StateUpdate, error) {
+	response, err := g.client.GetPendingStateUpdate()
+	if err != nil {
+		return nil, err
+	}
+
+	return adaptStateUpdate(response)
+}
+
+func adaptBlock(response *clients.Block) (*core.Block, error) {
+	// the commitments only depend on the receipt fields set here
+	receipts := make([]*core.TransactionReceipt, 0, len(response.Transactions))
+	hashes := make([]*felt.Felt, 0, len(response.Transactions))
+	for idx, transaction := range response.Transactions {
+		receipt := &core.TransactionReceipt{
+			TransactionHash: transaction.Hash,
+			Signatures:      transaction.Signature,
+		}
+		if transaction.Type == "INVOKE_FUNCTION" {
+			receipt.Type = core.Invoke
+		}
+		if idx < len(response.Receipts) {
+			receipt.Events = adaptTransactionReceipt(response.Receipts[idx]).Events
+		}
+		receipts = append(receipts, receipt)
+		hashes = append(hashes, transaction.Hash)
+	}
+
+	scheme, err := core.CommitmentSchemeFor(response.Version)
+	if err != nil {
+		return nil, err
+	}
+	transactionCommitment, err := core.TransactionCommitment(receipts, scheme)
+	if err != nil {
+		return nil, err
+	}
+	eventCommitment, eventCount, err := core.EventData(receipts, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	return &core.Block{
+		BlockHeader: core.BlockHeader{
+			ParentHash:            response.ParentHash,
+			Number:                response.Number,
+			GlobalStateRoot:       response.StateRoot,
+			SequencerAddress:      response.SequencerAddress,
+			Timestamp:             new(felt.Felt).SetUint64(response.Timestamp),
+			TransactionCount:      new(felt.Felt).SetUint64(uint64(len(response.Transactions))),
+			TransactionCommitment: transactionCommitment,
+			EventCount:            new(felt.Felt).SetUint64(eventCount),
+			EventCommitment:       eventCommitment,
+			ProtocolVersion:       new(felt.Felt),
+			ExtraData:             new(felt.Felt),
+		},
+		TransactionHashes: hashes,
+	}, nil
+}
+
 func adaptStateUpdate(response *clients.StateUpdate) (*core.StateUpdate, error) {
 	stateDiff := new(core.StateDiff)
 	stateDiff.DeclaredContracts = response.StateDiff.DeclaredContracts
+	for _, declaredClass := range response.StateDiff.DeclaredClasses {
+		stateDiff.DeclaredV1Classes = append(stateDiff.DeclaredV1Classes, core.DeclaredV1Class{
+			ClassHash:         declaredClass.ClassHash,
+			CompiledClassHash: declaredClass.CompiledClassHash,
+		})
+	}
 	for _, deployedContract := range response.StateDiff.DeployedContracts {
 		stateDiff.DeployedContracts = append(stateDiff.DeployedContracts, core.DeployedContract{
 			Address:   deployedContract.Address,
@@ -58,29 +221,30 @@ func adaptStateUpdate(response *clients.StateUpdate) (*core.StateUpdate, error)
 		})
 	}
 
-	stateDiff.Nonces = make(map[felt.Felt]*felt.Felt)
+	stateDiff.Nonces = make(core.FeltMap[*felt.Felt])
 	for addrStr, nonce := range response.StateDiff.Nonces {
 		addr, err := new(felt.Felt).SetString(addrStr)
 		if err != nil {
 			return nil, err
 		}
-		stateDiff.Nonces[*addr] = nonce
+		stateDiff.Nonces.Set(addr, nonce)
 	}
 
-	stateDiff.StorageDiffs = make(map[felt.Felt][]core.StorageDiff)
+	stateDiff.StorageDiffs = make(core.FeltMap[[]core.StorageDiff])
 	for addrStr, diffs := range response.StateDiff.StorageDiffs {
 		addr, err := new(felt.Felt).SetString(addrStr)
 		if err != nil {
 			return nil, err
 		}
 
-		stateDiff.StorageDiffs[*addr] = []core.StorageDiff{}
+		storageDiffs := []core.StorageDiff{}
 		for _, diff := range diffs {
-			stateDiff.StorageDiffs[*addr] = append(stateDiff.StorageDiffs[*addr], core.StorageDiff{
+			storageDiffs = append(storageDiffs, core.StorageDiff{
 				Key:   diff.Key,
 				Value: diff.Value,
 			})
 		}
+		stateDiff.StorageDiffs.Set(addr, storageDiffs)
 	}
 
 	return &core.StateUpdate{
@@ -90,3 +254,168 @@ func adaptStateUpdate(response *clients.StateUpdate) (*core.StateUpdate, error)
 		StateDiff: stateDiff,
 	}, nil
 }
+
+func adaptTransaction(transaction *clients.Transaction) (core.Transaction, error) {
+	version := transaction.Version
+	if version == nil {
+		version = new(felt.Felt)
+	}
+
+	switch transaction.Type {
+	case "INVOKE_FUNCTION":
+		// the feeder gateway reports the sender of version 1 invokes as the contract address
+		senderAddress := transaction.SenderAddress
+		if senderAddress == nil && version.IsOne() {
+			senderAddress = transaction.ContractAddress
+		}
+		return &core.InvokeTransaction{
+			ContractAddress:    transaction.ContractAddress,
+			EntryPointSelector: transaction.EntryPointSelector,
+			SenderAddress:      senderAddress,
+			Nonce:              transaction.Nonce,
+			CallData:           transaction.Calldata,
+			Signature:          transaction.Signature,
+			MaxFee:             transaction.MaxFee,
+			Version:            version,
+		}, nil
+	case "DECLARE":
+		return &core.DeclareTransaction{
+			ClassHash:     transaction.ClassHash,
+			SenderAddress: transaction.SenderAddress,
+			MaxFee:        transaction.MaxFee,
+			Signature:     transaction.Signature,
+			Nonce:         transaction.Nonce,
+			Version:       version,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported transaction type %q", transaction.Type)
+	}
+}
+
+func adaptClass(response *clients.ClassDefinition) *core.Class {
+	class := &core.Class{
+		APIVersion:   new(felt.Felt),
+		Externals:    adaptEntryPoints(response.EntryPoints.External),
+		L1Handlers:   adaptEntryPoints(response.EntryPoints.L1Handler),
+		Constructors: adaptEntryPoints(response.EntryPoints.Constructor),
+		Bytecode:     response.Program.Data,
+		Abi:          adaptAbi(response.Abi),
+		Program:      response.Program.Compressed,
+	}
+	for _, builtin := range response.Program.Builtins {
+		class.Builtins = append(class.Builtins, new(felt.Felt).SetBytes([]byte(builtin)))
+	}
+	return class
+}
+
+func adaptEntryPoints(entryPoints []clients.EntryPoint) []core.EntryPoint {
+	adapted := make([]core.EntryPoint, 0, len(entryPoints))
+	for _, entryPoint := range entryPoints {
+		adapted = append(adapted, core.EntryPoint{
+			Selector: entryPoint.Selector,
+			Offset:   entryPoint.Offset,
+		})
+	}
+	return adapted
+}
+
+// adaptAbi sorts the entries of abi by type, entries of unknown types
+// are left out
+func adaptAbi(abi clients.Abi) core.Abi {
+	var adapted core.Abi
+	for _, entry := range abi {
+		switch entry.Type {
+		case "function", "constructor", "l1_handler":
+			adapted.Functions = append(adapted.Functions, core.AbiFunction{
+				Type:            entry.Type,
+				Name:            entry.Name,
+				Inputs:          adaptAbiParams(entry.Inputs),
+				Outputs:         adaptAbiParams(entry.Outputs),
+				StateMutability: entry.StateMutability,
+			})
+		case "event":
+			adapted.Events = append(adapted.Events, core.AbiEvent{
+				Name: entry.Name,
+				Keys: adaptAbiParams(entry.Keys),
+				Data: adaptAbiParams(entry.Data),
+			})
+		case "struct":
+			members := make([]core.AbiMember, 0, len(entry.Members))
+			for _, member := range entry.Members {
+				members = append(members, core.AbiMember{
+					AbiParam: core.AbiParam{Name: member.Name, Type: member.Type},
+					Offset:   member.Offset,
+				})
+			}
+			adapted.Structs = append(adapted.Structs, core.AbiStruct{
+				Name:    entry.Name,
+				Size:    entry.Size,
+				Members: members,
+			})
+		}
+	}
+	return adapted
+}
+
+func adaptAbiParams(params []clients.AbiParam) []core.AbiParam {
+	adapted := make([]core.AbiParam, 0, len(params))
+	for _, param := range params {
+		adapted = append(adapted, core.AbiParam{Name: param.Name, Type: param.Type})
+	}
+	return adapted
+}
+
+func adaptTransactionReceipt(response *clients.TransactionReceipt) *core.TransactionReceipt {
+	receipt := &core.TransactionReceipt{
+		BlockHash:        response.BlockHash,
+		BlockNumber:      response.BlockNumber,
+		ActualFee:        response.ActualFee,
+		TransactionHash:  response.TransactionHash,
+		TransactionIndex: response.TransactionIndex,
+	}
+
+	for _, event := range response.Events {
+		receipt.Events = append(receipt.Events, &core.Event{
+			Data: event.Data,
+			From: event.From,
+			Keys: event.Keys,
+		})
+	}
+
+	if resources := response.ExecutionResources; resources != nil {
+		receipt.ExecutionResources = &core.ExecutionResources{
+			MemoryHoles: resources.MemoryHoles,
+			Steps:       resources.Steps,
+		}
+		counter := &receipt.ExecutionResources.BuiltinInstanceCounter
+		counter.Bitwise = resources.BuiltinInstanceCounter.Bitwise
+		counter.EcOp = resources.BuiltinInstanceCounter.EcOp
+		counter.Ecsda = resources.BuiltinInstanceCounter.Ecsda
+		counter.Output = resources.BuiltinInstanceCounter.Output
+		counter.Pedersen = resources.BuiltinInstanceCounter.Pedersen
+		counter.RangeCheck = resources.BuiltinInstanceCounter.RangeCheck
+	}
+
+	if message := response.L1ToL2Message; message != nil {
+		receipt.L1ToL2Message = &core.L1ToL2Message{
+			From:     common.HexToAddress(message.From),
+			Nonce:    message.Nonce,
+			Payload:  message.Payload,
+			Selector: message.Selector,
+			To:       message.To,
+		}
+	}
+
+	if response.L2ToL1Message != nil {
+		messages := make([]core.L2ToL1Message, 0, len(*response.L2ToL1Message))
+		for _, message := range *response.L2ToL1Message {
+			messages = append(messages, core.L2ToL1Message{
+				From:    message.From,
+				Payload: message.Payload,
+				To:      common.HexToAddress(message.To),
+			})
+		}
+		receipt.L2ToL1Message = &messages
+	}
+	return receipt
+}
@@ -2,10 +2,16 @@ package datasource
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/NethermindEth/juno/clients"
+	"github.com/NethermindEth/juno/core"
 	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -101,3 +107,250 @@ func TestAdaptStateUpdate(t *testing.T) {
 		}
 	}
 }
+
+func TestAdaptTransaction(t *testing.T) {
+	t.Run("invoke", func(t *testing.T) {
+		invokeJson := []byte(`{
+			"calldata": ["0x1", "0x2"],
+			"contract_address": "0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6",
+			"max_fee": "0x0",
+			"nonce": "0x3",
+			"signature": ["0x26ee1f973def2e6d5c7f32aaad96c84dab32df6a62ee0e8b530a72bc5478fe6"],
+			"transaction_hash": "0x69d743891f69d758928e163eff1e3d7256752f549f134974d4aa8d26d5d7da8",
+			"type": "INVOKE_FUNCTION",
+			"version": "0x1"
+		}`)
+		var gatewayTransaction clients.Transaction
+		assert.NoError(t, json.Unmarshal(invokeJson, &gatewayTransaction))
+
+		transaction, err := adaptTransaction(&gatewayTransaction)
+		assert.NoError(t, err)
+		invoke, ok := transaction.(*core.InvokeTransaction)
+		if assert.Equal(t, true, ok) {
+			assert.Equal(t, true, gatewayTransaction.ContractAddress.Equal(invoke.SenderAddress))
+			assert.Equal(t, true, gatewayTransaction.Nonce.Equal(invoke.Nonce))
+			assert.Equal(t, true, gatewayTransaction.Version.Equal(invoke.Version))
+			assert.Equal(t, gatewayTransaction.Calldata, invoke.CallData)
+			assert.Equal(t, gatewayTransaction.Signature, invoke.Signature)
+		}
+	})
+
+	t.Run("declare", func(t *testing.T) {
+		declareJson := []byte(`{
+			"transaction_hash": "0x93f542728e403f1edcea4a41f1509a39be35ebcad7d4b5aa77623e5e6480d",
+			"version": "0x1",
+			"max_fee": "0x5af3107a4000",
+			"signature": [
+				"0x516b5999b47509105675dd4c6ed9c373448038cfd00549fe868695916eee0ff",
+				"0x6c0189aaa56bfcb2a3e97198d04bd7a9750a4354b88f4e5edf57cf4d966ddda"
+			],
+			"nonce": "0x1d",
+			"class_hash": "0x2ed6bb4d57ad27a22972b81feb9d09798ff8c273684376ec72c154d90343453",
+			"sender_address": "0xb8a60857ed233885155f1d839086ca7ad03e6d4237cc10b085a4652a61a23",
+			"type": "DECLARE"
+		}`)
+		var gatewayTransaction clients.Transaction
+		assert.NoError(t, json.Unmarshal(declareJson, &gatewayTransaction))
+
+		transaction, err := adaptTransaction(&gatewayTransaction)
+		assert.NoError(t, err)
+		declare, ok := transaction.(*core.DeclareTransaction)
+		if assert.Equal(t, true, ok) {
+			assert.Equal(t, true, gatewayTransaction.ClassHash.Equal(declare.ClassHash))
+			assert.Equal(t, true, gatewayTransaction.SenderAddress.Equal(declare.SenderAddress))
+			assert.Equal(t, true, gatewayTransaction.MaxFee.Equal(declare.MaxFee))
+			assert.Equal(t, true, gatewayTransaction.Nonce.Equal(declare.Nonce))
+			assert.Equal(t, gatewayTransaction.Signature, declare.Signature)
+		}
+
+		// the class hash alone is enough to compute the transaction hash
+		hash, err := transaction.Hash([]byte("SN_MAIN"))
+		assert.NoError(t, err)
+		assert.Equal(t, true, gatewayTransaction.Hash.Equal(hash))
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		_, err := adaptTransaction(&clients.Transaction{Type: "UNKNOWN"})
+		assert.EqualError(t, err, `unsupported transaction type "UNKNOWN"`)
+	})
+}
+
+func TestGatewayGetTransaction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "NOT_RECEIVED", "transaction_hash": "0x1"}`))
+	}))
+	defer srv.Close()
+
+	gateway := &Gateway{client: clients.NewGatewayClient(srv.URL)}
+	_, err := gateway.GetTransaction(new(felt.Felt).SetUint64(1))
+	assert.ErrorIs(t, err, ErrTransactionNotFound)
+}
+
+func TestGatewayGetTransactionHash(t *testing.T) {
+	// https://alpha-mainnet.starknet.io/feeder_gateway/get_transaction?transactionHash=0x93f542728e403f1edcea4a41f1509a39be35ebcad7d4b5aa77623e5e6480d
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ACCEPTED_ON_L1", "transaction": {
+			"transaction_hash": "0x93f542728e403f1edcea4a41f1509a39be35ebcad7d4b5aa77623e5e6480d",
+			"version": "0x1",
+			"max_fee": "0x5af3107a4000",
+			"signature": [],
+			"nonce": "0x1d",
+			"class_hash": "0x2ed6bb4d57ad27a22972b81feb9d09798ff8c273684376ec72c154d90343453",
+			"sender_address": "0xb8a60857ed233885155f1d839086ca7ad03e6d4237cc10b085a4652a61a23",
+			"type": "DECLARE"
+		}}`))
+	}))
+	defer srv.Close()
+	hash, _ := new(felt.Felt).SetString("0x93f542728e403f1edcea4a41f1509a39be35ebcad7d4b5aa77623e5e6480d")
+
+	t.Run("chain id of the gateway", func(t *testing.T) {
+		gateway, err := NewGatewayWithConfig(clients.Config{BaseURL: srv.URL, ChainId: utils.MAINNET.ChainId()})
+		assert.NoError(t, err)
+		_, err = gateway.GetTransaction(hash)
+		assert.NoError(t, err)
+	})
+	t.Run("chain id of another network", func(t *testing.T) {
+		gateway, err := NewGatewayWithConfig(clients.Config{BaseURL: srv.URL, ChainId: utils.GOERLI.ChainId()})
+		assert.NoError(t, err)
+		_, err = gateway.GetTransaction(hash)
+		assert.ErrorIs(t, err, ErrTransactionHashMismatch)
+	})
+	t.Run("no chain id", func(t *testing.T) {
+		_, err := NewGatewayWithConfig(clients.Config{BaseURL: srv.URL})
+		assert.ErrorIs(t, err, clients.ErrMissingChainId)
+	})
+}
+
+func TestAdaptTransactionReceipt(t *testing.T) {
+	receiptJson := []byte(`{
+		"status": "ACCEPTED_ON_L1",
+		"block_hash": "0x3",
+		"block_number": 4,
+		"transaction_index": 2,
+		"transaction_hash": "0x5",
+		"l1_to_l2_consumed_message": {
+			"from_address": "0xae0ee0a63a2ce6baeeffe56e7714fb4efe48d419",
+			"to_address": "0x73314940630fd6dcda0d772d4c972c4e0a9946bef9dabf4ef84eda8ef542b82",
+			"selector": "0x2d757788a8d8d6f21d1cd40bce38a8222d70654214e96ff95d8086e684fbee5",
+			"payload": ["0x1", "0x2"],
+			"nonce": "0x6"
+		},
+		"l2_to_l1_messages": [{
+			"from_address": "0x7",
+			"to_address": "0xae0ee0a63a2ce6baeeffe56e7714fb4efe48d419",
+			"payload": ["0x8"]
+		}],
+		"events": [{
+			"from_address": "0x9",
+			"keys": ["0xa"],
+			"data": ["0xb", "0xc"]
+		}],
+		"execution_resources": {
+			"n_steps": 13,
+			"builtin_instance_counter": {"pedersen_builtin": 14, "range_check_builtin": 15},
+			"n_memory_holes": 16
+		},
+		"actual_fee": "0x11"
+	}`)
+	var gatewayReceipt clients.TransactionReceipt
+	assert.NoError(t, json.Unmarshal(receiptJson, &gatewayReceipt))
+
+	receipt := adaptTransactionReceipt(&gatewayReceipt)
+	assert.Equal(t, true, gatewayReceipt.BlockHash.Equal(receipt.BlockHash))
+	assert.Equal(t, uint64(4), receipt.BlockNumber)
+	assert.Equal(t, int64(2), receipt.TransactionIndex.Int64())
+	assert.Equal(t, true, gatewayReceipt.TransactionHash.Equal(receipt.TransactionHash))
+	assert.Equal(t, true, gatewayReceipt.ActualFee.Equal(receipt.ActualFee))
+
+	assert.Equal(t, "0xae0ee0a63a2ce6baeeffe56e7714fb4efe48d419", strings.ToLower(receipt.L1ToL2Message.From.Hex()))
+	assert.Equal(t, gatewayReceipt.L1ToL2Message.Payload, receipt.L1ToL2Message.Payload)
+	assert.Equal(t, true, gatewayReceipt.L1ToL2Message.Nonce.Equal(receipt.L1ToL2Message.Nonce))
+
+	assert.Equal(t, 1, len(*receipt.L2ToL1Message))
+	assert.Equal(t, "0xae0ee0a63a2ce6baeeffe56e7714fb4efe48d419", strings.ToLower((*receipt.L2ToL1Message)[0].To.Hex()))
+
+	assert.Equal(t, 1, len(receipt.Events))
+	assert.Equal(t, gatewayReceipt.Events[0].Data, receipt.Events[0].Data)
+	assert.Equal(t, gatewayReceipt.Events[0].Keys, receipt.Events[0].Keys)
+
+	assert.Equal(t, uint64(13), receipt.ExecutionResources.Steps)
+	assert.Equal(t, uint64(14), receipt.ExecutionResources.BuiltinInstanceCounter.Pedersen)
+	assert.Equal(t, uint64(15), receipt.ExecutionResources.BuiltinInstanceCounter.RangeCheck)
+	assert.Equal(t, uint64(16), receipt.ExecutionResources.MemoryHoles)
+}
+
+func TestAdaptBlock(t *testing.T) {
+	blockJson, err := os.ReadFile("../clients/testdata/block_11817.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := new(clients.Block)
+	if err = json.Unmarshal(blockJson, response); err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := adaptBlock(response)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, response.Number, block.Number)
+	assert.Equal(t, true, response.ParentHash.Equal(block.ParentHash))
+	assert.Equal(t, true, response.StateRoot.Equal(block.GlobalStateRoot))
+	assert.Equal(t, true, response.SequencerAddress.Equal(block.SequencerAddress))
+	assert.Equal(t, len(response.Transactions), len(block.TransactionHashes))
+	for idx, transaction := range response.Transactions {
+		assert.Equal(t, true, transaction.Hash.Equal(block.TransactionHashes[idx]))
+	}
+
+	hash, err := block.Hash(utils.MAINNET)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, true, response.Hash.Equal(hash), hash.Text(16))
+}
+
+func TestAdaptClass(t *testing.T) {
+	classJson, err := os.ReadFile("../clients/testdata/class_01efa8f8.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := new(clients.ClassDefinition)
+	if err = json.Unmarshal(classJson, response); err != nil {
+		t.Fatal(err)
+	}
+
+	class := adaptClass(response)
+	assert.Equal(t, true, class.APIVersion.IsZero())
+	assert.Equal(t, len(response.Program.Data), len(class.Bytecode))
+	assert.Equal(t, response.Program.Compressed, class.Program)
+	assert.Equal(t, []*felt.Felt{
+		new(felt.Felt).SetBytes([]byte("pedersen")),
+		new(felt.Felt).SetBytes([]byte("range_check")),
+	}, class.Builtins)
+
+	assert.Equal(t, 3, len(class.Abi.Functions))
+	assert.Equal(t, 2, len(class.Abi.Events))
+	assert.Equal(t, 0, len(class.Abi.Structs))
+	assert.Equal(t, "AdminChanged", class.Abi.Events[1].Name)
+	assert.Equal(t, []core.AbiParam{
+		{Name: "previousAdmin", Type: "felt"},
+		{Name: "newAdmin", Type: "felt"},
+	}, class.Abi.Events[1].Data)
+
+	// the selectors of the functions match their entry points
+	entryPoints := map[string][]core.EntryPoint{
+		"constructor": class.Constructors,
+		"function":    class.Externals,
+		"l1_handler":  class.L1Handlers,
+	}
+	for _, function := range class.Abi.Functions {
+		selector, err := function.Selector()
+		assert.NoError(t, err)
+		if assert.Equal(t, 1, len(entryPoints[function.Type]), function.Name) {
+			assert.Equal(t, true, entryPoints[function.Type][0].Selector.Equal(selector), function.Name)
+		}
+	}
+}
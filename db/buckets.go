@@ -14,6 +14,17 @@ const (
 	ContractClassHash // maps contract addresses and class hashes
 	ContractStorage   // contract storages
 	ContractNonce     // contract nonce
+	Class             // maps class hashes to classes
+	ClassesTrie       // maps class hashes to compiled class hash commitments
+	StateUpdates      // maps block numbers to state updates
+	BlockNumbers      // maps block hashes to block numbers
+	Receipts          // maps transaction hashes to transaction receipts
+	Blocks            // maps block numbers to blocks
+	NodeImport        // progress of the import of state trie nodes
+	BlockHashes       // maps block numbers to block hashes
+	StateRoots        // maps block numbers to state commitments
+	StorageGeneration // maps contract addresses to the generation of their storage
+	StaleStorage      // prefixes of the storage nodes of replaced contracts left to delete
 )
 
 // Key flattens a prefix and series of byte arrays into a single []byte.
@@ -1,15 +1,69 @@
 package db
 
-import "github.com/dgraph-io/badger/v3"
+import (
+	"errors"
 
-func NewDb(path string) (*badger.DB, error) {
-	opt := badger.DefaultOptions(path)
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/options"
+)
+
+// ErrReadOnly is returned when writing to a database opened read-only
+var ErrReadOnly = errors.New("database is read-only")
+
+// ErrEmptyPrefix is returned by [DeletePrefix] and [DeletePrefixTxn] when
+// the prefix is empty, which would delete the whole database
+var ErrEmptyPrefix = errors.New("empty prefix")
+
+// Options are the tunable settings of the database. Zero values keep the
+// defaults of badger.
+type Options struct {
+	// InMemory keeps all data in memory, path must be empty
+	InMemory bool
+	// ReadOnly opens an existing database without allowing writes to it,
+	// which lets several processes read the same database
+	ReadOnly bool
+	// SyncWrites syncs every write to disk before acknowledging it
+	SyncWrites bool
+	// DisableCompression stores data blocks uncompressed
+	DisableCompression bool
+	// NumCompactors is the number of compaction workers
+	NumCompactors int
+	// ValueLogFileSize is the maximum size of a value log file in bytes
+	ValueLogFileSize int64
+}
+
+// NewWithOptions opens the database at the given path with the given
+// [Options].
+func NewWithOptions(path string, opts Options) (*badger.DB, error) {
+	opt := badger.DefaultOptions(path).
+		WithInMemory(opts.InMemory).
+		WithReadOnly(opts.ReadOnly).
+		WithSyncWrites(opts.SyncWrites)
+	if opts.DisableCompression {
+		opt = opt.WithCompression(options.None)
+	}
+	if opts.NumCompactors > 0 {
+		opt = opt.WithNumCompactors(opts.NumCompactors)
+	}
+	if opts.ValueLogFileSize > 0 {
+		opt = opt.WithValueLogFileSize(opts.ValueLogFileSize)
+	}
 	return badger.Open(opt)
 }
 
+func NewDb(path string) (*badger.DB, error) {
+	return NewWithOptions(path, Options{})
+}
+
+// NewReadOnly opens the existing database at the given path without
+// allowing writes to it. Writes to the state and its tries fail with
+// [ErrReadOnly].
+func NewReadOnly(path string) (*badger.DB, error) {
+	return NewWithOptions(path, Options{ReadOnly: true})
+}
+
 func NewInMemoryDb() (*badger.DB, error) {
-	opt := badger.DefaultOptions("").WithInMemory(true)
-	return badger.Open(opt)
+	return NewWithOptions("", Options{InMemory: true})
 }
 
 func NewTestDb() *badger.DB {
@@ -19,3 +73,65 @@ func NewTestDb() *badger.DB {
 	}
 	return db
 }
+
+// deletePrefixChunk is the number of keys [DeletePrefix] deletes per
+// transaction
+var deletePrefixChunk = 10_000
+
+// DeletePrefix deletes every key that starts with the given prefix. Keys
+// are deleted in chunks, each in its own transaction, so that deleting a
+// large number of keys does not exceed the size limits of a transaction.
+// The deletion is therefore not atomic.
+func DeletePrefix(db *badger.DB, prefix []byte) error {
+	if len(prefix) == 0 {
+		return ErrEmptyPrefix
+	}
+	for {
+		deleted := 0
+		if err := db.Update(func(txn *badger.Txn) error {
+			var err error
+			deleted, err = deletePrefix(txn, prefix, deletePrefixChunk)
+			return err
+		}); err != nil {
+			return err
+		}
+		if deleted < deletePrefixChunk {
+			return nil
+		}
+	}
+}
+
+// DeletePrefixTxn deletes every key that starts with the given prefix in
+// the given Txn context. Unlike [DeletePrefix], it is bound by the size
+// limits of the transaction.
+func DeletePrefixTxn(txn *badger.Txn, prefix []byte) error {
+	if len(prefix) == 0 {
+		return ErrEmptyPrefix
+	}
+	_, err := deletePrefix(txn, prefix, 0)
+	return err
+}
+
+// deletePrefix deletes up to limit keys that start with the given prefix,
+// or all of them if limit is 0, and returns the number of deleted keys.
+func deletePrefix(txn *badger.Txn, prefix []byte, limit int) (int, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+
+	// keys are collected first, since deleting while iterating is not
+	// supported by badger
+	var keys [][]byte
+	for it.Rewind(); it.Valid() && (limit == 0 || len(keys) < limit); it.Next() {
+		keys = append(keys, it.Item().KeyCopy(nil))
+	}
+	it.Close()
+
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
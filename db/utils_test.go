@@ -0,0 +1,73 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	path := t.TempDir()
+	key, value := State.Key([]byte("key")), []byte("value")
+
+	db, err := NewWithOptions(path, Options{
+		SyncWrites:         true,
+		DisableCompression: true,
+		NumCompactors:      2,
+		ValueLogFileSize:   1 << 20,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, value)
+	}))
+	assert.NoError(t, db.Close())
+
+	db, err = NewWithOptions(path, Options{ReadOnly: true})
+	assert.NoError(t, err)
+	assert.NoError(t, db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		got, err := item.ValueCopy(nil)
+		assert.Equal(t, value, got)
+		return err
+	}))
+	assert.NoError(t, db.Close())
+
+	_, err = NewWithOptions(path, Options{InMemory: true})
+	assert.Error(t, err)
+}
+
+func TestDeletePrefix(t *testing.T) {
+	defer func(chunk int) { deletePrefixChunk = chunk }(deletePrefixChunk)
+	deletePrefixChunk = 3
+
+	testDb := NewTestDb()
+	assert.NoError(t, testDb.Update(func(txn *badger.Txn) error {
+		for i := byte(0); i < 10; i++ {
+			if err := txn.Set(State.Key([]byte{1, i}), []byte{i}); err != nil {
+				return err
+			}
+		}
+		return txn.Set(State.Key([]byte{2}), []byte{2})
+	}))
+
+	assert.NoError(t, DeletePrefix(testDb, State.Key([]byte{1})))
+	assert.NoError(t, testDb.View(func(txn *badger.Txn) error {
+		var keys [][]byte
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		assert.Equal(t, [][]byte{State.Key([]byte{2})}, keys)
+		return nil
+	}))
+
+	assert.ErrorIs(t, DeletePrefix(testDb, nil), ErrEmptyPrefix)
+	assert.ErrorIs(t, testDb.Update(func(txn *badger.Txn) error {
+		return DeletePrefixTxn(txn, []byte{})
+	}), ErrEmptyPrefix)
+}
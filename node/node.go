@@ -65,7 +65,7 @@ func New(cfg *Config) (StarkNetNode, error) {
 	return &Node{
 		cfg:        cfg,
 		blockchain: bc,
-		syncLoop:   sync.NewSyncLoop(bc, nil),
+		syncLoop:   sync.NewSyncLoop(bc, nil, nil),
 	}, nil
 }
 
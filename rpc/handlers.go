@@ -0,0 +1,200 @@
+// Package rpc implements the handlers of the StarkNet JSON-RPC [specification].
+//
+// [specification]: https://github.com/starkware-libs/starknet-specs/blob/master/api/starknet_api_openrpc.json
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/blockchain"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/state"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// Handler serves the StarkNet JSON-RPC methods
+type Handler struct {
+	state    *state.State
+	receipts blockchain.ReceiptStore
+	// timeouts holds the time the methods are given to run, by name. It
+	// can be set while requests are served, so it is guarded by
+	// timeoutsLock.
+	timeouts     map[string]time.Duration
+	timeoutsLock sync.RWMutex
+}
+
+func New(state *state.State, receipts blockchain.ReceiptStore) *Handler {
+	return &Handler{
+		state:    state,
+		receipts: receipts,
+	}
+}
+
+// WithTimeout bounds the time the method with the given name, such as
+// "starknet_call", runs for: once it has run for timeout, its reads of
+// the state fail and it returns [ErrInternal]. Methods run without a
+// time limit by default, or if timeout is not positive. Only
+// "starknet_call" runs in a bounded context for now: the timeouts of the
+// other methods are ignored.
+func (h *Handler) WithTimeout(method string, timeout time.Duration) *Handler {
+	h.timeoutsLock.Lock()
+	defer h.timeoutsLock.Unlock()
+	if h.timeouts == nil {
+		h.timeouts = make(map[string]time.Duration)
+	}
+	h.timeouts[method] = timeout
+	return h
+}
+
+// context returns the context the method with the given name runs in,
+// see [Handler.WithTimeout]
+func (h *Handler) context(method string) (context.Context, context.CancelFunc) {
+	h.timeoutsLock.RLock()
+	timeout := h.timeouts[method]
+	h.timeoutsLock.RUnlock()
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// stateAt returns the [state.State] at the given block. Only the latest
+// state is kept by the node for now, so the block can be referred to by
+// its tag, hash or number but earlier blocks are not found.
+func (h *Handler) stateAt(id *BlockId) (*state.State, *Error) {
+	if id == nil || id.Pending {
+		return nil, ErrBlockNotFound
+	}
+
+	var st *state.State
+	var err error
+	switch {
+	case id.Latest:
+		return h.state, nil
+	case id.Hash != nil:
+		st, err = h.state.StateAtBlockHash(id.Hash)
+	default:
+		st, err = h.state.StateAtBlockNumber(id.Number)
+	}
+	if errors.Is(err, state.ErrStateUpdateNotFound) || errors.Is(err, state.ErrHistoricalStateUnavailable) {
+		return nil, ErrBlockNotFound
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+	return st, nil
+}
+
+// GetClass returns the class with the given hash at the given block.
+// It implements the "starknet_getClass" method.
+func (h *Handler) GetClass(id *BlockId, classHash *felt.Felt) (*Class, *Error) {
+	st, rpcErr := h.stateAt(id)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	class, err := st.GetClass(classHash)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrInvalidContractClassHash
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+
+	adapted, err := adaptClass(class)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	return adapted, nil
+}
+
+// GetClassAt returns the class of the contract at the given address at
+// the given block. It implements the "starknet_getClassAt" method.
+func (h *Handler) GetClassAt(id *BlockId, address *felt.Felt) (*Class, *Error) {
+	st, rpcErr := h.stateAt(id)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	classHash, err := st.GetContractClass(address)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrContractNotFound
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+
+	return h.GetClass(id, classHash)
+}
+
+// Call runs the given function call at the given block without changing
+// the state and returns its result. It implements the "starknet_call"
+// method. Calls are run by the [state.Executor] of the state, without
+// one they fail with [ErrInternal]. Their run time can be bounded with
+// [Handler.WithTimeout], calls that run out of time fail with
+// [ErrInternal] too.
+func (h *Handler) Call(call *FunctionCall, id *BlockId) ([]*felt.Felt, *Error) {
+	st, rpcErr := h.stateAt(id)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	ctx, cancel := h.context("starknet_call")
+	defer cancel()
+	result, err := st.CallCtx(ctx, call.ContractAddress, call.EntryPointSelector, call.Calldata)
+	switch {
+	case errors.Is(err, state.ErrContractNotFound):
+		return nil, ErrContractNotFound
+	case errors.Is(err, badger.ErrKeyNotFound):
+		// the class of the contract is unknown
+		return nil, ErrInvalidContractClassHash
+	case errors.Is(err, state.ErrInvalidMessageSelector):
+		return nil, ErrInvalidMessageSelector
+	case errors.Is(err, state.ErrInvalidCallData):
+		return nil, ErrInvalidCallData
+	case err != nil:
+		return nil, ErrInternal
+	}
+	return result, nil
+}
+
+// GetStateUpdate returns the state update of the given block. It
+// implements the "starknet_getStateUpdate" method.
+func (h *Handler) GetStateUpdate(id *BlockId) (*StateUpdate, *Error) {
+	if id == nil || id.Pending {
+		return nil, ErrBlockNotFound
+	}
+
+	reader := h.state.DiffReader()
+	var update *core.StateUpdate
+	var err error
+	switch {
+	case id.Latest:
+		_, update, err = reader.LatestStateUpdate()
+	case id.Hash != nil:
+		update, err = reader.StateUpdateByHash(id.Hash)
+	default:
+		update, err = reader.StateUpdate(id.Number)
+	}
+	if errors.Is(err, state.ErrStateUpdateNotFound) {
+		return nil, ErrBlockNotFound
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+
+	return adaptStateUpdate(update), nil
+}
+
+// GetTransactionReceipt returns the receipt of the transaction with the
+// given hash. It implements the "starknet_getTransactionReceipt" method.
+func (h *Handler) GetTransactionReceipt(transactionHash *felt.Felt) (*TransactionReceipt, *Error) {
+	receipt, err := h.receipts.Receipt(transactionHash)
+	if errors.Is(err, blockchain.ErrReceiptNotFound) {
+		return nil, ErrTxnHashNotFound
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+
+	return adaptReceipt(receipt), nil
+}
@@ -0,0 +1,431 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/blockchain"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/state"
+	"github.com/NethermindEth/juno/db"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var latest = &BlockId{Latest: true}
+
+func TestBlockIdUnmarshalJSON(t *testing.T) {
+	tests := map[string]struct {
+		json string
+		want BlockId
+		err  bool
+	}{
+		"latest":       {json: `"latest"`, want: BlockId{Latest: true}},
+		"pending":      {json: `"pending"`, want: BlockId{Pending: true}},
+		"number":       {json: `{"block_number": 37}`, want: BlockId{Number: 37}},
+		"hash":         {json: `{"block_hash": "0x37"}`, want: BlockId{Hash: new(felt.Felt).SetUint64(0x37)}},
+		"unknown tag":  {json: `"earliest"`, err: true},
+		"empty object": {json: `{}`, err: true},
+		"both":         {json: `{"block_hash": "0x37", "block_number": 37}`, err: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var id BlockId
+			err := json.Unmarshal([]byte(test.json), &id)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, id)
+		})
+	}
+}
+
+func TestHandlerContext(t *testing.T) {
+	handler := New(nil, blockchain.ReceiptStore{})
+
+	ctx, cancel := handler.context("starknet_call")
+	_, bounded := ctx.Deadline()
+	assert.Equal(t, false, bounded)
+	cancel()
+
+	ctx, cancel = handler.WithTimeout("starknet_call", time.Millisecond).context("starknet_call")
+	defer cancel()
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+	other, cancelOther := handler.context("starknet_getClass")
+	defer cancelOther()
+	_, bounded = other.Deadline()
+	assert.Equal(t, false, bounded)
+}
+
+func TestGetClass(t *testing.T) {
+	testDb := db.NewTestDb()
+	st := state.NewState(testDb)
+	handler := New(st, blockchain.NewReceiptStore(testDb))
+
+	classHash := new(felt.Felt).SetUint64(1)
+	class := &core.Class{
+		APIVersion: new(felt.Felt),
+		Externals: []core.EntryPoint{
+			{Selector: new(felt.Felt).SetUint64(2), Offset: new(felt.Felt).SetUint64(3)},
+		},
+		L1Handlers:   []core.EntryPoint{},
+		Constructors: []core.EntryPoint{},
+		Builtins:     []*felt.Felt{new(felt.Felt).SetBytes([]byte("range_check"))},
+		ProgramHash:  new(felt.Felt).SetUint64(4),
+		Bytecode:     []*felt.Felt{new(felt.Felt).SetUint64(5)},
+		Program:      base64.StdEncoding.EncodeToString([]byte("compressed program")),
+	}
+	assert.NoError(t, st.PutClass(classHash, class))
+
+	t.Run("unknown block", func(t *testing.T) {
+		_, rpcErr := handler.GetClass(&BlockId{Number: 1}, classHash)
+		assert.Equal(t, ErrBlockNotFound, rpcErr)
+	})
+
+	t.Run("unknown class", func(t *testing.T) {
+		_, rpcErr := handler.GetClass(latest, new(felt.Felt).SetUint64(2))
+		assert.Equal(t, ErrInvalidContractClassHash, rpcErr)
+	})
+
+	t.Run("known class", func(t *testing.T) {
+		got, rpcErr := handler.GetClass(latest, classHash)
+		assert.Nil(t, rpcErr)
+		assert.Equal(t, EntryPoints{
+			Constructor: []EntryPoint{},
+			External:    []EntryPoint{{Selector: class.Externals[0].Selector, Offset: class.Externals[0].Offset}},
+			L1Handler:   []EntryPoint{},
+		}, got.EntryPoints)
+		// the program is served as it was stored
+		assert.Equal(t, class.Program, got.Program)
+	})
+
+	t.Run("class without program", func(t *testing.T) {
+		withoutProgram := *class
+		withoutProgram.Program = ""
+		assert.NoError(t, st.PutClass(new(felt.Felt).SetUint64(3), &withoutProgram))
+
+		_, rpcErr := handler.GetClass(latest, new(felt.Felt).SetUint64(3))
+		assert.Equal(t, ErrInternal, rpcErr)
+	})
+}
+
+func TestGetClassAt(t *testing.T) {
+	testDb := db.NewTestDb()
+	st := state.NewState(testDb)
+	handler := New(st, blockchain.NewReceiptStore(testDb))
+
+	addr, _ := new(felt.Felt).SetString("0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+	classHash, _ := new(felt.Felt).SetString("0x10455c752b86932ce552f2b0fe81a880746649b9aee7e0d842bf3f52378f9f8")
+	newRoot, _ := new(felt.Felt).SetString("0x4bdef7bf8b81a868aeab4b48ef952415fe105ab479e2f7bc671c92173542368")
+	blockHash := new(felt.Felt).SetUint64(0xb)
+	assert.NoError(t, st.Update(0, &core.StateUpdate{
+		BlockHash: blockHash,
+		OldRoot:   new(felt.Felt),
+		NewRoot:   newRoot,
+		StateDiff: &core.StateDiff{
+			DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: classHash}},
+		},
+	}))
+
+	t.Run("unknown block", func(t *testing.T) {
+		for _, id := range []*BlockId{{Number: 1}, {Hash: new(felt.Felt).SetUint64(0xc)}} {
+			_, rpcErr := handler.GetClassAt(id, addr)
+			assert.Equal(t, ErrBlockNotFound, rpcErr)
+		}
+	})
+
+	t.Run("unknown contract", func(t *testing.T) {
+		_, rpcErr := handler.GetClassAt(latest, new(felt.Felt).SetUint64(1))
+		assert.Equal(t, ErrContractNotFound, rpcErr)
+	})
+
+	t.Run("unknown class", func(t *testing.T) {
+		_, rpcErr := handler.GetClassAt(latest, addr)
+		assert.Equal(t, ErrInvalidContractClassHash, rpcErr)
+	})
+
+	t.Run("deployed contract", func(t *testing.T) {
+		class := &core.Class{
+			APIVersion: new(felt.Felt),
+			Externals: []core.EntryPoint{
+				{Selector: new(felt.Felt).SetUint64(2), Offset: new(felt.Felt).SetUint64(3)},
+			},
+			ProgramHash: new(felt.Felt).SetUint64(4),
+			Program:     base64.StdEncoding.EncodeToString([]byte("compressed program")),
+		}
+		assert.NoError(t, st.PutClass(classHash, class))
+
+		want, rpcErr := handler.GetClass(latest, classHash)
+		assert.Nil(t, rpcErr)
+		got, rpcErr := handler.GetClassAt(latest, addr)
+		assert.Nil(t, rpcErr)
+		assert.Equal(t, want, got)
+
+		// the latest block can be referred to by number or hash
+		for _, id := range []*BlockId{{Number: 0}, {Hash: blockHash}} {
+			got, rpcErr = handler.GetClassAt(id, addr)
+			assert.Nil(t, rpcErr)
+			assert.Equal(t, want, got)
+		}
+	})
+}
+
+// echoExecutor runs every entry point as a function returning its
+// arguments, of which there must be at least one
+type echoExecutor struct{}
+
+func (echoExecutor) Call(_ state.StateReader, _ *felt.Felt, _ *core.Class, _ core.EntryPoint,
+	calldata []*felt.Felt,
+) ([]*felt.Felt, error) {
+	if len(calldata) == 0 {
+		return nil, state.ErrInvalidCallData
+	}
+	return calldata, nil
+}
+
+func TestCall(t *testing.T) {
+	testDb := db.NewTestDb()
+	st := state.NewState(testDb)
+	handler := New(st, blockchain.NewReceiptStore(testDb))
+
+	addr, _ := new(felt.Felt).SetString("0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+	classHash, _ := new(felt.Felt).SetString("0x10455c752b86932ce552f2b0fe81a880746649b9aee7e0d842bf3f52378f9f8")
+	newRoot, _ := new(felt.Felt).SetString("0x4bdef7bf8b81a868aeab4b48ef952415fe105ab479e2f7bc671c92173542368")
+	assert.NoError(t, st.Update(0, &core.StateUpdate{
+		BlockHash: new(felt.Felt).SetUint64(0xb),
+		OldRoot:   new(felt.Felt),
+		NewRoot:   newRoot,
+		StateDiff: &core.StateDiff{
+			DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: classHash}},
+		},
+	}))
+
+	selector := new(felt.Felt).SetUint64(2)
+	call := &FunctionCall{
+		ContractAddress:    addr,
+		EntryPointSelector: selector,
+		Calldata:           []*felt.Felt{new(felt.Felt).SetUint64(37)},
+	}
+
+	t.Run("unknown block", func(t *testing.T) {
+		_, rpcErr := handler.Call(call, &BlockId{Number: 1})
+		assert.Equal(t, ErrBlockNotFound, rpcErr)
+	})
+
+	t.Run("unknown contract", func(t *testing.T) {
+		_, rpcErr := handler.Call(&FunctionCall{
+			ContractAddress:    new(felt.Felt).SetUint64(1),
+			EntryPointSelector: selector,
+		}, latest)
+		assert.Equal(t, ErrContractNotFound, rpcErr)
+	})
+
+	t.Run("unknown class", func(t *testing.T) {
+		_, rpcErr := handler.Call(call, latest)
+		assert.Equal(t, ErrInvalidContractClassHash, rpcErr)
+	})
+
+	assert.NoError(t, st.PutClass(classHash, &core.Class{
+		APIVersion: new(felt.Felt),
+		Externals:  []core.EntryPoint{{Selector: selector, Offset: new(felt.Felt).SetUint64(3)}},
+	}))
+
+	t.Run("unknown selector", func(t *testing.T) {
+		_, rpcErr := handler.Call(&FunctionCall{
+			ContractAddress:    addr,
+			EntryPointSelector: new(felt.Felt).SetUint64(3),
+		}, latest)
+		assert.Equal(t, ErrInvalidMessageSelector, rpcErr)
+	})
+
+	t.Run("no executor", func(t *testing.T) {
+		_, rpcErr := handler.Call(call, latest)
+		assert.Equal(t, ErrInternal, rpcErr)
+	})
+
+	st.WithExecutor(echoExecutor{})
+	t.Run("invalid calldata", func(t *testing.T) {
+		_, rpcErr := handler.Call(&FunctionCall{ContractAddress: addr, EntryPointSelector: selector}, latest)
+		assert.Equal(t, ErrInvalidCallData, rpcErr)
+	})
+
+	t.Run("call", func(t *testing.T) {
+		got, rpcErr := handler.Call(call, latest)
+		assert.Nil(t, rpcErr)
+		assert.Equal(t, call.Calldata, got)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		st.WithExecutor(slowExecutor{})
+		defer st.WithExecutor(echoExecutor{})
+
+		_, rpcErr := handler.WithTimeout("starknet_call", time.Millisecond).Call(call, latest)
+		assert.Equal(t, ErrInternal, rpcErr)
+
+		_, rpcErr = handler.WithTimeout("starknet_call", 0).Call(call, latest)
+		assert.Nil(t, rpcErr)
+	})
+}
+
+// slowExecutor reads the nonce of the contract after taking longer than
+// the timeout of [TestCall]
+type slowExecutor struct{}
+
+func (slowExecutor) Call(reader state.StateReader, contract *felt.Felt, _ *core.Class, _ core.EntryPoint,
+	_ []*felt.Felt,
+) ([]*felt.Felt, error) {
+	time.Sleep(10 * time.Millisecond)
+	nonce, err := reader.ContractNonce(contract)
+	if err != nil {
+		return nil, err
+	}
+	return []*felt.Felt{nonce}, nil
+}
+
+func TestGetStateUpdate(t *testing.T) {
+	testDb := db.NewTestDb()
+	st := state.NewState(testDb)
+	handler := New(st, blockchain.NewReceiptStore(testDb))
+
+	addr, _ := new(felt.Felt).SetString("0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+	classHash, _ := new(felt.Felt).SetString("0x10455c752b86932ce552f2b0fe81a880746649b9aee7e0d842bf3f52378f9f8")
+	root0, _ := new(felt.Felt).SetString("0x4bdef7bf8b81a868aeab4b48ef952415fe105ab479e2f7bc671c92173542368")
+	update0 := &core.StateUpdate{
+		BlockHash: new(felt.Felt).SetUint64(0xa),
+		OldRoot:   new(felt.Felt),
+		NewRoot:   root0,
+		StateDiff: &core.StateDiff{
+			DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: classHash}},
+		},
+	}
+	update1 := &core.StateUpdate{
+		BlockHash: new(felt.Felt).SetUint64(0xb),
+		OldRoot:   root0,
+		StateDiff: &core.StateDiff{
+			StorageDiffs: map[felt.Felt][]core.StorageDiff{
+				*addr: {{Key: new(felt.Felt).SetUint64(1), Value: new(felt.Felt).SetUint64(2)}},
+			},
+			Nonces: map[felt.Felt]*felt.Felt{*addr: new(felt.Felt).SetUint64(1)},
+		},
+	}
+
+	t.Run("no blocks", func(t *testing.T) {
+		_, rpcErr := handler.GetStateUpdate(latest)
+		assert.Equal(t, ErrBlockNotFound, rpcErr)
+	})
+
+	assert.NoError(t, st.Update(0, update0))
+	var err error
+	update1.NewRoot, err = st.SimulateUpdate(update1)
+	assert.NoError(t, err)
+	assert.NoError(t, st.Update(1, update1))
+
+	t.Run("unknown block", func(t *testing.T) {
+		for _, id := range []*BlockId{{Number: 2}, {Hash: new(felt.Felt).SetUint64(0xc)}, {Pending: true}} {
+			_, rpcErr := handler.GetStateUpdate(id)
+			assert.Equal(t, ErrBlockNotFound, rpcErr)
+		}
+	})
+
+	// felts are encoded the way felt.Felt marshals them
+	feltJSON := func(f *felt.Felt) string {
+		encoded, err := json.Marshal(f)
+		assert.NoError(t, err)
+		return string(encoded)
+	}
+
+	t.Run("known blocks", func(t *testing.T) {
+		byNumber, rpcErr := handler.GetStateUpdate(&BlockId{Number: 0})
+		assert.Nil(t, rpcErr)
+		byHash, rpcErr := handler.GetStateUpdate(&BlockId{Hash: update0.BlockHash})
+		assert.Nil(t, rpcErr)
+		assert.Equal(t, byNumber, byHash)
+
+		got, err := json.Marshal(byNumber)
+		assert.NoError(t, err)
+		assert.JSONEq(t, fmt.Sprintf(`{
+			"block_hash": %s,
+			"new_root": %s,
+			"old_root": %s,
+			"state_diff": {
+				"storage_diffs": [],
+				"declared_contract_hashes": [],
+				"declared_classes": [],
+				"deployed_contracts": [{"address": %s, "class_hash": %s}],
+				"nonces": []
+			}
+		}`, feltJSON(update0.BlockHash), feltJSON(root0), feltJSON(update0.OldRoot), feltJSON(addr),
+			feltJSON(classHash)), string(got))
+
+		latestUpdate, rpcErr := handler.GetStateUpdate(latest)
+		assert.Nil(t, rpcErr)
+		assert.Equal(t, true, update1.NewRoot.Equal(latestUpdate.NewRoot))
+		got, err = json.Marshal(latestUpdate.StateDiff)
+		assert.NoError(t, err)
+		assert.JSONEq(t, fmt.Sprintf(`{
+			"storage_diffs": [{"address": %[1]s, "storage_entries": [{"key": 1, "value": 2}]}],
+			"declared_contract_hashes": [],
+			"declared_classes": [],
+			"deployed_contracts": [],
+			"nonces": [{"contract_address": %[1]s, "nonce": 1}]
+		}`, feltJSON(addr)), string(got))
+	})
+}
+
+func TestGetTransactionReceipt(t *testing.T) {
+	testDb := db.NewTestDb()
+	receipts := blockchain.NewReceiptStore(testDb)
+	handler := New(state.NewState(testDb), receipts)
+
+	l1Address := common.HexToAddress("0xae0ee0a63a2ce6baeeffe56e7714fb4efe48d419")
+	receipt := &core.TransactionReceipt{
+		BlockHash:   new(felt.Felt).SetUint64(1),
+		BlockNumber: 2,
+		ActualFee:   new(felt.Felt).SetUint64(3),
+		Events: []*core.Event{{
+			From: new(felt.Felt).SetUint64(4),
+			Keys: []*felt.Felt{new(felt.Felt).SetUint64(5)},
+			Data: []*felt.Felt{new(felt.Felt).SetUint64(6), new(felt.Felt).SetUint64(7)},
+		}},
+		L1ToL2Message: &core.L1ToL2Message{
+			From:    l1Address,
+			Payload: []*felt.Felt{new(felt.Felt).SetUint64(8)},
+		},
+		L2ToL1Message: &[]core.L2ToL1Message{{
+			From:    new(felt.Felt).SetUint64(9),
+			Payload: []*felt.Felt{new(felt.Felt).SetUint64(10)},
+			To:      l1Address,
+		}},
+		TransactionHash: new(felt.Felt).SetUint64(11),
+	}
+
+	_, rpcErr := handler.GetTransactionReceipt(receipt.TransactionHash)
+	assert.Equal(t, ErrTxnHashNotFound, rpcErr)
+
+	assert.NoError(t, receipts.Put(receipt))
+	adapted, rpcErr := handler.GetTransactionReceipt(receipt.TransactionHash)
+	assert.Nil(t, rpcErr)
+
+	got, err := json.Marshal(adapted)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"transaction_hash": 11,
+		"actual_fee": 3,
+		"status": "ACCEPTED_ON_L2",
+		"block_hash": 1,
+		"block_number": 2,
+		"messages_sent": [{"to_address": "0xae0ee0a63a2ce6baeeffe56e7714fb4efe48d419", "payload": [10]}],
+		"l1_origin_message": {"from_address": "0xae0ee0a63a2ce6baeeffe56e7714fb4efe48d419", "payload": [8]},
+		"events": [{"from_address": 4, "keys": [5], "data": [6, 7]}]
+	}`, string(got))
+}
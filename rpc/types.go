@@ -0,0 +1,306 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Error is an error as defined by the StarkNet JSON-RPC [specification].
+//
+// [specification]: https://github.com/starkware-libs/starknet-specs/blob/master/api/starknet_api_openrpc.json
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+var (
+	ErrContractNotFound         = &Error{Code: 20, Message: "Contract not found"}
+	ErrInvalidMessageSelector   = &Error{Code: 21, Message: "Invalid message selector"}
+	ErrInvalidCallData          = &Error{Code: 22, Message: "Invalid call data"}
+	ErrBlockNotFound            = &Error{Code: 24, Message: "Block not found"}
+	ErrTxnHashNotFound          = &Error{Code: 25, Message: "Transaction hash not found"}
+	ErrInvalidContractClassHash = &Error{Code: 28, Message: "The supplied contract class hash is invalid or unknown"}
+	ErrInternal                 = &Error{Code: -32603, Message: "Internal error"}
+)
+
+// BlockId identifies a block by either its hash, number or a tag
+// ("latest" or "pending").
+type BlockId struct {
+	Latest  bool
+	Pending bool
+	Hash    *felt.Felt
+	Number  uint64
+}
+
+func (b *BlockId) UnmarshalJSON(data []byte) error {
+	var tag string
+	if err := json.Unmarshal(data, &tag); err == nil {
+		switch tag {
+		case "latest":
+			b.Latest = true
+		case "pending":
+			b.Pending = true
+		default:
+			return fmt.Errorf("unknown block tag: %s", tag)
+		}
+		return nil
+	}
+
+	var id struct {
+		Hash   *felt.Felt `json:"block_hash"`
+		Number *uint64    `json:"block_number"`
+	}
+	if err := json.Unmarshal(data, &id); err != nil {
+		return err
+	}
+	if (id.Hash == nil) == (id.Number == nil) {
+		return errors.New("block id must contain exactly one of block_hash or block_number")
+	}
+
+	b.Hash = id.Hash
+	if id.Number != nil {
+		b.Number = *id.Number
+	}
+	return nil
+}
+
+// FunctionCall is a call of an external function of a contract
+type FunctionCall struct {
+	ContractAddress    *felt.Felt   `json:"contract_address"`
+	EntryPointSelector *felt.Felt   `json:"entry_point_selector"`
+	Calldata           []*felt.Felt `json:"calldata"`
+}
+
+// EntryPoint is the RPC representation of a [core.EntryPoint]
+type EntryPoint struct {
+	Selector *felt.Felt `json:"selector"`
+	Offset   *felt.Felt `json:"offset"`
+}
+
+// EntryPoints groups [EntryPoint]s by their type
+type EntryPoints struct {
+	Constructor []EntryPoint `json:"CONSTRUCTOR"`
+	External    []EntryPoint `json:"EXTERNAL"`
+	L1Handler   []EntryPoint `json:"L1_HANDLER"`
+}
+
+// Class is the RPC representation of a [core.Class]
+type Class struct {
+	EntryPoints EntryPoints `json:"entry_points_by_type"`
+	// Program is the base64 encoded, gzip compressed program of the class,
+	// as it was declared or fetched.
+	Program string `json:"program"`
+}
+
+// errUnknownProgram is returned by adaptClass for classes stored without
+// their program
+var errUnknownProgram = errors.New("unknown class program")
+
+func adaptEntryPoints(entryPoints []core.EntryPoint) []EntryPoint {
+	adapted := make([]EntryPoint, 0, len(entryPoints))
+	for _, entryPoint := range entryPoints {
+		adapted = append(adapted, EntryPoint{
+			Selector: entryPoint.Selector,
+			Offset:   entryPoint.Offset,
+		})
+	}
+	return adapted
+}
+
+func adaptClass(class *core.Class) (*Class, error) {
+	if class.Program == "" {
+		return nil, errUnknownProgram
+	}
+
+	return &Class{
+		EntryPoints: EntryPoints{
+			Constructor: adaptEntryPoints(class.Constructors),
+			External:    adaptEntryPoints(class.Externals),
+			L1Handler:   adaptEntryPoints(class.L1Handlers),
+		},
+		Program: class.Program,
+	}, nil
+}
+
+// StorageEntry is a storage slot written by a [StateUpdate]
+type StorageEntry struct {
+	Key   *felt.Felt `json:"key"`
+	Value *felt.Felt `json:"value"`
+}
+
+// StorageDiff groups the [StorageEntry]s of a contract
+type StorageDiff struct {
+	Address        *felt.Felt     `json:"address"`
+	StorageEntries []StorageEntry `json:"storage_entries"`
+}
+
+// DeployedContract is the RPC representation of a [core.DeployedContract]
+type DeployedContract struct {
+	Address   *felt.Felt `json:"address"`
+	ClassHash *felt.Felt `json:"class_hash"`
+}
+
+// DeclaredClass is the RPC representation of a [core.DeclaredV1Class]
+type DeclaredClass struct {
+	ClassHash         *felt.Felt `json:"class_hash"`
+	CompiledClassHash *felt.Felt `json:"compiled_class_hash"`
+}
+
+// Nonce is the nonce of a contract set by a [StateUpdate]
+type Nonce struct {
+	ContractAddress *felt.Felt `json:"contract_address"`
+	Nonce           *felt.Felt `json:"nonce"`
+}
+
+// StateDiff is the RPC representation of a [core.StateDiff]
+type StateDiff struct {
+	StorageDiffs           []StorageDiff      `json:"storage_diffs"`
+	DeclaredContractHashes []*felt.Felt       `json:"declared_contract_hashes"`
+	DeclaredClasses        []DeclaredClass    `json:"declared_classes"`
+	DeployedContracts      []DeployedContract `json:"deployed_contracts"`
+	Nonces                 []Nonce            `json:"nonces"`
+}
+
+// StateUpdate is the RPC representation of a [core.StateUpdate]
+type StateUpdate struct {
+	BlockHash *felt.Felt `json:"block_hash"`
+	NewRoot   *felt.Felt `json:"new_root"`
+	OldRoot   *felt.Felt `json:"old_root"`
+	StateDiff StateDiff  `json:"state_diff"`
+}
+
+func adaptStateUpdate(update *core.StateUpdate) *StateUpdate {
+	diff := StateDiff{
+		StorageDiffs:           make([]StorageDiff, 0, len(update.StateDiff.StorageDiffs)),
+		DeclaredContractHashes: make([]*felt.Felt, 0, len(update.StateDiff.DeclaredContracts)),
+		DeclaredClasses:        make([]DeclaredClass, 0, len(update.StateDiff.DeclaredV1Classes)),
+		DeployedContracts:      make([]DeployedContract, 0, len(update.StateDiff.DeployedContracts)),
+		Nonces:                 make([]Nonce, 0, len(update.StateDiff.Nonces)),
+	}
+
+	for _, addr := range update.StateDiff.StorageDiffs.Keys() {
+		storageDiffs, _ := update.StateDiff.StorageDiffs.Get(addr)
+		entries := make([]StorageEntry, 0, len(storageDiffs))
+		for _, storageDiff := range storageDiffs {
+			entries = append(entries, StorageEntry{Key: storageDiff.Key, Value: storageDiff.Value})
+		}
+		diff.StorageDiffs = append(diff.StorageDiffs, StorageDiff{Address: addr, StorageEntries: entries})
+	}
+
+	diff.DeclaredContractHashes = append(diff.DeclaredContractHashes, update.StateDiff.DeclaredContracts...)
+	for _, class := range update.StateDiff.DeclaredV1Classes {
+		diff.DeclaredClasses = append(diff.DeclaredClasses, DeclaredClass{
+			ClassHash:         class.ClassHash,
+			CompiledClassHash: class.CompiledClassHash,
+		})
+	}
+
+	for _, contract := range update.StateDiff.DeployedContracts {
+		diff.DeployedContracts = append(diff.DeployedContracts, DeployedContract{
+			Address:   contract.Address,
+			ClassHash: contract.ClassHash,
+		})
+	}
+
+	for _, addr := range update.StateDiff.Nonces.Keys() {
+		nonce, _ := update.StateDiff.Nonces.Get(addr)
+		diff.Nonces = append(diff.Nonces, Nonce{ContractAddress: addr, Nonce: nonce})
+	}
+
+	return &StateUpdate{
+		BlockHash: update.BlockHash,
+		NewRoot:   update.NewRoot,
+		OldRoot:   update.OldRoot,
+		StateDiff: diff,
+	}
+}
+
+// Event is the RPC representation of a [core.Event]
+type Event struct {
+	FromAddress *felt.Felt   `json:"from_address"`
+	Keys        []*felt.Felt `json:"keys"`
+	Data        []*felt.Felt `json:"data"`
+}
+
+// MsgToL1 is a message sent to L1 by a transaction
+type MsgToL1 struct {
+	ToAddress string       `json:"to_address"`
+	Payload   []*felt.Felt `json:"payload"`
+}
+
+// L1OriginMessage is the L1 message consumed by an L1 handler transaction
+type L1OriginMessage struct {
+	FromAddress string       `json:"from_address"`
+	Payload     []*felt.Felt `json:"payload"`
+}
+
+// TransactionReceipt is the RPC representation of a [core.TransactionReceipt]
+type TransactionReceipt struct {
+	TransactionHash *felt.Felt       `json:"transaction_hash"`
+	ActualFee       *felt.Felt       `json:"actual_fee"`
+	Status          string           `json:"status"`
+	BlockHash       *felt.Felt       `json:"block_hash"`
+	BlockNumber     uint64           `json:"block_number"`
+	MessagesSent    []MsgToL1        `json:"messages_sent"`
+	L1OriginMessage *L1OriginMessage `json:"l1_origin_message,omitempty"`
+	Events          []Event          `json:"events"`
+}
+
+func adaptEvents(events []*core.Event) []Event {
+	adapted := make([]Event, 0, len(events))
+	for _, event := range events {
+		adapted = append(adapted, Event{
+			FromAddress: event.From,
+			Keys:        event.Keys,
+			Data:        event.Data,
+		})
+	}
+	return adapted
+}
+
+// ethAddress encodes an L1 address in lowercase hex, like the feeder
+// gateway does.
+func ethAddress(addr common.Address) string {
+	return "0x" + hex.EncodeToString(addr.Bytes())
+}
+
+// adaptReceipt adapts the receipt of a transaction in a synced block,
+// which is accepted on L2.
+func adaptReceipt(receipt *core.TransactionReceipt) *TransactionReceipt {
+	adapted := &TransactionReceipt{
+		TransactionHash: receipt.TransactionHash,
+		ActualFee:       receipt.ActualFee,
+		Status:          "ACCEPTED_ON_L2",
+		BlockHash:       receipt.BlockHash,
+		BlockNumber:     receipt.BlockNumber,
+		MessagesSent:    []MsgToL1{},
+		Events:          adaptEvents(receipt.Events),
+	}
+
+	if receipt.L2ToL1Message != nil {
+		for _, message := range *receipt.L2ToL1Message {
+			adapted.MessagesSent = append(adapted.MessagesSent, MsgToL1{
+				ToAddress: ethAddress(message.To),
+				Payload:   message.Payload,
+			})
+		}
+	}
+
+	if message := receipt.L1ToL2Message; message != nil {
+		adapted.L1OriginMessage = &L1OriginMessage{
+			FromAddress: ethAddress(message.From),
+			Payload:     message.Payload,
+		}
+	}
+	return adapted
+}
@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/utils"
+)
+
+// fetchPipeline fetches the state updates of consecutive blocks ahead of
+// the block being applied, so that the update of the next block is usually
+// ready by the time the previous one has been applied. The updates of at
+// most depth blocks are fetched or held at a time, which also bounds the
+// number of concurrent requests to the DataSources, and they are delivered
+// in block order. A pipeline that is no longer used must be closed, so that
+// its fetches do not outlive it.
+type fetchPipeline struct {
+	fetch      func(blockNumber uint64) (*core.StateUpdate, error)
+	retryDelay time.Duration
+	log        utils.Logger
+	// idle tells whether the given block is past the tip of the chain, the
+	// failures to fetch it are expected then
+	idle func(blockNumber uint64) bool
+
+	// ctx is cancelled by Close, fetches tracks the running fetches
+	ctx     context.Context
+	cancel  context.CancelFunc
+	fetches sync.WaitGroup
+
+	// next is the number of the block delivered next, slots[i] holds the
+	// fetch of block next+i
+	next  uint64
+	slots []*fetchSlot
+}
+
+// fetchSlot is the fetch of a single state update, update and err are set
+// once done is closed
+type fetchSlot struct {
+	done   chan struct{}
+	update *core.StateUpdate
+	err    error
+}
+
+// newFetchPipeline starts fetching the state updates of depth blocks from
+// start, until ctx is cancelled or the pipeline is closed. Failures to
+// fetch the blocks that idle reports past the tip of the chain are logged
+// at the debug level, idle may be nil.
+func newFetchPipeline(ctx context.Context, start uint64, depth int,
+	fetch func(uint64) (*core.StateUpdate, error), idle func(uint64) bool, log utils.Logger,
+) *fetchPipeline {
+	if depth < 1 {
+		depth = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	p := &fetchPipeline{
+		fetch:      fetch,
+		retryDelay: retryDelay,
+		log:        log,
+		idle:       idle,
+		ctx:        ctx,
+		cancel:     cancel,
+		next:       start,
+		slots:      make([]*fetchSlot, depth),
+	}
+	for idx := range p.slots {
+		p.slots[idx] = p.start(start+uint64(idx), 0)
+	}
+	return p
+}
+
+// start fetches the state update of the given block in the background,
+// after waiting for delay. The fetch fails with the error of the context
+// of the pipeline if it is cancelled first.
+func (p *fetchPipeline) start(blockNumber uint64, delay time.Duration) *fetchSlot {
+	slot := &fetchSlot{done: make(chan struct{})}
+	p.fetches.Add(1)
+	go func() {
+		defer p.fetches.Done()
+		defer close(slot.done)
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-p.ctx.Done():
+			case <-timer.C:
+			}
+		}
+		if slot.err = p.ctx.Err(); slot.err != nil {
+			return
+		}
+		slot.update, slot.err = p.fetch(blockNumber)
+	}()
+	return slot
+}
+
+// Close cancels the fetches of the pipeline that have not started yet and
+// waits for the ones in flight to return.
+func (p *fetchPipeline) Close() {
+	p.cancel()
+	p.fetches.Wait()
+}
+
+// Next returns the number and state update of the next block once it has
+// been fetched. A failed fetch is retried after retryDelay while the
+// fetches of the following blocks go on. After maxFetchAttempts failures
+// the last error is returned, calling Next again keeps retrying the same
+// block.
+func (p *fetchPipeline) Next(ctx context.Context) (uint64, *core.StateUpdate, error) {
+	for attempt := 1; ; attempt++ {
+		head := p.slots[0]
+		select {
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		case <-head.done:
+		}
+		if head.err == nil {
+			break
+		}
+
+		if p.idle != nil && p.idle(p.next) {
+			p.log.Debug("State update not out yet", "number", p.next, "attempt", attempt, "err", head.err)
+		} else {
+			p.log.Warn("Failed to fetch state update", "number", p.next, "attempt", attempt, "err", head.err)
+		}
+		p.slots[0] = p.start(p.next, p.retryDelay)
+		if attempt == maxFetchAttempts {
+			return 0, nil, head.err
+		}
+	}
+
+	blockNumber, update := p.next, p.slots[0].update
+	copy(p.slots, p.slots[1:])
+	p.next++
+
+	last := len(p.slots) - 1
+	p.slots[last] = p.start(p.next+uint64(last), 0)
+	// the following blocks may not have existed yet when they were first
+	// fetched, now that one more block is out they are worth a new attempt
+	for idx, slot := range p.slots[:last] {
+		select {
+		case <-slot.done:
+			if slot.err != nil {
+				p.slots[idx] = p.start(p.next+uint64(idx), 0)
+			}
+		default:
+		}
+	}
+	return blockNumber, update, nil
+}
@@ -0,0 +1,211 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingFetcher serves a state update for every block, whose NewRoot is
+// the block number, and records the fetches of each block
+type countingFetcher struct {
+	mu       sync.Mutex
+	calls    map[uint64]int
+	inFlight int
+	maxIn    int
+	// fail tells whether the given attempt of a block fails
+	fail  func(blockNumber uint64, attempt int) bool
+	delay func(blockNumber uint64) time.Duration
+}
+
+func (c *countingFetcher) fetch(blockNumber uint64) (*core.StateUpdate, error) {
+	c.mu.Lock()
+	if c.calls == nil {
+		c.calls = make(map[uint64]int)
+	}
+	c.calls[blockNumber]++
+	attempt := c.calls[blockNumber]
+	if c.inFlight++; c.inFlight > c.maxIn {
+		c.maxIn = c.inFlight
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+
+	if c.delay != nil {
+		time.Sleep(c.delay(blockNumber))
+	}
+	if c.fail != nil && c.fail(blockNumber, attempt) {
+		return nil, errors.New("transient error")
+	}
+	return &core.StateUpdate{NewRoot: new(felt.Felt).SetUint64(blockNumber)}, nil
+}
+
+func (c *countingFetcher) callsOf(blockNumber uint64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[blockNumber]
+}
+
+func TestFetchPipeline(t *testing.T) {
+	const depth = 4
+
+	newPipeline := func(start uint64, fetcher *countingFetcher) *fetchPipeline {
+		pipeline := newFetchPipeline(context.Background(), start, depth, fetcher.fetch, nil, utils.NopLogger{})
+		pipeline.retryDelay = time.Millisecond
+		return pipeline
+	}
+	assertNext := func(t *testing.T, pipeline *fetchPipeline, want uint64) {
+		blockNumber, update, err := pipeline.Next(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, want, blockNumber)
+		if assert.NotNil(t, update) {
+			assert.Equal(t, true, update.NewRoot.Equal(new(felt.Felt).SetUint64(want)))
+		}
+	}
+
+	t.Run("in order and bounded", func(t *testing.T) {
+		// later blocks are fetched faster than earlier ones
+		fetcher := &countingFetcher{delay: func(blockNumber uint64) time.Duration {
+			return time.Duration(depth-blockNumber%depth) * time.Millisecond
+		}}
+		pipeline := newPipeline(5, fetcher)
+		for want := uint64(5); want < 25; want++ {
+			assertNext(t, pipeline, want)
+		}
+
+		fetcher.mu.Lock()
+		defer fetcher.mu.Unlock()
+		assert.LessOrEqual(t, fetcher.maxIn, depth)
+		for blockNumber := uint64(5); blockNumber < 25; blockNumber++ {
+			assert.Equal(t, 1, fetcher.calls[blockNumber])
+		}
+	})
+
+	t.Run("failed block is retried while the following blocks are fetched", func(t *testing.T) {
+		fetcher := &countingFetcher{fail: func(blockNumber uint64, attempt int) bool {
+			return blockNumber == 1 && attempt < maxFetchAttempts
+		}}
+		pipeline := newPipeline(0, fetcher)
+		for want := uint64(0); want < 2*depth; want++ {
+			assertNext(t, pipeline, want)
+		}
+
+		assert.Equal(t, maxFetchAttempts, fetcher.callsOf(1))
+		for blockNumber := uint64(2); blockNumber < depth; blockNumber++ {
+			assert.Equal(t, 1, fetcher.callsOf(blockNumber))
+		}
+	})
+
+	t.Run("gives up after too many failures", func(t *testing.T) {
+		var failing sync.Mutex
+		stillFailing := true
+		fetcher := &countingFetcher{fail: func(blockNumber uint64, _ int) bool {
+			failing.Lock()
+			defer failing.Unlock()
+			return blockNumber == 0 && stillFailing
+		}}
+		pipeline := newPipeline(0, fetcher)
+
+		_, _, err := pipeline.Next(context.Background())
+		assert.EqualError(t, err, "transient error")
+		assert.LessOrEqual(t, maxFetchAttempts, fetcher.callsOf(0))
+
+		// the same block is retried by the next call
+		failing.Lock()
+		stillFailing = false
+		failing.Unlock()
+		assertNext(t, pipeline, 0)
+		assertNext(t, pipeline, 1)
+	})
+
+	t.Run("following blocks that were not out yet are fetched again", func(t *testing.T) {
+		var mu sync.Mutex
+		latest := uint64(0)
+		fetcher := &countingFetcher{fail: func(blockNumber uint64, _ int) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return blockNumber > latest
+		}}
+		pipeline := newPipeline(0, fetcher)
+		// only the new attempts made as blocks are delivered can succeed
+		pipeline.retryDelay = time.Minute
+		assert.Eventually(t, func() bool {
+			return fetcher.callsOf(depth-1) == 1
+		}, time.Second, time.Millisecond)
+
+		mu.Lock()
+		latest = depth
+		mu.Unlock()
+		assertNext(t, pipeline, 0)
+		assertNext(t, pipeline, 1)
+		assertNext(t, pipeline, 2)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		fetcher := &countingFetcher{delay: func(uint64) time.Duration { return time.Second }}
+		pipeline := newPipeline(0, fetcher)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _, err := pipeline.Next(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		fetcher := &countingFetcher{
+			fail:  func(blockNumber uint64, _ int) bool { return blockNumber == 0 },
+			delay: func(blockNumber uint64) time.Duration { return time.Duration(blockNumber) * time.Millisecond },
+		}
+		pipeline := newPipeline(0, fetcher)
+		// block 0 waits for its retry while the following blocks are fetched
+		pipeline.retryDelay = time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		_, _, err := pipeline.Next(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		closed := make(chan struct{})
+		go func() {
+			pipeline.Close()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatal("Close waited for the retry delay")
+		}
+
+		fetcher.mu.Lock()
+		defer fetcher.mu.Unlock()
+		assert.Equal(t, 0, fetcher.inFlight)
+		assert.Equal(t, 1, fetcher.calls[0])
+	})
+
+	t.Run("idle at the tip", func(t *testing.T) {
+		fetcher := &countingFetcher{fail: func(blockNumber uint64, _ int) bool { return blockNumber > 1 }}
+		log := new(recordingLogger)
+		pipeline := newFetchPipeline(context.Background(), 0, depth, fetcher.fetch,
+			func(blockNumber uint64) bool { return blockNumber > 1 }, log)
+		pipeline.retryDelay = time.Millisecond
+		defer pipeline.Close()
+
+		assertNext(t, pipeline, 0)
+		assertNext(t, pipeline, 1)
+		_, _, err := pipeline.Next(context.Background())
+		assert.EqualError(t, err, "transient error")
+		assert.Equal(t, maxFetchAttempts, len(log.messages["debug"]))
+		assert.Equal(t, 0, len(log.messages["warn"]))
+	})
+}
@@ -1,34 +1,115 @@
 package sync
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/NethermindEth/juno/core"
 	"github.com/NethermindEth/juno/core/blockchain"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/state"
 	"github.com/NethermindEth/juno/data_source"
+	"github.com/NethermindEth/juno/utils"
 )
 
+const (
+	// maxFetchAttempts is the number of times a state update is fetched
+	// before the SyncLoop gives up on it.
+	maxFetchAttempts = 3
+	// retryDelay is how long the SyncLoop waits before trying again
+	// after a failed fetch.
+	retryDelay = time.Second
+	// defaultSyncedDistance is the default SyncedDistance of a SyncLoop.
+	defaultSyncedDistance = 1
+	// defaultPrefetchDepth is the default PrefetchDepth of a SyncLoop.
+	defaultPrefetchDepth = 8
+)
+
+// ErrPendingMismatch is returned when the pending block and the pending
+// state update fetched along with it keep being built on top of different
+// blocks, as happens when a block is sealed between their fetches.
+var ErrPendingMismatch = errors.New("pending block and state update do not match")
+
+// ErrUnexpectedBlock is returned when an update for a block other than
+// the one following the last applied block is applied.
+type ErrUnexpectedBlock struct {
+	Want uint64
+	Got  uint64
+}
+
+func (e *ErrUnexpectedBlock) Error() string {
+	return fmt.Sprintf("unexpected block: want %d, got %d", e.Want, e.Got)
+}
+
+// ErrReorg is returned when the old root of the update for the block
+// following the last applied block does not match the root of the last
+// applied block, i.e. the chain has been reorganised.
+type ErrReorg struct {
+	BlockNumber uint64
+	Want        *felt.Felt
+	Got         *felt.Felt
+}
+
+func (e *ErrReorg) Error() string {
+	return fmt.Sprintf("reorg detected at block %d: want old root %s, got %s",
+		e.BlockNumber, e.Want.Text(16), e.Got.Text(16))
+}
+
 // SyncLoop manages a list of DataSources to fetch the latest blockchain updates
 type SyncLoop struct {
 	running uint64
 
 	Blockchain  *blockchain.Blockchain
+	State       *state.State
 	DataSources []*datasource.DataSource
+	Log         utils.Logger
+
+	// SyncedDistance is the number of blocks the State can be behind the
+	// latest block of the chain and still be reported as synced.
+	SyncedDistance uint64
+
+	// PrefetchDepth is the number of blocks whose state updates are
+	// fetched concurrently by Run, ahead of the block being applied.
+	PrefetchDepth int
+
+	// head is the number and root of the last applied block, nil if no
+	// block has been applied yet.
+	head *syncHead
+
+	// latestMu guards latest, the number of the latest block of the chain
+	// as last fetched by SyncLatest, nil until it is first fetched.
+	latestMu sync.RWMutex
+	latest   *uint64
 
 	ExitChn chan struct{}
 }
 
-func NewSyncLoop(bc *blockchain.Blockchain, sources []*datasource.DataSource) *SyncLoop {
+type syncHead struct {
+	number uint64
+	root   *felt.Felt
+}
+
+func NewSyncLoop(bc *blockchain.Blockchain, st *state.State, sources []*datasource.DataSource) *SyncLoop {
 	return &SyncLoop{
 		running: 0,
 
-		Blockchain:  bc,
-		DataSources: sources,
-		ExitChn:     make(chan struct{}),
+		Blockchain:     bc,
+		State:          st,
+		DataSources:    sources,
+		Log:            utils.NopLogger{},
+		SyncedDistance: defaultSyncedDistance,
+		PrefetchDepth:  defaultPrefetchDepth,
+		ExitChn:        make(chan struct{}),
 	}
 }
 
-// Run starts the SyncLoop, returns an error if the loop is already running
+// Run starts the SyncLoop, returns an error if the loop is already running.
+// The state updates of up to PrefetchDepth blocks are fetched ahead of the
+// block being applied.
 func (l *SyncLoop) Run() error {
 	running := atomic.CompareAndSwapUint64(&l.running, 0, 1)
 	if !running {
@@ -36,8 +117,88 @@ func (l *SyncLoop) Run() error {
 	}
 	defer atomic.CompareAndSwapUint64(&l.running, 1, 0)
 
-	<-l.ExitChn // todo: work
-	return nil
+	if l.State == nil || len(l.DataSources) == 0 {
+		<-l.ExitChn // nothing to sync
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-l.ExitChn:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		if err := l.syncPipelined(ctx); err != nil {
+			var reorg *ErrReorg
+			if errors.As(err, &reorg) {
+				return err
+			}
+			l.Log.Warn("Failed to sync", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// syncPipelined applies the state updates fetched by a [fetchPipeline]
+// until ctx is cancelled. Updates that do not follow the last applied
+// block are re-fetched, along with the updates prefetched after them. If
+// the update keeps mismatching the last applied root, an [ErrReorg] is
+// returned.
+func (l *SyncLoop) syncPipelined(ctx context.Context) error {
+	var pipeline *fetchPipeline
+	defer func() {
+		if pipeline != nil {
+			pipeline.Close()
+		}
+	}()
+
+	mismatches := 0
+	for {
+		if pipeline == nil {
+			start, _, err := l.nextHead()
+			if err != nil {
+				return err
+			}
+			pipeline = newFetchPipeline(ctx, start, l.PrefetchDepth, l.fetchStateUpdate, l.pastLatest, l.Log)
+		}
+
+		blockNumber, update, err := pipeline.Next(ctx)
+		if ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			// the pipeline waits before fetching the block again
+			continue
+		}
+
+		if err = l.ApplyUpdate(blockNumber, update); err != nil {
+			// the prefetched updates may be stale, the next pipeline starts
+			// once their fetches are over so that their number stays bounded
+			pipeline.Close()
+			pipeline = nil
+
+			var reorg *ErrReorg
+			if !errors.As(err, &reorg) {
+				return err
+			}
+			if mismatches++; mismatches == maxFetchAttempts {
+				return err
+			}
+			l.Log.Warn("State update does not follow the last applied block", "number", blockNumber,
+				"attempt", mismatches, "want", reorg.Want.Text(16), "got", reorg.Got.Text(16))
+			continue
+		}
+		mismatches = 0
+	}
 }
 
 // Shutdown attempts to stop the SyncLoop, should block until loop acknowledges the request
@@ -45,3 +206,282 @@ func (l *SyncLoop) Shutdown() error {
 	l.ExitChn <- struct{}{}
 	return nil
 }
+
+// nextHead returns the number of the block to be applied next and the
+// root its update is expected to start from. Before a block has been
+// applied by the SyncLoop, it resumes from the height of the State.
+func (l *SyncLoop) nextHead() (uint64, *felt.Felt, error) {
+	if l.head == nil {
+		root, err := l.State.Root()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		height, err := l.State.Height()
+		if errors.Is(err, state.ErrNotSynced) {
+			return 0, root, nil
+		} else if err != nil {
+			return 0, nil, err
+		}
+		return height + 1, root, nil
+	}
+	return l.head.number + 1, l.head.root, nil
+}
+
+// pastLatest refreshes the number of the latest block of the chain and
+// reports whether the given block comes after it, i.e. is not out yet. It
+// is false if the latest block is unknown.
+func (l *SyncLoop) pastLatest(blockNumber uint64) bool {
+	if err := l.SyncLatest(); err != nil {
+		return false
+	}
+
+	l.latestMu.RLock()
+	defer l.latestMu.RUnlock()
+	return l.latest != nil && blockNumber > *l.latest
+}
+
+// SyncNext fetches the state update of the block following the last
+// applied block and applies it. Updates that do not follow the last
+// applied block are re-fetched rather than applied. If the update keeps
+// mismatching the last applied root, an [ErrReorg] is returned to
+// distinguish it from transient fetch errors.
+func (l *SyncLoop) SyncNext() error {
+	blockNumber, _, err := l.nextHead()
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < maxFetchAttempts; attempt++ {
+		var update *core.StateUpdate
+		if update, lastErr = l.fetchStateUpdate(blockNumber); lastErr != nil {
+			l.Log.Warn("Failed to fetch state update", "number", blockNumber, "attempt", attempt+1,
+				"err", lastErr)
+			continue
+		}
+
+		if lastErr = l.ApplyUpdate(blockNumber, update); lastErr == nil {
+			return nil
+		}
+
+		var reorg *ErrReorg
+		if !errors.As(lastErr, &reorg) {
+			return lastErr
+		}
+		l.Log.Warn("State update does not follow the last applied block", "number", blockNumber,
+			"attempt", attempt+1, "want", reorg.Want.Text(16), "got", reorg.Got.Text(16))
+	}
+	return lastErr
+}
+
+// fetchStateUpdate returns the state update for the given block number
+// from the first DataSource that serves it.
+func (l *SyncLoop) fetchStateUpdate(blockNumber uint64) (*core.StateUpdate, error) {
+	err := errors.New("no data sources")
+	for _, source := range l.DataSources {
+		var update *core.StateUpdate
+		if update, err = (*source).GetStateUpdate(blockNumber); err == nil {
+			return update, nil
+		}
+	}
+	return nil, err
+}
+
+// ApplyUpdate applies the state update of the given block to the State.
+// The block must immediately follow the last applied block, otherwise
+// [ErrUnexpectedBlock] is returned. If the update's old root does not
+// match the root of the last applied block, [ErrReorg] is returned.
+func (l *SyncLoop) ApplyUpdate(blockNumber uint64, update *core.StateUpdate) error {
+	want, root, err := l.nextHead()
+	if err != nil {
+		return err
+	}
+	if blockNumber != want {
+		return &ErrUnexpectedBlock{Want: want, Got: blockNumber}
+	}
+	if !update.OldRoot.Equal(root) {
+		return &ErrReorg{BlockNumber: blockNumber, Want: root, Got: update.OldRoot}
+	}
+
+	if err = l.State.Update(blockNumber, update); err != nil {
+		return err
+	}
+	// a pending block built on top of the previous block is the block that
+	// has just been sealed or a replaced one
+	if err = l.State.ClearStalePending(); err != nil {
+		l.Log.Warn("Failed to clear the pending block", "err", err)
+	}
+
+	l.head = &syncHead{number: blockNumber, root: update.NewRoot}
+	l.Log.Info("Applied block", "number", blockNumber, "root", update.NewRoot.Text(16),
+		"storageDiffs", len(update.StateDiff.StorageDiffs))
+	return nil
+}
+
+// PollPending fetches the pending block every interval and sets it as the
+// pending block of the State, until ctx is cancelled. Only DataSources
+// implementing [datasource.PendingSource] are polled. A pending block that
+// is not built on top of the State is not set.
+func (l *SyncLoop) PollPending(ctx context.Context, interval time.Duration) error {
+	return l.poll(ctx, interval, l.SyncPending, "Failed to fetch pending block")
+}
+
+// poll calls fetch every interval, until ctx is cancelled. Errors of
+// fetch are logged with the given message and do not stop polling.
+func (l *SyncLoop) poll(ctx context.Context, interval time.Duration, fetch func() error, failure string) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := fetch(); err != nil {
+			l.Log.Warn(failure, "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncPending fetches the pending block and replaces the pending block of
+// the State with it. If the pending block is not built on top of the
+// State, the pending block of the State is cleared instead.
+//
+// The pending block and its state update are fetched separately, so a
+// block can be sealed in between. They are fetched again if only one of
+// them is built on top of the State, the block by following the last
+// applied block and the update by starting from the root of the State. If
+// they keep mismatching, [ErrPendingMismatch] is returned.
+func (l *SyncLoop) SyncPending() error {
+	for attempt := 1; attempt <= maxFetchAttempts; attempt++ {
+		block, update, err := l.fetchPending()
+		if err != nil {
+			return err
+		}
+
+		blockOnTop, updateOnTop, err := l.pendingOnTop(block, update)
+		if err != nil {
+			return err
+		}
+		if blockOnTop == updateOnTop {
+			_, err = l.State.SetPendingOnTop(&state.Pending{Block: block, StateUpdate: update})
+			return err
+		}
+		l.Log.Debug("Pending block and state update do not match", "attempt", attempt,
+			"blockOnTop", blockOnTop, "updateOnTop", updateOnTop)
+	}
+	return ErrPendingMismatch
+}
+
+// pendingOnTop tells whether the given pending block follows the last
+// applied block, and whether the given pending state update starts from
+// the root of the State.
+func (l *SyncLoop) pendingOnTop(block *core.Block, update *core.StateUpdate) (bool, bool, error) {
+	// the pending block of an empty State is the genesis block
+	latestHash := new(felt.Felt)
+	_, latest, err := l.State.DiffReader().LatestStateUpdate()
+	if err == nil {
+		latestHash = latest.BlockHash
+	} else if !errors.Is(err, state.ErrStateUpdateNotFound) {
+		return false, false, err
+	}
+
+	root, err := l.State.Root()
+	if err != nil {
+		return false, false, err
+	}
+	blockOnTop := latestHash != nil && block.ParentHash != nil && block.ParentHash.Equal(latestHash)
+	return blockOnTop, update.OldRoot.Equal(root), nil
+}
+
+// fetchPending returns the pending block and its state update from the
+// first DataSource that serves them.
+func (l *SyncLoop) fetchPending() (*core.Block, *core.StateUpdate, error) {
+	err := errors.New("no pending data sources")
+	for _, source := range l.DataSources {
+		pendingSource, ok := (*source).(datasource.PendingSource)
+		if !ok {
+			continue
+		}
+
+		var block *core.Block
+		if block, err = pendingSource.GetPendingBlock(); err != nil {
+			continue
+		}
+		var update *core.StateUpdate
+		if update, err = pendingSource.GetPendingStateUpdate(); err == nil {
+			return block, update, nil
+		}
+	}
+	return nil, nil, err
+}
+
+// SyncStatus tells how far the State is from the latest block of the chain
+type SyncStatus struct {
+	// Height is the number of the last block applied to the State, nil if
+	// no block has been applied yet.
+	Height *uint64
+	// LatestBlock is the number of the latest block of the chain, as last
+	// fetched from the DataSources, nil if it has not been fetched yet.
+	LatestBlock *uint64
+	// Synced is set if the State is at most SyncedDistance blocks behind
+	// LatestBlock.
+	Synced bool
+}
+
+// Status returns the [SyncStatus] of the SyncLoop. It does not reach out to
+// the DataSources, the latest block is refreshed by [SyncLoop.PollLatest].
+// It is safe to call concurrently with the SyncLoop.
+func (l *SyncLoop) Status() SyncStatus {
+	var status SyncStatus
+
+	l.latestMu.RLock()
+	status.LatestBlock = l.latest
+	l.latestMu.RUnlock()
+
+	if l.State != nil {
+		height, err := l.State.Height()
+		if err == nil {
+			status.Height = &height
+		} else if !errors.Is(err, state.ErrNotSynced) {
+			l.Log.Warn("Failed to read the height of the state", "err", err)
+		}
+	}
+
+	if status.Height != nil && status.LatestBlock != nil {
+		status.Synced = *status.Height+l.SyncedDistance >= *status.LatestBlock
+	}
+	return status
+}
+
+// PollLatest fetches the number of the latest block of the chain every
+// interval, until ctx is cancelled. Only DataSources implementing
+// [datasource.HeadSource] are polled.
+func (l *SyncLoop) PollLatest(ctx context.Context, interval time.Duration) error {
+	return l.poll(ctx, interval, l.SyncLatest, "Failed to fetch latest block")
+}
+
+// SyncLatest fetches the number of the latest block of the chain from the
+// first DataSource that serves it, which is then reported by
+// [SyncLoop.Status].
+func (l *SyncLoop) SyncLatest() error {
+	err := errors.New("no head data sources")
+	for _, source := range l.DataSources {
+		headSource, ok := (*source).(datasource.HeadSource)
+		if !ok {
+			continue
+		}
+
+		var latest uint64
+		if latest, err = headSource.GetLatestBlockNumber(); err == nil {
+			l.latestMu.Lock()
+			l.latest = &latest
+			l.latestMu.Unlock()
+			return nil
+		}
+	}
+	return err
+}
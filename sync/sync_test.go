@@ -0,0 +1,425 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/blockchain"
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/juno/core/state"
+	"github.com/NethermindEth/juno/data_source"
+	"github.com/NethermindEth/juno/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDataSource serves state updates from memory and fails for the
+// first failures calls.
+type fakeDataSource struct {
+	mu       sync.Mutex
+	updates  map[uint64]*core.StateUpdate
+	failures int
+}
+
+func (f *fakeDataSource) GetBlockByNumber(uint64) (*core.Block, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeDataSource) GetTransaction(*felt.Felt) (*core.Transaction, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeDataSource) GetTransactionReceipt(*felt.Felt) (*core.TransactionReceipt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeDataSource) GetClass(*felt.Felt) (*core.Class, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeDataSource) GetStateUpdate(blockNumber uint64) (*core.StateUpdate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("transient error")
+	}
+	if update, ok := f.updates[blockNumber]; ok {
+		return update, nil
+	}
+	return nil, errors.New("block not found")
+}
+
+// fakePendingSource is a fakeDataSource that also serves a pending block
+// built on top of the block with hash parent. The first staleBlocks
+// pending blocks it serves are built on top of another block.
+type fakePendingSource struct {
+	fakeDataSource
+	pending     *core.StateUpdate
+	parent      *felt.Felt
+	staleBlocks int
+}
+
+func (f *fakePendingSource) GetPendingBlock() (*core.Block, error) {
+	if f.pending == nil {
+		return nil, errors.New("no pending block")
+	}
+	parent := f.parent
+	if f.staleBlocks > 0 {
+		f.staleBlocks--
+		parent = new(felt.Felt).SetUint64(37)
+	}
+	return &core.Block{BlockHeader: core.BlockHeader{ParentHash: parent, TransactionCount: new(felt.Felt)}}, nil
+}
+
+func (f *fakePendingSource) GetPendingStateUpdate() (*core.StateUpdate, error) {
+	if f.pending == nil {
+		return nil, errors.New("no pending block")
+	}
+	return f.pending, nil
+}
+
+func testUpdates() map[uint64]*core.StateUpdate {
+	addr, _ := new(felt.Felt).SetString("0x20cfa74ee3564b4cd5435cdace0f9c4d43b939620e4a0bb5076105df0a626c6")
+	classHash, _ := new(felt.Felt).SetString("0x10455c752b86932ce552f2b0fe81a880746649b9aee7e0d842bf3f52378f9f8")
+	root0, _ := new(felt.Felt).SetString("0x4bdef7bf8b81a868aeab4b48ef952415fe105ab479e2f7bc671c92173542368")
+	root1, _ := new(felt.Felt).SetString("0x6210642ffd49f64617fc9e5c0bbe53a6a92769e2996eb312a42d2bdb7f2afc1")
+
+	return map[uint64]*core.StateUpdate{
+		0: {
+			BlockHash: new(felt.Felt).SetUint64(0x100),
+			OldRoot:   new(felt.Felt),
+			NewRoot:   root0,
+			StateDiff: &core.StateDiff{
+				DeployedContracts: []core.DeployedContract{{Address: addr, ClassHash: classHash}},
+			},
+		},
+		1: {
+			BlockHash: new(felt.Felt).SetUint64(0x101),
+			OldRoot:   root0,
+			NewRoot:   root1,
+			StateDiff: &core.StateDiff{
+				Nonces: map[felt.Felt]*felt.Felt{*addr: new(felt.Felt).SetUint64(1)},
+			},
+		},
+	}
+}
+
+func newTestSyncLoop(source datasource.DataSource) *SyncLoop {
+	return NewSyncLoop(blockchain.NewBlockchain(), state.NewState(db.NewTestDb()),
+		[]*datasource.DataSource{&source})
+}
+
+func TestSyncNext(t *testing.T) {
+	updates := testUpdates()
+
+	t.Run("applies blocks sequentially", func(t *testing.T) {
+		loop := newTestSyncLoop(&fakeDataSource{updates: updates})
+
+		assert.NoError(t, loop.SyncNext())
+		assert.NoError(t, loop.SyncNext())
+
+		root, err := loop.State.Root()
+		assert.NoError(t, err)
+		assert.Equal(t, true, root.Equal(updates[1].NewRoot))
+
+		// no block 2 yet
+		assert.EqualError(t, loop.SyncNext(), "block not found")
+	})
+
+	t.Run("re-fetches after transient errors", func(t *testing.T) {
+		loop := newTestSyncLoop(&fakeDataSource{updates: updates, failures: maxFetchAttempts - 1})
+		assert.NoError(t, loop.SyncNext())
+	})
+
+	t.Run("gives up after too many transient errors", func(t *testing.T) {
+		loop := newTestSyncLoop(&fakeDataSource{updates: updates, failures: maxFetchAttempts})
+		assert.EqualError(t, loop.SyncNext(), "transient error")
+	})
+
+	t.Run("resumes from the height of the state", func(t *testing.T) {
+		st := state.NewState(db.NewTestDb())
+		assert.NoError(t, st.Update(0, updates[0]))
+
+		var source datasource.DataSource = &fakeDataSource{updates: updates}
+		loop := NewSyncLoop(blockchain.NewBlockchain(), st, []*datasource.DataSource{&source})
+		assert.NoError(t, loop.SyncNext())
+
+		height, err := st.Height()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), height)
+	})
+
+	t.Run("reorg", func(t *testing.T) {
+		reorged := map[uint64]*core.StateUpdate{
+			0: updates[0],
+			1: {
+				OldRoot:   new(felt.Felt).SetUint64(1),
+				NewRoot:   updates[1].NewRoot,
+				StateDiff: updates[1].StateDiff,
+			},
+		}
+		loop := newTestSyncLoop(&fakeDataSource{updates: reorged})
+
+		assert.NoError(t, loop.SyncNext())
+		err := loop.SyncNext()
+
+		var reorg *ErrReorg
+		if assert.Equal(t, true, errors.As(err, &reorg)) {
+			assert.Equal(t, uint64(1), reorg.BlockNumber)
+			assert.Equal(t, true, reorg.Want.Equal(updates[0].NewRoot))
+		}
+	})
+}
+
+func TestApplyUpdate(t *testing.T) {
+	updates := testUpdates()
+	loop := newTestSyncLoop(&fakeDataSource{})
+
+	var unexpected *ErrUnexpectedBlock
+	assert.Equal(t, true, errors.As(loop.ApplyUpdate(1, updates[1]), &unexpected))
+	assert.Equal(t, uint64(0), unexpected.Want)
+
+	assert.NoError(t, loop.ApplyUpdate(0, updates[0]))
+	assert.Equal(t, true, errors.As(loop.ApplyUpdate(0, updates[0]), &unexpected))
+	assert.Equal(t, uint64(1), unexpected.Want)
+
+	assert.NoError(t, loop.ApplyUpdate(1, updates[1]))
+}
+
+// recordingLogger records the messages logged at each level
+type recordingLogger struct {
+	messages map[string][]string
+}
+
+func (r *recordingLogger) record(level, msg string) {
+	if r.messages == nil {
+		r.messages = make(map[string][]string)
+	}
+	r.messages[level] = append(r.messages[level], msg)
+}
+
+func (r *recordingLogger) Debug(msg string, _ ...interface{}) { r.record("debug", msg) }
+
+func (r *recordingLogger) Info(msg string, _ ...interface{}) { r.record("info", msg) }
+
+func (r *recordingLogger) Warn(msg string, _ ...interface{}) { r.record("warn", msg) }
+
+func (r *recordingLogger) Error(msg string, _ ...interface{}) { r.record("error", msg) }
+
+func TestLogging(t *testing.T) {
+	updates := testUpdates()
+	log := new(recordingLogger)
+
+	loop := newTestSyncLoop(&fakeDataSource{updates: updates, failures: 1})
+	loop.Log = log
+	loop.State.WithLogger(log)
+
+	assert.NoError(t, loop.SyncNext())
+	assert.Equal(t, []string{"Failed to fetch state update"}, log.messages["warn"])
+	assert.Equal(t, []string{"Applied block"}, log.messages["info"])
+	assert.Equal(t, []string{"Applied state update"}, log.messages["debug"])
+
+	mismatched := *updates[1]
+	mismatched.NewRoot = new(felt.Felt).SetUint64(1)
+	var mismatch *state.ErrMismatchedRoot
+	assert.Equal(t, true, errors.As(loop.ApplyUpdate(1, &mismatched), &mismatch))
+	assert.Equal(t, []string{"Failed to fetch state update", "Mismatched state root"}, log.messages["warn"])
+	assert.Equal(t, 1, len(log.messages["info"]))
+}
+
+func TestSyncPending(t *testing.T) {
+	updates := testUpdates()
+	source := &fakePendingSource{fakeDataSource: fakeDataSource{updates: updates}}
+	loop := newTestSyncLoop(source)
+
+	t.Run("no pending block", func(t *testing.T) {
+		assert.EqualError(t, loop.SyncPending(), "no pending block")
+		assert.Nil(t, loop.State.Pending())
+	})
+
+	t.Run("pending block not built on top of the state", func(t *testing.T) {
+		source.pending, source.parent = updates[1], updates[0].BlockHash
+		assert.NoError(t, loop.SyncPending())
+		assert.Nil(t, loop.State.Pending())
+	})
+
+	assert.NoError(t, loop.SyncNext())
+
+	t.Run("replaced pending block", func(t *testing.T) {
+		assert.NoError(t, loop.SyncPending())
+		assert.Equal(t, updates[1], loop.State.Pending().StateUpdate)
+
+		replaced := *updates[1]
+		replaced.StateDiff = &core.StateDiff{}
+		source.pending = &replaced
+		assert.NoError(t, loop.SyncPending())
+		assert.Equal(t, &replaced, loop.State.Pending().StateUpdate)
+	})
+
+	t.Run("block sealed between the fetches", func(t *testing.T) {
+		source.pending, source.staleBlocks = updates[1], maxFetchAttempts-1
+		assert.NoError(t, loop.SyncPending())
+		assert.Equal(t, updates[1], loop.State.Pending().StateUpdate)
+		assert.Equal(t, 0, source.staleBlocks)
+
+		replaced := *updates[1]
+		replaced.StateDiff = &core.StateDiff{}
+		source.pending, source.staleBlocks = &replaced, maxFetchAttempts
+		assert.ErrorIs(t, loop.SyncPending(), ErrPendingMismatch)
+		// the previous pending block is left as it is
+		assert.Equal(t, updates[1], loop.State.Pending().StateUpdate)
+	})
+
+	t.Run("cleared when the block is sealed", func(t *testing.T) {
+		assert.NoError(t, loop.SyncNext())
+		assert.Nil(t, loop.State.Pending())
+	})
+
+	t.Run("sources without pending blocks", func(t *testing.T) {
+		loop := newTestSyncLoop(&fakeDataSource{updates: updates})
+		assert.EqualError(t, loop.SyncPending(), "no pending data sources")
+	})
+}
+
+func TestPollPending(t *testing.T) {
+	updates := testUpdates()
+	loop := newTestSyncLoop(&fakePendingSource{
+		fakeDataSource: fakeDataSource{updates: updates},
+		pending:        updates[0],
+		parent:         new(felt.Felt),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- loop.PollPending(ctx, time.Millisecond)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return loop.State.Pending() != nil
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("poller did not stop after cancellation")
+	}
+}
+
+// fakeHeadSource is a fakeDataSource that also serves the latest block
+// number
+type fakeHeadSource struct {
+	fakeDataSource
+	latest uint64
+}
+
+func (f *fakeHeadSource) GetLatestBlockNumber() (uint64, error) {
+	return f.latest, nil
+}
+
+func TestStatus(t *testing.T) {
+	source := &fakeHeadSource{fakeDataSource: fakeDataSource{updates: testUpdates()}, latest: 1}
+	loop := newTestSyncLoop(source)
+
+	assert.Equal(t, SyncStatus{}, loop.Status())
+
+	assert.NoError(t, loop.SyncLatest())
+	status := loop.Status()
+	assert.Nil(t, status.Height)
+	assert.Equal(t, uint64(1), *status.LatestBlock)
+	assert.Equal(t, false, status.Synced)
+
+	// one block behind is synced by default
+	assert.NoError(t, loop.SyncNext())
+	status = loop.Status()
+	assert.Equal(t, uint64(0), *status.Height)
+	assert.Equal(t, true, status.Synced)
+
+	// the latest block is only refreshed by SyncLatest
+	source.latest = 5
+	assert.Equal(t, true, loop.Status().Synced)
+	assert.NoError(t, loop.SyncLatest())
+	status = loop.Status()
+	assert.Equal(t, uint64(5), *status.LatestBlock)
+	assert.Equal(t, false, status.Synced)
+
+	loop.SyncedDistance = 5
+	assert.Equal(t, true, loop.Status().Synced)
+
+	t.Run("sources without head", func(t *testing.T) {
+		loop := newTestSyncLoop(&fakeDataSource{updates: testUpdates()})
+		assert.EqualError(t, loop.SyncLatest(), "no head data sources")
+		assert.Nil(t, loop.Status().LatestBlock)
+	})
+}
+
+func TestPollLatest(t *testing.T) {
+	loop := newTestSyncLoop(&fakeHeadSource{latest: 37})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- loop.PollLatest(ctx, time.Millisecond)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return loop.Status().LatestBlock != nil
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(37), *loop.Status().LatestBlock)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("poller did not stop after cancellation")
+	}
+}
+
+func TestRun(t *testing.T) {
+	updates := testUpdates()
+
+	t.Run("applies blocks until shut down", func(t *testing.T) {
+		loop := newTestSyncLoop(&fakeDataSource{updates: updates, failures: 1})
+
+		done := make(chan error)
+		go func() {
+			done <- loop.Run()
+		}()
+
+		assert.Eventually(t, func() bool {
+			height, err := loop.State.Height()
+			return err == nil && height == 1
+		}, 5*time.Second, time.Millisecond)
+
+		assert.NoError(t, loop.Shutdown())
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("loop did not stop after shutdown")
+		}
+	})
+
+	t.Run("reorg", func(t *testing.T) {
+		reorged := map[uint64]*core.StateUpdate{
+			0: updates[0],
+			1: {
+				OldRoot:   new(felt.Felt).SetUint64(1),
+				NewRoot:   updates[1].NewRoot,
+				StateDiff: updates[1].StateDiff,
+			},
+		}
+		loop := newTestSyncLoop(&fakeDataSource{updates: reorged})
+
+		var reorg *ErrReorg
+		assert.Equal(t, true, errors.As(loop.Run(), &reorg))
+		assert.Equal(t, uint64(1), reorg.BlockNumber)
+	})
+}
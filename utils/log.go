@@ -0,0 +1,26 @@
+package utils
+
+// Logger is a leveled, structured logger. Besides a message, every method
+// takes a list of alternating keys and values describing the event, e.g.
+//
+//	log.Info("Applied block", "number", 42, "root", "0x1")
+//
+// It allows packages to log without depending on a specific logging
+// library.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// NopLogger is a [Logger] that discards everything
+type NopLogger struct{}
+
+func (NopLogger) Debug(string, ...interface{}) {}
+
+func (NopLogger) Info(string, ...interface{}) {}
+
+func (NopLogger) Warn(string, ...interface{}) {}
+
+func (NopLogger) Error(string, ...interface{}) {}